@@ -10,6 +10,8 @@ type Aggregator struct {
 	newAggState []AggState
 
 	child Operator // the child operator for the inputs to aggregate
+
+	memory *MemoryManager // limits the memory used for the groups, if not nil
 }
 
 type AggType int
@@ -23,12 +25,12 @@ const DefaultGroup int = 0 // for handling the case of no group-by
 
 // Construct an aggregator with a group-by.
 func NewGroupedAggregator(emptyAggState []AggState, groupByFields []Expr, child Operator) *Aggregator {
-	return &Aggregator{groupByFields, emptyAggState, child}
+	return &Aggregator{groupByFields, emptyAggState, child, nil}
 }
 
 // Construct an aggregator with no group-by.
 func NewAggregator(emptyAggState []AggState, child Operator) *Aggregator {
-	return &Aggregator{nil, emptyAggState, child}
+	return &Aggregator{nil, emptyAggState, child, nil}
 }
 
 // Return a TupleDescriptor for this aggregation.
@@ -67,6 +69,10 @@ func (a *Aggregator) Descriptor() *TupleDesc {
 // iterate through each group's result. In the case where there is no group-by,
 // the iterator simply iterates through only one tuple, representing the
 // aggregation of all child tuples.
+//
+// The memory the groups use is reserved from the memory manager of the
+// operator, if it has one, and given back once the last group is returned.
+// Returns a MemoryLimitError if the groups don't fit in the memory budget.
 func (a *Aggregator) Iterator(tid TransactionID) (func() (*Tuple, error), error) {
 	// the child iterator
 	childIter, err := a.child.Iterator(tid)
@@ -96,11 +102,13 @@ func (a *Aggregator) Iterator(tid TransactionID) (func() (*Tuple, error), error)
 	var groupByList []*Tuple
 	// the iterator for iterating thru the finalized aggregation results for each group
 	var finalizedIter func() (*Tuple, error)
+	mem := memoryReservation{m: a.memory, tid: tid}
 
 	return func() (*Tuple, error) {
 		// iterates thru all child tuples
 		for t, err := childIter(); t != nil || err != nil; t, err = childIter() {
 			if err != nil {
+				mem.free()
 				return nil, err
 			}
 			if t == nil {
@@ -119,6 +127,10 @@ func (a *Aggregator) Iterator(tid TransactionID) (func() (*Tuple, error), error)
 
 				key := keygenTup.tupleKey()
 				if aggState[key] == nil {
+					if err := mem.grow(tupleMemorySize(keygenTup) + int64(len(a.newAggState))*tupleMemoryOverhead); err != nil {
+						mem.free()
+						return nil, err
+					}
 					asNew := make([]AggState, len(a.newAggState))
 					aggState[key] = &asNew
 					groupByList = append(groupByList, keygenTup)
@@ -132,7 +144,10 @@ func (a *Aggregator) Iterator(tid TransactionID) (func() (*Tuple, error), error)
 			if a.groupByFields == nil {
 				var tup *Tuple
 				for i := 0; i < len(a.newAggState); i++ {
-					newTup := (*aggState[DefaultGroup])[i].Finalize()
+					newTup, err := (*aggState[DefaultGroup])[i].Finalize()
+					if err != nil {
+						return nil, err
+					}
 					tup = joinTuples(tup, newTup)
 				}
 				finalizedIter = func() (*Tuple, error) { return nil, nil }
@@ -141,7 +156,11 @@ func (a *Aggregator) Iterator(tid TransactionID) (func() (*Tuple, error), error)
 				finalizedIter = getFinalizedTuplesIterator(a, groupByList, aggState)
 			}
 		}
-		return finalizedIter()
+		t, err := finalizedIter()
+		if t == nil || err != nil {
+			mem.free()
+		}
+		return t, err
 	}, nil
 }
 
@@ -202,7 +221,10 @@ func getFinalizedTuplesIterator(a *Aggregator, groupByList []*Tuple, aggState ma
 		key := gby.tupleKey()
 		var tup *Tuple
 		for i := 0; i < len(a.newAggState); i++ {
-			newTup := (*aggState[key])[i].Finalize()
+			newTup, err := (*aggState[key])[i].Finalize()
+			if err != nil {
+				return nil, err
+			}
 			tup = joinTuples(tup, newTup)
 		}
 		rett := joinTuples(gby, tup)
@@ -373,3 +373,71 @@ func TestAggRepeatedIteration(t *testing.T) {
 		t.Errorf("count changed on repeated iteration")
 	}
 }
+
+func TestAggNull(t *testing.T) {
+	td, t1, t2, hf, _, tid := makeTestVars(t)
+	tNull := Tuple{Desc: td, Fields: []DBValue{StringField{"nobody"}, NullField{}}}
+	insertTupleForTest(t, hf, &t1, tid)
+	insertTupleForTest(t, hf, &t2, tid)
+	insertTupleForTest(t, hf, &tNull, tid)
+
+	expr := FieldExpr{td.Fields[1]}
+	aggs := []AggState{&CountAggState{}, &SumAggState{}, &AvgAggState{}, &MinAggState{}, &MaxAggState{}}
+	for _, a := range aggs {
+		if err := a.Init("agg", &expr); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	agg := NewAggregator(aggs, hf)
+	iter, err := agg.Iterator(tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	tup, err := iter()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if tup == nil {
+		t.Fatalf("Expected non-null tuple")
+	}
+	expected := []DBValue{IntField{2}, IntField{1024}, FloatField{512}, IntField{25}, IntField{999}}
+	for i, v := range expected {
+		if tup.Fields[i] != v {
+			t.Errorf("aggregate %d returned %v, expected %v", i, tup.Fields[i], v)
+		}
+	}
+}
+
+func TestAggAllNull(t *testing.T) {
+	td, _, _, hf, _, tid := makeTestVars(t)
+	tNull := Tuple{Desc: td, Fields: []DBValue{StringField{"nobody"}, NullField{}}}
+	insertTupleForTest(t, hf, &tNull, tid)
+
+	expr := FieldExpr{td.Fields[1]}
+	aggs := []AggState{&CountAggState{}, &SumAggState{}, &AvgAggState{}, &MinAggState{}, &MaxAggState{}}
+	for _, a := range aggs {
+		if err := a.Init("agg", &expr); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	agg := NewAggregator(aggs, hf)
+	iter, err := agg.Iterator(tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	tup, err := iter()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if tup == nil {
+		t.Fatalf("Expected non-null tuple")
+	}
+	if cnt, ok := tup.Fields[0].(IntField); !ok || cnt.Value != 0 {
+		t.Errorf("expected count of 0, got %v", tup.Fields[0])
+	}
+	for i := 1; i < len(aggs); i++ {
+		if !isNull(tup.Fields[i]) {
+			t.Errorf("aggregate %d of only NULLs returned %v, expected NULL", i, tup.Fields[i])
+		}
+	}
+}
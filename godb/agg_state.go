@@ -1,5 +1,7 @@
 package godb
 
+import "math/big"
+
 // interface for an aggregation state
 type AggState interface {
 	// Initializes an aggregation state. Is supplied with an alias, an expr to
@@ -13,14 +15,17 @@ type AggState interface {
 	// Adds an tuple to the aggregation state.
 	AddTuple(*Tuple)
 
-	// Returns the final result of the aggregation as a tuple.
-	Finalize() *Tuple
+	// Returns the final result of the aggregation as a tuple, or an error if
+	// the result can't be represented, e.g., if a decimal SUM overflows.
+	Finalize() (*Tuple, error)
 
 	// Gets the tuple description of the tuple that Finalize() returns.
 	GetTupleDesc() *TupleDesc
 }
 
-// Implements the aggregation state for COUNT
+// Implements the aggregation state for COUNT. Like SQL, NULL values of the
+// expression are not counted; COUNT(*) is evaluated with a constant expression
+// so that every tuple is counted.
 type CountAggState struct {
 	alias string
 	expr  Expr
@@ -39,15 +44,19 @@ func (a *CountAggState) Init(alias string, expr Expr) error {
 }
 
 func (a *CountAggState) AddTuple(t *Tuple) {
+	v, err := a.expr.EvalExpr(t)
+	if err == nil && isNull(v) {
+		return
+	}
 	a.count++
 }
 
-func (a *CountAggState) Finalize() *Tuple {
+func (a *CountAggState) Finalize() (*Tuple, error) {
 	td := a.GetTupleDesc()
 	f := IntField{int64(a.count)}
 	fs := []DBValue{f}
 	t := Tuple{*td, fs, nil}
-	return &t
+	return &t, nil
 }
 
 func (a *CountAggState) GetTupleDesc() *TupleDesc {
@@ -58,15 +67,22 @@ func (a *CountAggState) GetTupleDesc() *TupleDesc {
 	return &td
 }
 
-// Implements the aggregation state for SUM
+// Implements the aggregation state for SUM. NULL values are ignored; the SUM
+// of no non-NULL values is NULL. The SUM of a float expression is a float.
+//
+// The SUM of a DECIMAL(p,s) expression is a DECIMAL(18,s). It is computed
+// exactly, and is an error if the final sum has more than 18 digits.
 type SumAggState struct {
-	alias string
-	expr  Expr
-	sum   int64
+	alias      string
+	expr       Expr
+	sum        int64
+	floatSum   float64
+	decimalSum *big.Int
+	count      int64
 }
 
 func (a *SumAggState) Copy() AggState {
-	return &SumAggState{a.alias, a.expr, a.sum}
+	return &SumAggState{a.alias, a.expr, a.sum, a.floatSum, new(big.Int).Set(a.decimalSum), a.count}
 }
 
 func intAggGetter(v DBValue) any {
@@ -81,6 +97,9 @@ func stringAggGetter(v DBValue) any {
 
 func (a *SumAggState) Init(alias string, expr Expr) error {
 	a.sum = 0
+	a.floatSum = 0
+	a.decimalSum = new(big.Int)
+	a.count = 0
 	a.expr = expr
 	a.alias = alias
 	return nil
@@ -91,36 +110,72 @@ func (a *SumAggState) AddTuple(t *Tuple) {
 	if err != nil {
 		return
 	}
-	switch v.(type) {
+	switch v := v.(type) {
 	case IntField:
-		a.sum += v.(IntField).Value
+		a.sum += v.Value
+		a.floatSum += float64(v.Value)
+		a.count++
+	case FloatField:
+		a.floatSum += v.Value
+		a.count++
+	case DecimalField:
+		a.decimalSum.Add(a.decimalSum, v.bigValue())
+		a.count++
 	}
 }
 
 func (a *SumAggState) GetTupleDesc() *TupleDesc {
+	exprType := a.expr.GetExprType().Ftype
+	if exprType == FloatType {
+		return &TupleDesc{[]FieldType{{a.alias, "", FloatType}}}
+	}
+	if exprType.isDecimal() {
+		return &TupleDesc{[]FieldType{{a.alias, "", decimalType(maxDecimalPrecision, exprType.scale())}}}
+	}
 	return &TupleDesc{[]FieldType{{a.alias, "", IntType}}}
 }
 
-func (a *SumAggState) Finalize() *Tuple {
-	return &Tuple{*a.GetTupleDesc(), []DBValue{IntField{a.sum}}, nil}
+func (a *SumAggState) Finalize() (*Tuple, error) {
+	td := a.GetTupleDesc()
+	if a.count == 0 {
+		return &Tuple{*td, []DBValue{NullField{}}, nil}, nil
+	}
+	sumType := td.Fields[0].Ftype
+	if sumType == FloatType {
+		return &Tuple{*td, []DBValue{FloatField{a.floatSum}}, nil}, nil
+	}
+	if sumType.isDecimal() {
+		sum, err := decimalFromBig(a.decimalSum, sumType.scale())
+		if err != nil {
+			return nil, err
+		}
+		return &Tuple{*td, []DBValue{sum}, nil}, nil
+	}
+	return &Tuple{*td, []DBValue{IntField{a.sum}}, nil}, nil
 }
 
-// Implements the aggregation state for AVG
-// Note that we always AddTuple() at least once before Finalize()
-// so no worries for divide-by-zero
+// Implements the aggregation state for AVG. The average is always a float,
+// even for int expressions, so that the fractional part isn't lost.
+// NULL values are ignored and not counted; the AVG of no non-NULL values is
+// NULL, which also avoids dividing by zero.
+//
+// The AVG of a decimal expression is an exact decimal, rounded to at least
+// minDivisionScale digits after the decimal point, as for decimal division.
 type AvgAggState struct {
-	alias string
-	expr  Expr
-	sum   int64
-	count int64
+	alias      string
+	expr       Expr
+	sum        float64
+	decimalSum *big.Int
+	count      int64
 }
 
 func (a *AvgAggState) Copy() AggState {
-	return &AvgAggState{a.alias, a.expr, a.sum, a.count}
+	return &AvgAggState{a.alias, a.expr, a.sum, new(big.Int).Set(a.decimalSum), a.count}
 }
 
 func (a *AvgAggState) Init(alias string, expr Expr) error {
 	a.sum = 0
+	a.decimalSum = new(big.Int)
 	a.count = 0
 	a.expr = expr
 	a.alias = alias
@@ -132,24 +187,48 @@ func (a *AvgAggState) AddTuple(t *Tuple) {
 	if err != nil {
 		return
 	}
-	switch v.(type) {
+	switch v := v.(type) {
 	case IntField:
-		a.sum += v.(IntField).Value
+		a.sum += float64(v.Value)
+		a.count++
+	case FloatField:
+		a.sum += v.Value
+		a.count++
+	case DecimalField:
+		a.decimalSum.Add(a.decimalSum, v.bigValue())
+		a.count++
 	}
-	a.count++
 }
 
 func (a *AvgAggState) GetTupleDesc() *TupleDesc {
-	return &TupleDesc{[]FieldType{{a.alias, "", IntType}}}
+	exprType := a.expr.GetExprType().Ftype
+	if exprType.isDecimal() {
+		return &TupleDesc{[]FieldType{{a.alias, "", decimalResultType("/", exprType, IntType)}}}
+	}
+	return &TupleDesc{[]FieldType{{a.alias, "", FloatType}}}
 }
 
-func (a *AvgAggState) Finalize() *Tuple {
-	return &Tuple{*a.GetTupleDesc(), []DBValue{IntField{a.sum / a.count}}, nil}
+func (a *AvgAggState) Finalize() (*Tuple, error) {
+	td := a.GetTupleDesc()
+	if a.count == 0 {
+		return &Tuple{*td, []DBValue{NullField{}}, nil}, nil
+	}
+	avgType := td.Fields[0].Ftype
+	if avgType.isDecimal() {
+		// the sum has the scale of the expression, and the average has the
+		// scale of avgType
+		sum := new(big.Int).Mul(a.decimalSum, pow10(avgType.scale()-a.expr.GetExprType().Ftype.scale()))
+		avg, err := decimalFromBig(roundedQuo(sum, big.NewInt(a.count)), avgType.scale())
+		if err != nil {
+			return nil, err
+		}
+		return &Tuple{*td, []DBValue{avg}, nil}, nil
+	}
+	return &Tuple{*td, []DBValue{FloatField{a.sum / float64(a.count)}}, nil}, nil
 }
 
 // Implements the aggregation state for MAX
-// Note that we always AddTuple() at least once before Finalize()
-// so no worries for NaN max
+// NULL values are ignored; if no non-NULL value is seen the result is NULL.
 type MaxAggState struct {
 	alias string
 	expr  Expr
@@ -167,12 +246,13 @@ func (a *MaxAggState) Copy() AggState {
 func (a *MaxAggState) Init(alias string, expr Expr) error {
 	a.expr = expr
 	a.alias = alias
+	a.null = true
 	return nil
 }
 
 func (a *MaxAggState) AddTuple(t *Tuple) {
 	v, err := a.expr.EvalExpr(t)
-	if err != nil {
+	if err != nil || isNull(v) {
 		return
 	}
 
@@ -188,13 +268,15 @@ func (a *MaxAggState) GetTupleDesc() *TupleDesc {
 	return &TupleDesc{[]FieldType{{a.alias, "", a.expr.GetExprType().Ftype}}}
 }
 
-func (a *MaxAggState) Finalize() *Tuple {
-	return &Tuple{*a.GetTupleDesc(), []DBValue{a.val}, nil}
+func (a *MaxAggState) Finalize() (*Tuple, error) {
+	if a.null {
+		return &Tuple{*a.GetTupleDesc(), []DBValue{NullField{}}, nil}, nil
+	}
+	return &Tuple{*a.GetTupleDesc(), []DBValue{a.val}, nil}, nil
 }
 
 // Implements the aggregation state for MIN
-// Note that we always AddTuple() at least once before Finalize()
-// so no worries for NaN min
+// NULL values are ignored; if no non-NULL value is seen the result is NULL.
 type MinAggState struct {
 	MaxAggState
 }
@@ -209,12 +291,13 @@ func (a *MinAggState) Copy() AggState {
 func (a *MinAggState) Init(alias string, expr Expr) error {
 	a.expr = expr
 	a.alias = alias
+	a.null = true
 	return nil
 }
 
 func (a *MinAggState) AddTuple(t *Tuple) {
 	v, err := a.expr.EvalExpr(t)
-	if err != nil {
+	if err != nil || isNull(v) {
 		return
 	}
 	if a.null {
@@ -229,6 +312,9 @@ func (a *MinAggState) GetTupleDesc() *TupleDesc {
 	return &TupleDesc{[]FieldType{{a.alias, "", a.expr.GetExprType().Ftype}}}
 }
 
-func (a *MinAggState) Finalize() *Tuple {
-	return &Tuple{*a.GetTupleDesc(), []DBValue{a.val}, nil}
+func (a *MinAggState) Finalize() (*Tuple, error) {
+	if a.null {
+		return &Tuple{*a.GetTupleDesc(), []DBValue{NullField{}}, nil}, nil
+	}
+	return &Tuple{*a.GetTupleDesc(), []DBValue{a.val}, nil}, nil
 }
@@ -0,0 +1,436 @@
+package godb
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// A BTreeFile is a disk-resident B+ tree that indexes one field of a
+// [HeapFile]. It implements the [Index] interface.
+//
+// The pages of the tree are read and locked through the buffer pool like the
+// pages of a heap file (see [btreePage] for their format). The root of the
+// tree is always page 0: when the root splits, its entries are moved to two
+// new pages and the root becomes their parent. Pages are never merged or
+// freed; entries are simply removed from their leaf when tuples are deleted.
+type BTreeFile struct {
+	table       *HeapFile
+	field       FieldType
+	fieldNo     int       // the position of the indexed field in the table
+	entryDesc   TupleDesc // the key, page number and slot number of an entry
+	numPages    int
+	backingFile string
+	bufPool     *BufferPool
+	sync.Mutex
+}
+
+// Create a BTreeFile.
+// Parameters
+// - fromFile: backing file for the BTreeFile. May be empty or a previously created index.
+// - table: the HeapFile that is indexed.
+// - field: the name of the field of table that is indexed.
+// - bp: the BufferPool that is used to store pages read from the BTreeFile
+// May return an error if the file cannot be opened or created, or if the
+// field doesn't exist.
+func NewBTreeFile(fromFile string, table *HeapFile, field string, bp *BufferPool) (*BTreeFile, error) {
+	td := table.Descriptor()
+	fieldNo, err := findFieldInTd(FieldType{field, "", UnknownType}, td)
+	if err != nil {
+		return nil, err
+	}
+	keyField := td.Fields[fieldNo]
+	entryDesc := indexEntryDesc(keyField)
+
+	f, err := os.OpenFile(fromFile, os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	bf := &BTreeFile{table, keyField, fieldNo, entryDesc, int(fi.Size() / int64(PageSize)), fromFile, bp, sync.Mutex{}}
+	if bf.numPages == 0 {
+		// a new index starts with an empty root leaf
+		if err := bf.flushPage(newBTreePage(0, true, bf)); err != nil {
+			return nil, err
+		}
+		bf.numPages = 1
+	}
+	return bf, nil
+}
+
+// Return the name of the backing file
+func (f *BTreeFile) BackingFile() string {
+	return f.backingFile
+}
+
+// Return the number of pages in the index
+func (f *BTreeFile) NumPages() int {
+	f.Lock()
+	defer f.Unlock()
+	return f.numPages
+}
+
+// Return the field of the table that is indexed.
+func (f *BTreeFile) keyField() FieldType {
+	return f.field
+}
+
+// A B+ tree can find the tuples for equality and range predicates.
+func (f *BTreeFile) supportsOp(op BoolOp) bool {
+	switch op {
+	case OpEq, OpLt, OpLe, OpGt, OpGe:
+		return true
+	}
+	return false
+}
+
+// Estimate the number of pages read by a lookup: one page per level of the
+// tree, plus the leaves that hold the matching entries.
+func (f *BTreeFile) estimatePagesRead(selectivity float64) int {
+	numPages := f.NumPages()
+	// assume pages are about two thirds full of 32 byte entries
+	fanout := PageSize * 2 / 3 / 32
+	height := 1
+	for n := fanout; n < numPages; n *= fanout {
+		height++
+	}
+	return height + int(selectivity*float64(numPages))
+}
+
+// Pin the specified page of the index in the buffer pool (see
+// [BufferPool.PinPage]), so that it isn't evicted while it is read or
+// changed. The caller must release the handle once it is done with the page.
+func (f *BTreeFile) pinPage(pageNo int, tid TransactionID, perm RWPerm) (*btreePage, *PageHandle, error) {
+	h, err := f.bufPool.PinPage(f, pageNo, tid, perm)
+	if err != nil {
+		return nil, nil, err
+	}
+	return h.Page.(*btreePage), h, nil
+}
+
+// Find the leaf that contains (or would contain) e, read locking the pages on
+// the way down. Returns the leaf, pinned, and the page numbers of the internal
+// pages from the root to the leaf's parent. The caller must release the
+// handle of the leaf.
+func (f *BTreeFile) findLeaf(e *indexEntry, tid TransactionID) (*btreePage, *PageHandle, []int, error) {
+	var path []int
+	pg, h, err := f.pinPage(0, tid, ReadPerm)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	for !pg.leaf {
+		path = append(path, pg.pageNo)
+		child := pg.children[0]
+		if e != nil {
+			child = pg.childFor(e)
+		}
+		h.Release()
+		pg, h, err = f.pinPage(child, tid, ReadPerm)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	return pg, h, path, nil
+}
+
+// Append a new, empty page to the file and return its page number.
+func (f *BTreeFile) newPage(leaf bool) (int, error) {
+	f.Lock()
+	defer f.Unlock()
+	pageNo := f.numPages
+	// flush an empty page to later add to buffer pool, like HeapFile does
+	err := f.flushPage(newBTreePage(pageNo, leaf, f))
+	if err != nil {
+		return 0, err
+	}
+	f.numPages++
+	return pageNo, nil
+}
+
+// Add an entry for the tuple, which must have been inserted into the table,
+// to the index. Tuples with a NULL key are not indexed.
+//
+// The entry is inserted into its leaf. If the leaf is full, it is split and
+// the entry that separates the two halves is inserted into its parent, which
+// may split in turn up to the root.
+func (f *BTreeFile) insertTuple(t *Tuple, tid TransactionID) error {
+	e, err := indexEntryFor(t, f.fieldNo)
+	if err != nil || e == nil {
+		return err
+	}
+	// entries must be small enough that a page that has overflowed can be
+	// split into two pages that fit
+	if size := e.tuple(&f.entryDesc).serializedSize() + btreeChildSize; size > (PageSize-btreeHeaderSize)/4 {
+		return GoDBError{MalformedDataError, fmt.Sprintf("key of %d bytes is too large to index", size)}
+	}
+
+	leaf, h, path, err := f.findLeaf(e, tid)
+	if err != nil {
+		return err
+	}
+	h.Release()
+	pageNo, child := leaf.pageNo, -1
+	for {
+		pg, h, err := f.pinPage(pageNo, tid, WritePerm)
+		if err != nil {
+			return err
+		}
+		if pg.entrySize(e) <= pg.getFreeSpace() {
+			pg.insertEntry(e, child)
+			pg.setDirty(tid, true)
+			h.Release()
+			return nil
+		}
+		if pageNo == 0 {
+			h.Release()
+			return f.splitRoot(e, child, tid)
+		}
+
+		rightNo, err := f.newPage(pg.leaf)
+		if err != nil {
+			h.Release()
+			return err
+		}
+		right, rh, err := f.pinPage(rightNo, tid, WritePerm)
+		if err != nil {
+			h.Release()
+			return err
+		}
+		pg.insertEntry(e, child)
+		e, child = pg.splitInto(right), rightNo
+		pg.setDirty(tid, true)
+		right.setDirty(tid, true)
+		h.Release()
+		rh.Release()
+		pageNo, path = path[len(path)-1], path[:len(path)-1]
+	}
+}
+
+// Insert an entry into the root, which is full, by moving its entries to a
+// new page and splitting that page. The root becomes an internal page with the
+// two pages as its children.
+func (f *BTreeFile) splitRoot(e *indexEntry, child int, tid TransactionID) error {
+	root, h, err := f.pinPage(0, tid, WritePerm)
+	if err != nil {
+		return err
+	}
+	defer h.Release()
+	leftNo, err := f.newPage(root.leaf)
+	if err != nil {
+		return err
+	}
+	rightNo, err := f.newPage(root.leaf)
+	if err != nil {
+		return err
+	}
+	left, lh, err := f.pinPage(leftNo, tid, WritePerm)
+	if err != nil {
+		return err
+	}
+	defer lh.Release()
+	right, rh, err := f.pinPage(rightNo, tid, WritePerm)
+	if err != nil {
+		return err
+	}
+	defer rh.Release()
+	root.insertEntry(e, child)
+	left.entries, left.children, left.next = root.entries, root.children, root.next
+	left.computeUsedBytes()
+	sep := left.splitInto(right)
+
+	root.leaf = false
+	root.entries = []*indexEntry{sep}
+	root.children = []int{leftNo, rightNo}
+	root.next = -1
+	root.computeUsedBytes()
+	root.setDirty(tid, true)
+	left.setDirty(tid, true)
+	right.setDirty(tid, true)
+	return nil
+}
+
+// Remove the entry for the tuple, which must have been deleted from the
+// table, from the index.
+func (f *BTreeFile) deleteTuple(t *Tuple, tid TransactionID) error {
+	e, err := indexEntryFor(t, f.fieldNo)
+	if err != nil || e == nil {
+		return err
+	}
+	pg, h, _, err := f.findLeaf(e, tid)
+	if err != nil {
+		return err
+	}
+	h.Release()
+	pg, h, err = f.pinPage(pg.pageNo, tid, WritePerm)
+	if err != nil {
+		return err
+	}
+	defer h.Release()
+	err = pg.deleteEntry(e)
+	if err != nil {
+		return err
+	}
+	pg.setDirty(tid, true)
+	return nil
+}
+
+// Return an iterator over the entries of the index in order, starting from
+// the first entry greater than or equal to start, or from the first entry if
+// start is nil. The leaves are read locked as they are reached.
+func (f *BTreeFile) entryIter(start *indexEntry, tid TransactionID) (func() (*indexEntry, error), error) {
+	pg, h, _, err := f.findLeaf(start, tid)
+	if err != nil {
+		return nil, err
+	}
+	// copy the entries of each leaf, in case the transaction modifies the
+	// index while iterating
+	entries := append([]*indexEntry{}, pg.entries...)
+	next := pg.next
+	pos := 0
+	if start != nil {
+		pos = pg.search(start)
+	}
+	h.Release()
+	return func() (*indexEntry, error) {
+		for pos >= len(entries) {
+			if next == -1 {
+				return nil, nil
+			}
+			pg, h, err := f.pinPage(next, tid, ReadPerm)
+			if err != nil {
+				return nil, err
+			}
+			entries = append([]*indexEntry{}, pg.entries...)
+			next = pg.next
+			h.Release()
+			pos = 0
+		}
+		e := entries[pos]
+		pos++
+		return e, nil
+	}, nil
+}
+
+// Return an iterator over the record ids of the tuples whose key satisfies
+// "key op value", in key order.
+func (f *BTreeFile) lookup(op BoolOp, value DBValue, tid TransactionID) (func() (recordID, error), error) {
+	if !f.supportsOp(op) {
+		return nil, GoDBError{IllegalOperationError, fmt.Sprintf("B+ tree index does not support %s", op)}
+	}
+	// NULL is never equal to or ordered with any key
+	if isNull(value) {
+		return func() (recordID, error) { return nil, nil }, nil
+	}
+	// scans for keys greater than the value start from the first entry with
+	// the value; the smallest record id is less than that of any entry
+	var start *indexEntry
+	if op == OpEq || op == OpGt || op == OpGe {
+		start = &indexEntry{value, heapFileRid{-1, -1}}
+	}
+	iter, err := f.entryIter(start, tid)
+	if err != nil {
+		return nil, err
+	}
+	done := false
+	return func() (recordID, error) {
+		for !done {
+			e, err := iter()
+			if err != nil || e == nil {
+				return nil, err
+			}
+			c := compareIndexKeys(e.key, value)
+			switch op {
+			case OpEq:
+				done = c > 0
+			case OpGt:
+				if c <= 0 {
+					continue
+				}
+			case OpLt:
+				done = c >= 0
+			case OpLe:
+				done = c > 0
+			}
+			if !done {
+				return e.rid, nil
+			}
+		}
+		return nil, nil
+	}, nil
+}
+
+// Read the specified page number from the BTreeFile on disk.
+func (f *BTreeFile) readPage(pageNo int) (Page, error) {
+	b, err := readPageBytes(f.backingFile, pageNo)
+	if err != nil {
+		return nil, err
+	}
+	return f.pageFromBuffer(pageNo, bytes.NewBuffer(b))
+}
+
+// Construct the index page with the specified page number from its contents,
+// which were read from disk or from the log.
+func (f *BTreeFile) pageFromBuffer(pageNo int, buf *bytes.Buffer) (Page, error) {
+	pg := newBTreePage(pageNo, true, f)
+	if err := pg.initFromBuffer(buf); err != nil {
+		return nil, err
+	}
+	return pg, nil
+}
+
+// Write the page back to its location in the backing file.
+func (f *BTreeFile) flushPage(p Page) error {
+	file, err := os.OpenFile(f.backingFile, os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	pg := p.(*btreePage)
+	buf, err := pg.toBuffer()
+	if err != nil {
+		return err
+	}
+	_, err = file.WriteAt(buf.Bytes(), int64(pg.pageNo*PageSize))
+	return err
+}
+
+// [Operator] descriptor method -- the index entries are tuples with the key,
+// and the page and slot numbers of the tuple in the table.
+func (f *BTreeFile) Descriptor() *TupleDesc {
+	return &f.entryDesc
+}
+
+// [Operator] iterator method -- return the entries of the index in key order.
+func (f *BTreeFile) Iterator(tid TransactionID) (func() (*Tuple, error), error) {
+	iter, err := f.entryIter(nil, tid)
+	if err != nil {
+		return nil, err
+	}
+	return func() (*Tuple, error) {
+		e, err := iter()
+		if err != nil || e == nil {
+			return nil, err
+		}
+		return e.tuple(&f.entryDesc), nil
+	}, nil
+}
+
+// internal structure to use as key for a B+ tree page. Indexes are rebuilt
+// from scratch when they are created, so pages are keyed by the file object
+// rather than its name, so that the pages of a dropped index that are still in
+// the buffer pool are never returned for a new index with the same name.
+type btreeHash struct {
+	file   *BTreeFile
+	pageNo int
+}
+
+// This method returns a key for a page to use in a map object, used by
+// BufferPool to determine if a page is cached or not.
+func (f *BTreeFile) pageKey(pgNo int) any {
+	return btreeHash{f, pgNo}
+}
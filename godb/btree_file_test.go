@@ -0,0 +1,271 @@
+package godb
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+// Create a table "test" with the name and age fields, and an index named
+// test_<field> on one of its fields.
+func makeBTreeTestVars(t *testing.T, field string) (*BufferPool, *Catalog, *HeapFile, Index) {
+	t.Helper()
+	os.Remove(TestingFile)
+	bp, c, err := MakeTestDatabase(100, "catalog.txt")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	td, _, _ := makeTupleTestVars()
+	tbl, err := c.addTable("test", td)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if err := c.createIndex("test_"+field, "test", field, "btree"); err != nil {
+		t.Fatalf(err.Error())
+	}
+	info, err := c.GetIndexInfo("test_" + field)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	return bp, c, tbl.(*HeapFile), info.file
+}
+
+// Insert the tuples into the table and its indexes.
+func insertIndexedTuplesForTest(t *testing.T, hf *HeapFile, tups []Tuple, tid TransactionID) {
+	t.Helper()
+	for i := range tups {
+		insertTupleForTest(t, hf, &tups[i], tid)
+		if err := insertIntoIndexes(hf, &tups[i], tid); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+}
+
+// Flush the pages dirtied by the transaction and commit it, so that the pages
+// can be evicted by later transactions.
+func flushAndCommitForTest(t *testing.T, bp *BufferPool, tid TransactionID) {
+	t.Helper()
+	if err := bp.flushDirtyPages(tid); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if err := bp.CommitTransaction(tid); err != nil {
+		t.Fatalf(err.Error())
+	}
+}
+
+func countLookupForTest(t *testing.T, idx Index, op BoolOp, v DBValue, tid TransactionID) int {
+	t.Helper()
+	iter, err := idx.lookup(op, v, tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	cnt := 0
+	for {
+		rid, err := iter()
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if rid == nil {
+			return cnt
+		}
+		cnt++
+	}
+}
+
+// Check that the entries of the index are in order, and return how many there
+// are.
+func checkIndexOrderForTest(t *testing.T, idx Index, tid TransactionID) int {
+	t.Helper()
+	iter, err := idx.Iterator(tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	var prev *Tuple
+	cnt := 0
+	for {
+		tup, err := iter()
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if tup == nil {
+			return cnt
+		}
+		if prev != nil && compareIndexKeys(prev.Fields[0], tup.Fields[0]) > 0 {
+			t.Fatalf("index entries out of order: %v before %v", prev.Fields[0], tup.Fields[0])
+		}
+		prev = tup
+		cnt++
+	}
+}
+
+func TestBTreeInsertLookup(t *testing.T) {
+	bp, _, hf, idx := makeBTreeTestVars(t, "age")
+	td, _, _ := makeTupleTestVars()
+
+	tups := make([]Tuple, 2000)
+	for i := range tups {
+		tups[i] = Tuple{Desc: td, Fields: []DBValue{StringField{fmt.Sprintf("name%d", i)}, IntField{int64((i * 7) % 500)}}}
+	}
+	tid := BeginTransactionForTest(t, bp)
+	insertIndexedTuplesForTest(t, hf, tups, tid)
+	flushAndCommitForTest(t, bp, tid)
+
+	tid = BeginTransactionForTest(t, bp)
+	defer bp.CommitTransaction(tid)
+	if idx.NumPages() < 3 {
+		t.Errorf("expected the root to have split, but the index only has %d pages", idx.NumPages())
+	}
+	if n := checkIndexOrderForTest(t, idx, tid); n != 2000 {
+		t.Errorf("expected 2000 index entries, got %d", n)
+	}
+
+	lookups := []struct {
+		op       BoolOp
+		v        int64
+		expected int
+	}{
+		{OpEq, 7, 4},
+		{OpEq, 500, 0},
+		{OpLt, 10, 40},
+		{OpLe, 10, 44},
+		{OpGt, 495, 16},
+		{OpGe, 495, 20},
+		{OpGt, 499, 0},
+		{OpLt, 0, 0},
+	}
+	for _, l := range lookups {
+		if n := countLookupForTest(t, idx, l.op, IntField{l.v}, tid); n != l.expected {
+			t.Errorf("expected %d entries for age %s %d, got %d", l.expected, opToStr(l.op), l.v, n)
+		}
+	}
+
+	// the record ids returned by the index find the tuples
+	scan, err := NewIndexScan(hf, idx, OpEq, IntField{7})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	iter, err := scan.Iterator(tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	cnt := 0
+	for {
+		tup, err := iter()
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if tup == nil {
+			break
+		}
+		if tup.Fields[1].(IntField).Value != 7 {
+			t.Errorf("index scan for age = 7 returned %v", tup.Fields)
+		}
+		cnt++
+	}
+	if cnt != 4 {
+		t.Errorf("expected index scan to return 4 tuples, got %d", cnt)
+	}
+}
+
+func TestBTreeMultiLevel(t *testing.T) {
+	bp, _, hf, idx := makeBTreeTestVars(t, "name")
+	td, _, _ := makeTupleTestVars()
+
+	// long keys so that the internal pages split too; the tree doesn't fit
+	// in the buffer pool, so pages are evicted while they are split
+	n := 1500
+	tups := make([]Tuple, n)
+	for i := range tups {
+		k := (i * 7919) % n
+		tups[i] = Tuple{Desc: td, Fields: []DBValue{StringField{fmt.Sprintf("%04d%s", k, strings.Repeat("x", 200))}, IntField{int64(k)}}}
+	}
+	tid := BeginTransactionForTest(t, bp)
+	insertIndexedTuplesForTest(t, hf, tups, tid)
+	flushAndCommitForTest(t, bp, tid)
+
+	tid = BeginTransactionForTest(t, bp)
+	defer bp.CommitTransaction(tid)
+	root, _, err := idx.(*BTreeFile).pinPage(0, tid, ReadPerm)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	child, _, err := idx.(*BTreeFile).pinPage(root.children[0], tid, ReadPerm)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if root.leaf || child.leaf {
+		t.Errorf("expected a tree with at least three levels")
+	}
+	if cnt := checkIndexOrderForTest(t, idx, tid); cnt != n {
+		t.Errorf("expected %d index entries, got %d", n, cnt)
+	}
+	key := StringField{"0042" + strings.Repeat("x", 200)}
+	if cnt := countLookupForTest(t, idx, OpEq, key, tid); cnt != 1 {
+		t.Errorf("expected 1 entry for key 0042..., got %d", cnt)
+	}
+	if cnt := countLookupForTest(t, idx, OpLt, key, tid); cnt != 42 {
+		t.Errorf("expected 42 entries less than key 0042..., got %d", cnt)
+	}
+
+	// keys that wouldn't leave room for a split are rejected
+	long := Tuple{Desc: td, Fields: []DBValue{StringField{strings.Repeat("y", PageSize/2)}, IntField{1}}}
+	insertTupleForTest(t, hf, &long, tid)
+	if err := insertIntoIndexes(hf, &long, tid); err == nil {
+		t.Errorf("expected a key of %d bytes to be too large to index", PageSize/2)
+	}
+}
+
+func TestBTreeDeleteAndAbort(t *testing.T) {
+	bp, _, hf, idx := makeBTreeTestVars(t, "age")
+	td, _, _ := makeTupleTestVars()
+
+	tups := make([]Tuple, 1000)
+	for i := range tups {
+		tups[i] = Tuple{Desc: td, Fields: []DBValue{StringField{"name"}, IntField{int64(i % 100)}}}
+	}
+	// NULL keys are not indexed
+	tups[999].Fields[1] = NullField{}
+	tid := BeginTransactionForTest(t, bp)
+	insertIndexedTuplesForTest(t, hf, tups, tid)
+	flushAndCommitForTest(t, bp, tid)
+
+	tid = BeginTransactionForTest(t, bp)
+	for i := 0; i < len(tups); i += 2 {
+		if err := hf.deleteTuple(&tups[i], tid); err != nil {
+			t.Fatalf(err.Error())
+		}
+		if err := deleteFromIndexes(hf, &tups[i], tid); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	if err := deleteFromIndexes(hf, &tups[0], tid); err == nil {
+		t.Errorf("expected deleting an entry twice to fail")
+	}
+	flushAndCommitForTest(t, bp, tid)
+
+	tid = BeginTransactionForTest(t, bp)
+	if n := checkIndexOrderForTest(t, idx, tid); n != 499 {
+		t.Errorf("expected 499 index entries after deletes, got %d", n)
+	}
+	if n := countLookupForTest(t, idx, OpEq, IntField{4}, tid); n != 0 {
+		t.Errorf("expected no entries for a deleted key, got %d", n)
+	}
+	if n := countLookupForTest(t, idx, OpEq, IntField{5}, tid); n != 10 {
+		t.Errorf("expected 10 entries for key 5, got %d", n)
+	}
+
+	// entries inserted by an aborted transaction are rolled back
+	more := make([]Tuple, 500)
+	for i := range more {
+		more[i] = Tuple{Desc: td, Fields: []DBValue{StringField{"more"}, IntField{int64(i)}}}
+	}
+	insertIndexedTuplesForTest(t, hf, more, tid)
+	bp.AbortTransaction(tid)
+
+	tid = BeginTransactionForTest(t, bp)
+	defer bp.CommitTransaction(tid)
+	if n := checkIndexOrderForTest(t, idx, tid); n != 499 {
+		t.Errorf("expected 499 index entries after abort, got %d", n)
+	}
+}
@@ -0,0 +1,307 @@
+package godb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+/* btreePage implements the Page interface for the pages of a [BTreeFile].
+
+A page is either a leaf or an internal page, and holds a sorted list of index
+entries. An entry is a key and the record id of the heap tuple it was taken
+from. Entries are ordered by key and then by record id, which makes every
+entry unique: keys may be duplicated, and a delete can find the exact entry to
+remove. Entries are serialized as tuples with the key, the page number and the
+slot number of the record id (see [BTreeFile.Descriptor]).
+
+All pages are PageSize bytes, and begin with a header with the checksum of
+the page (see [ChecksumSize]):
+
++----------------------------------------------------------------------------+
+| checksum (4 bytes) | kind (1 byte) | numEntries (4 bytes) | link (4 bytes) |
++----------------------------------------------------------------------------+
+| entry 0 | entry 1 | ... | entry n-1                                        |
++----------------------------------------------------------------------------+
+| free space                                                                 |
++----------------------------------------------------------------------------+
+
+In a leaf page, the link is the page number of the next leaf in key order, or
+-1 for the last leaf, so that range scans can follow the leaves. In an
+internal page, the link is the page number of the leftmost child, and each
+entry is followed by the 4 byte page number of the child that holds the
+entries greater than or equal to it (and less than the next entry).
+*/
+
+type btreePage struct {
+	leaf      bool
+	entries   []*indexEntry
+	children  []int // the children of an internal page; one more than entries
+	next      int   // the next leaf after a leaf page, or -1
+	usedBytes int   // bytes used by the entries and child pointers
+	dirty     bool
+	pageNo    int
+	file      *BTreeFile
+	lastTxn   TransactionID
+	bImage    Page
+	sync.Mutex
+}
+
+const (
+	btreeLeafPage     int8 = 0
+	btreeInternalPage int8 = 1
+
+	btreeHeaderSize = ChecksumSize + 9
+	btreeChildSize  = 4 // size of a child pointer in an internal page
+)
+
+// Construct a new, empty B+ tree page.
+func newBTreePage(pageNo int, leaf bool, f *BTreeFile) *btreePage {
+	pg := &btreePage{leaf: leaf, next: -1, pageNo: pageNo, file: f}
+	if !leaf {
+		pg.children = []int{-1}
+	}
+	return pg
+}
+
+// Return the number of bytes an entry takes on the page.
+func (p *btreePage) entrySize(e *indexEntry) int {
+	size := e.tuple(&p.file.entryDesc).serializedSize()
+	if !p.leaf {
+		size += btreeChildSize
+	}
+	return size
+}
+
+// Return the number of bytes on the page that are not used by the header or
+// entries. This is negative if the page has overflowed and must be split.
+func (p *btreePage) getFreeSpace() int {
+	return PageSize - btreeHeaderSize - p.usedBytes
+}
+
+func (p *btreePage) computeUsedBytes() {
+	p.usedBytes = 0
+	for _, e := range p.entries {
+		p.usedBytes += p.entrySize(e)
+	}
+}
+
+// Return the position of the first entry on the page that is greater than or
+// equal to e.
+func (p *btreePage) search(e *indexEntry) int {
+	return sort.Search(len(p.entries), func(i int) bool {
+		return p.entries[i].compare(e) >= 0
+	})
+}
+
+// Return the child of an internal page whose entries include e.
+func (p *btreePage) childFor(e *indexEntry) int {
+	i := sort.Search(len(p.entries), func(i int) bool {
+		return p.entries[i].compare(e) > 0
+	})
+	return p.children[i]
+}
+
+// Insert an entry into a leaf page, or an entry and the child to its right
+// into an internal page. The page may overflow, in which case the caller must
+// split it.
+func (p *btreePage) insertEntry(e *indexEntry, child int) {
+	i := p.search(e)
+	p.entries = append(p.entries, nil)
+	copy(p.entries[i+1:], p.entries[i:])
+	p.entries[i] = e
+	if !p.leaf {
+		p.children = append(p.children, 0)
+		copy(p.children[i+2:], p.children[i+1:])
+		p.children[i+1] = child
+	}
+	p.usedBytes += p.entrySize(e)
+}
+
+// Remove an entry from a leaf page, or return an error if it isn't on the
+// page.
+func (p *btreePage) deleteEntry(e *indexEntry) error {
+	i := p.search(e)
+	if i == len(p.entries) || p.entries[i].compare(e) != 0 {
+		return GoDBError{TupleNotFoundError, "index entry not found on delete"}
+	}
+	p.usedBytes -= p.entrySize(e)
+	p.entries = append(p.entries[:i], p.entries[i+1:]...)
+	return nil
+}
+
+// Move the upper half of the entries on the page, by size, to the empty page
+// right. Returns the entry that separates the two pages in their parent: for
+// leaves, this is a copy of the first entry of right; for internal pages, the
+// middle entry is moved up to the parent.
+func (p *btreePage) splitInto(right *btreePage) *indexEntry {
+	mid, size := 0, 0
+	for mid < len(p.entries)-1 && size < p.usedBytes/2 {
+		size += p.entrySize(p.entries[mid])
+		mid++
+	}
+	var sep *indexEntry
+	if p.leaf {
+		right.entries = append([]*indexEntry{}, p.entries[mid:]...)
+		right.next = p.next
+		p.next = right.pageNo
+		sep = right.entries[0]
+		p.entries = p.entries[:mid]
+	} else {
+		sep = p.entries[mid]
+		right.entries = append([]*indexEntry{}, p.entries[mid+1:]...)
+		right.children = append([]int{}, p.children[mid+1:]...)
+		p.entries = p.entries[:mid]
+		p.children = p.children[:mid+1]
+	}
+	p.computeUsedBytes()
+	right.computeUsedBytes()
+	return sep
+}
+
+// Page method - return whether or not the page is dirty
+func (p *btreePage) isDirty() bool {
+	p.Lock()
+	defer p.Unlock()
+	return p.dirty
+}
+
+// Page method - mark the page as dirty
+func (p *btreePage) setDirty(tid TransactionID, dirty bool) {
+	p.Lock()
+	defer p.Unlock()
+	p.lastTxn = tid
+	p.dirty = dirty
+}
+
+// Page method - return the BTreeFile for this page.
+func (p *btreePage) getFile() DBFile {
+	return p.file
+}
+
+// Returns the page number of the page.
+func (p *btreePage) PageNo() int {
+	return p.pageNo
+}
+
+// Returns the transaction that last dirtied the page.
+func (p *btreePage) lastTransaction() TransactionID {
+	return p.lastTxn
+}
+
+// Returns the before-image of the page. This is used for logging and recovery.
+func (p *btreePage) BeforeImage() Page {
+	return p.bImage
+}
+
+// Sets the before-image of the page to the current state of the page. Entries
+// are never modified in place, so the before-image can share them.
+func (p *btreePage) SetBeforeImage() {
+	p.bImage = &btreePage{
+		leaf:      p.leaf,
+		entries:   append([]*indexEntry{}, p.entries...),
+		children:  append([]int{}, p.children...),
+		next:      p.next,
+		usedBytes: p.usedBytes,
+		dirty:     p.dirty,
+		pageNo:    p.pageNo,
+		file:      p.file,
+		lastTxn:   p.lastTxn,
+	}
+}
+
+// Allocate a new bytes.Buffer and write the page to it, in the format
+// described above. Returns an error if the entries don't fit on the page.
+func (p *btreePage) toBuffer() (*bytes.Buffer, error) {
+	if p.getFreeSpace() < 0 {
+		return nil, GoDBError{MalformedDataError, "index entries are greater than page size"}
+	}
+	buf := new(bytes.Buffer)
+	kind, link := btreeLeafPage, p.next
+	if !p.leaf {
+		kind, link = btreeInternalPage, p.children[0]
+	}
+	// the checksum is filled in once the rest of the page is written
+	buf.Write(make([]byte, ChecksumSize))
+	err := binary.Write(buf, binary.LittleEndian, kind)
+	if err != nil {
+		return nil, err
+	}
+	err = binary.Write(buf, binary.LittleEndian, int32(len(p.entries)))
+	if err != nil {
+		return nil, err
+	}
+	err = binary.Write(buf, binary.LittleEndian, int32(link))
+	if err != nil {
+		return nil, err
+	}
+	for i, e := range p.entries {
+		err = e.tuple(&p.file.entryDesc).writeTo(buf)
+		if err != nil {
+			return nil, err
+		}
+		if !p.leaf {
+			err = binary.Write(buf, binary.LittleEndian, int32(p.children[i+1]))
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	buf.Write(make([]byte, PageSize-buf.Len()))
+	setPageChecksum(buf.Bytes())
+	return buf, nil
+}
+
+// Read the contents of the page from the supplied buffer. The checksum of the
+// page is verified by the caller.
+func (p *btreePage) initFromBuffer(buf *bytes.Buffer) error {
+	buf.Next(ChecksumSize)
+	var kind int8
+	var numEntries, link int32
+	err := binary.Read(buf, binary.LittleEndian, &kind)
+	if err != nil {
+		return err
+	}
+	err = binary.Read(buf, binary.LittleEndian, &numEntries)
+	if err != nil {
+		return err
+	}
+	err = binary.Read(buf, binary.LittleEndian, &link)
+	if err != nil {
+		return err
+	}
+	if (kind != btreeLeafPage && kind != btreeInternalPage) || numEntries < 0 || int(numEntries) > PageSize {
+		return GoDBError{MalformedDataError, fmt.Sprintf("invalid header in index page %d", p.pageNo)}
+	}
+	p.leaf = kind == btreeLeafPage
+	p.entries = make([]*indexEntry, numEntries)
+	p.children = nil
+	p.next = -1
+	if p.leaf {
+		p.next = int(link)
+	} else {
+		p.children = make([]int, 1, numEntries+1)
+		p.children[0] = int(link)
+	}
+	for i := range p.entries {
+		t, err := readTupleFrom(buf, &p.file.entryDesc)
+		if err != nil {
+			return err
+		}
+		p.entries[i] = indexEntryFromTuple(t)
+		if !p.leaf {
+			var child int32
+			err = binary.Read(buf, binary.LittleEndian, &child)
+			if err != nil {
+				return err
+			}
+			p.children = append(p.children, int(child))
+		}
+	}
+	p.computeUsedBytes()
+	p.dirty = false
+	p.SetBeforeImage()
+	return nil
+}
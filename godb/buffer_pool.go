@@ -7,7 +7,9 @@ package godb
 
 import (
 	"fmt"
+	"log"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -17,51 +19,144 @@ type RWPerm int
 const (
 	ReadPerm  RWPerm = iota
 	WritePerm RWPerm = iota
+
+	// intention locks, which a transaction takes on a table before it locks
+	// pages of the table, and on a page before it locks records of the page,
+	// for reading or writing (see [LockTable])
+	intentReadPerm  RWPerm = iota
+	intentWritePerm RWPerm = iota
+
+	// a read lock on a whole table together with an intention write lock
+	sharedIntentWritePerm RWPerm = iota
 )
 
+// Return the intention lock that a transaction takes on a table, or a page,
+// before it locks one of its pages, or records, with the given permissions.
+func intentionFor(perm RWPerm) RWPerm {
+	if perm == ReadPerm || perm == intentReadPerm {
+		return intentReadPerm
+	}
+	return intentWritePerm
+}
+
 type BufferPool struct {
-	pages     map[any]Page
-	maxPages  int
+	// the cached pages, split into partitions by [pagePartition], each of
+	// which has its own latch
+	partitions [numPartitions]bufferPoolPartition
+
 	lockTable *LockTable
 	logfile   *LogFile
 
-	// the transactions that are currently running. This is a set, so the value
-	// is not important
-	runningTids map[TransactionID]any
-
-	sync.Mutex
+	// the replacement policy, which chooses the pages to evict, the number of
+	// pages the buffer pool may hold, and the number of pages that are cached
+	// or being read into the buffer pool, which frameLatch protects
+	policy     ReplacementPolicy
+	maxPages   int
+	numFrames  int
+	frameLatch sync.Mutex
+
+	// how long to wait for a lock before giving up, or 0 to wait until the
+	// lock is granted (a time.Duration)
+	lockTimeout atomic.Int64
+
+	counters bufferPoolCounters // see [BufferPool.Stats]
+
+	// the memory manager whose budget sets maxPages, if any (see
+	// [BufferPool.SetMemoryManager])
+	memory atomic.Pointer[MemoryManager]
+
+	// protects the log file. Pages are written while holding this latch, so
+	// that the writes are ordered with the log records that describe them
+	logLatch sync.Mutex
+
+	// taken exclusively by [BufferPool.Checkpoint], and shared by everything
+	// that logs changes or writes pages, so that nothing is logged while a
+	// checkpoint writes the pages
+	checkpointLatch sync.RWMutex
+
+	// closed to stop the background page writer, and closed by the writer when
+	// it has stopped (see [BufferPool.StartPageWriter]), protected by
+	// writerLatch
+	writerStop  chan struct{}
+	writerDone  chan struct{}
+	writerLatch sync.Mutex
+
+	readAhead readAhead // see [BufferPool.SetReadAhead]
+
+	// the snapshots of the transactions that read them, and the versions of
+	// records they need (see [BufferPool.BeginSnapshotTransaction])
+	snapshots snapshotManager
+
+	// the transactions that are currently running, with their isolation
+	// levels and start times, protected by tidLatch
+	runningTids map[TransactionID]runningTransaction
+	tidLatch    sync.Mutex
 }
 
-// Create a new BufferPool with the specified number of pages
-func NewBufferPool(numPages int) (*BufferPool, error) {
+// Create a new BufferPool with the specified number of pages. The replacement
+// policy that chooses the pages to evict may be passed as the second argument,
+// e.g., NewBufferPool(1000, NewClockPolicy()); the default is
+// [NewLRUPolicy].
+//
+// There is no global latch: the pages and the locks on them are split into
+// partitions with latches of their own, and pages are read without holding
+// any latch, so that transactions using different pages run in parallel.
+// Latches are always taken in the order checkpointLatch, logLatch,
+// frameLatch, then the latch of a partition, then tidLatch. The lock of the
+// snapshot manager is taken after the latch of a heap page.
+func NewBufferPool(numPages int, policy ...ReplacementPolicy) (*BufferPool, error) {
 	if numPages <= 0 {
 		return nil, fmt.Errorf("numPages must be positive")
 	}
-	return &BufferPool{
-		make(map[any]Page),
-		numPages,
-		NewLockTable(),
-		nil,
-		make(map[TransactionID]any),
-		sync.Mutex{},
-	}, nil
+	if len(policy) > 1 {
+		return nil, fmt.Errorf("at most one replacement policy may be specified")
+	}
+	var p ReplacementPolicy = NewLRUPolicy()
+	if len(policy) == 1 {
+		p = policy[0]
+	}
+	bp := &BufferPool{
+		maxPages:    numPages,
+		lockTable:   NewLockTable(),
+		policy:      p,
+		runningTids: make(map[TransactionID]runningTransaction),
+		readAhead:   readAhead{pages: DefaultReadAhead, runs: make(map[TransactionID]map[DBFile]*sequentialRun)},
+		snapshots:   newSnapshotManager(),
+	}
+	for i := range bp.partitions {
+		bp.partitions[i] = newBufferPoolPartition()
+	}
+	bp.lockTable.logWritten = bp.logWritten
+	return bp, nil
 }
 
 // Testing method -- iterate through all pages in the buffer pool and flush them
 // using [DBFile.flushPage]. Does not need to be thread/transaction safe
 func (bp *BufferPool) FlushAllPages() {
-	for _, page := range bp.pages {
-		page.getFile().flushPage(page)
+	for i := range bp.partitions {
+		p := &bp.partitions[i]
+		for _, page := range p.pages {
+			if page.isDirty() {
+				bp.counters.update(func(s *BufferPoolStats) { s.DirtyFlushes++ })
+			}
+			bp.flushPage(page)
+		}
+		clear(p.unflushed)
 	}
 }
 
 // Testing method -- flush all dirty pages in the buffer pool and set them to
 // clean. Does not need to be thread/transaction safe.
 func (bp *BufferPool) flushDirtyPages(tid TransactionID) error {
-	for _, pg := range bp.pages {
-		if pg.isDirty() {
-			pg.getFile().flushPage(pg)
-			pg.setDirty(tid, false)
+	for i := range bp.partitions {
+		p := &bp.partitions[i]
+		for key, pg := range p.pages {
+			if pg.isDirty() {
+				bp.counters.update(func(s *BufferPoolStats) { s.DirtyFlushes++ })
+				bp.flushPage(pg)
+				pg.setDirty(tid, false)
+				delete(p.unflushed, key)
+			}
 		}
 	}
 	return nil
@@ -69,73 +164,150 @@ func (bp *BufferPool) flushDirtyPages(tid TransactionID) error {
 
 // Returns true if the transaction is runing.
 //
-// Caller must hold the bufferpool lock.
+// Caller must hold tidLatch.
 func (bp *BufferPool) tidIsRunning(tid TransactionID) bool {
 	_, is_running := bp.runningTids[tid]
 	return is_running
 }
 
-// Abort the transaction, releasing locks. Because GoDB is FORCE/NO STEAL, none
-// of the pages tid has dirtied will be on disk so it is sufficient to just
-// release locks to abort. You do not need to implement this for lab 1.
+// Remove the transaction from the running transactions, when it commits or
+// aborts. This happens before its pins and locks are released, so that a
+// request for a page that races with the end of the transaction either sees
+// that it is no longer running, or has its pin and lock released with the
+// others. Returns false if the transaction wasn't running.
+func (bp *BufferPool) endTransaction(tid TransactionID) bool {
+	bp.tidLatch.Lock()
+	defer bp.tidLatch.Unlock()
+	if !bp.tidIsRunning(tid) {
+		return false
+	}
+	delete(bp.runningTids, tid)
+	bp.readAhead.forget(tid)
+	return true
+}
+
+// Abort the transaction, releasing locks. GoDB is STEAL: the page writer, or a
+// buffer pool that needs a frame, may have written pages with the uncommitted
+// changes of tid to disk, after logging them (see [BufferPool.writePages]).
+// Those changes are undone on disk from their update records in the log (see
+// [BufferPool.Rollback]); the changes tid made to the pages in the buffer
+// pool are rolled back by dropping the pages, or, on heap pages, by putting
+// back the records tid changed. You do not need to implement this for lab 1.
 func (bp *BufferPool) AbortTransaction(tid TransactionID) {
-	bp.Lock()
-	defer bp.Unlock()
+	bp.checkpointLatch.RLock()
+	defer bp.checkpointLatch.RUnlock()
 
-	if !bp.tidIsRunning(tid) {
-		fmt.Errorf("transaction error: %v", IllegalTransactionError)
+	if !bp.endTransaction(tid) {
 		return
 	}
+	if bp.snapshots.end(tid) {
+		bp.pruneVersions()
+	}
 
+	bp.logLatch.Lock()
 	bp.LogFile().LogAbort(tid)
 	bp.LogFile().Force()
 
-	bp.Rollback(tid)
-
-	for _, pg := range bp.lockTable.WriteLockedPages(tid) {
-		delete(bp.pages, pg)
+	// the pages tid modified are dropped below, so the committed changes on
+	// them that aren't on disk yet, which are in their before images, have to
+	// be written first
+	writeLocked := bp.lockTable.WriteLockedPages(tid)
+	for _, pg := range writeLocked {
+		p := bp.partition(pg)
+		p.Lock()
+		var before Page
+		if _, unflushed := p.unflushed[pg]; unflushed {
+			before = p.pages[pg].(loggedPage).BeforeImage()
+		}
+		p.Unlock()
+		if before != nil {
+			bp.flushPage(before)
+		}
 	}
 
-	bp.lockTable.ReleaseLocks(tid)
+	bp.abortRecords(tid)
+	if err := bp.Rollback(tid); err != nil {
+		// the uncommitted changes of tid that were written to disk may still
+		// be there; recovery undoes them once the database is restarted
+		log.Printf("failed to roll back transaction %d: %v", tid, err)
+	}
 
-	delete(bp.runningTids, tid)
+	// the pages are dropped before the log latch is released, so that the
+	// page writer doesn't write them
+	for _, pg := range writeLocked {
+		bp.removePage(pg)
+	}
+	bp.logLatch.Unlock()
 
+	bp.unpinAll(tid)
+	bp.lockTable.ReleaseLocks(tid)
+	if m := bp.memory.Load(); m != nil {
+		m.releaseAll(tid)
+	}
 }
 
-// Commit the transaction, releasing locks. Because GoDB is FORCE/NO STEAL, none
-// of the pages tid has dirtied will be on disk, so prior to releasing locks you
-// should iterate through pages and write them to disk.  In GoDB lab3 we assume
-// that the system will not crash while doing this, allowing us to avoid using a
-// WAL. You do not need to implement this for lab 1.
+// Commit the transaction, releasing locks. GoDB is STEAL/NO FORCE: some of the
+// pages tid dirtied may already be on disk, with their changes logged (see
+// [BufferPool.writePages]), and the rest are not written when tid commits.
+// Instead, the changes on the pages it dirtied are logged, followed by a
+// Commit record, and the log is forced before the locks are released; the
+// pages are written later by the page writer, or when they are evicted. You
+// do not need to implement this for lab 1.
 func (bp *BufferPool) CommitTransaction(tid TransactionID) error {
-	bp.Lock()
-	defer bp.Unlock()
+	bp.checkpointLatch.RLock()
+	defer bp.checkpointLatch.RUnlock()
 
-	if !bp.tidIsRunning(tid) {
+	if !bp.endTransaction(tid) {
 		return fmt.Errorf("transaction error: %v", IllegalTransactionError)
 	}
+	if bp.snapshots.end(tid) {
+		bp.pruneVersions()
+	}
+	bp.snapshots.startCommit(tid)
 
+	bp.logLatch.Lock()
 	for _, pageNum := range bp.lockTable.WriteLockedPages(tid) {
+		p := bp.partition(pageNum)
+		p.Lock()
 
-		page := bp.pages[pageNum]
+		page := p.pages[pageNum]
 
 		if page == nil {
+			p.Unlock()
 			continue
 		}
 
+		// a page may be clean because the page writer wrote it to disk, but
+		// its before image still has to move past this transaction's changes
+		lp := page.(loggedPage)
 		if page.isDirty() {
 
 			page.setDirty(tid, false)
 
-			bp.LogFile().LogUpdate(tid, page.(*heapPage).bImage, page)
-			page.(*heapPage).SetBeforeImage()
+			bp.LogFile().LogUpdate(tid, lp.BeforeImage(), page)
+			p.unflushed[pageNum] = nil
 		}
+		lp.SetBeforeImage()
+		if hp, ok := page.(*heapPage); ok {
+			// the records tid changed are part of the before image now
+			hp.latch.Lock()
+			hp.clearOwner(tid)
+			hp.latch.Unlock()
+		}
+		p.Unlock()
 	}
+	bp.commitRecords(tid)
 
 	bp.LogFile().LogCommit(tid)
 	bp.LogFile().Force()
+	bp.logLatch.Unlock()
+	bp.snapshots.finishCommit(tid)
+
+	bp.unpinAll(tid)
 	bp.lockTable.ReleaseLocks(tid)
-	delete(bp.runningTids, tid)
+	if m := bp.memory.Load(); m != nil {
+		m.releaseAll(tid)
+	}
 
 	return nil
 }
@@ -144,120 +316,422 @@ func (bp *BufferPool) CommitTransaction(tid TransactionID) error {
 //
 // Returns an error if the transaction is already running.
 func (bp *BufferPool) BeginTransaction(tid TransactionID) error {
-	bp.Lock()
-	defer bp.Unlock()
-
+	bp.tidLatch.Lock()
 	if bp.tidIsRunning(tid) {
+		bp.tidLatch.Unlock()
 		return fmt.Errorf("transaction error: %v", IllegalTransactionError)
 	}
+	bp.runningTids[tid] = runningTransaction{Serializable, time.Now(), nil}
+	bp.tidLatch.Unlock()
 
+	bp.logLatch.Lock()
+	defer bp.logLatch.Unlock()
 	bp.LogFile().LogBegin(tid)
 	bp.LogFile().Force()
-	bp.runningTids[tid] = nil
 
 	return nil
 }
 
-// If necessary, evict clean page from the buffer pool. If all pages are dirty,
-// return an error.
-func (bp *BufferPool) evictPage() error {
-
-	if len(bp.pages) < bp.maxPages {
-		return nil
+// Drop the page with the specified key from the buffer pool, e.g., because the
+// transaction that modified it aborted.
+func (bp *BufferPool) removePage(key any) {
+	bp.frameLatch.Lock()
+	defer bp.frameLatch.Unlock()
+	p := bp.partition(key)
+	p.Lock()
+	if _, ok := p.pages[key]; ok {
+		delete(p.pages, key)
+		bp.numFrames--
 	}
+	delete(p.unflushed, key)
+	delete(p.prefetched, key)
+	p.Unlock()
+	bp.policy.pageRemoved(key)
+}
 
-	// evict first clean page
-	for key, page := range bp.pages {
-		if !page.isDirty() {
-			delete(bp.pages, key)
-			return nil
+// Drop a heap file whose table is dropped: throw away its pages in the buffer
+// pool without writing them, and then delete the file and its free space map
+// (see [HeapFile.remove]), so that a table created later with the same file
+// starts empty instead of from the cached or stored pages of the dropped one.
+//
+// Returns an IllegalOperationError if a transaction has a page of the file
+// pinned.
+func (bp *BufferPool) dropFile(f *HeapFile) error {
+	ofFile := func(key any) bool {
+		h, ok := key.(heapHash)
+		return ok && h.FileName == f.backingFile
+	}
+	pinned := bp.findPages(func(p *bufferPoolPartition, key any, page Page) bool {
+		return ofFile(key) && p.pins[key] != 0
+	})
+	if len(pinned) > 0 {
+		return GoDBError{IllegalOperationError, fmt.Sprintf("file %s is in use", f.backingFile)}
+	}
+	for _, key := range bp.findPages(func(p *bufferPoolPartition, key any, page Page) bool { return ofFile(key) }) {
+		bp.removePage(key)
+	}
+	for i := range bp.partitions {
+		p := &bp.partitions[i]
+		p.Lock()
+		for key := range p.evictedOwners {
+			if ofFile(key) {
+				delete(p.evictedOwners, key)
+			}
 		}
+		p.Unlock()
 	}
+	return f.remove()
+}
 
-	for key, page := range bp.pages {
-		if page.isDirty() {
+// Drop the page with the specified key from the buffer pool to make room for
+// another page, if it is still unpinned and matches its file. Returns true if
+// the page was dropped.
+//
+// Caller must hold frameLatch.
+func (bp *BufferPool) evictCleanPage(key any) bool {
+	p := bp.partition(key)
+	p.Lock()
+	defer p.Unlock()
+	if _, ok := p.pages[key]; !ok {
+		bp.policy.pageRemoved(key)
+		return false
+	}
+	if !p.evictable(key, true) {
+		return false
+	}
+	if hp, ok := p.pages[key].(*heapPage); ok {
+		if o := hp.detachOwners(); o != nil {
+			p.evictedOwners[key] = o
+		}
+	}
+	delete(p.pages, key)
+	delete(p.prefetched, key)
+	bp.policy.pageRemoved(key)
+	return true
+}
 
-			befImg := page.(*heapPage)
-			bp.LogFile().LogUpdate(befImg.lastTxn, befImg.BeforeImage(), page)
+// Reserve room for a page that is being read into the buffer pool. If the
+// buffer pool is full, evict a page, choosing it with the replacement policy.
+// Pinned pages are never evicted, and pages that match their files are
+// evicted before pages that have to be written first (see
+// [BufferPool.writePages]), which are written without holding frameLatch.
+// If every page is pinned, return an error.
+func (bp *BufferPool) reserveFrame() error {
+	for {
+		bp.frameLatch.Lock()
+		if bp.numFrames < bp.maxPages {
+			bp.numFrames++
+			bp.frameLatch.Unlock()
+			return nil
+		}
 
-			bp.LogFile().Force()
-			page.getFile().flushPage(page)
+		key, ok := bp.policy.victim(func(key any) bool {
+			p := bp.partition(key)
+			p.Lock()
+			defer p.Unlock()
+			return p.evictable(key, true)
+		})
+		if ok {
+			evicted := bp.evictCleanPage(key)
+			if evicted {
+				bp.counters.update(func(s *BufferPoolStats) { s.Evictions++ })
+			}
+			if evicted && bp.numFrames <= bp.maxPages {
+				// the frame of the evicted page is handed to the new page
+				bp.frameLatch.Unlock()
+				return nil
+			}
+			if evicted {
+				// the buffer pool is shrinking (see [BufferPool.resize])
+				bp.numFrames--
+			}
+			bp.frameLatch.Unlock()
+			continue
+		}
 
-			delete(bp.pages, key)
-			return nil
+		key, ok = bp.policy.victim(func(key any) bool {
+			p := bp.partition(key)
+			p.Lock()
+			defer p.Unlock()
+			return p.evictable(key, false)
+		})
+		maxPages := bp.maxPages
+		bp.frameLatch.Unlock()
+		if !ok {
+			return GoDBError{BufferPoolFullError, fmt.Sprintf("all %d pages in the buffer pool are pinned", maxPages)}
 		}
+		// once the page is written, it is evicted in the next round, unless it
+		// is used again in the meantime
+		bp.checkpointLatch.RLock()
+		err := bp.writePages([]any{key})
+		bp.checkpointLatch.RUnlock()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Give back a frame reserved by [BufferPool.reserveFrame] that wasn't used.
+func (bp *BufferPool) releaseFrame() {
+	bp.frameLatch.Lock()
+	defer bp.frameLatch.Unlock()
+	bp.numFrames--
+}
+
+// Tell the replacement policy about an access to the page with the specified
+// key, unless it was dropped in the meantime.
+func (bp *BufferPool) pageAccessed(key any, scan bool) {
+	bp.frameLatch.Lock()
+	defer bp.frameLatch.Unlock()
+	if _, ok := bp.cachedPage(key); ok {
+		bp.policy.pageAccessed(key, scan)
 	}
-	return GoDBError{BufferPoolFullError, "all pages in buffer pool are dirty"}
 }
 
 // Returns true if the transaction is runing.
 func (bp *BufferPool) IsRunning(tid TransactionID) bool {
-	bp.Lock()
-	defer bp.Unlock()
+	bp.tidLatch.Lock()
+	defer bp.tidLatch.Unlock()
 	return bp.tidIsRunning(tid)
 }
 
-// Loads the specified page from the specified DBFile, but does not lock it.
-func (bp *BufferPool) loadPage(file DBFile, pageNo int) (Page, error) {
-	bp.Lock()
-	defer bp.Unlock()
+// Returns true if another transaction holds a lock on the specified page, so
+// that tid would have to wait to lock it with the given permissions.
+func (bp *BufferPool) pageLockedByOther(file DBFile, pageNo int, tid TransactionID, perm RWPerm) bool {
+	return bp.lockTable.lockedByOther(file, pageNo, tid, perm)
+}
 
+// Loads the specified page from the specified DBFile, but does not lock it.
+// scan is true if the page is read by a large sequential scan (see
+// [ReplacementPolicy]).
+//
+// The page is read from its file without holding any latch. If a page of the
+// same partition is written in the meantime, the page is read again, since the
+// copy that was read may be stale.
+func (bp *BufferPool) loadPage(file DBFile, pageNo int, scan bool) (Page, error) {
 	hashCode := file.pageKey(pageNo)
+	p := bp.partition(hashCode)
 
-	var pg Page
-	pg, ok := bp.pages[hashCode]
-	if !ok {
-		var err error
-		pg, err = file.readPage(pageNo)
+	for {
+		p.Lock()
+		pg, ok := p.pages[hashCode]
+		delete(p.prefetched, hashCode)
+		generation := p.generation
+		p.Unlock()
+		if ok {
+			bp.counters.update(func(s *BufferPoolStats) { s.Hits++ })
+			bp.pageAccessed(hashCode, scan)
+			return pg, nil
+		}
+
+		pg, err := bp.readPage(file, pageNo)
 		if err != nil {
 			return nil, err
 		}
-		err = bp.evictPage()
+		err = bp.reserveFrame()
 		if err != nil {
 			return nil, err
 		}
-		bp.pages[hashCode] = pg
+
+		p.Lock()
+		if cached, ok := p.pages[hashCode]; ok {
+			// another transaction read the page at the same time
+			p.Unlock()
+			bp.releaseFrame()
+			pg = cached
+		} else if p.generation != generation {
+			p.Unlock()
+			bp.releaseFrame()
+			continue
+		} else {
+			p.addPage(hashCode, pg)
+			p.Unlock()
+		}
+		bp.counters.update(func(s *BufferPoolStats) { s.Misses++ })
+		bp.pageAccessed(hashCode, scan)
+		return pg, nil
 	}
-	return pg, nil
 }
 
 // Retrieve the specified page from the specified DBFile (e.g., a HeapFile), on
 // behalf of the specified transaction. If a page is not cached in the buffer pool,
-// you can read it from disk uing [DBFile.readPage]. If the buffer pool is full (i.e.,
-// already stores numPages pages), a page should be evicted.  Should not evict
-// pages that are dirty, as this would violate NO STEAL. If the buffer pool is
-// full of dirty pages, you should return an error. Before returning the page,
-// attempt to lock it with the specified permission.  If the lock is
-// unavailable, should block until the lock is free. If a deadlock occurs, abort
-// one of the transactions in the deadlock. For lab 1, you do not need to
-// implement locking or deadlock detection. You will likely want to store a list
-// of pages in the BufferPool in a map keyed by the [DBFile.pageKey].
+// it is read from disk using [DBFile.readPage]. If the buffer pool is full (i.e.,
+// already stores numPages pages), a page is evicted (see
+// [BufferPool.reserveFrame]). Only pinned pages can't be evicted; dirty pages
+// are written to disk before they are evicted, after their uncommitted changes
+// are logged (STEAL). If every page is pinned, an error is returned. Before
+// returning the page, it is locked with the specified permission. If the lock
+// is unavailable, GetPage blocks until the lock is free. If a deadlock occurs,
+// one of the transactions in the deadlock is aborted. Pages are stored in the
+// BufferPool in maps keyed by the [DBFile.pageKey].
+//
+// The page is not pinned, so it may be evicted as soon as GetPage returns; use
+// [BufferPool.PinPage] to keep a page in the buffer pool while it is in use.
+//
+// Locks are held until the transaction commits or aborts, except that read
+// locks of a transaction at the ReadCommitted isolation level are released
+// when GetPage returns, or when the handle returned by PinPage is released.
 func (bp *BufferPool) GetPage(file DBFile, pageNo int, tid TransactionID, perm RWPerm) (Page, error) {
+	h, err := bp.getPage(file, pageNo, tid, perm, false)
+	if err != nil {
+		return nil, err
+	}
+	h.Release()
+	return h.Page, nil
+}
+
+// Retrieve a page like [BufferPool.GetPage], and pin it in the buffer pool, so
+// that it can't be evicted until the returned handle is released. Pages that
+// are still pinned when the transaction commits or aborts are unpinned then.
+//
+// Returns a BufferPoolFullError if the page isn't cached, and every page in
+// the buffer pool is pinned.
+func (bp *BufferPool) PinPage(file DBFile, pageNo int, tid TransactionID, perm RWPerm) (*PageHandle, error) {
+	return bp.getPage(file, pageNo, tid, perm, false)
+}
+
+// Set how long [BufferPool.GetPage] waits for a lock held by another
+// transaction before giving up with a LockTimeoutError. The default, 0, waits
+// until the lock is granted.
+func (bp *BufferPool) SetLockTimeout(d time.Duration) {
+	bp.lockTimeout.Store(int64(d))
+}
+
+// Set the number of locks on the pages and records of one table that a
+// transaction may hold before they are escalated to a lock on the whole table
+// (see [LockTable]). The default is [DefaultLockEscalation]; 0 turns
+// escalation off.
+func (bp *BufferPool) SetLockEscalation(n int) {
+	bp.lockTable.setEscalation(n)
+}
+
+// Scans that read more pages than the buffer pool holds, divided by this
+// fraction, are large scans, whose pages are evicted first.
+const largeScanFraction = 4
+
+// Returns true if a sequential scan of numPages pages is a large scan, whose
+// pages should be read with [BufferPool.getScanPage].
+func (bp *BufferPool) isLargeScan(numPages int) bool {
+	return numPages > bp.capacity()/largeScanFraction
+}
+
+// Retrieve and pin a page for a large sequential scan, like
+// [BufferPool.PinPage]. The page is evicted before the other pages in the
+// buffer pool if the scan brought it in, so that the scan doesn't push every
+// other page out.
+func (bp *BufferPool) getScanPage(file DBFile, pageNo int, tid TransactionID, perm RWPerm) (*PageHandle, error) {
+	return bp.getPage(file, pageNo, tid, perm, true)
+}
+
+func (bp *BufferPool) getPage(file DBFile, pageNo int, tid TransactionID, perm RWPerm, scan bool) (*PageHandle, error) {
 	if !bp.IsRunning(tid) {
 		return nil, GoDBError{IllegalTransactionError, "Transaction is not running or has aborted."}
 	}
 
+	if from, to := bp.readAhead.access(tid, file, pageNo); from < to {
+		go bp.prefetchPages(file, from, min(to, file.NumPages()))
+	}
+
 	//loop until locks are acquired
 	for {
 		// ensure page is in the buffer pool
-		pg, err := bp.loadPage(file, pageNo)
+		pg, err := bp.loadPage(file, pageNo, scan)
 		if err != nil {
 			return nil, err
 		}
 
-		// try to lock the page
-		bp.Lock()
-		switch bp.lockTable.TryLock(file, pageNo, tid, perm) {
+		// try to lock the file, and then the page (see [LockTable])
+		resp, w := bp.lockTable.requestFileLock(file, tid, intentionFor(perm))
+		if resp == Grant {
+			resp, w = bp.lockTable.requestLock(file, pageNo, tid, perm)
+		}
+		switch resp {
 		case Grant:
-			bp.Unlock()
-			return pg, nil
+			// a transaction that reads committed data releases its read
+			// locks as soon as it's done reading (see [ReadCommitted])
+			read := perm == ReadPerm || perm == intentReadPerm
+			short := read && bp.isolationOf(tid) == ReadCommitted
+			hashCode := file.pageKey(pageNo)
+			p := bp.partition(hashCode)
+			p.Lock()
+			if p.pages[hashCode] != pg {
+				// the page was evicted while we were locking it
+				p.Unlock()
+				continue
+			}
+			if !bp.IsRunning(tid) {
+				// the transaction was aborted while we were waiting; its
+				// locks may have been released before this one was granted
+				p.Unlock()
+				bp.lockTable.ReleaseLocks(tid)
+				return nil, GoDBError{IllegalTransactionError, "Transaction has aborted."}
+			}
+			p.pin(tid, hashCode)
+			p.Unlock()
+			return &PageHandle{pg, bp, hashCode, tid, short, false}, nil
 		case Wait:
-			bp.Unlock()
-			time.Sleep(2 * time.Millisecond)
+			timeout := time.Duration(bp.lockTimeout.Load())
+			switch bp.waitForLock(w, timeout) {
+			case Wait:
+				// the transaction keeps running, and may retry or abort
+				return nil, GoDBError{LockTimeoutError, fmt.Sprintf("timed out after %v waiting for a lock on page %d", timeout, pageNo)}
+			case Abort:
+				return nil, bp.deadlockAbort(tid)
+			}
 		case Abort:
-			bp.Unlock()
-			bp.AbortTransaction(tid)
-			return nil, GoDBError{IllegalTransactionError, "Transaction has aborted."}
+			return nil, bp.deadlockAbort(tid)
 		}
 	}
 }
+
+// Block until the queued lock request w is granted, its transaction is
+// wounded (see [DeadlockPolicy]), or the timeout expires; in the latter cases
+// the request is withdrawn. Returns Grant if the lock was granted, Abort if
+// the transaction was wounded, and Wait if the timeout expired. A timeout of 0
+// waits until the lock is granted or the transaction is wounded.
+func (bp *BufferPool) waitForLock(w *lockWaiter, timeout time.Duration) LockResponse {
+	bp.counters.update(func(s *BufferPoolStats) { s.LockWaits++ })
+	var expired <-chan time.Time
+	if timeout != 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+	select {
+	case <-w.granted:
+		return Grant
+	case <-w.wounded:
+		bp.lockTable.cancelWait(w)
+		return Abort
+	case <-expired:
+		// the lock may have been granted just as we gave up
+		if bp.lockTable.cancelWait(w) {
+			return Wait
+		}
+		return Grant
+	}
+}
+
+// Abort tid, which the deadlock policy chose to abort, and return the error to
+// return to its caller.
+func (bp *BufferPool) deadlockAbort(tid TransactionID) error {
+	bp.counters.update(func(s *BufferPoolStats) { s.DeadlockAborts++ })
+	bp.AbortTransaction(tid)
+	return GoDBError{IllegalTransactionError, "Transaction has aborted."}
+}
+
+// Set the policy that decides which transactions are aborted when
+// transactions wait for each other's locks (see [DeadlockPolicy]). The
+// default is NewDeadlockDetection(VictimRequester).
+func (bp *BufferPool) SetDeadlockPolicy(policy DeadlockPolicy) {
+	bp.lockTable.setDeadlockPolicy(policy)
+}
+
+// Return the number of bytes of the log that the changes of tid take, for
+// VictimLeastLog.
+func (bp *BufferPool) logWritten(tid TransactionID) int64 {
+	if lf := bp.LogFile(); lf != nil {
+		return lf.written(tid)
+	}
+	return 0
+}
@@ -2,10 +2,14 @@ package godb
 
 import (
 	"fmt"
+	"io"
+	"time"
 )
 
 // Rolls back a transaction by reading the log and undoing the changes made by
 // the transaction.
+//
+// Caller must hold logLatch.
 func (bp *BufferPool) Rollback(tid TransactionID) error {
 	iter, err := bp.LogFile().ReverseIterator()
 	if err != nil {
@@ -25,22 +29,198 @@ func (bp *BufferPool) Rollback(tid TransactionID) error {
 		if tid == record.Tid() {
 			if record.Type() == UpdateRecord {
 
-				before := record.(*UpdateLogRecord).Before
-				file := before.(*heapPage).getFile()
-				file.flushPage(before)
-
-				for key, page := range bp.pages {
-					if page.(*heapPage).lastTxn == tid {
-						delete(bp.pages, key)
-					}
-				}
+				bp.applyUpdate(record.(*UpdateLogRecord), false)
 
 			}
 		}
 	}
+
+	// the pages on which tid changed records were rolled back by
+	// [BufferPool.abortRecords], and may hold the changes of others
+	rowLocked := make(map[any]bool)
+	for _, key := range bp.lockTable.intentWriteLockedPages(tid) {
+		rowLocked[key] = true
+	}
+	keys := bp.findPages(func(p *bufferPoolPartition, key any, page Page) bool {
+		return page.(loggedPage).lastTransaction() == tid && !rowLocked[key]
+	})
+	for _, key := range keys {
+		bp.removePage(key)
+	}
 	return nil
 }
 
+// Write the changes an update record describes to disk: the after image to
+// redo them, or the before image to undo them. Heap pages may hold the changes
+// of several transactions, which lock records rather than pages (see
+// [LockTable]), so only the records that differ between the images are
+// written to them; other pages are overwritten with the image.
+func (bp *BufferPool) applyUpdate(rec *UpdateLogRecord, redo bool) error {
+	image := rec.Before
+	if redo {
+		image = rec.After
+	}
+	before, ok := rec.Before.(*heapPage)
+	after, _ := rec.After.(*heapPage)
+	if !ok || after == nil {
+		return bp.flushPage(image)
+	}
+	pg, err := bp.readPage(before.file, before.pageNo)
+	if err != nil {
+		// the page isn't on disk yet, or was torn, so all of it is written
+		return bp.flushPage(image)
+	}
+	hp := pg.(*heapPage)
+	for _, slot := range changedSlots(before, after) {
+		hp.copySlotFrom(image.(*heapPage), slot)
+	}
+	return bp.flushPage(hp)
+}
+
+// Drop the versions on the heap page images of an update record that is read
+// during recovery, which were made before the database was started (see
+// [heapPage.forgetVersions]), so that they aren't written back.
+func forgetLoggedVersions(rec *UpdateLogRecord) {
+	for _, image := range []Page{rec.Before, rec.After} {
+		if hp, ok := image.(*heapPage); ok {
+			hp.forgetVersions()
+		}
+	}
+}
+
+// Log the uncommitted changes on a dirty page before it is written to its
+// file. The changes that transactions made to records of a heap page are
+// logged with a record for each of them, so that each can be undone alone
+// (see [heapPage.uncommittedImages]); other pages are logged as a whole, for
+// the transaction that last dirtied them.
+//
+// Caller must hold logLatch and the latch of the page's partition.
+func (bp *BufferPool) logUncommitted(page Page) error {
+	if hp, ok := page.(*heapPage); ok && hp.hasOwners() {
+		before := hp.BeforeImage()
+		for tid, after := range hp.uncommittedImages() {
+			if err := bp.LogFile().LogUpdate(tid, before, after); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	lp := page.(loggedPage)
+	return bp.LogFile().LogUpdate(lp.lastTransaction(), lp.BeforeImage(), page)
+}
+
+// Lock a record of a heap file for tid with the given permissions, waiting
+// until the lock is granted like [BufferPool.GetPage]. The caller should hold
+// an intention lock on the page of the record.
+//
+// Returns an IllegalTransactionError if tid was aborted to break a deadlock,
+// or a LockTimeoutError if the lock wasn't granted in time.
+func (bp *BufferPool) lockRecord(file DBFile, rid heapFileRid, tid TransactionID, perm RWPerm) error {
+	return bp.waitForGrant(tid, fmt.Sprintf("record %d of page %d", rid.slotNo, rid.pageNo), func() (LockResponse, *lockWaiter) {
+		return bp.lockTable.requestRecordLock(file, rid, tid, perm)
+	})
+}
+
+// Lock a whole file for tid, waiting until the lock is granted like
+// [BufferPool.GetPage]. With ReadPerm, tid can then read every page of the
+// file without locking it, and with WritePerm, it can also change them
+// without waiting for other transactions (see [LockTable]). A bulk job that
+// reads or rewrites a whole table should lock it this way, instead of locking
+// each of its pages; [HeapFile.Iterator] does for large scans.
+//
+// Returns an IllegalTransactionError if tid was aborted to break a deadlock,
+// or a LockTimeoutError if the lock wasn't granted in time.
+func (bp *BufferPool) LockFile(file DBFile, tid TransactionID, perm RWPerm) error {
+	if !bp.IsRunning(tid) {
+		return GoDBError{IllegalTransactionError, "Transaction is not running or has aborted."}
+	}
+	return bp.waitForGrant(tid, "the file", func() (LockResponse, *lockWaiter) {
+		return bp.lockTable.requestFileLock(file, tid, perm)
+	})
+}
+
+// Make the lock request of tid until it is granted, waiting for the queued
+// request each time it has to wait, like [BufferPool.GetPage]. what describes
+// the locked object in a LockTimeoutError.
+func (bp *BufferPool) waitForGrant(tid TransactionID, what string, request func() (LockResponse, *lockWaiter)) error {
+	for {
+		resp, w := request()
+		switch resp {
+		case Grant:
+			if !bp.IsRunning(tid) {
+				// the transaction was aborted while we were waiting
+				bp.lockTable.ReleaseLocks(tid)
+				return GoDBError{IllegalTransactionError, "Transaction has aborted."}
+			}
+			return nil
+		case Wait:
+			timeout := time.Duration(bp.lockTimeout.Load())
+			switch bp.waitForLock(w, timeout) {
+			case Wait:
+				return GoDBError{LockTimeoutError, fmt.Sprintf("timed out after %v waiting for a lock on %s", timeout, what)}
+			case Abort:
+				return bp.deadlockAbort(tid)
+			}
+		case Abort:
+			return bp.deadlockAbort(tid)
+		}
+	}
+}
+
+// Log the changes that tid made to records of heap pages, on which other
+// transactions may have changed other records, and make them part of the
+// before images of the pages, when tid commits. Each page is logged with only
+// the changes of tid (see [heapPage.commitSlots]). The changes on pages that
+// were evicted were logged before the pages were written.
+//
+// Caller must hold logLatch.
+func (bp *BufferPool) commitRecords(tid TransactionID) {
+	for _, key := range bp.lockTable.intentWriteLockedPages(tid) {
+		p := bp.partition(key)
+		p.Lock()
+		hp, ok := p.pages[key].(*heapPage)
+		if ok {
+			if before, after := hp.commitSlots(tid, &bp.snapshots); after != nil {
+				bp.LogFile().LogUpdate(tid, before, after)
+				p.unflushed[key] = nil
+			}
+		} else if o := p.evictedOwners[key]; o != nil {
+			o.keepVersions(tid, &bp.snapshots)
+			if o.clear(tid) {
+				delete(p.evictedOwners, key)
+			}
+		}
+		p.Unlock()
+		if ok {
+			// the space of the records tid deleted is free now
+			hp.file.fsm.update(hp.pageNo, hp.availableSpace())
+		}
+	}
+}
+
+// Put back the records of heap pages that tid changed, when tid aborts,
+// leaving the changes of other transactions on the pages in place (see
+// [heapPage.abortSlots]). The changes on pages that were evicted are rolled
+// back on disk by [BufferPool.Rollback].
+//
+// Caller must hold logLatch.
+func (bp *BufferPool) abortRecords(tid TransactionID) {
+	for _, key := range bp.lockTable.intentWriteLockedPages(tid) {
+		p := bp.partition(key)
+		p.Lock()
+		hp, ok := p.pages[key].(*heapPage)
+		if ok {
+			hp.abortSlots(tid)
+		} else if o := p.evictedOwners[key]; o != nil && o.clear(tid) {
+			delete(p.evictedOwners, key)
+		}
+		p.Unlock()
+		if ok {
+			hp.file.fsm.update(hp.pageNo, hp.availableSpace())
+		}
+	}
+}
+
 // Returns the log file associated with the buffer pool.
 func (bp *BufferPool) LogFile() *LogFile {
 	return bp.logfile
@@ -48,6 +228,10 @@ func (bp *BufferPool) LogFile() *LogFile {
 
 // Recover the buffer pool from a log file. This should be called when the
 // database is started, even if the log file is empty.
+//
+// Changes are redone from the last checkpoint, since the changes logged before
+// it are on disk, and the changes of the transactions that didn't finish are
+// undone, reading the log back to the oldest of their Begin records.
 func (bp *BufferPool) Recover(logFile *LogFile) error {
 
 	bp.logfile = logFile
@@ -55,6 +239,17 @@ func (bp *BufferPool) Recover(logFile *LogFile) error {
 	activeTransactions := make(map[TransactionID]bool)
 	completedTransactions := make(map[TransactionID]bool)
 
+	start, running, err := logFile.lastCheckpoint()
+	if err != nil {
+		return fmt.Errorf("error finding the last checkpoint: %w", err)
+	}
+	for _, tid := range running {
+		activeTransactions[tid] = true
+	}
+	if err := logFile.seek(start, io.SeekStart); err != nil {
+		return err
+	}
+
 	forwardIter := logFile.ForwardIterator()
 	for {
 		record, err := forwardIter()
@@ -68,8 +263,8 @@ func (bp *BufferPool) Recover(logFile *LogFile) error {
 		switch rec := record.(type) {
 		case *UpdateLogRecord:
 			if _, completed := completedTransactions[rec.Tid()]; !completed {
-				afterImage := rec.After
-				if err := afterImage.getFile().flushPage(afterImage); err != nil {
+				forgetLoggedVersions(rec)
+				if err := bp.applyUpdate(rec, true); err != nil {
 					return fmt.Errorf("failed to redo logged changes: %w", err)
 				}
 				activeTransactions[rec.Tid()] = true
@@ -86,7 +281,12 @@ func (bp *BufferPool) Recover(logFile *LogFile) error {
 	if err != nil {
 		return fmt.Errorf("error setting up reverse iterator: %w", err)
 	}
-	for {
+	// the transactions whose Begin record hasn't been read yet
+	unbegun := make(map[TransactionID]bool)
+	for tid := range activeTransactions {
+		unbegun[tid] = true
+	}
+	for len(unbegun) > 0 {
 		record, err := reverseIter()
 		if err != nil {
 			return fmt.Errorf("error reading log during undo phase: %w", err)
@@ -95,16 +295,28 @@ func (bp *BufferPool) Recover(logFile *LogFile) error {
 			break
 		}
 
+		if record.Type() == BeginRecord {
+			delete(unbegun, record.Tid())
+		}
 		if updateRecord, ok := record.(*UpdateLogRecord); ok {
 			if _, active := activeTransactions[updateRecord.Tid()]; active {
-				beforeImage := updateRecord.Before
-				if err := beforeImage.getFile().flushPage(beforeImage); err != nil {
+				forgetLoggedVersions(updateRecord)
+				if err := bp.applyUpdate(updateRecord, false); err != nil {
 					return fmt.Errorf("failed to undo changes for transaction %d: %w", updateRecord.Tid(), err)
 				}
 			}
 		}
 	}
 
-	return nil
+	// new records are appended to the log, starting with aborts for the
+	// transactions that were undone, so that they aren't undone again by the
+	// next recovery
+	if err := logFile.seek(0, io.SeekEnd); err != nil {
+		return err
+	}
+	for tid := range activeTransactions {
+		logFile.LogAbort(tid)
+	}
+	return logFile.Force()
 
 }
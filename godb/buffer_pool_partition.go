@@ -0,0 +1,188 @@
+package godb
+
+import "sync"
+
+// The number of partitions of the page table of the [BufferPool] and of the
+// [LockTable]. Each partition has its own latch, so transactions using pages
+// in different partitions don't wait for each other.
+const numPartitions = 16
+
+// Return the page number of the page with the specified key (see
+// [DBFile.pageKey]), or of the page of the record, or of the first page of
+// the table or the file end, with the specified key.
+func pageKeyNo(key any) int {
+	switch k := key.(type) {
+	case heapHash:
+		return k.PageNo
+	case btreeHash:
+		return k.pageNo
+	case hashIndexHash:
+		return k.pageNo
+	case MemPageKey:
+		return k.pgNo
+	case recordKey:
+		return pageKeyNo(k.page)
+	case tableKey:
+		return pageKeyNo(k.page)
+	case endKey:
+		return pageKeyNo(k.page)
+	}
+	return 0
+}
+
+// Return the partition of the page with the specified key. Consecutive pages
+// of a file are in different partitions, so that a scan spreads over them.
+func pagePartition(key any) int {
+	pageNo := pageKeyNo(key)
+	if pageNo < 0 {
+		pageNo = -pageNo
+	}
+	return pageNo % numPartitions
+}
+
+// The cached pages of one partition of the [BufferPool].
+type bufferPoolPartition struct {
+	pages map[any]Page
+
+	// the number of pins on each page, and the pins held by each transaction
+	// (see [PageHandle])
+	pins    map[any]int
+	tidPins map[TransactionID]map[any]int
+
+	// the pages whose committed changes have been logged, but not yet written
+	// to their files. This is a set, so the value is not important
+	unflushed map[any]any
+
+	// the pages that were read ahead of a sequential scan (see
+	// [BufferPool.SetReadAhead]), and haven't been requested yet. This is a
+	// set, so the value is not important
+	prefetched map[any]any
+
+	// the slots that uncommitted transactions changed on heap pages that were
+	// evicted (see [heapPage.detachOwners])
+	evictedOwners map[any]*slotOwners
+
+	// incremented whenever a page of the partition is written, so that a page
+	// that was read from its file at the same time is read again (see
+	// [BufferPool.loadPage])
+	generation int
+
+	sync.Mutex
+}
+
+func newBufferPoolPartition() bufferPoolPartition {
+	return bufferPoolPartition{
+		pages:      make(map[any]Page),
+		pins:       make(map[any]int),
+		tidPins:    make(map[TransactionID]map[any]int),
+		unflushed:  make(map[any]any),
+		prefetched: make(map[any]any),
+
+		evictedOwners: make(map[any]*slotOwners),
+	}
+}
+
+// Add a page that was read from its file to the partition, attaching the
+// slots that uncommitted transactions changed, if it was evicted with some.
+//
+// Caller must hold the latch of the partition.
+func (p *bufferPoolPartition) addPage(key any, pg Page) {
+	p.pages[key] = pg
+	if o := p.evictedOwners[key]; o != nil {
+		pg.(*heapPage).attachOwners(o)
+		delete(p.evictedOwners, key)
+	}
+}
+
+// Return the partition of the buffer pool that caches the page with the
+// specified key.
+func (bp *BufferPool) partition(key any) *bufferPoolPartition {
+	return &bp.partitions[pagePartition(key)]
+}
+
+// Return the cached page with the specified key, if any.
+func (bp *BufferPool) cachedPage(key any) (Page, bool) {
+	p := bp.partition(key)
+	p.Lock()
+	defer p.Unlock()
+	pg, ok := p.pages[key]
+	return pg, ok
+}
+
+// Return the number of pages in the buffer pool.
+func (bp *BufferPool) numCachedPages() int {
+	n := 0
+	for i := range bp.partitions {
+		p := &bp.partitions[i]
+		p.Lock()
+		n += len(p.pages)
+		p.Unlock()
+	}
+	return n
+}
+
+// Return the number of pins on the page with the specified key.
+func (bp *BufferPool) pinCount(key any) int {
+	p := bp.partition(key)
+	p.Lock()
+	defer p.Unlock()
+	return p.pins[key]
+}
+
+// Return the number of pinned pages in the buffer pool.
+func (bp *BufferPool) numPinnedPages() int {
+	n := 0
+	for i := range bp.partitions {
+		p := &bp.partitions[i]
+		p.Lock()
+		n += len(p.pins)
+		p.Unlock()
+	}
+	return n
+}
+
+// Return the number of pages whose committed changes aren't on disk yet.
+func (bp *BufferPool) numUnflushedPages() int {
+	n := 0
+	for i := range bp.partitions {
+		p := &bp.partitions[i]
+		p.Lock()
+		n += len(p.unflushed)
+		p.Unlock()
+	}
+	return n
+}
+
+// Return the keys of the cached pages for which match returns true. match is
+// called while holding the latch of the page's partition.
+func (bp *BufferPool) findPages(match func(p *bufferPoolPartition, key any, page Page) bool) []any {
+	var keys []any
+	for i := range bp.partitions {
+		p := &bp.partitions[i]
+		p.Lock()
+		for key, page := range p.pages {
+			if match(p, key, page) {
+				keys = append(keys, key)
+			}
+		}
+		p.Unlock()
+	}
+	return keys
+}
+
+// Returns true if the page with the specified key is unpinned, and, if clean
+// is true, matches its file.
+//
+// Caller must hold the latch of the partition.
+func (p *bufferPoolPartition) evictable(key any, clean bool) bool {
+	page, ok := p.pages[key]
+	if !ok {
+		// the page was dropped after the replacement policy saw it
+		return true
+	}
+	if p.pins[key] != 0 {
+		return false
+	}
+	_, unflushed := p.unflushed[key]
+	return !clean || (!unflushed && !page.isDirty())
+}
@@ -0,0 +1,179 @@
+package godb
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// I/O statistics of a single file, as seen by the [BufferPool].
+type FileStats struct {
+	Reads     int64         // pages read with [DBFile.readPage]
+	Writes    int64         // pages written with [DBFile.flushPage]
+	ReadTime  time.Duration // time spent in readPage
+	WriteTime time.Duration // time spent in flushPage
+}
+
+// Statistics about the [BufferPool] since it was created or the statistics were
+// last reset, returned by [BufferPool.Stats].
+type BufferPoolStats struct {
+	Hits         int64 // page requests for pages that were in the buffer pool
+	Misses       int64 // page requests that read the page from its file
+	Evictions    int64 // pages dropped to make room for other pages
+	DirtyFlushes int64 // dirty pages written back to their files
+	Prefetches   int64 // pages read ahead of sequential scans
+
+	LockWaits      int64 // lock requests that waited for other transactions
+	DeadlockAborts int64 // transactions aborted by the [DeadlockPolicy]
+
+	// the I/O of each file, by the name of its backing file
+	Files map[string]FileStats
+}
+
+// Return the total I/O of all of the files.
+func (s BufferPoolStats) Total() FileStats {
+	var total FileStats
+	for _, f := range s.Files {
+		total.Reads += f.Reads
+		total.Writes += f.Writes
+		total.ReadTime += f.ReadTime
+		total.WriteTime += f.WriteTime
+	}
+	return total
+}
+
+// Return the fraction of page requests that were served from the buffer pool,
+// or 0 if there were no requests.
+func (s BufferPoolStats) HitRate() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
+// Format the statistics as a table, with a row for each file.
+func (s BufferPoolStats) String() string {
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "hits: %d, misses: %d (hit rate %.1f%%), evictions: %d, dirty flushes: %d, prefetches: %d\n",
+		s.Hits, s.Misses, 100*s.HitRate(), s.Evictions, s.DirtyFlushes, s.Prefetches)
+	fmt.Fprintf(&buf, "lock waits: %d, deadlock aborts: %d\n", s.LockWaits, s.DeadlockAborts)
+	names := make([]string, 0, len(s.Files))
+	for name := range s.Files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Fprintf(&buf, "%-30s %10s %12s %10s %12s\n", "file", "reads", "read time", "writes", "write time")
+	for _, name := range names {
+		f := s.Files[name]
+		fmt.Fprintf(&buf, "%-30s %10d %12v %10d %12v\n", name, f.Reads, f.ReadTime, f.Writes, f.WriteTime)
+	}
+	total := s.Total()
+	fmt.Fprintf(&buf, "%-30s %10d %12v %10d %12v\n", "total", total.Reads, total.ReadTime, total.Writes, total.WriteTime)
+	return buf.String()
+}
+
+// The counters behind [BufferPoolStats]. They have their own lock, because
+// pages are read and written without holding any other latch.
+type bufferPoolCounters struct {
+	stats BufferPoolStats
+	sync.Mutex
+}
+
+// Return the name under which the I/O of a file is counted.
+func statsFileName(file DBFile) string {
+	if f, ok := file.(interface{ BackingFile() string }); ok {
+		return f.BackingFile()
+	}
+	return fmt.Sprintf("%T", file)
+}
+
+// Apply update to the statistics of file.
+func (c *bufferPoolCounters) updateFile(file DBFile, update func(f *FileStats)) {
+	name := statsFileName(file)
+	c.Lock()
+	defer c.Unlock()
+	if c.stats.Files == nil {
+		c.stats.Files = make(map[string]FileStats)
+	}
+	f := c.stats.Files[name]
+	update(&f)
+	c.stats.Files[name] = f
+}
+
+// Apply update to the buffer pool counters.
+func (c *bufferPoolCounters) update(update func(s *BufferPoolStats)) {
+	c.Lock()
+	defer c.Unlock()
+	update(&c.stats)
+}
+
+// Return a copy of the statistics of the buffer pool since it was created or
+// [BufferPool.ResetStats] was last called.
+func (bp *BufferPool) Stats() BufferPoolStats {
+	bp.counters.Lock()
+	defer bp.counters.Unlock()
+	s := bp.counters.stats
+	s.Files = make(map[string]FileStats, len(bp.counters.stats.Files))
+	for name, f := range bp.counters.stats.Files {
+		s.Files[name] = f
+	}
+	return s
+}
+
+// Reset all of the statistics of the buffer pool to zero, e.g., between
+// benchmarks.
+func (bp *BufferPool) ResetStats() {
+	bp.counters.Lock()
+	defer bp.counters.Unlock()
+	bp.counters.stats = BufferPoolStats{}
+}
+
+// Read a page from its file with [DBFile.readPage], counting the read.
+func (bp *BufferPool) readPage(file DBFile, pageNo int) (Page, error) {
+	start := time.Now()
+	pg, err := file.readPage(pageNo)
+	elapsed := time.Since(start)
+	bp.counters.updateFile(file, func(f *FileStats) {
+		f.Reads++
+		f.ReadTime += elapsed
+	})
+	return pg, err
+}
+
+// Read the pages from page from up to, but not including, page to of a file
+// with a single read, counting the reads.
+func (bp *BufferPool) readPages(file pageRangeReader, from int, to int) ([]Page, error) {
+	start := time.Now()
+	pages, err := file.readPages(from, to)
+	elapsed := time.Since(start)
+	bp.counters.updateFile(file, func(f *FileStats) {
+		f.Reads += int64(to - from)
+		f.ReadTime += elapsed
+	})
+	return pages, err
+}
+
+// Write a page to its file with [DBFile.flushPage], counting the write. The
+// generation of the page's partition is advanced afterwards (see
+// [BufferPool.loadPage]).
+//
+// Caller must not hold the latch of any partition.
+func (bp *BufferPool) flushPage(page Page) error {
+	file := page.getFile()
+	start := time.Now()
+	err := file.flushPage(page)
+	elapsed := time.Since(start)
+	if lp, ok := page.(loggedPage); ok {
+		p := bp.partition(file.pageKey(lp.PageNo()))
+		p.Lock()
+		p.generation++
+		p.Unlock()
+	}
+	bp.counters.updateFile(file, func(f *FileStats) {
+		f.Writes++
+		f.WriteTime += elapsed
+	})
+	return err
+}
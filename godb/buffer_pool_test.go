@@ -1,14 +1,16 @@
 package godb
 
 import (
+	"fmt"
 	"os"
+	"sync"
 	"testing"
 )
 
 func TestBufferPoolGetPage(t *testing.T) {
 	_, t1, t2, hf, bp, _ := makeTestVars(t)
 	tid := NewTID()
-	for i := 0; i < 300; i++ {
+	for i := 0; i < 500; i++ {
 		bp.BeginTransaction(tid)
 		err := hf.insertTuple(&t1, tid)
 		if err != nil {
@@ -92,3 +94,180 @@ func TestBufferPoolHoldsMultipleHeapFiles(t *testing.T) {
 		t.Errorf("should cause bufferpool dirty page overflow here")
 	}
 }
+
+func TestBufferPoolPinnedPagesNotEvicted(t *testing.T) {
+	bp, hf := makeTestFile(t, 100)
+	td, _, _ := makeTupleTestVars()
+	fillPagesForTest(t, bp, hf, 3)
+
+	// a buffer pool with room for two pages
+	bp = makePolicyTestBufferPool(t, 2, NewLRUPolicy())
+	hf, err := NewHeapFile(TestingFile, &td, bp)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	tid := BeginTransactionForTest(t, bp)
+	pg0, err := bp.PinPage(hf, 0, tid, ReadPerm)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	pg1, err := bp.PinPage(hf, 1, tid, ReadPerm)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	_, err = bp.GetPage(hf, 2, tid, ReadPerm)
+	if gdbErr, ok := err.(GoDBError); !ok || gdbErr.code != BufferPoolFullError {
+		t.Fatalf("expected a BufferPoolFullError when every page is pinned, got %v", err)
+	}
+
+	// releasing a pin makes its page the only one that can be evicted
+	pg0.Release()
+	pg0.Release()
+	if _, err := bp.GetPage(hf, 2, tid, ReadPerm); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if _, ok := bp.cachedPage(hf.pageKey(0)); ok {
+		t.Errorf("expected the unpinned page to be evicted")
+	}
+	if pg, _ := bp.cachedPage(hf.pageKey(1)); pg != pg1.Page {
+		t.Errorf("expected the pinned page to stay in the buffer pool")
+	}
+	pg1.Release()
+
+	// an iterator pins the page it is reading; with one page pinned by
+	// another handle, it can still read every page
+	pg2, err := bp.PinPage(hf, 2, tid, ReadPerm)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	iter, err := hf.Iterator(tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if tup, err := iter(); err != nil || tup == nil {
+		t.Fatalf("expected a tuple from the iterator, got %v (err = %v)", tup, err)
+	}
+	if bp.pinCount(hf.pageKey(0)) != 1 {
+		t.Errorf("expected the iterator to pin the page it is reading")
+	}
+	if _, err := bp.GetPage(hf, 1, tid, ReadPerm); err == nil {
+		t.Errorf("expected the page pinned by the iterator not to be evicted")
+	}
+	cnt := 1
+	for {
+		tup, err := iter()
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if tup == nil {
+			break
+		}
+		cnt++
+	}
+	if bp.numPinnedPages() != 1 || bp.pinCount(hf.pageKey(2)) != 1 {
+		t.Errorf("expected only the page pinned by the handle to be pinned after the scan, got %d pinned pages", bp.numPinnedPages())
+	}
+
+	// pins that are still held when the transaction commits are released
+	iter, err = hf.Iterator(tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if _, err := iter(); err != nil {
+		t.Fatalf(err.Error())
+	}
+	bp.CommitTransaction(tid)
+	pg2.Release()
+	if bp.numPinnedPages() != 0 {
+		t.Errorf("expected no pages to be pinned after commit, got %d", bp.numPinnedPages())
+	}
+}
+
+func TestBufferPoolStats(t *testing.T) {
+	bp, hf := makeTestFile(t, 100)
+	td, _, _ := makeTupleTestVars()
+	fillPagesForTest(t, bp, hf, 3)
+	if s := bp.Stats(); s.DirtyFlushes != 3 || s.Files[hf.BackingFile()].Writes < 3 {
+		t.Errorf("expected the 3 dirty pages to be flushed, got %d dirty flushes and %d writes", s.DirtyFlushes, s.Files[hf.BackingFile()].Writes)
+	}
+
+	bp = makePolicyTestBufferPool(t, 2, NewLRUPolicy())
+	hf, err := NewHeapFile(TestingFile, &td, bp)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	tid := BeginTransactionForTest(t, bp)
+	defer bp.CommitTransaction(tid)
+	for _, p := range []int{0, 1, 0, 2} {
+		if _, err := bp.GetPage(hf, p, tid, ReadPerm); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	s := bp.Stats()
+	if s.Hits != 1 || s.Misses != 3 || s.Evictions != 1 || s.DirtyFlushes != 0 {
+		t.Errorf("expected 1 hit, 3 misses, 1 eviction and no flushes, got %+v", s)
+	}
+	if f := s.Files[hf.BackingFile()]; f.Reads != 3 || f.Writes != 0 || f.ReadTime <= 0 {
+		t.Errorf("expected 3 timed reads and no writes of %s, got %+v", hf.BackingFile(), f)
+	}
+	if s.Total().Reads != 3 {
+		t.Errorf("expected 3 reads in total, got %d", s.Total().Reads)
+	}
+
+	bp.ResetStats()
+	if s := bp.Stats(); s.Hits != 0 || s.Misses != 0 || len(s.Files) != 0 {
+		t.Errorf("expected the statistics to be reset, got %+v", s)
+	}
+}
+
+func TestBufferPoolConcurrentReaders(t *testing.T) {
+	bp, hf := makeTestFile(t, 100)
+	td, _, _ := makeTupleTestVars()
+	fillPagesForTest(t, bp, hf, 20)
+
+	// a buffer pool with room for half of the pages, so that the readers
+	// evict each other's pages
+	bp = makePolicyTestBufferPool(t, 10, NewClockPolicy())
+	hf, err := NewHeapFile(TestingFile, &td, bp)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	const numReaders = 8
+	errs := make(chan error, numReaders)
+	var wg sync.WaitGroup
+	for r := 0; r < numReaders; r++ {
+		wg.Add(1)
+		go func(r int) {
+			defer wg.Done()
+			tid := NewTID()
+			if err := bp.BeginTransaction(tid); err != nil {
+				errs <- err
+				return
+			}
+			defer bp.CommitTransaction(tid)
+			for i := 0; i < 3*hf.NumPages(); i++ {
+				pageNo := (i + r) % hf.NumPages()
+				pg, err := bp.PinPage(hf, pageNo, tid, ReadPerm)
+				if err != nil {
+					errs <- err
+					return
+				}
+				if n := pg.Page.(*heapPage).PageNo(); n != pageNo {
+					errs <- fmt.Errorf("expected page %d, got page %d", pageNo, n)
+				}
+				pg.Release()
+			}
+		}(r)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("reader failed: %v", err)
+	}
+	if n := bp.numCachedPages(); n > 10 {
+		t.Errorf("expected at most 10 pages in the buffer pool, got %d", n)
+	}
+	if bp.numPinnedPages() != 0 {
+		t.Errorf("expected no pages to be pinned after the readers committed, got %d", bp.numPinnedPages())
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"regexp"
 	"sort"
 	"strings"
 )
@@ -20,9 +21,24 @@ type Table struct {
 	file DBFile
 }
 
+// An index on a field of a table.
+type IndexInfo struct {
+	id    int
+	name  string
+	table string
+	field string
+	kind  string // the type of index, btree or hash
+	file  Index
+}
+
+// Indexes are identified in the log by ids starting from indexFileIdBase, so
+// that they don't collide with the ids of tables.
+const indexFileIdBase = 1 << 20
+
 type Catalog struct {
 	tableMap   map[string]*Table
 	columnMap  map[string][]*Table
+	indexMap   map[string]*IndexInfo
 	bufferPool *BufferPool
 	rootPath   string
 	filePath   string
@@ -39,11 +55,21 @@ func (c *Catalog) SaveToFile(catalogFile string, rootPath string) error {
 }
 
 func (c *Catalog) dropTable(tableName string) error {
-	_, ok := c.tableMap[tableName]
+	t, ok := c.tableMap[tableName]
 	if !ok {
 		return GoDBError{NoSuchTableError, "couldn't find table to drop"}
 	}
+	if hf, ok := t.file.(*HeapFile); ok {
+		if err := c.bufferPool.dropFile(hf); err != nil {
+			return err
+		}
+	}
 
+	for name, idx := range c.indexMap {
+		if idx.table == tableName {
+			delete(c.indexMap, name)
+		}
+	}
 	delete(c.tableMap, tableName)
 	for cn, ts := range c.columnMap {
 		tsFiltered := make([]*Table, 0)
@@ -96,13 +122,20 @@ func (c *Catalog) parseCatalogFile() error {
 	for scanner.Scan() {
 		// code to read each line
 		line := strings.ToLower(scanner.Text())
-		sep := strings.Split(line, "(")
-		if len(sep) != 2 {
-			return GoDBError{ParseError, fmt.Sprintf("expected one paren in catalog entry, got %d (%s)", len(sep), line)}
+		if m := catalogIndexRegexp.FindStringSubmatch(line); m != nil {
+			if _, err := c.addIndex(m[1], m[2], m[3], m[4]); err != nil {
+				return err
+			}
+			continue
+		}
+		// field types may have parens too, e.g., decimal(10,2)
+		sep := strings.SplitN(line, "(", 2)
+		if len(sep) != 2 || !strings.HasSuffix(strings.TrimSpace(sep[1]), ")") {
+			return GoDBError{ParseError, fmt.Sprintf("expected parens around fields in catalog entry (%s)", line)}
 		}
 		tableName := strings.TrimSpace(sep[0])
-		rest := strings.Trim(sep[1], "()")
-		fields := strings.Split(rest, ",")
+		rest := strings.TrimSuffix(strings.TrimSpace(sep[1]), ")")
+		fields := splitCatalogFields(rest)
 
 		var fieldArray []FieldType
 		for _, f := range fields {
@@ -125,8 +158,31 @@ func (c *Catalog) parseCatalogFile() error {
 				fallthrough
 			case "text":
 				fieldType.Ftype = StringType
+			case "float":
+				fallthrough
+			case "double":
+				fallthrough
+			case "real":
+				fieldType.Ftype = FloatType
+			case "date":
+				fieldType.Ftype = DateType
+			case "timestamp":
+				fallthrough
+			case "datetime":
+				fieldType.Ftype = TimestampType
+			case "interval":
+				fieldType.Ftype = IntervalType
 			default:
-				return GoDBError{ParseError, fmt.Sprintf("unknown type %s (line %s)", nameType[1], line)}
+				// the precision and scale of a decimal may be separated by
+				// spaces
+				decimalType, ok, err := parseDecimalType(strings.Join(nameType[1:], ""))
+				if err != nil {
+					return GoDBError{ParseError, fmt.Sprintf("%s (line %s)", err.(GoDBError).errString, line)}
+				}
+				if !ok {
+					return GoDBError{ParseError, fmt.Sprintf("unknown type %s (line %s)", nameType[1], line)}
+				}
+				fieldType.Ftype = decimalType
 			}
 			fieldArray = append(fieldArray, fieldType)
 		}
@@ -140,8 +196,33 @@ func (c *Catalog) parseCatalogFile() error {
 	return nil
 }
 
+// Indexes are listed in the catalog file after the table they are on, e.g.,
+// "index t_age on t(age) using btree".
+var catalogIndexRegexp = regexp.MustCompile(`^\s*index\s+(\w+)\s+on\s+(\w+)\s*\(\s*(\w+)\s*\)\s+using\s+(\w+)\s*$`)
+
+// Split the fields of a catalog entry on the commas that aren't inside the
+// parens of a field type.
+func splitCatalogFields(s string) []string {
+	var fields []string
+	depth, start := 0, 0
+	for i, c := range s {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				fields = append(fields, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(fields, s[start:])
+}
+
 func NewCatalog(catalogFile string, bp *BufferPool, rootPath string) *Catalog {
-	return &Catalog{make(map[string]*Table), make(map[string][]*Table), bp, rootPath, catalogFile}
+	return &Catalog{make(map[string]*Table), make(map[string][]*Table), make(map[string]*IndexInfo), bp, rootPath, catalogFile}
 }
 
 func NewCatalogFromFile(catalogFile string, bp *BufferPool, rootPath string) (*Catalog, error) {
@@ -152,6 +233,35 @@ func NewCatalogFromFile(catalogFile string, bp *BufferPool, rootPath string) (*C
 	return c, nil
 }
 
+// Construct a catalog from the header pages of the table files in rootPath,
+// e.g., to rebuild a catalog file that was lost. Each file with a .dat suffix
+// is added as a table named after the file. Indexes are not recorded in the
+// table files, so they need to be created again. The catalog can be written
+// with [Catalog.SaveToFile].
+//
+// Returns an error if one of the files is not a heap file.
+func NewCatalogFromDataFiles(catalogFile string, bp *BufferPool, rootPath string) (*Catalog, error) {
+	c := NewCatalog(catalogFile, bp, rootPath)
+	entries, err := os.ReadDir(rootPath)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		name, ok := strings.CutSuffix(e.Name(), ".dat")
+		if !ok || e.IsDir() {
+			continue
+		}
+		td, err := readHeapFileHeader(c.tableNameToFile(name))
+		if err != nil {
+			return nil, err
+		}
+		if _, err := c.addTable(name, *td); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
 // Add a new table to the catalog.
 //
 // Returns an error if the table already exists.
@@ -179,6 +289,120 @@ func (c *Catalog) addTable(named string, desc TupleDesc) (DBFile, error) {
 	return hf, nil
 }
 
+// Add an index of the specified kind on a field of a table to the catalog. The
+// index is opened from its backing file, which may be empty or an index
+// created previously; use [Catalog.createIndex] to build a new index from the
+// contents of the table.
+//
+// Returns an error if the index already exists, or if the table or field
+// doesn't exist.
+func (c *Catalog) addIndex(name string, tableName string, field string, kind string) (Index, error) {
+	if _, ok := c.indexMap[name]; ok {
+		return nil, GoDBError{DuplicateTableError, fmt.Sprintf("an index named '%s' already exists", name)}
+	}
+	t, err := c.GetTableInfo(tableName)
+	if err != nil {
+		return nil, err
+	}
+	hf, ok := t.file.(*HeapFile)
+	if !ok {
+		return nil, GoDBError{IllegalOperationError, fmt.Sprintf("table '%s' cannot be indexed", tableName)}
+	}
+	idx, err := newIndexFile(kind, c.indexNameToFile(name), hf, field, c.bufferPool)
+	if err != nil {
+		return nil, err
+	}
+
+	id := indexFileIdBase
+	for _, i := range c.indexMap {
+		if i.id >= id {
+			id = i.id + 1
+		}
+	}
+	c.indexMap[name] = &IndexInfo{id, name, tableName, field, kind, idx}
+	hf.addIndex(idx)
+	return idx, nil
+}
+
+// Create a new index of the specified kind on a field of a table, and build
+// it from the tuples in the table.
+func (c *Catalog) createIndex(name string, tableName string, field string, kind string) error {
+	if _, ok := c.indexMap[name]; ok {
+		return GoDBError{DuplicateTableError, fmt.Sprintf("an index named '%s' already exists", name)}
+	}
+	// remove the file of any index that was dropped with the same name
+	os.Remove(c.indexNameToFile(name))
+	idx, err := c.addIndex(name, tableName, field, kind)
+	if err != nil {
+		return err
+	}
+	hf, _ := c.GetTable(tableName)
+	if err := buildIndex(c.bufferPool, idx, hf.(*HeapFile)); err != nil {
+		c.dropIndex(name, tableName)
+		return err
+	}
+	return nil
+}
+
+// Remove an index from the catalog. If tableName is not empty, the index must
+// be on that table.
+func (c *Catalog) dropIndex(name string, tableName string) error {
+	idx, ok := c.indexMap[name]
+	if !ok || (tableName != "" && idx.table != tableName) {
+		return GoDBError{NoSuchTableError, fmt.Sprintf("no index '%s' found", name)}
+	}
+	if hf, err := c.GetTable(idx.table); err == nil {
+		hf.(*HeapFile).removeIndex(idx.file)
+	}
+	delete(c.indexMap, name)
+	return nil
+}
+
+func (c *Catalog) indexNameToFile(indexName string) string {
+	return c.rootPath + "/" + indexName + ".idx"
+}
+
+// Get the catalog entry for an index.
+func (c *Catalog) GetIndexInfo(named string) (*IndexInfo, error) {
+	idx, ok := c.indexMap[named]
+	if !ok {
+		return nil, GoDBError{NoSuchTableError, fmt.Sprintf("no index '%s' found", named)}
+	}
+	return idx, nil
+}
+
+// Return the id of a table or index file, which identifies the file in the
+// log.
+func (c *Catalog) fileId(f DBFile) (int, error) {
+	for _, idx := range c.indexMap {
+		if idx.file == f {
+			return idx.id, nil
+		}
+	}
+	t, err := c.GetTableInfoDBFile(f)
+	if err != nil {
+		return 0, err
+	}
+	return t.id, nil
+}
+
+// Return the table or index file with the specified id.
+func (c *Catalog) fileById(id int) (DBFile, error) {
+	if id >= indexFileIdBase {
+		for _, idx := range c.indexMap {
+			if idx.id == id {
+				return idx.file, nil
+			}
+		}
+		return nil, GoDBError{NoSuchTableError, fmt.Sprintf("no index '%d' found", id)}
+	}
+	t, err := c.GetTableInfoId(id)
+	if err != nil {
+		return nil, err
+	}
+	return t.file, nil
+}
+
 func (c *Catalog) ComputeTableStats() error {
 	for _, t := range c.tableMap {
 		stats, err := ComputeTableStats(c.bufferPool, t.file)
@@ -202,6 +426,15 @@ func (c *Catalog) GetTableInfo(named string) (*Table, error) {
 	return t, nil
 }
 
+// Return the memory manager of the catalog's buffer pool, which limits the
+// memory used by the operators of its queries, or nil if there is none.
+func (c *Catalog) memoryManager() *MemoryManager {
+	if c.bufferPool == nil {
+		return nil
+	}
+	return c.bufferPool.MemoryManager()
+}
+
 func (c *Catalog) GetTable(named string) (DBFile, error) {
 	t, err := c.GetTableInfo(named)
 	if err != nil {
@@ -248,19 +481,11 @@ func (c *Catalog) NumTables() int {
 }
 
 func (t *Table) String() string {
-	var buf strings.Builder
-	buf.WriteString(t.name)
-	buf.WriteByte('(')
-	for i, f := range t.desc.Fields {
-		if i != 0 {
-			buf.WriteString(", ")
-		}
-		buf.WriteString(f.Fname)
-		buf.WriteByte(' ')
-		buf.WriteString(f.Ftype.String())
-	}
-	buf.WriteString(")\n")
-	return buf.String()
+	return t.name + schemaString(&t.desc) + "\n"
+}
+
+func (idx *IndexInfo) String() string {
+	return fmt.Sprintf("index %s on %s(%s) using %s\n", idx.name, idx.table, idx.field, idx.kind)
 }
 
 func (c *Catalog) String() string {
@@ -273,6 +498,16 @@ func (c *Catalog) String() string {
 	for _, t := range keys {
 		buf.WriteString(c.tableMap[t].String())
 	}
+	// indexes are written after all of the tables, so that the tables exist
+	// when the indexes are loaded
+	keys = keys[:0]
+	for k := range c.indexMap {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, idx := range keys {
+		buf.WriteString(c.indexMap[idx].String())
+	}
 	return buf.String()
 }
 
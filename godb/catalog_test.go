@@ -1,6 +1,7 @@
 package godb
 
 import (
+	"os"
 	"testing"
 )
 
@@ -15,3 +16,88 @@ func TestNewCatalogFromFile(t *testing.T) {
 		t.Errorf("unexpected catalog: %#v", s)
 	}
 }
+
+func TestNewCatalogFromFileFloat(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir+"/catalog.txt", "readings (sensor string, value float, error double, scale real)\n")
+	c := NewCatalog("catalog.txt", nil, dir)
+	if err := c.parseCatalogFile(); err != nil {
+		t.Fatalf("failed to parse catalog file, %s", err.Error())
+	}
+	s := c.String()
+	if s != "readings(sensor string, value float, error float, scale float)\n" {
+		t.Errorf("unexpected catalog: %#v", s)
+	}
+}
+
+func TestNewCatalogFromFileDecimal(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir+"/catalog.txt", "orders (id int, total decimal(10,2), rate numeric(8, 4), qty decimal)\n")
+	c := NewCatalog("catalog.txt", nil, dir)
+	if err := c.parseCatalogFile(); err != nil {
+		t.Fatalf("failed to parse catalog file, %s", err.Error())
+	}
+	s := c.String()
+	if s != "orders(id int, total decimal(10,2), rate decimal(8,4), qty decimal(18,0))\n" {
+		t.Errorf("unexpected catalog: %#v", s)
+	}
+
+	// the catalog must be readable after it is saved
+	writeFile(t, dir+"/catalog.txt", s)
+	c = NewCatalog("catalog.txt", nil, dir)
+	if err := c.parseCatalogFile(); err != nil {
+		t.Fatalf("failed to parse saved catalog file, %s", err.Error())
+	}
+	if c.String() != s {
+		t.Errorf("catalog changed after saving: %#v", c.String())
+	}
+}
+
+func TestNewCatalogFromFileIndex(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir+"/catalog.txt", "people (name string, age int)\nindex people_age on people(age) using btree\n")
+	c := NewCatalog("catalog.txt", nil, dir)
+	if err := c.parseCatalogFile(); err != nil {
+		t.Fatalf("failed to parse catalog file, %s", err.Error())
+	}
+	s := c.String()
+	if s != "people(name string, age int)\nindex people_age on people(age) using btree\n" {
+		t.Errorf("unexpected catalog: %#v", s)
+	}
+	hf, _ := c.GetTable("people")
+	if len(hf.(*HeapFile).getIndexes()) != 1 {
+		t.Errorf("expected the index to be attached to its table")
+	}
+
+	writeFile(t, dir+"/catalog.txt", "index people_age on missing(age) using btree\n")
+	c = NewCatalog("catalog.txt", nil, dir)
+	if err := c.parseCatalogFile(); err == nil {
+		t.Errorf("expected an index on a missing table to fail")
+	}
+}
+
+func TestDropTableRemovesFiles(t *testing.T) {
+	dir := t.TempDir()
+	bp, err := NewBufferPool(10)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	c := NewCatalog("catalog.txt", bp, dir)
+	td, _, _ := makeTupleTestVars()
+	if _, err := c.addTable("t", td); err != nil {
+		t.Fatalf(err.Error())
+	}
+	for _, file := range []string{c.tableNameToFile("t"), c.tableNameToFile("t") + ".fsm"} {
+		if _, err := os.Stat(file); err != nil {
+			t.Fatalf("expected %s to exist, %s", file, err.Error())
+		}
+	}
+	if err := c.dropTable("t"); err != nil {
+		t.Fatalf(err.Error())
+	}
+	for _, file := range []string{c.tableNameToFile("t"), c.tableNameToFile("t") + ".fsm"} {
+		if _, err := os.Stat(file); !os.IsNotExist(err) {
+			t.Errorf("expected %s of the dropped table to be deleted, got %v", file, err)
+		}
+	}
+}
@@ -0,0 +1,456 @@
+package godb
+
+// This file implements the DATE, TIMESTAMP and INTERVAL types: parsing and
+// formatting of literals, comparison, and the arithmetic, EXTRACT and
+// DATE_TRUNC functions registered in exprs.go.
+//
+// All times are in UTC; GoDB does not support time zones.
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	microsPerSecond int64 = 1000000
+	microsPerMinute int64 = 60 * microsPerSecond
+	microsPerHour   int64 = 60 * microsPerMinute
+	microsPerDay    int64 = 24 * microsPerHour
+
+	// Used to order intervals with different units, as in PostgreSQL
+	daysPerMonth int64 = 30
+)
+
+const dateLayout = "2006-01-02"
+
+// Layouts accepted for timestamp literals, in the order they are tried.
+var timestampLayouts = []string{
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+	time.RFC3339Nano,
+	"2006-01-02 15:04",
+	dateLayout,
+}
+
+// Integer division that rounds towards negative infinity, so that times before
+// the epoch fall in the correct day.
+func floorDiv(a, b int64) int64 {
+	q := a / b
+	if (a%b != 0) && ((a < 0) != (b < 0)) {
+		q--
+	}
+	return q
+}
+
+func (d DateField) toTime() time.Time {
+	return time.Unix(d.Value*(microsPerDay/microsPerSecond), 0).UTC()
+}
+
+func (d DateField) toTimestamp() TimestampField {
+	return TimestampField{d.Value * microsPerDay}
+}
+
+func (ts TimestampField) toTime() time.Time {
+	return time.UnixMicro(ts.Value).UTC()
+}
+
+func (ts TimestampField) toDate() DateField {
+	return DateField{floorDiv(ts.Value, microsPerDay)}
+}
+
+func timeToTimestamp(t time.Time) TimestampField {
+	return TimestampField{t.UnixMicro()}
+}
+
+func (d DateField) String() string {
+	return d.toTime().Format(dateLayout)
+}
+
+func (ts TimestampField) String() string {
+	return ts.toTime().Format("2006-01-02 15:04:05.999999")
+}
+
+// Format an interval in the style of PostgreSQL, e.g., "1 year 2 mons 3 days
+// 04:05:06".
+func (iv IntervalField) String() string {
+	var parts []string
+	plural := func(n int64, unit string) string {
+		if n == 1 {
+			return fmt.Sprintf("%d %s", n, unit)
+		}
+		return fmt.Sprintf("%d %ss", n, unit)
+	}
+	years := int64(iv.Months) / 12
+	months := int64(iv.Months) % 12
+	if years != 0 {
+		parts = append(parts, plural(years, "year"))
+	}
+	if months != 0 {
+		parts = append(parts, plural(months, "mon"))
+	}
+	if iv.Days != 0 {
+		parts = append(parts, plural(int64(iv.Days), "day"))
+	}
+	if iv.Micros != 0 || len(parts) == 0 {
+		micros := iv.Micros
+		sign := ""
+		if micros < 0 {
+			sign = "-"
+			micros = -micros
+		}
+		str := fmt.Sprintf("%s%02d:%02d:%02d", sign, micros/microsPerHour, (micros%microsPerHour)/microsPerMinute, (micros%microsPerMinute)/microsPerSecond)
+		if frac := micros % microsPerSecond; frac != 0 {
+			str = str + strings.TrimRight(fmt.Sprintf(".%06d", frac), "0")
+		}
+		parts = append(parts, str)
+	}
+	return strings.Join(parts, " ")
+}
+
+// Approximate length of the interval in microseconds, treating a month as 30
+// days. Used to compare intervals.
+func (iv IntervalField) approxMicros() int64 {
+	return (int64(iv.Months)*daysPerMonth+int64(iv.Days))*microsPerDay + iv.Micros
+}
+
+// Parse a date literal of the form YYYY-MM-DD.
+func parseDate(s string) (DateField, error) {
+	t, err := time.Parse(dateLayout, strings.TrimSpace(s))
+	if err != nil {
+		return DateField{}, GoDBError{TypeMismatchError, fmt.Sprintf("invalid date '%s', expected YYYY-MM-DD", s)}
+	}
+	return DateField{floorDiv(t.Unix(), microsPerDay/microsPerSecond)}, nil
+}
+
+// Parse a timestamp literal, e.g., 2026-01-01 12:30:00. A date alone is
+// midnight of that date.
+func parseTimestamp(s string) (TimestampField, error) {
+	s = strings.TrimSpace(s)
+	for _, layout := range timestampLayouts {
+		t, err := time.Parse(layout, s)
+		if err == nil {
+			return timeToTimestamp(t), nil
+		}
+	}
+	return TimestampField{}, GoDBError{TypeMismatchError, fmt.Sprintf("invalid timestamp '%s', expected YYYY-MM-DD HH:MM:SS", s)}
+}
+
+// Number of months, days or microseconds in each interval unit. Exactly one
+// of the values is non-zero.
+type intervalUnit struct {
+	months int64
+	days   int64
+	micros int64
+}
+
+var intervalUnits = map[string]intervalUnit{
+	"microsecond": {0, 0, 1},
+	"millisecond": {0, 0, 1000},
+	"second":      {0, 0, microsPerSecond},
+	"sec":         {0, 0, microsPerSecond},
+	"minute":      {0, 0, microsPerMinute},
+	"min":         {0, 0, microsPerMinute},
+	"hour":        {0, 0, microsPerHour},
+	"day":         {0, 1, 0},
+	"week":        {0, 7, 0},
+	"month":       {1, 0, 0},
+	"mon":         {1, 0, 0},
+	"quarter":     {3, 0, 0},
+	"year":        {12, 0, 0},
+}
+
+// Parse an interval literal, e.g., "1 year 2 months 3 days 04:05:06" or
+// "90 minutes". Quantities of months and days must be whole numbers.
+func parseInterval(s string) (IntervalField, error) {
+	var iv IntervalField
+	badInterval := GoDBError{TypeMismatchError, fmt.Sprintf("invalid interval '%s'", s)}
+	tokens := strings.Fields(strings.ToLower(s))
+	if len(tokens) == 0 {
+		return iv, badInterval
+	}
+	for i := 0; i < len(tokens); i++ {
+		tok := tokens[i]
+		if strings.Contains(tok, ":") {
+			micros, err := parseIntervalTime(tok)
+			if err != nil {
+				return iv, badInterval
+			}
+			iv.Micros += micros
+			continue
+		}
+		n, err := strconv.ParseFloat(tok, 64)
+		if err != nil || i+1 >= len(tokens) {
+			return iv, badInterval
+		}
+		i++
+		unit, ok := intervalUnits[strings.TrimSuffix(tokens[i], "s")]
+		if !ok {
+			return iv, badInterval
+		}
+		if unit.micros != 0 {
+			iv.Micros += int64(n * float64(unit.micros))
+		} else if n != float64(int64(n)) {
+			return iv, GoDBError{TypeMismatchError, fmt.Sprintf("fractional %s in interval '%s' not supported", tokens[i], s)}
+		} else {
+			iv.Months += int32(int64(n) * unit.months)
+			iv.Days += int32(int64(n) * unit.days)
+		}
+	}
+	return iv, nil
+}
+
+// Parse the time part of an interval, [-]HH:MM[:SS[.ffffff]], into
+// microseconds.
+func parseIntervalTime(s string) (int64, error) {
+	sign := int64(1)
+	if strings.HasPrefix(s, "-") {
+		sign = -1
+		s = s[1:]
+	}
+	parts := strings.Split(s, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return 0, fmt.Errorf("malformed time %s", s)
+	}
+	hours, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	minutes, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	var seconds float64
+	if len(parts) == 3 {
+		seconds, err = strconv.ParseFloat(parts[2], 64)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return sign * (hours*microsPerHour + minutes*microsPerMinute + int64(seconds*float64(microsPerSecond))), nil
+}
+
+// Parse a string into a value of a date or time type. Returns an error if t is
+// not a date or time type.
+func parseDateTimeValue(s string, t DBType) (DBValue, error) {
+	switch t {
+	case DateType:
+		return parseDate(s)
+	case TimestampType:
+		return parseTimestamp(s)
+	case IntervalType:
+		return parseInterval(s)
+	}
+	return nil, GoDBError{TypeMismatchError, fmt.Sprintf("%s is not a date or time type", t)}
+}
+
+// Add an interval to a timestamp. Months are added first, and if the day of
+// the month doesn't exist in the resulting month, the last day of the month is
+// used instead (e.g., Jan 31 + 1 month is Feb 28 or 29).
+func addInterval(ts TimestampField, iv IntervalField) TimestampField {
+	t := ts.toTime()
+	if iv.Months != 0 {
+		year, month, day := t.Date()
+		totalMonths := int64(year)*12 + int64(month-1) + int64(iv.Months)
+		year = int(floorDiv(totalMonths, 12))
+		month = time.Month(totalMonths-int64(year)*12) + 1
+		lastDay := time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+		day = min(day, lastDay)
+		t = time.Date(year, month, day, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+	}
+	return TimestampField{timeToTimestamp(t).Value + int64(iv.Days)*microsPerDay + iv.Micros}
+}
+
+func negateInterval(iv IntervalField) IntervalField {
+	return IntervalField{-iv.Months, -iv.Days, -iv.Micros}
+}
+
+// Functions registered in funcs. Dates are passed as int64 days since the
+// epoch, timestamps as int64 microseconds since the epoch and intervals as
+// IntervalFields.
+
+func dateFunc(args []any) any {
+	d, err := parseDate(args[0].(string))
+	if err != nil {
+		return err
+	}
+	return d.Value
+}
+
+func timestampToDateFunc(args []any) any {
+	return TimestampField{args[0].(int64)}.toDate().Value
+}
+
+func timestampFunc(args []any) any {
+	ts, err := parseTimestamp(args[0].(string))
+	if err != nil {
+		return err
+	}
+	return ts.Value
+}
+
+func dateToTimestampFunc(args []any) any {
+	return DateField{args[0].(int64)}.toTimestamp().Value
+}
+
+func intervalFunc(args []any) any {
+	iv, err := parseInterval(args[0].(string))
+	if err != nil {
+		return err
+	}
+	return iv
+}
+
+func addDaysFunc(args []any) any {
+	return args[0].(int64) + args[1].(int64)
+}
+
+func minusDaysFunc(args []any) any {
+	return args[0].(int64) - args[1].(int64)
+}
+
+func dateDiffFunc(args []any) any {
+	return args[0].(int64) - args[1].(int64)
+}
+
+func addDateIntervalFunc(args []any) any {
+	ts := DateField{args[0].(int64)}.toTimestamp()
+	return addInterval(ts, args[1].(IntervalField)).Value
+}
+
+func minusDateIntervalFunc(args []any) any {
+	ts := DateField{args[0].(int64)}.toTimestamp()
+	return addInterval(ts, negateInterval(args[1].(IntervalField))).Value
+}
+
+func addTimestampIntervalFunc(args []any) any {
+	return addInterval(TimestampField{args[0].(int64)}, args[1].(IntervalField)).Value
+}
+
+func minusTimestampIntervalFunc(args []any) any {
+	return addInterval(TimestampField{args[0].(int64)}, negateInterval(args[1].(IntervalField))).Value
+}
+
+// The difference between two timestamps, as days and a time.
+func timestampDiffFunc(args []any) any {
+	diff := args[0].(int64) - args[1].(int64)
+	return IntervalField{0, int32(diff / microsPerDay), diff % microsPerDay}
+}
+
+func addIntervalsFunc(args []any) any {
+	iv1 := args[0].(IntervalField)
+	iv2 := args[1].(IntervalField)
+	return IntervalField{iv1.Months + iv2.Months, iv1.Days + iv2.Days, iv1.Micros + iv2.Micros}
+}
+
+func minusIntervalsFunc(args []any) any {
+	iv1 := args[0].(IntervalField)
+	iv2 := negateInterval(args[1].(IntervalField))
+	return IntervalField{iv1.Months + iv2.Months, iv1.Days + iv2.Days, iv1.Micros + iv2.Micros}
+}
+
+func timesIntervalFunc(args []any) any {
+	iv := args[0].(IntervalField)
+	n := args[1].(int64)
+	return IntervalField{iv.Months * int32(n), iv.Days * int32(n), iv.Micros * n}
+}
+
+// EXTRACT(field, timestamp). Supported fields are year, quarter, month, week
+// (ISO week number), day, dow (0 is Sunday), doy, hour, minute, second and
+// epoch (seconds since the Unix epoch).
+func extractTimestampFunc(args []any) any {
+	field := strings.ToLower(args[0].(string))
+	micros := args[1].(int64)
+	t := TimestampField{micros}.toTime()
+	switch field {
+	case "year":
+		return int64(t.Year())
+	case "quarter":
+		return int64(t.Month()-1)/3 + 1
+	case "month":
+		return int64(t.Month())
+	case "week":
+		_, week := t.ISOWeek()
+		return int64(week)
+	case "day":
+		return int64(t.Day())
+	case "dow":
+		return int64(t.Weekday())
+	case "doy":
+		return int64(t.YearDay())
+	case "hour":
+		return int64(t.Hour())
+	case "minute":
+		return int64(t.Minute())
+	case "second":
+		return int64(t.Second())
+	case "epoch":
+		return floorDiv(micros, microsPerSecond)
+	}
+	return GoDBError{ParseError, fmt.Sprintf("unsupported field '%s' in extract", field)}
+}
+
+func extractDateFunc(args []any) any {
+	ts := DateField{args[1].(int64)}.toTimestamp()
+	return extractTimestampFunc([]any{args[0], ts.Value})
+}
+
+// EXTRACT(field, interval). Supported fields are year, month, day, hour,
+// minute, second and epoch (total seconds, treating a month as 30 days).
+func extractIntervalFunc(args []any) any {
+	field := strings.ToLower(args[0].(string))
+	iv := args[1].(IntervalField)
+	switch field {
+	case "year":
+		return int64(iv.Months / 12)
+	case "month":
+		return int64(iv.Months % 12)
+	case "day":
+		return int64(iv.Days)
+	case "hour":
+		return iv.Micros / microsPerHour
+	case "minute":
+		return (iv.Micros % microsPerHour) / microsPerMinute
+	case "second":
+		return (iv.Micros % microsPerMinute) / microsPerSecond
+	case "epoch":
+		return iv.approxMicros() / microsPerSecond
+	}
+	return GoDBError{ParseError, fmt.Sprintf("unsupported field '%s' in extract", field)}
+}
+
+// DATE_TRUNC(unit, timestamp). Truncates the timestamp to the start of the
+// year, quarter, month, week (starting Monday), day, hour, minute or second.
+func dateTruncFunc(args []any) any {
+	unit := strings.ToLower(args[0].(string))
+	t := TimestampField{args[1].(int64)}.toTime()
+	year, month, day := t.Date()
+	switch unit {
+	case "year":
+		t = time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC)
+	case "quarter":
+		t = time.Date(year, month-(month-1)%3, 1, 0, 0, 0, 0, time.UTC)
+	case "month":
+		t = time.Date(year, month, 1, 0, 0, 0, 0, time.UTC)
+	case "week":
+		daysSinceMonday := (int(t.Weekday()) + 6) % 7
+		t = time.Date(year, month, day-daysSinceMonday, 0, 0, 0, 0, time.UTC)
+	case "day":
+		t = time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	case "hour":
+		t = t.Truncate(time.Hour)
+	case "minute":
+		t = t.Truncate(time.Minute)
+	case "second":
+		t = t.Truncate(time.Second)
+	default:
+		return GoDBError{ParseError, fmt.Sprintf("unsupported unit '%s' in date_trunc", unit)}
+	}
+	return timeToTimestamp(t).Value
+}
+
+func dateTruncDateFunc(args []any) any {
+	ts := DateField{args[1].(int64)}.toTimestamp()
+	return dateTruncFunc([]any{args[0], ts.Value})
+}
@@ -0,0 +1,160 @@
+package godb
+
+import (
+	"testing"
+)
+
+func TestDateTimeParseFormat(t *testing.T) {
+	d, err := parseDate("2026-03-15")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if d.String() != "2026-03-15" {
+		t.Errorf("expected date 2026-03-15, got %s", d)
+	}
+	d, err = parseDate("1969-12-31")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if d.Value != -1 || d.String() != "1969-12-31" {
+		t.Errorf("expected day -1 for 1969-12-31, got %d (%s)", d.Value, d)
+	}
+
+	timestamps := map[string]string{
+		"2026-01-01":                "2026-01-01 00:00:00",
+		"2026-01-01 12:30:05":       "2026-01-01 12:30:05",
+		"2026-01-01T12:30:05.25":    "2026-01-01 12:30:05.25",
+		"2026-01-01T14:30:05+02:00": "2026-01-01 12:30:05",
+		"2026-01-01 12:30":          "2026-01-01 12:30:00",
+	}
+	for in, out := range timestamps {
+		ts, err := parseTimestamp(in)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if ts.String() != out {
+			t.Errorf("expected timestamp %s to format as %s, got %s", in, out, ts)
+		}
+	}
+
+	intervals := map[string]string{
+		"1 day":                           "1 day",
+		"1 year 2 months 3 days 04:05:06": "1 year 2 mons 3 days 04:05:06",
+		"90 minutes":                      "01:30:00",
+		"2 weeks":                         "14 days",
+		"1 quarter":                       "3 mons",
+		"-1 days":                         "-1 days",
+		"1.5 seconds":                     "00:00:01.5",
+		"0 seconds":                       "00:00:00",
+		"3 hours -00:30":                  "02:30:00",
+		"1 mon 1 microsecond":             "1 mon 00:00:00.000001",
+	}
+	for in, out := range intervals {
+		iv, err := parseInterval(in)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if iv.String() != out {
+			t.Errorf("expected interval %s to format as %s, got %s", in, out, iv)
+		}
+	}
+
+	bad := []struct {
+		s     string
+		dtype DBType
+	}{
+		{"2026-13-01", DateType},
+		{"yesterday", DateType},
+		{"2026-01-01 25:00:00", TimestampType},
+		{"1 fortnight", IntervalType},
+		{"1.5 days", IntervalType},
+		{"day", IntervalType},
+	}
+	for _, b := range bad {
+		if _, err := parseDateTimeValue(b.s, b.dtype); err == nil {
+			t.Errorf("expected '%s' to be an invalid %s", b.s, b.dtype)
+		}
+	}
+}
+
+func TestDateTimeCompare(t *testing.T) {
+	d, _ := parseDate("2026-01-01")
+	midnight, _ := parseTimestamp("2026-01-01 00:00:00")
+	noon, _ := parseTimestamp("2026-01-01 12:00:00")
+	if !d.EvalPred(midnight, OpEq) || !midnight.EvalPred(d, OpEq) {
+		t.Errorf("expected a date to equal midnight of the same day")
+	}
+	if !d.EvalPred(noon, OpLt) || !noon.EvalPred(d, OpGt) {
+		t.Errorf("expected a date to be before noon of the same day")
+	}
+	month, _ := parseInterval("1 month")
+	days, _ := parseInterval("30 days")
+	hours, _ := parseInterval("721 hours")
+	if !month.EvalPred(days, OpEq) {
+		t.Errorf("expected 1 month to equal 30 days")
+	}
+	if !hours.EvalPred(month, OpGt) {
+		t.Errorf("expected 721 hours to be longer than 1 month")
+	}
+	if d.EvalPred(StringField{"2026-01-01"}, OpEq) {
+		t.Errorf("expected a date not to equal a string")
+	}
+}
+
+func TestDateTimeArithmetic(t *testing.T) {
+	ts, _ := parseTimestamp("2026-01-31 10:00:00")
+	month, _ := parseInterval("1 month")
+	if got := addInterval(ts, month).String(); got != "2026-02-28 10:00:00" {
+		t.Errorf("expected Jan 31 + 1 month to be Feb 28, got %s", got)
+	}
+	leap, _ := parseTimestamp("2028-01-31 10:00:00")
+	if got := addInterval(leap, month).String(); got != "2028-02-29 10:00:00" {
+		t.Errorf("expected Jan 31 + 1 month to be Feb 29 in a leap year, got %s", got)
+	}
+	iv, _ := parseInterval("-13 months 1 day 02:00:00")
+	if got := addInterval(ts, iv).String(); got != "2025-01-01 12:00:00" {
+		t.Errorf("expected 2026-01-31 10:00 + (-13 months 1 day 2 hours) to be 2025-01-01 12:00, got %s", got)
+	}
+
+	other, _ := parseTimestamp("2026-01-28 06:30:00")
+	diff := timestampDiffFunc([]any{ts.Value, other.Value}).(IntervalField)
+	if diff.String() != "3 days 03:30:00" {
+		t.Errorf("expected difference of 3 days 03:30:00, got %s", diff)
+	}
+
+	extracts := map[string]int64{
+		"year":    2026,
+		"quarter": 1,
+		"month":   1,
+		"day":     31,
+		"dow":     6,
+		"doy":     31,
+		"hour":    10,
+		"minute":  0,
+		"epoch":   ts.Value / 1000000,
+	}
+	for field, expected := range extracts {
+		got := extractTimestampFunc([]any{field, ts.Value})
+		if got != expected {
+			t.Errorf("expected extract(%s) to be %d, got %v", field, expected, got)
+		}
+	}
+	if _, ok := extractTimestampFunc([]any{"fortnight", ts.Value}).(error); !ok {
+		t.Errorf("expected extract of an unknown field to fail")
+	}
+
+	truncs := map[string]string{
+		"year":    "2026-01-01 00:00:00",
+		"quarter": "2026-01-01 00:00:00",
+		"month":   "2026-01-01 00:00:00",
+		"week":    "2026-01-26 00:00:00",
+		"day":     "2026-01-31 00:00:00",
+		"hour":    "2026-01-31 10:00:00",
+	}
+	for unit, expected := range truncs {
+		got := TimestampField{dateTruncFunc([]any{unit, ts.Value}).(int64)}
+		if got.String() != expected {
+			t.Errorf("expected date_trunc(%s) to be %s, got %s", unit, expected, got)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package godb
+
+// A DeadlockPolicy decides what the [LockTable] does when a transaction
+// requests a lock that conflicts with the locks that other transactions hold,
+// or are waiting for, so that transactions never wait for each other forever.
+// A policy may abort the requesting transaction, so that it doesn't wait, or
+// wound other transactions, which are aborted when they next request a lock or
+// as soon as they are waiting for one, while the requesting transaction waits
+// for them (see [LockTable.wound]).
+//
+// Deadlock detection aborts a transaction once a cycle of waiting
+// transactions forms; wait-die and wound-wait prevent cycles from forming, by
+// letting only older transactions wait for younger ones, or only younger ones
+// wait for older ones, without searching the wait-for graph. Transactions are
+// ordered by their IDs, which [NewTID] hands out in increasing order, so a
+// transaction with a lower ID is older.
+//
+// The abort rates of the policies can be compared with the DeadlockAborts
+// counter of [BufferPoolStats].
+type DeadlockPolicy interface {
+	// Return the transactions to abort so that tid can wait for the
+	// transactions in waitsFor, whose edges are in the wait-for graph. tid
+	// doesn't wait if it is returned; the other transactions are wounded.
+	// Called while holding the graphLatch of the lock table.
+	resolve(t *LockTable, tid TransactionID, waitsFor []TransactionID) []TransactionID
+}
+
+// The transaction that deadlock detection aborts to break a cycle of waiting
+// transactions (see [NewDeadlockDetection]).
+type DeadlockVictim int
+
+const (
+	// The transaction whose request closed the cycle. This is the default.
+	VictimRequester DeadlockVictim = iota
+	// The youngest transaction in the cycle.
+	VictimYoungest
+	// The transaction that holds the fewest locks on pages and records.
+	VictimFewestLocks
+	// The transaction whose changes take the fewest bytes of the log. As
+	// changes are logged when transactions commit, this counts the changes
+	// that were logged early, e.g., by the page writer; ties go to the
+	// youngest transaction.
+	VictimLeastLog
+)
+
+// Search the wait-for graph for a cycle on every request that has to wait,
+// and abort a transaction in the cycle.
+type detectionPolicy struct {
+	victim DeadlockVictim
+}
+
+// Construct a deadlock policy that searches the wait-for graph for a cycle
+// whenever a transaction has to wait for a lock, and aborts the specified
+// victim if there is one. NewDeadlockDetection(VictimRequester) is the default
+// policy of [NewLockTable].
+func NewDeadlockDetection(victim DeadlockVictim) DeadlockPolicy {
+	return &detectionPolicy{victim}
+}
+
+func (p *detectionPolicy) resolve(t *LockTable, tid TransactionID, waitsFor []TransactionID) []TransactionID {
+	cycle := t.waitGraph.cycle(tid)
+	if cycle == nil {
+		return nil
+	}
+	if p.victim == VictimRequester {
+		return []TransactionID{tid}
+	}
+	for _, other := range cycle {
+		if t.wounded[other] {
+			// the cycle is broken once the wounded transaction aborts
+			return nil
+		}
+	}
+	cost := func(other TransactionID) int64 { return 0 }
+	switch p.victim {
+	case VictimFewestLocks:
+		cost = func(other TransactionID) int64 { return int64(t.locksHeld(other)) }
+	case VictimLeastLog:
+		if t.logWritten != nil {
+			cost = t.logWritten
+		}
+	}
+	victim, victimCost := cycle[0], cost(cycle[0])
+	for _, other := range cycle[1:] {
+		c := cost(other)
+		if c < victimCost || (c == victimCost && other > victim) {
+			victim, victimCost = other, c
+		}
+	}
+	return []TransactionID{victim}
+}
+
+// A transaction that requests a lock held by an older one dies.
+type waitDiePolicy struct{}
+
+// Construct a wait-die deadlock policy: a transaction may wait for younger
+// transactions, but is aborted if it requests a lock that an older
+// transaction holds or waits for.
+func NewWaitDie() DeadlockPolicy {
+	return waitDiePolicy{}
+}
+
+func (waitDiePolicy) resolve(t *LockTable, tid TransactionID, waitsFor []TransactionID) []TransactionID {
+	for _, other := range waitsFor {
+		if other < tid {
+			return []TransactionID{tid}
+		}
+	}
+	return nil
+}
+
+// A transaction that requests a lock held by a younger one wounds it.
+type woundWaitPolicy struct{}
+
+// Construct a wound-wait deadlock policy: a transaction may wait for older
+// transactions, and wounds the younger transactions that hold or wait for
+// the lock it requests, which are aborted.
+func NewWoundWait() DeadlockPolicy {
+	return woundWaitPolicy{}
+}
+
+func (woundWaitPolicy) resolve(t *LockTable, tid TransactionID, waitsFor []TransactionID) []TransactionID {
+	var younger []TransactionID
+	for _, other := range waitsFor {
+		if other > tid {
+			younger = append(younger, other)
+		}
+	}
+	return younger
+}
@@ -0,0 +1,158 @@
+package godb
+
+import (
+	"testing"
+	"time"
+)
+
+// Returns true if the transaction of the queued request w was wounded.
+func woundedForTest(w *lockWaiter) bool {
+	select {
+	case <-w.wounded:
+		return true
+	default:
+		return false
+	}
+}
+
+func TestDeadlockPolicyWaitDie(t *testing.T) {
+	lt := NewLockTable()
+	lt.setDeadlockPolicy(NewWaitDie())
+	older, younger := NewTID(), NewTID()
+	f := &MemFile{0, nil, nil}
+	if lt.TryLock(f, 0, younger, WritePerm) != Grant || lt.TryLock(f, 1, older, WritePerm) != Grant {
+		t.Fatalf("Expected locks to be granted")
+	}
+	// the older transaction waits, the younger one dies, without a cycle
+	if lt.TryLock(f, 0, older, ReadPerm) != Wait {
+		t.Errorf("Expected the older transaction to wait")
+	}
+	if lt.TryLock(f, 1, younger, ReadPerm) != Abort {
+		t.Errorf("Expected the younger transaction to abort")
+	}
+}
+
+func TestDeadlockPolicyWoundWait(t *testing.T) {
+	lt := NewLockTable()
+	lt.setDeadlockPolicy(NewWoundWait())
+	older, younger := NewTID(), NewTID()
+	f := &MemFile{0, nil, nil}
+	if lt.TryLock(f, 0, older, WritePerm) != Grant || lt.TryLock(f, 1, younger, WritePerm) != Grant {
+		t.Fatalf("Expected locks to be granted")
+	}
+	// the younger transaction waits for the older one
+	resp, w := lt.requestLock(f, 0, younger, ReadPerm)
+	if resp != Wait || woundedForTest(w) {
+		t.Fatalf("Expected the younger transaction to wait")
+	}
+	// the older one wounds it instead of waiting for it
+	resp, _ = lt.requestLock(f, 1, older, ReadPerm)
+	if resp != Wait {
+		t.Errorf("Expected the older transaction to wait for the wounded one")
+	}
+	if !woundedForTest(w) {
+		t.Errorf("Expected the waiting younger transaction to be wounded")
+	}
+	if lt.TryLock(f, 2, younger, ReadPerm) != Abort {
+		t.Errorf("Expected the wounded transaction to abort on its next request")
+	}
+	lt.ReleaseLocks(younger)
+	if lt.TryLock(f, 1, older, ReadPerm) != Grant {
+		t.Errorf("Expected the older transaction to get the lock")
+	}
+	if lt.isWounded(younger) {
+		t.Errorf("Expected the wound to be forgotten once the transaction ended")
+	}
+}
+
+func TestDeadlockPolicyVictims(t *testing.T) {
+	for _, victim := range []DeadlockVictim{VictimRequester, VictimYoungest, VictimFewestLocks, VictimLeastLog} {
+		lt := NewLockTable()
+		lt.setDeadlockPolicy(NewDeadlockDetection(victim))
+		tid1, tid2, tid3 := NewTID(), NewTID(), NewTID()
+		lt.logWritten = func(tid TransactionID) int64 {
+			if tid == tid2 {
+				return 100
+			}
+			return 200
+		}
+		f := &MemFile{0, nil, nil}
+		// tid2 holds a single lock, the others two, and has logged the least
+		for pageNo, tid := range []TransactionID{tid1, tid2, tid3, tid1, tid3} {
+			if lt.TryLock(f, pageNo, tid, WritePerm) != Grant {
+				t.Fatalf("Expected lock to be granted")
+			}
+		}
+
+		// tid3 waits for tid1, tid2 for tid3, and tid1 for tid2, which
+		// closes the cycle
+		_, w3 := lt.requestLock(f, 0, tid3, WritePerm)
+		_, w2 := lt.requestLock(f, 2, tid2, WritePerm)
+		resp, _ := lt.requestLock(f, 1, tid1, WritePerm)
+
+		var expected TransactionID
+		switch victim {
+		case VictimRequester:
+			expected = tid1
+		case VictimYoungest:
+			expected = tid3
+		case VictimFewestLocks, VictimLeastLog:
+			expected = tid2
+		}
+		if (resp == Abort) != (expected == tid1) {
+			t.Errorf("victim %d: unexpected response %d to the request that closed the cycle", victim, resp)
+		}
+		if woundedForTest(w2) != (expected == tid2) || woundedForTest(w3) != (expected == tid3) {
+			t.Errorf("victim %d: expected only transaction %d to be aborted", victim, expected)
+		}
+	}
+}
+
+func TestDeadlockPolicyAbortCounts(t *testing.T) {
+	bp, hf, older, younger, _ := transactionTestSetUp(t)
+	bp.SetDeadlockPolicy(NewWoundWait())
+	bp.ResetStats()
+	if _, err := bp.GetPage(hf, 0, older, WritePerm); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if _, err := bp.GetPage(hf, 1, younger, WritePerm); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	// the younger transaction waits for the older one, which then wounds it
+	done := make(chan error)
+	go func() {
+		_, err := bp.GetPage(hf, 0, younger, WritePerm)
+		done <- err
+	}()
+	time.Sleep(100 * time.Millisecond)
+	granted := make(chan error)
+	go func() {
+		_, err := bp.GetPage(hf, 1, older, WritePerm)
+		granted <- err
+	}()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Errorf("Expected the wounded transaction to be aborted")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("the wounded transaction is still waiting")
+	}
+	select {
+	case err := <-granted:
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("the older transaction is still waiting")
+	}
+	if bp.IsRunning(younger) || !bp.IsRunning(older) {
+		t.Errorf("Expected only the younger transaction to be aborted")
+	}
+	stats := bp.Stats()
+	if stats.DeadlockAborts != 1 || stats.LockWaits != 2 {
+		t.Errorf("Expected 1 deadlock abort and 2 lock waits, got %d and %d", stats.DeadlockAborts, stats.LockWaits)
+	}
+	bp.CommitTransaction(older)
+}
@@ -0,0 +1,394 @@
+package godb
+
+// This file implements the exact DECIMAL(p,s) type: the encoding of precision
+// and scale in a DBType, parsing and formatting of decimal literals, rounding,
+// comparison, and the arithmetic functions registered in exprs.go.
+//
+// A decimal is stored as an int64 unscaled value, so that a DECIMAL(10,2)
+// value 12.34 is stored as 1234 with a scale of 2. This limits the precision
+// of a decimal to 18 digits. Whenever a value has to be stored with fewer
+// digits after the decimal point, it is rounded half away from zero, as in
+// PostgreSQL; a value with too many digits before the decimal point is an
+// error with code NumericOverflowError rather than being silently truncated.
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+const (
+	// Every 18 digit number fits in an int64.
+	maxDecimalPrecision = 18
+
+	// Precision of the decimal type and of int values converted to decimals
+	// when neither is specified.
+	defaultDecimalPrecision = maxDecimalPrecision
+
+	// The quotient of two decimals, and the average of a decimal column, is
+	// computed with at least this many digits after the decimal point.
+	minDivisionScale = 6
+)
+
+// DecimalType is the type of the DECIMAL values, whatever their precision and
+// scale. Columns and expressions have a DECIMAL(p,s) type with a specific
+// precision and scale, see [DBType.precision] and [DBType.scale]; use
+// [DBType.baseType] to switch on the kind of a type that may be a decimal.
+const DecimalType DBType = 1 << 16
+
+// Return the DECIMAL(p,s) type. Does not check that p and s are valid; see
+// [newDecimalType].
+func decimalType(precision int, scale int) DBType {
+	return DecimalType | DBType(precision<<8) | DBType(scale)
+}
+
+// Return the DECIMAL(p,s) type, or an error if there is no such type.
+func newDecimalType(precision int, scale int) (DBType, error) {
+	if precision < 1 || precision > maxDecimalPrecision {
+		return UnknownType, GoDBError{ParseError, fmt.Sprintf("decimal precision %d must be between 1 and %d", precision, maxDecimalPrecision)}
+	}
+	if scale < 0 || scale > precision {
+		return UnknownType, GoDBError{ParseError, fmt.Sprintf("decimal scale %d must be between 0 and the precision %d", scale, precision)}
+	}
+	return decimalType(precision, scale), nil
+}
+
+// Parse the name of a decimal type, e.g., decimal(10,2), numeric(5) or
+// decimal. Returns ok = false if name isn't a decimal type.
+func parseDecimalType(name string) (t DBType, ok bool, err error) {
+	name = strings.ReplaceAll(strings.ToLower(name), " ", "")
+	base, args, hasArgs := strings.Cut(name, "(")
+	if base != "decimal" && base != "numeric" {
+		return UnknownType, false, nil
+	}
+	if !hasArgs {
+		return decimalType(defaultDecimalPrecision, 0), true, nil
+	}
+	if !strings.HasSuffix(args, ")") {
+		return UnknownType, true, GoDBError{ParseError, fmt.Sprintf("malformed decimal type %s", name)}
+	}
+	p, s, hasScale := strings.Cut(strings.TrimSuffix(args, ")"), ",")
+	if !hasScale {
+		s = "0"
+	}
+	precision, err := strconv.Atoi(p)
+	if err != nil {
+		return UnknownType, true, GoDBError{ParseError, fmt.Sprintf("malformed decimal type %s", name)}
+	}
+	scale, err := strconv.Atoi(s)
+	if err != nil {
+		return UnknownType, true, GoDBError{ParseError, fmt.Sprintf("malformed decimal type %s", name)}
+	}
+	t, err = newDecimalType(precision, scale)
+	return t, true, err
+}
+
+// Return true if t is a DECIMAL(p,s) type, or DecimalType itself.
+func (t DBType) isDecimal() bool {
+	return t&DecimalType != 0
+}
+
+// Return DecimalType for decimal types, and t for all other types.
+func (t DBType) baseType() DBType {
+	if t.isDecimal() {
+		return DecimalType
+	}
+	return t
+}
+
+// The total number of digits of a decimal type.
+func (t DBType) precision() int {
+	return int(t>>8) & 0xff
+}
+
+// The number of digits after the decimal point of a decimal type.
+func (t DBType) scale() int {
+	return int(t) & 0xff
+}
+
+// Return the type of the result of applying the arithmetic operator op to
+// decimals of types t1 and t2. Ints are treated as decimals with a scale of 0.
+func decimalResultType(op string, t1 DBType, t2 DBType) DBType {
+	p1, s1 := decimalPrecisionScale(t1)
+	p2, s2 := decimalPrecisionScale(t2)
+	scale := decimalResultScale(op, s1, s2)
+	var precision int
+	switch op {
+	case "+", "-":
+		precision = max(p1-s1, p2-s2) + scale + 1
+	case "*":
+		precision = p1 + p2 + 1
+	default:
+		precision = maxDecimalPrecision
+	}
+	return decimalType(min(precision, maxDecimalPrecision), scale)
+}
+
+// Return the scale of the result of applying op to decimals with scales s1 and
+// s2. Sums and differences keep the larger scale, products add the scales, and
+// quotients have at least minDivisionScale digits after the decimal point.
+func decimalResultScale(op string, s1 int, s2 int) int {
+	switch op {
+	case "+", "-":
+		return max(s1, s2)
+	case "*":
+		return min(s1+s2, maxDecimalPrecision)
+	default:
+		return min(max(s1, s2, minDivisionScale), maxDecimalPrecision)
+	}
+}
+
+func decimalPrecisionScale(t DBType) (int, int) {
+	if t.isDecimal() {
+		return t.precision(), t.scale()
+	}
+	return defaultDecimalPrecision, 0
+}
+
+// Decimal field value, stored as an unscaled int64: the value of the field is
+// Value / 10^Scale. The scale of a field is the scale of its column or
+// expression type.
+type DecimalField struct {
+	Value int64
+	Scale int
+}
+
+// Return the DECIMAL(p,s) type of a decimal value, where p is the number of
+// digits of the value.
+func (d DecimalField) dbType() DBType {
+	digits := len(strings.TrimPrefix(strconv.FormatInt(d.Value, 10), "-"))
+	return decimalType(max(digits, d.Scale), d.Scale)
+}
+
+func (d DecimalField) String() string {
+	digits := strconv.FormatInt(d.Value, 10)
+	sign := ""
+	if d.Value < 0 {
+		sign, digits = "-", digits[1:]
+	}
+	if d.Scale == 0 {
+		return sign + digits
+	}
+	if len(digits) <= d.Scale {
+		digits = strings.Repeat("0", d.Scale-len(digits)+1) + digits
+	}
+	point := len(digits) - d.Scale
+	return sign + digits[:point] + "." + digits[point:]
+}
+
+func (d DecimalField) toFloat() float64 {
+	f, _ := strconv.ParseFloat(d.String(), 64)
+	return f
+}
+
+func (d DecimalField) bigValue() *big.Int {
+	return big.NewInt(d.Value)
+}
+
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
+
+// The largest unscaled value of a decimal.
+var maxDecimalValue = new(big.Int).Sub(pow10(maxDecimalPrecision), big.NewInt(1))
+
+// Return the quotient x / y, rounded half away from zero.
+func roundedQuo(x *big.Int, y *big.Int) *big.Int {
+	q, r := new(big.Int).QuoRem(x, y, new(big.Int))
+	r.Abs(r).Lsh(r, 1)
+	if r.Cmp(new(big.Int).Abs(y)) >= 0 {
+		if (x.Sign() < 0) != (y.Sign() < 0) {
+			q.Sub(q, big.NewInt(1))
+		} else {
+			q.Add(q, big.NewInt(1))
+		}
+	}
+	return q
+}
+
+// Return the unscaled value x with the given scale as a DecimalField, or an
+// error if it has more than maxDecimalPrecision digits.
+func decimalFromBig(x *big.Int, scale int) (DecimalField, error) {
+	if new(big.Int).Abs(x).Cmp(maxDecimalValue) > 0 {
+		return DecimalField{}, GoDBError{NumericOverflowError, fmt.Sprintf("decimal value overflows %d digits", maxDecimalPrecision)}
+	}
+	return DecimalField{x.Int64(), scale}, nil
+}
+
+// Return d with the given scale, rounding half away from zero if digits after
+// the decimal point are dropped.
+func (d DecimalField) rescale(scale int) (DecimalField, error) {
+	if scale == d.Scale {
+		return d, nil
+	}
+	x := d.bigValue()
+	if scale > d.Scale {
+		x.Mul(x, pow10(scale-d.Scale))
+	} else {
+		x = roundedQuo(x, pow10(d.Scale-scale))
+	}
+	return decimalFromBig(x, scale)
+}
+
+// Round d to the scale of the decimal type t, and check that it fits in the
+// precision of t.
+func (d DecimalField) fit(t DBType) (DecimalField, error) {
+	r, err := d.rescale(t.scale())
+	if err != nil {
+		return r, GoDBError{NumericOverflowError, fmt.Sprintf("value %s overflows %s", d, t)}
+	}
+	if new(big.Int).Abs(r.bigValue()).Cmp(pow10(t.precision())) >= 0 {
+		return r, GoDBError{NumericOverflowError, fmt.Sprintf("value %s overflows %s", d, t)}
+	}
+	return r, nil
+}
+
+// Parse a decimal literal such as 12, -0.5 or 1.25e3. The scale of the result
+// is the number of digits after the decimal point, so that the literal is
+// represented exactly.
+func parseDecimal(s string) (DecimalField, error) {
+	bad := GoDBError{TypeMismatchError, fmt.Sprintf("invalid decimal '%s'", s)}
+	s = strings.TrimSpace(s)
+	mantissa, exp := s, 0
+	if i := strings.IndexAny(s, "eE"); i >= 0 {
+		e, err := strconv.Atoi(s[i+1:])
+		if err != nil {
+			return DecimalField{}, bad
+		}
+		mantissa, exp = s[:i], e
+	}
+	sign := ""
+	if strings.HasPrefix(mantissa, "-") || strings.HasPrefix(mantissa, "+") {
+		sign, mantissa = mantissa[:1], mantissa[1:]
+	}
+	intPart, fracPart, _ := strings.Cut(mantissa, ".")
+	digits := intPart + fracPart
+	if digits == "" || strings.Trim(digits, "0123456789") != "" {
+		return DecimalField{}, bad
+	}
+	x, _ := new(big.Int).SetString(sign+digits, 10)
+	scale := len(fracPart) - exp
+	if scale < 0 {
+		x.Mul(x, pow10(-scale))
+		scale = 0
+	}
+	if scale > maxDecimalPrecision {
+		x = roundedQuo(x, pow10(scale-maxDecimalPrecision))
+		scale = maxDecimalPrecision
+	}
+	return decimalFromBig(x, scale)
+}
+
+// Convert an int, float, string or decimal to a decimal exactly, without
+// rounding it to the scale of a type. Floats are converted from their shortest
+// decimal representation, so that the literal 1.1 is the decimal 1.1.
+func toDecimal(v DBValue) (DBValue, error) {
+	switch v := v.(type) {
+	case IntField:
+		return DecimalField{v.Value, 0}, nil
+	case FloatField:
+		if math.IsNaN(v.Value) || math.IsInf(v.Value, 0) {
+			return nil, GoDBError{NumericOverflowError, fmt.Sprintf("float %v can't be converted to a decimal", v.Value)}
+		}
+		return parseDecimal(strconv.FormatFloat(v.Value, 'f', -1, 64))
+	case StringField:
+		return parseDecimal(v.Value)
+	}
+	return v, nil
+}
+
+// Compare two decimals, returning -1, 0 or 1.
+func (d DecimalField) cmp(d2 DecimalField) int {
+	if d.Scale == d2.Scale {
+		return cmpInt64(d.Value, d2.Value)
+	}
+	x1, x2 := d.bigValue(), d2.bigValue()
+	if d.Scale < d2.Scale {
+		x1.Mul(x1, pow10(d2.Scale-d.Scale))
+	} else {
+		x2.Mul(x2, pow10(d.Scale-d2.Scale))
+	}
+	return x1.Cmp(x2)
+}
+
+func cmpInt64(x1 int64, x2 int64) int {
+	if x1 < x2 {
+		return -1
+	} else if x1 > x2 {
+		return 1
+	}
+	return 0
+}
+
+// Decimals can be compared exactly with decimals and ints; comparisons with
+// floats convert the decimal to a float.
+func (d1 DecimalField) EvalPred(v2 DBValue, op BoolOp) bool {
+	if result, ok := evalNullPred(op); ok {
+		return result
+	}
+	switch v2 := v2.(type) {
+	case DecimalField:
+		return evalInt64Pred(int64(d1.cmp(v2)), 0, op)
+	case IntField:
+		return evalInt64Pred(int64(d1.cmp(DecimalField{v2.Value, 0})), 0, op)
+	case FloatField:
+		return FloatField{d1.toFloat()}.EvalPred(v2, op)
+	}
+	return false
+}
+
+// Arguments of the decimal functions in exprs.go are DecimalFields; ints are
+// converted to decimals with a scale of 0 before the function is called.
+
+func addDecimalFunc(args []any) any {
+	return decimalArith("+", args[0].(DecimalField), args[1].(DecimalField))
+}
+
+func minusDecimalFunc(args []any) any {
+	return decimalArith("-", args[0].(DecimalField), args[1].(DecimalField))
+}
+
+func timesDecimalFunc(args []any) any {
+	return decimalArith("*", args[0].(DecimalField), args[1].(DecimalField))
+}
+
+func divDecimalFunc(args []any) any {
+	return decimalArith("/", args[0].(DecimalField), args[1].(DecimalField))
+}
+
+// Apply op to two decimals, returning a DecimalField with the scale given by
+// [decimalResultScale], or an error if the result overflows or is a division
+// by zero.
+func decimalArith(op string, d1 DecimalField, d2 DecimalField) any {
+	scale := decimalResultScale(op, d1.Scale, d2.Scale)
+	x1, x2 := d1.bigValue(), d2.bigValue()
+	var x *big.Int
+	switch op {
+	case "+", "-":
+		x1.Mul(x1, pow10(scale-d1.Scale))
+		x2.Mul(x2, pow10(scale-d2.Scale))
+		if op == "+" {
+			x = x1.Add(x1, x2)
+		} else {
+			x = x1.Sub(x1, x2)
+		}
+	case "*":
+		x = roundedQuo(x1.Mul(x1, x2), pow10(d1.Scale+d2.Scale-scale))
+	case "/":
+		if x2.Sign() == 0 {
+			return GoDBError{IllegalOperationError, "decimal division by zero"}
+		}
+		// d1 / d2 = (x1 / 10^s1) / (x2 / 10^s2), and the result is scaled by
+		// 10^scale
+		x1.Mul(x1, pow10(scale+d2.Scale))
+		x2.Mul(x2, pow10(d1.Scale))
+		x = roundedQuo(x1, x2)
+	}
+	d, err := decimalFromBig(x, scale)
+	if err != nil {
+		return err
+	}
+	return d
+}
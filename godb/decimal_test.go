@@ -0,0 +1,138 @@
+package godb
+
+import (
+	"testing"
+)
+
+func TestDecimalParseFormat(t *testing.T) {
+	decimals := map[string]string{
+		"12.34":    "12.34",
+		"-0.5":     "-0.5",
+		"+7":       "7",
+		"0.001":    "0.001",
+		"-.25":     "-0.25",
+		"1.25e3":   "1250",
+		"125e-4":   "0.0125",
+		"100.00":   "100.00",
+		"-0.00001": "-0.00001",
+	}
+	for in, out := range decimals {
+		d, err := parseDecimal(in)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if d.String() != out {
+			t.Errorf("expected decimal %s to format as %s, got %s", in, out, d)
+		}
+	}
+	for _, bad := range []string{"", "abc", "1.2.3", "--1", "1e"} {
+		if _, err := parseDecimal(bad); err == nil {
+			t.Errorf("expected '%s' to be an invalid decimal", bad)
+		}
+	}
+	if _, err := parseDecimal("1234567890123456789"); err == nil || err.(GoDBError).code != NumericOverflowError {
+		t.Errorf("expected a 19 digit decimal to overflow, got %v", err)
+	}
+
+	types := map[string]string{
+		"decimal(10,2)":  "decimal(10,2)",
+		"numeric(5)":     "decimal(5,0)",
+		"decimal":        "decimal(18,0)",
+		"DECIMAL(8, 3)":  "decimal(8,3)",
+		"numeric(18,18)": "decimal(18,18)",
+	}
+	for in, out := range types {
+		dt, ok, err := parseDecimalType(in)
+		if err != nil || !ok {
+			t.Fatalf("failed to parse decimal type %s, %v", in, err)
+		}
+		if dt.String() != out || !dt.isDecimal() || dt.baseType() != DecimalType {
+			t.Errorf("expected type %s to be %s, got %s", in, out, dt)
+		}
+	}
+	for _, bad := range []string{"decimal(19,2)", "decimal(5,6)", "decimal(0)", "decimal(a,b)"} {
+		if _, _, err := parseDecimalType(bad); err == nil {
+			t.Errorf("expected %s to be an invalid decimal type", bad)
+		}
+	}
+}
+
+func TestDecimalRounding(t *testing.T) {
+	money := decimalType(6, 2)
+	rounded := map[string]string{
+		"1.005":   "1.01",
+		"1.004":   "1.00",
+		"-1.005":  "-1.01",
+		"-1.0049": "-1.00",
+		"2.5":     "2.50",
+		"9999.99": "9999.99",
+	}
+	for in, out := range rounded {
+		v, err := coerceValue(StringField{in}, money)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if v.(DecimalField).String() != out {
+			t.Errorf("expected %s to round to %s, got %s", in, out, v)
+		}
+	}
+	for _, overflow := range []DBValue{StringField{"10000"}, StringField{"9999.995"}, IntField{-10000}, FloatField{12345.6}} {
+		_, err := coerceValue(overflow, money)
+		if err == nil || err.(GoDBError).code != NumericOverflowError {
+			t.Errorf("expected %v to overflow %s, got %v", overflow, money, err)
+		}
+	}
+	v, err := coerceValue(FloatField{0.1}, money)
+	if err != nil || v != (DecimalField{10, 2}) {
+		t.Errorf("expected float 0.1 to be the decimal 0.10, got %v (%v)", v, err)
+	}
+}
+
+func TestDecimalArithmetic(t *testing.T) {
+	a := DecimalField{1050, 2} // 10.50
+	b := DecimalField{3, 0}    // 3
+	c := DecimalField{-125, 3} // -0.125
+	results := []struct {
+		got      any
+		expected string
+	}{
+		{addDecimalFunc([]any{a, c}), "10.375"},
+		{minusDecimalFunc([]any{c, a}), "-10.625"},
+		{timesDecimalFunc([]any{a, c}), "-1.31250"},
+		{divDecimalFunc([]any{a, b}), "3.500000"},
+		{divDecimalFunc([]any{DecimalField{2, 0}, b}), "0.666667"},
+		{divDecimalFunc([]any{DecimalField{-2, 0}, b}), "-0.666667"},
+	}
+	for _, r := range results {
+		d, ok := r.got.(DecimalField)
+		if !ok || d.String() != r.expected {
+			t.Errorf("expected %s, got %v", r.expected, r.got)
+		}
+	}
+	if err, ok := divDecimalFunc([]any{a, DecimalField{0, 2}}).(error); !ok {
+		t.Errorf("expected division by zero to fail")
+	} else if err.(GoDBError).code != IllegalOperationError {
+		t.Errorf("unexpected division by zero error %v", err)
+	}
+	big := DecimalField{999999999999999999, 0}
+	if err, ok := addDecimalFunc([]any{big, DecimalField{1, 0}}).(error); !ok || err.(GoDBError).code != NumericOverflowError {
+		t.Errorf("expected overflow adding to %s, got %v", big, err)
+	}
+	if err, ok := timesDecimalFunc([]any{big, b}).(error); !ok || err.(GoDBError).code != NumericOverflowError {
+		t.Errorf("expected overflow multiplying %s, got %v", big, err)
+	}
+
+	if rt := decimalResultType("+", decimalType(10, 2), decimalType(6, 4)); rt != decimalType(13, 4) {
+		t.Errorf("expected decimal(10,2) + decimal(6,4) to be decimal(13,4), got %s", rt)
+	}
+	if rt := decimalResultType("*", decimalType(10, 2), IntType); rt != decimalType(18, 2) {
+		t.Errorf("expected decimal(10,2) * int to be decimal(18,2), got %s", rt)
+	}
+
+	if !a.EvalPred(DecimalField{105, 1}, OpEq) || !a.EvalPred(IntField{10}, OpGt) || !(IntField{11}).EvalPred(a, OpGt) {
+		t.Errorf("expected decimals with different scales and ints to compare exactly")
+	}
+	if !c.EvalPred(FloatField{-0.125}, OpEq) || !(FloatField{10.4}).EvalPred(a, OpLt) {
+		t.Errorf("expected decimals to compare with floats")
+	}
+}
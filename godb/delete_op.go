@@ -21,7 +21,8 @@ func (i *DeleteOp) Descriptor() *TupleDesc {
 // Return an iterator that deletes all of the tuples from the child iterator
 // from the DBFile passed to the constructor and then returns a one-field tuple
 // with a "count" field indicating the number of tuples that were deleted.
-// Tuples should be deleted using the [DBFile.deleteTuple] method.
+// Tuples should be deleted using the [DBFile.deleteTuple] method, and removed
+// from the indexes on the DBFile.
 func (dop *DeleteOp) Iterator(tid TransactionID) (func() (*Tuple, error), error) {
 	iter, err := dop.child.Iterator(tid)
 	if err != nil {
@@ -45,6 +46,10 @@ func (dop *DeleteOp) Iterator(tid TransactionID) (func() (*Tuple, error), error)
 			if err != nil {
 				return nil, err
 			}
+			err = deleteFromIndexes(dop.deleteFile, t, tid)
+			if err != nil {
+				return nil, err
+			}
 			cnt = cnt + 1
 		}
 		didIterate = true
@@ -13,7 +13,7 @@ import (
 //other values from tuples.
 
 type Expr interface {
-	EvalExpr(t *Tuple) (DBValue, error) //DBValue is either IntField or StringField
+	EvalExpr(t *Tuple) (DBValue, error) //DBValue is either IntField, StringField, FloatField, DecimalField or NullField
 	GetExprType() FieldType             //Return the type of the Expression
 }
 
@@ -54,7 +54,7 @@ type FuncExpr struct {
 }
 
 func (f *FuncExpr) GetExprType() FieldType {
-	fType, exists := funcs[f.op]
+	fType, exists := lookupFunc(f.op, f.args)
 	//todo return err
 	if !exists {
 		return FieldType{f.op, "", IntType}
@@ -66,7 +66,13 @@ func (f *FuncExpr) GetExprType() FieldType {
 			ft = fieldExpr.GetExprType()
 		}
 	}
-	return FieldType{ft.Fname, ft.TableQualifier, fType.outType}
+	outType := fType.outType
+	// The precision and scale of a decimal result depend on those of the
+	// arguments
+	if outType == DecimalType {
+		outType = decimalResultType(f.op, (*f.args[0]).GetExprType().Ftype, (*f.args[1]).GetExprType().Ftype)
+	}
+	return FieldType{ft.Fname, ft.TableQualifier, outType}
 
 }
 
@@ -92,9 +98,115 @@ var funcs = map[string]FuncType{
 	"epochtodatetimestring": {[]DBType{IntType}, StringType, dateString},
 	"imin":                  {[]DBType{IntType, IntType}, IntType, minFunc},
 	"imax":                  {[]DBType{IntType, IntType}, IntType, maxFunc},
+	"date":                  {[]DBType{StringType}, DateType, dateFunc},
+	"timestamp":             {[]DBType{StringType}, TimestampType, timestampFunc},
+	"interval":              {[]DBType{StringType}, IntervalType, intervalFunc},
+	"extract":               {[]DBType{StringType, TimestampType}, IntType, extractTimestampFunc},
+	"date_trunc":            {[]DBType{StringType, TimestampType}, TimestampType, dateTruncFunc},
+}
+
+// Other versions of functions in funcs, e.g., for floats or dates. When the
+// types of the arguments of a function don't match its entry in funcs, the
+// first of these whose argument types match is used instead. Int arguments
+// are promoted to floats or decimals, and decimal arguments to floats, where
+// needed.
+//
+// DecimalType arguments accept decimals of any precision and scale, and a
+// DecimalType result has the type given by [decimalResultType].
+var funcOverloads = map[string][]FuncType{
+	"+": {
+		{[]DBType{DecimalType, DecimalType}, DecimalType, addDecimalFunc},
+		{[]DBType{FloatType, FloatType}, FloatType, addFloatFunc},
+		{[]DBType{DateType, IntType}, DateType, addDaysFunc},
+		{[]DBType{DateType, IntervalType}, TimestampType, addDateIntervalFunc},
+		{[]DBType{TimestampType, IntervalType}, TimestampType, addTimestampIntervalFunc},
+		{[]DBType{IntervalType, IntervalType}, IntervalType, addIntervalsFunc},
+	},
+	"-": {
+		{[]DBType{DecimalType, DecimalType}, DecimalType, minusDecimalFunc},
+		{[]DBType{FloatType, FloatType}, FloatType, minusFloatFunc},
+		{[]DBType{DateType, IntType}, DateType, minusDaysFunc},
+		{[]DBType{DateType, DateType}, IntType, dateDiffFunc},
+		{[]DBType{DateType, IntervalType}, TimestampType, minusDateIntervalFunc},
+		{[]DBType{TimestampType, IntervalType}, TimestampType, minusTimestampIntervalFunc},
+		{[]DBType{TimestampType, TimestampType}, IntervalType, timestampDiffFunc},
+		{[]DBType{IntervalType, IntervalType}, IntervalType, minusIntervalsFunc},
+	},
+	"*": {
+		{[]DBType{DecimalType, DecimalType}, DecimalType, timesDecimalFunc},
+		{[]DBType{FloatType, FloatType}, FloatType, timesFloatFunc},
+		{[]DBType{IntervalType, IntType}, IntervalType, timesIntervalFunc},
+	},
+	"/":          {{[]DBType{DecimalType, DecimalType}, DecimalType, divDecimalFunc}, {[]DBType{FloatType, FloatType}, FloatType, divFloatFunc}},
+	"sq":         {{[]DBType{FloatType}, FloatType, sqFloatFunc}},
+	"date":       {{[]DBType{TimestampType}, DateType, timestampToDateFunc}},
+	"timestamp":  {{[]DBType{DateType}, TimestampType, dateToTimestampFunc}},
+	"extract":    {{[]DBType{StringType, DateType}, IntType, extractDateFunc}, {[]DBType{StringType, IntervalType}, IntType, extractIntervalFunc}},
+	"date_trunc": {{[]DBType{StringType, DateType}, TimestampType, dateTruncDateFunc}},
+}
+
+// Return true if the types of args are compatible with the argument types of
+// fType. NULL arguments are compatible with any type.
+func argsMatch(fType FuncType, args []*Expr, promote bool) bool {
+	if len(args) != len(fType.argTypes) {
+		return false
+	}
+	for i, arg := range args {
+		if !argTypeMatches(fType.argTypes[i], (*arg).GetExprType().Ftype, promote) {
+			return false
+		}
+	}
+	return true
+}
+
+// Return true if an argument of type argType can be passed to a function
+// parameter of type paramType, promoting ints to floats and decimals, and
+// decimals to floats, if promote is true.
+func argTypeMatches(paramType DBType, argType DBType, promote bool) bool {
+	if argType == paramType || argType == UnknownType {
+		return true
+	}
+	if paramType == DecimalType && argType.isDecimal() {
+		return true
+	}
+	if !promote {
+		return false
+	}
+	switch paramType {
+	case FloatType:
+		return argType == IntType || argType.isDecimal()
+	case DecimalType:
+		return argType == IntType
+	}
+	return false
+}
+
+// Find the function named op to apply to args, choosing between the function
+// in funcs and its overloads in funcOverloads based on the types of args.
+func lookupFunc(op string, args []*Expr) (FuncType, bool) {
+	fType, exists := funcs[op]
+	if exists && argsMatch(fType, args, false) {
+		return fType, true
+	}
+	for _, overload := range funcOverloads[op] {
+		if argsMatch(overload, args, true) {
+			return overload, true
+		}
+	}
+	return fType, exists
 }
 
 func ListOfFunctions() string {
+	fList := listFunctions(funcs)
+	for name, overloads := range funcOverloads {
+		for _, f := range overloads {
+			fList = fList + listFunctions(map[string]FuncType{name: f})
+		}
+	}
+	return fList
+}
+
+func listFunctions(funcs map[string]FuncType) string {
 	fList := ""
 	for name, f := range funcs {
 		args := "("
@@ -104,12 +216,7 @@ func ListOfFunctions() string {
 			if hasArg {
 				args = args + ","
 			}
-			switch a {
-			case IntType:
-				args = args + "int"
-			case StringType:
-				args = args + "string"
-			}
+			args = args + a.String()
 			hasArg = true
 		}
 		args = args + ")"
@@ -193,6 +300,26 @@ func sqFunc(args []any) any {
 	return args[0].(int64) * args[0].(int64)
 }
 
+func addFloatFunc(args []any) any {
+	return args[0].(float64) + args[1].(float64)
+}
+
+func minusFloatFunc(args []any) any {
+	return args[0].(float64) - args[1].(float64)
+}
+
+func timesFloatFunc(args []any) any {
+	return args[0].(float64) * args[1].(float64)
+}
+
+func divFloatFunc(args []any) any {
+	return args[0].(float64) / args[1].(float64)
+}
+
+func sqFloatFunc(args []any) any {
+	return args[0].(float64) * args[0].(float64)
+}
+
 func subStrFunc(args []any) any {
 	stringVal := args[0].(string)
 	start := args[1].(int64)
@@ -211,7 +338,7 @@ func subStrFunc(args []any) any {
 }
 
 func (f *FuncExpr) EvalExpr(t *Tuple) (DBValue, error) {
-	fType, exists := funcs[f.op]
+	fType, exists := lookupFunc(f.op, f.args)
 	if !exists {
 		return nil, GoDBError{ParseError, fmt.Sprintf("unknown function %s", f.op)}
 	}
@@ -221,31 +348,97 @@ func (f *FuncExpr) EvalExpr(t *Tuple) (DBValue, error) {
 	argvals := make([]any, len(fType.argTypes))
 	for i, argType := range fType.argTypes {
 		arg := *f.args[i]
-		if arg.GetExprType().Ftype != argType {
-			typeName := "string"
-			switch argType {
-			case IntType:
-				typeName = "int"
-			}
-			return nil, GoDBError{ParseError, fmt.Sprintf("function %s expected arg of type %s", f.op, typeName)}
+		argExprType := arg.GetExprType().Ftype
+		if !argTypeMatches(argType, argExprType, true) {
+			return nil, GoDBError{ParseError, fmt.Sprintf("function %s expected arg of type %s", f.op, argType.String())}
 		}
 		val, err := arg.EvalExpr(t)
 		if err != nil {
 			return nil, err
 		}
+		// Functions of NULL are NULL
+		if isNull(val) {
+			return NullField{}, nil
+		}
 		switch argType {
 		case IntType:
 			argvals[i] = val.(IntField).Value
 		case StringType:
 			argvals[i] = val.(StringField).Value
+		case FloatType:
+			switch val := val.(type) {
+			case FloatField:
+				argvals[i] = val.Value
+			case IntField:
+				argvals[i] = float64(val.Value)
+			case DecimalField:
+				argvals[i] = val.toFloat()
+			}
+		case DecimalType:
+			switch val := val.(type) {
+			case DecimalField:
+				argvals[i] = val
+			case IntField:
+				argvals[i] = DecimalField{val.Value, 0}
+			}
+		case DateType:
+			argvals[i] = val.(DateField).Value
+		case TimestampType:
+			argvals[i] = val.(TimestampField).Value
+		case IntervalType:
+			argvals[i] = val.(IntervalField)
 		}
 	}
 	result := fType.f(argvals)
+	// Functions that can fail, e.g., when parsing a date, return an error
+	if err, ok := result.(error); ok {
+		return nil, err
+	}
 	switch fType.outType {
 	case IntType:
 		return IntField{result.(int64)}, nil
 	case StringType:
 		return StringField{result.(string)}, nil
+	case FloatType:
+		return FloatField{result.(float64)}, nil
+	case DateType:
+		return DateField{result.(int64)}, nil
+	case TimestampType:
+		return TimestampField{result.(int64)}, nil
+	case IntervalType:
+		return result.(IntervalField), nil
+	case DecimalType:
+		return result.(DecimalField), nil
 	}
 	return nil, GoDBError{ParseError, "unknown result type in function"}
 }
+
+// If e is a constant, convert it to type t where there is an implicit
+// conversion (see [coerceValue]). Used so that, e.g., ts >= '2026-01-01'
+// compares a timestamp with a timestamp rather than with a string. Filters
+// with the constant on the left, e.g., '2026-01-01' <= ts, are parsed with it
+// on the right (see [parseWhere]), so it is converted the same way.
+//
+// Constants compared with decimals are converted to decimals exactly, rather
+// than being rounded to the scale of t, so that, e.g., price = 1.005 is false
+// for a DECIMAL(10,2) price of 1.01.
+func coerceConstExpr(e Expr, t DBType) (Expr, error) {
+	c, ok := e.(*ConstExpr)
+	if !ok || c.constType == t {
+		return e, nil
+	}
+	var v DBValue
+	var err error
+	if t.isDecimal() {
+		v, err = toDecimal(c.val)
+	} else {
+		v, err = coerceValue(c.val, t)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if isNull(v) {
+		return e, nil
+	}
+	return &ConstExpr{v, typeOfValue(v)}, nil
+}
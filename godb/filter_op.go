@@ -40,13 +40,16 @@ func (f *Filter) Iterator(tid TransactionID) (func() (*Tuple, error), error) {
 			}
 			val1, err := f.left.EvalExpr(t)
 			if err != nil {
-				return nil, error
+				return nil, err
 			}
 			val2, err := f.right.EvalExpr(t)
 			if err != nil {
-				return nil, error
+				return nil, err
 			}
 
+			// EvalPred returns false when the predicate is unknown (i.e.,
+			// a NULL is compared with anything other than IS [NOT] NULL),
+			// so such tuples are filtered out.
 			if val1.EvalPred(val2, f.op) {
 				return t, nil
 			}
@@ -76,3 +76,48 @@ func TestFilterString(t *testing.T) {
 		t.Errorf("unexpected number of results")
 	}
 }
+
+func TestFilterNull(t *testing.T) {
+	td, t1, t2, hf, _, tid := makeTestVars(t)
+	tNull := Tuple{Desc: td, Fields: []DBValue{StringField{"nobody"}, NullField{}}}
+	insertTupleForTest(t, hf, &t1, tid)
+	insertTupleForTest(t, hf, &t2, tid)
+	insertTupleForTest(t, hf, &tNull, tid)
+
+	var f FieldType = FieldType{"age", "", IntType}
+	cases := []struct {
+		constExpr Expr
+		op        BoolOp
+		expected  int
+	}{
+		{&ConstExpr{NullField{}, UnknownType}, OpIsNull, 1},
+		{&ConstExpr{NullField{}, UnknownType}, OpIsNotNull, 2},
+		{&ConstExpr{IntField{25}, IntType}, OpGe, 2},
+		{&ConstExpr{IntField{25}, IntType}, OpNeq, 1},
+		{&ConstExpr{NullField{}, UnknownType}, OpEq, 0},
+	}
+	for _, c := range cases {
+		filt, err := NewFilter(c.constExpr, c.op, &FieldExpr{f}, hf)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		iter, err := filt.Iterator(tid)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		cnt := 0
+		for {
+			tup, err := iter()
+			if err != nil {
+				t.Fatalf(err.Error())
+			}
+			if tup == nil {
+				break
+			}
+			cnt++
+		}
+		if cnt != c.expected {
+			t.Errorf("filter age%s%v returned %d tuples, expected %d", c.op, exprToStr(c.constExpr), cnt, c.expected)
+		}
+	}
+}
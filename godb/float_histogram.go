@@ -0,0 +1,101 @@
+package godb
+
+import (
+	"fmt"
+)
+
+// FloatHistogram is a fixed-width histogram over a single float field.
+//
+// Unlike an [IntHistogram], the values in a bin are continuous, so range
+// predicates are estimated by linearly interpolating within the bins, and
+// equality predicates assume that the values within a bin are distinct.
+type FloatHistogram struct {
+	bins     []int64
+	min      float64
+	max      float64
+	n        int64
+	binWidth float64
+}
+
+// NewFloatHistogram creates a new FloatHistogram with the specified number of
+// bins.
+//
+// Min and max specify the range of values that the histogram will cover
+// (inclusive).
+func NewFloatHistogram(nBins int64, vMin float64, vMax float64) (*FloatHistogram, error) {
+	if nBins <= 0 {
+		return nil, fmt.Errorf("nBins must be positive")
+	}
+	if vMin > vMax {
+		return nil, fmt.Errorf("min must be less than or equal to max")
+	}
+	bins := make([]int64, nBins)
+	binWidth := (vMax - vMin) / float64(nBins)
+	return &FloatHistogram{bins, vMin, vMax, 0, binWidth}, nil
+}
+
+func (h *FloatHistogram) bin(v float64) int64 {
+	if h.binWidth == 0 {
+		return 0
+	}
+	bin := int64((v - h.min) / h.binWidth)
+	return max(0, min(bin, int64(len(h.bins)-1)))
+}
+
+// Add a value v to the histogram.
+func (h *FloatHistogram) AddValue(v float64) {
+	h.bins[h.bin(v)]++
+	h.n++
+}
+
+// Return the fraction of values in the histogram that are less than v.
+func (h *FloatHistogram) fractionBelow(v float64) float64 {
+	if v <= h.min {
+		return 0.0
+	}
+	if v > h.max {
+		return 1.0
+	}
+	if h.binWidth == 0 {
+		// all values are equal to h.min, so none are below v
+		return 0.0
+	}
+	b := h.bin(v)
+	total := 0.0
+	for i := int64(0); i < b; i++ {
+		total += float64(h.bins[i])
+	}
+	binL := h.min + h.binWidth*float64(b)
+	total += float64(h.bins[b]) * min(1.0, (v-binL)/h.binWidth)
+	return total / float64(h.n)
+}
+
+// Estimate the selectivity of a predicate and operand on the values represented
+// by this histogram.
+//
+// For example, if op is OpLt and v is 10.5, return the fraction of values that
+// are less than 10.5.
+func (h *FloatHistogram) EstimateSelectivity(op BoolOp, v float64) float64 {
+	if h.n == 0 {
+		return 0.0
+	}
+	eq := 0.0
+	if v >= h.min && v <= h.max && h.bins[h.bin(v)] > 0 {
+		eq = 1.0 / float64(h.n)
+	}
+	switch op {
+	case OpLt:
+		return h.fractionBelow(v)
+	case OpLe:
+		return min(1.0, h.fractionBelow(v)+eq)
+	case OpGt:
+		return max(0.0, 1.0-h.fractionBelow(v)-eq)
+	case OpGe:
+		return 1.0 - h.fractionBelow(v)
+	case OpEq:
+		return eq
+	case OpNeq:
+		return 1.0 - eq
+	}
+	return 1.0
+}
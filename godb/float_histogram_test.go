@@ -0,0 +1,59 @@
+package godb
+
+import (
+	"math"
+	"testing"
+)
+
+func TestFloatHistogram(t *testing.T) {
+	h, err := NewFloatHistogram(100, 0, 1)
+	if err != nil {
+		t.Fatalf("Failed to create histogram: %v", err)
+	}
+	for c := 0; c < 1000; c++ {
+		h.AddValue(float64(c) / 999)
+	}
+
+	checks := []struct {
+		op       BoolOp
+		v        float64
+		expected float64
+	}{
+		{OpLt, 0.25, 0.25},
+		{OpGe, 0.25, 0.75},
+		{OpGt, 0.5, 0.5},
+		{OpLe, 0.9, 0.9},
+		{OpLt, -1, 0},
+		{OpGt, 2, 0},
+		{OpLe, 2, 1},
+	}
+	for _, c := range checks {
+		sel := h.EstimateSelectivity(c.op, c.v)
+		if math.Abs(sel-c.expected) > 0.02 {
+			t.Errorf("selectivity of %s %v should be about %v, got %v", c.op, c.v, c.expected, sel)
+		}
+	}
+
+	if sel := h.EstimateSelectivity(OpEq, 0.5); sel <= 0 || sel > 0.01 {
+		t.Errorf("selectivity of = 0.5 should be small but non-zero, got %v", sel)
+	}
+	if sel := h.EstimateSelectivity(OpEq, 5); sel != 0 {
+		t.Errorf("selectivity of = 5 should be 0, got %v", sel)
+	}
+}
+
+func TestFloatHistogramSingleValue(t *testing.T) {
+	h, err := NewFloatHistogram(10, 2.5, 2.5)
+	if err != nil {
+		t.Fatalf("Failed to create histogram: %v", err)
+	}
+	for c := 0; c < 10; c++ {
+		h.AddValue(2.5)
+	}
+	if sel := h.EstimateSelectivity(OpGe, 2.5); sel != 1 {
+		t.Errorf("selectivity of >= 2.5 should be 1, got %v", sel)
+	}
+	if sel := h.EstimateSelectivity(OpLt, 2.5); sel != 0 {
+		t.Errorf("selectivity of < 2.5 should be 0, got %v", sel)
+	}
+}
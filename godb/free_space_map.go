@@ -0,0 +1,132 @@
+package godb
+
+import (
+	"io"
+	"os"
+	"sync"
+)
+
+// A freeSpaceMap records the approximate free space on each page of a
+// [HeapFile], so that inserts can go straight to a page with room for the
+// tuple instead of reading every page of the file.
+//
+// The map is stored next to the heap file, in a file with the same name and a
+// .fsm suffix. It holds one byte per page: the free space on the page, in
+// units of PageSize/256 bytes, rounded down. An entry is written to disk when
+// its page is, so that after a restart the map describes the pages on disk.
+// The map is only a hint -- it is never logged, and an entry that is missing
+// or wrong only costs a page read, after which the entry is corrected.
+type freeSpaceMap struct {
+	fileName string
+	free     []uint8
+	// the page the last search returned; searches start here, so that an
+	// inserter keeps filling the same page until it is full
+	next int
+	sync.Mutex
+}
+
+// The largest free space category, which is also used for pages that are
+// missing from the map, so that they are checked by the next insert.
+const fsmMaxCategory = 255
+
+// Return the number of bytes of free space that each category of the map
+// represents.
+func fsmUnit() int {
+	return (PageSize + fsmMaxCategory) / (fsmMaxCategory + 1)
+}
+
+// Return the category recorded for a page with the specified free space.
+func fsmCategory(freeSpace int) uint8 {
+	if freeSpace <= 0 {
+		return 0
+	}
+	return uint8(min(freeSpace/fsmUnit(), fsmMaxCategory))
+}
+
+// Open the free space map of the heap file backed by fileName, which has
+// numPages pages. Pages that the map doesn't have an entry for, for example
+// because the heap file was created before the map, are assumed to have free
+// space.
+func openFreeSpaceMap(fileName string, numPages int) (*freeSpaceMap, error) {
+	m := &freeSpaceMap{fileName: fileName + ".fsm"}
+	file, err := os.OpenFile(m.fileName, os.O_CREATE|os.O_RDONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	m.free = make([]uint8, numPages)
+	n, err := io.ReadFull(file, m.free)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+	for p := n; p < numPages; p++ {
+		m.free[p] = fsmMaxCategory
+	}
+	return m, nil
+}
+
+// Record the free space of a page in memory. Pages past the end of the map
+// are added to it.
+func (m *freeSpaceMap) update(pageNo int, freeSpace int) {
+	m.Lock()
+	defer m.Unlock()
+	for len(m.free) <= pageNo {
+		m.free = append(m.free, fsmMaxCategory)
+	}
+	m.free[pageNo] = fsmCategory(freeSpace)
+}
+
+// Record the free space of a page that was written to disk, in memory and in
+// the map on disk.
+func (m *freeSpaceMap) flush(pageNo int, freeSpace int) error {
+	m.update(pageNo, freeSpace)
+	file, err := os.OpenFile(m.fileName, os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = file.WriteAt([]byte{fsmCategory(freeSpace)}, int64(pageNo))
+	return err
+}
+
+// Delete the map from disk, when its heap file is dropped (see
+// [HeapFile.remove]).
+func (m *freeSpaceMap) remove() error {
+	m.Lock()
+	defer m.Unlock()
+	if err := os.Remove(m.fileName); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Find a page that probably has at least needed bytes of free space, starting
+// at the page the last search returned and wrapping around to the start of the
+// map. Pages for which skip returns true are passed over; the caller uses it
+// to avoid pages it already tried, and pages locked by other transactions.
+// Returns -1 if there is no such page.
+//
+// skip is called without holding the lock on the map.
+func (m *freeSpaceMap) search(needed int, skip func(pageNo int) bool) int {
+	want := uint8(min((needed+fsmUnit()-1)/fsmUnit(), fsmMaxCategory))
+	m.Lock()
+	numPages, start := len(m.free), m.next
+	m.Unlock()
+	for i := 0; i < numPages; i++ {
+		m.Lock()
+		for i < numPages && m.free[(start+i)%numPages] < want {
+			i++
+		}
+		m.Unlock()
+		if i == numPages {
+			break
+		}
+		if p := (start + i) % numPages; !skip(p) {
+			m.Lock()
+			m.next = p
+			m.Unlock()
+			return p
+		}
+	}
+	return -1
+}
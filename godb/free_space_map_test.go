@@ -0,0 +1,130 @@
+package godb
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// Fill the first pages of a heap file, then delete some of the tuples on page
+// 1, committing both transactions.
+func makeFreeSpaceTestFile(t *testing.T) (*BufferPool, *HeapFile, []Tuple) {
+	t.Helper()
+	bp, hf := makeTestFile(t, 100)
+	td, _, _ := makeTupleTestVars()
+	tups := make([]Tuple, 600)
+	for i := range tups {
+		tups[i] = Tuple{Desc: td, Fields: []DBValue{StringField{fmt.Sprintf("name%d", i)}, IntField{int64(i)}}}
+	}
+	tid := BeginTransactionForTest(t, bp)
+	for i := range tups {
+		insertTupleForTest(t, hf, &tups[i], tid)
+	}
+	flushAndCommitForTest(t, bp, tid)
+	if hf.NumPages() < 4 {
+		t.Fatalf("expected the tuples to fill at least 4 pages, got %d", hf.NumPages())
+	}
+
+	tid = BeginTransactionForTest(t, bp)
+	for i := range tups {
+		if tups[i].Rid.(heapFileRid).pageNo == 1 && i%2 == 0 {
+			if err := hf.deleteTuple(&tups[i], tid); err != nil {
+				t.Fatalf(err.Error())
+			}
+		}
+	}
+	flushAndCommitForTest(t, bp, tid)
+	return bp, hf, tups
+}
+
+func TestFreeSpaceMapReopen(t *testing.T) {
+	_, hf, tups := makeFreeSpaceTestFile(t)
+	numPages := hf.NumPages()
+
+	// the map is read back from disk, and matches the pages
+	bp, _, err := MakeTestDatabase(10, "catalog.txt")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	hf2, err := NewHeapFile(hf.BackingFile(), hf.Descriptor(), bp)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	for p := 0; p < numPages; p++ {
+		if hf2.fsm.free[p] != hf.fsm.free[p] {
+			t.Errorf("expected free space category %d for page %d after reopening, got %d", hf.fsm.free[p], p, hf2.fsm.free[p])
+		}
+	}
+	if hf2.fsm.free[0] != 0 || hf2.fsm.free[1] == 0 {
+		t.Errorf("expected page 0 to be full and page 1 to have free space, got %v", hf2.fsm.free)
+	}
+
+	// an insert goes straight to the page with free space, without reading
+	// the full pages before it
+	tid := BeginTransactionForTest(t, bp)
+	tup := Tuple{Desc: *hf.Descriptor(), Fields: []DBValue{StringField{"new"}, IntField{1}}}
+	insertTupleForTest(t, hf2, &tup, tid)
+	if p := tup.Rid.(heapFileRid).pageNo; p != 1 {
+		t.Errorf("expected the tuple to be inserted into page 1, got page %d", p)
+	}
+	if bp.numCachedPages() != 1 {
+		t.Errorf("expected the insert to read 1 page, but it read %d", bp.numCachedPages())
+	}
+	if hf2.NumPages() != numPages {
+		t.Errorf("expected the insert to reuse free space, but the file grew to %d pages", hf2.NumPages())
+	}
+	flushAndCommitForTest(t, bp, tid)
+
+	// the space freed by the deletes is used before the file grows
+	tid = BeginTransactionForTest(t, bp)
+	defer bp.CommitTransaction(tid)
+	deleted := 0
+	for i := range tups {
+		if tups[i].Rid.(heapFileRid).pageNo == 1 && i%2 == 0 {
+			deleted++
+		}
+	}
+	for i := 1; i < deleted; i++ {
+		tup := Tuple{Desc: *hf.Descriptor(), Fields: []DBValue{StringField{fmt.Sprintf("new%d", i)}, IntField{1}}}
+		insertTupleForTest(t, hf2, &tup, tid)
+	}
+	if hf2.NumPages() != numPages {
+		t.Errorf("expected the inserts to reuse the deleted slots, but the file grew to %d pages", hf2.NumPages())
+	}
+}
+
+func TestFreeSpaceMapConcurrentInserters(t *testing.T) {
+	bp, hf, _ := makeFreeSpaceTestFile(t)
+	numPages := hf.NumPages()
+	td := *hf.Descriptor()
+
+	tid1 := BeginTransactionForTest(t, bp)
+	defer bp.CommitTransaction(tid1)
+	t1 := Tuple{Desc: td, Fields: []DBValue{StringField{"first"}, IntField{1}}}
+	insertTupleForTest(t, hf, &t1, tid1)
+
+	// a second inserter only locks the record it inserts, so it doesn't wait
+	// for the first to commit, even if it uses the same page
+	tid2 := BeginTransactionForTest(t, bp)
+	defer bp.CommitTransaction(tid2)
+	t2 := Tuple{Desc: td, Fields: []DBValue{StringField{"second"}, IntField{2}}}
+	done := make(chan error)
+	go func() {
+		done <- hf.insertTuple(&t2, tid2)
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("second inserter is waiting for the lock held by the first")
+	}
+	p1, p2 := t1.Rid.(heapFileRid).pageNo, t2.Rid.(heapFileRid).pageNo
+	if p1 >= numPages || p2 >= numPages {
+		t.Errorf("expected the inserters to reuse free space, but they used pages %d and %d", p1, p2)
+	}
+	if t1.Rid == t2.Rid {
+		t.Errorf("expected concurrent inserters to use different slots, both used %v", t1.Rid)
+	}
+}
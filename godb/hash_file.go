@@ -0,0 +1,524 @@
+package godb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"os"
+	"sync"
+)
+
+// A HashFile is a disk-resident linear hash index on one field of a
+// [HeapFile]. It implements the [Index] interface, and can only find the
+// tuples whose field is equal to a value.
+//
+// Entries are assigned to buckets by the hash of their key. Each bucket is a
+// chain of pages, which are read and locked through the buffer pool like the
+// pages of a heap file (see [hashPage] for their format). When an insert has to
+// add a page to a bucket, the next bucket in order is split in two, so that the
+// number of buckets grows with the number of entries. Once the directory page
+// is full, buckets are no longer split, and their chains just get longer.
+type HashFile struct {
+	table       *HeapFile
+	field       FieldType
+	fieldNo     int       // the position of the indexed field in the table
+	entryDesc   TupleDesc // the key, page number and slot number of an entry
+	numPages    int
+	backingFile string
+	bufPool     *BufferPool
+	sync.Mutex
+}
+
+// The number of buckets of a new hash index.
+const hashInitialBuckets = 4
+
+// Create a HashFile.
+// Parameters
+// - fromFile: backing file for the HashFile. May be empty or a previously created index.
+// - table: the HeapFile that is indexed.
+// - field: the name of the field of table that is indexed.
+// - bp: the BufferPool that is used to store pages read from the HashFile
+// May return an error if the file cannot be opened or created, or if the
+// field doesn't exist.
+func NewHashFile(fromFile string, table *HeapFile, field string, bp *BufferPool) (*HashFile, error) {
+	td := table.Descriptor()
+	fieldNo, err := findFieldInTd(FieldType{field, "", UnknownType}, td)
+	if err != nil {
+		return nil, err
+	}
+	keyField := td.Fields[fieldNo]
+
+	f, err := os.OpenFile(fromFile, os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	hf := &HashFile{table, keyField, fieldNo, indexEntryDesc(keyField), int(fi.Size() / int64(PageSize)), fromFile, bp, sync.Mutex{}}
+	if hf.numPages == 0 {
+		// a new index starts with a directory page and empty buckets
+		dir := newHashPage(0, true, hf)
+		for i := 1; i <= hashInitialBuckets; i++ {
+			dir.buckets = append(dir.buckets, i)
+			if err := hf.flushPage(newHashPage(i, false, hf)); err != nil {
+				return nil, err
+			}
+		}
+		if err := hf.flushPage(dir); err != nil {
+			return nil, err
+		}
+		hf.numPages = hashInitialBuckets + 1
+	}
+	return hf, nil
+}
+
+// Return the name of the backing file
+func (f *HashFile) BackingFile() string {
+	return f.backingFile
+}
+
+// Return the number of pages in the index
+func (f *HashFile) NumPages() int {
+	f.Lock()
+	defer f.Unlock()
+	return f.numPages
+}
+
+// Return the field of the table that is indexed.
+func (f *HashFile) keyField() FieldType {
+	return f.field
+}
+
+// A hash index can only find the tuples for equality predicates.
+func (f *HashFile) supportsOp(op BoolOp) bool {
+	return op == OpEq
+}
+
+// Estimate the number of pages read by a lookup: the directory page, plus the
+// pages of the bucket that holds the matching entries.
+func (f *HashFile) estimatePagesRead(selectivity float64) int {
+	return 1 + max(1, int(math.Ceil(selectivity*float64(f.NumPages()))))
+}
+
+// Hash a key. Keys that are equal have the same hash, as long as they have
+// the type of the indexed field (see [HashFile.probeKey]).
+func hashIndexKey(v DBValue) uint64 {
+	h := fnv.New64a()
+	var x int64
+	switch v := v.(type) {
+	case StringField:
+		h.Write([]byte(v.Value))
+		return h.Sum64()
+	case IntField:
+		x = v.Value
+	case FloatField:
+		// 0 and -0 are equal
+		if v.Value != 0 {
+			x = int64(math.Float64bits(v.Value))
+		}
+	case DecimalField:
+		// decimals with different scales may be equal
+		for v.Scale > 0 && v.Value%10 == 0 {
+			v.Value /= 10
+			v.Scale--
+		}
+		x = v.Value*31 + int64(v.Scale)
+	case DateField:
+		x = v.Value
+	case TimestampField:
+		x = v.Value
+	case IntervalField:
+		// intervals are equal if they have the same approximate length
+		x = v.approxMicros()
+	}
+	binary.Write(h, binary.LittleEndian, x)
+	return h.Sum64()
+}
+
+// Convert a value that is looked up in the index to the type of the indexed
+// field, so that it can be hashed. Returns false if it can't be converted, in
+// which case equal keys may have a different hash.
+func (f *HashFile) probeKey(v DBValue) (DBValue, bool) {
+	var err error
+	if f.field.Ftype.isDecimal() {
+		// decimals are compared exactly, so they aren't rounded to the scale
+		// of the field
+		v, err = toDecimal(v)
+	} else {
+		v, err = coerceValue(v, f.field.Ftype)
+	}
+	if err != nil {
+		return nil, false
+	}
+	return v, typeOfValue(v).baseType() == f.field.Ftype.baseType()
+}
+
+// Return the bucket that holds the entries with the specified hash, given the
+// directory page.
+func (p *hashPage) bucketFor(h uint64) int {
+	n := uint64(hashInitialBuckets << p.level)
+	b := h % n
+	if b < uint64(p.next) {
+		// the bucket has already been split in this round
+		b = h % (2 * n)
+	}
+	return int(b)
+}
+
+// Pin the specified page of the index in the buffer pool, like
+// [BTreeFile.pinPage]. The caller must release the handle once it is done
+// with the page.
+func (f *HashFile) pinPage(pageNo int, tid TransactionID, perm RWPerm) (*hashPage, *PageHandle, error) {
+	h, err := f.bufPool.PinPage(f, pageNo, tid, perm)
+	if err != nil {
+		return nil, nil, err
+	}
+	return h.Page.(*hashPage), h, nil
+}
+
+// Append a new, empty bucket page to the file and return its page number.
+func (f *HashFile) newPage() (int, error) {
+	f.Lock()
+	defer f.Unlock()
+	pageNo := f.numPages
+	// flush an empty page to later add to buffer pool, like HeapFile does
+	err := f.flushPage(newHashPage(pageNo, false, f))
+	if err != nil {
+		return 0, err
+	}
+	f.numPages++
+	return pageNo, nil
+}
+
+// Return the first page of the bucket for a key, read locking the directory
+// page.
+func (f *HashFile) bucketPage(key DBValue, tid TransactionID) (int, error) {
+	dir, h, err := f.pinPage(0, tid, ReadPerm)
+	if err != nil {
+		return 0, err
+	}
+	defer h.Release()
+	return dir.buckets[dir.bucketFor(hashIndexKey(key))], nil
+}
+
+// Add an entry for the tuple, which must have been inserted into the table,
+// to the index. Tuples with a NULL key are not indexed.
+//
+// The entry is added to the first page of its bucket with enough free space.
+// If there is none, a page is added to the end of the bucket and the next
+// bucket is split.
+func (f *HashFile) insertTuple(t *Tuple, tid TransactionID) error {
+	e, err := indexEntryFor(t, f.fieldNo)
+	if err != nil || e == nil {
+		return err
+	}
+	if size := e.tuple(&f.entryDesc).serializedSize(); size > PageSize-hashHeaderSize {
+		return GoDBError{MalformedDataError, fmt.Sprintf("key of %d bytes is too large to index", size)}
+	}
+	pageNo, err := f.bucketPage(e.key, tid)
+	if err != nil {
+		return err
+	}
+	var last int
+	for pageNo != -1 {
+		pg, h, err := f.pinPage(pageNo, tid, WritePerm)
+		if err != nil {
+			return err
+		}
+		inserted := pg.insertEntry(e)
+		if inserted {
+			pg.setDirty(tid, true)
+		}
+		last, pageNo = pageNo, pg.overflow
+		h.Release()
+		if inserted {
+			return nil
+		}
+	}
+
+	pageNo, err = f.newPage()
+	if err != nil {
+		return err
+	}
+	if err := f.appendPage(last, pageNo, tid, func(pg *hashPage) { pg.insertEntry(e) }); err != nil {
+		return err
+	}
+	return f.split(tid)
+}
+
+// Link the new page newNo to the end of a bucket, after the page last, and
+// fill it with fill. Both pages are pinned while they are changed.
+func (f *HashFile) appendPage(last int, newNo int, tid TransactionID, fill func(pg *hashPage)) error {
+	prev, ph, err := f.pinPage(last, tid, WritePerm)
+	if err != nil {
+		return err
+	}
+	defer ph.Release()
+	pg, h, err := f.pinPage(newNo, tid, WritePerm)
+	if err != nil {
+		return err
+	}
+	defer h.Release()
+	fill(pg)
+	pg.setDirty(tid, true)
+	prev.overflow = newNo
+	prev.setDirty(tid, true)
+	return nil
+}
+
+// Split the next bucket in two, moving the entries whose hash now selects the
+// new bucket into it. Does nothing if the directory page is full.
+func (f *HashFile) split(tid TransactionID) error {
+	dir, h, err := f.pinPage(0, tid, WritePerm)
+	if err != nil {
+		return err
+	}
+	defer h.Release()
+	if len(dir.buckets) >= hashMaxBuckets() {
+		return nil
+	}
+	newNo, err := f.newPage()
+	if err != nil {
+		return err
+	}
+	n := hashInitialBuckets << dir.level
+	bucket, newBucket := dir.next, len(dir.buckets)
+	firstPage := dir.buckets[bucket]
+	dir.buckets = append(dir.buckets, newNo)
+	dir.next++
+	if dir.next == n {
+		dir.level++
+		dir.next = 0
+	}
+	dir.setDirty(tid, true)
+
+	var pageNos []int
+	var stay, move []*indexEntry
+	for pageNo := firstPage; pageNo != -1; {
+		pg, h, err := f.pinPage(pageNo, tid, WritePerm)
+		if err != nil {
+			return err
+		}
+		for _, e := range pg.entries {
+			if hashIndexKey(e.key)%uint64(2*n) == uint64(newBucket) {
+				move = append(move, e)
+			} else {
+				stay = append(stay, e)
+			}
+		}
+		pageNos = append(pageNos, pageNo)
+		pageNo = pg.overflow
+		h.Release()
+	}
+	if err := f.fillBucket(pageNos, stay, tid); err != nil {
+		return err
+	}
+	return f.fillBucket([]int{newNo}, move, tid)
+}
+
+// Replace the entries of the pages of a bucket with the specified entries,
+// adding pages to the end of the bucket if they don't fit.
+func (f *HashFile) fillBucket(pageNos []int, entries []*indexEntry, tid TransactionID) error {
+	fill := func(pg *hashPage) {
+		pg.entries, pg.usedBytes = nil, 0
+		for len(entries) > 0 && pg.insertEntry(entries[0]) {
+			entries = entries[1:]
+		}
+	}
+	for i := 0; i < len(pageNos) || len(entries) > 0; i++ {
+		if i == len(pageNos) {
+			pageNo, err := f.newPage()
+			if err != nil {
+				return err
+			}
+			if err := f.appendPage(pageNos[i-1], pageNo, tid, fill); err != nil {
+				return err
+			}
+			pageNos = append(pageNos, pageNo)
+			continue
+		}
+		pg, h, err := f.pinPage(pageNos[i], tid, WritePerm)
+		if err != nil {
+			return err
+		}
+		fill(pg)
+		pg.setDirty(tid, true)
+		h.Release()
+	}
+	return nil
+}
+
+// Remove the entry for the tuple, which must have been deleted from the
+// table, from the index.
+func (f *HashFile) deleteTuple(t *Tuple, tid TransactionID) error {
+	e, err := indexEntryFor(t, f.fieldNo)
+	if err != nil || e == nil {
+		return err
+	}
+	pageNo, err := f.bucketPage(e.key, tid)
+	if err != nil {
+		return err
+	}
+	for pageNo != -1 {
+		pg, h, err := f.pinPage(pageNo, tid, WritePerm)
+		if err != nil {
+			return err
+		}
+		deleted := pg.deleteEntry(e)
+		if deleted {
+			pg.setDirty(tid, true)
+		}
+		pageNo = pg.overflow
+		h.Release()
+		if deleted {
+			return nil
+		}
+	}
+	return GoDBError{TupleNotFoundError, "index entry not found on delete"}
+}
+
+// Return an iterator over the entries of the buckets that start at the
+// specified pages. The pages are read locked as they are reached.
+func (f *HashFile) entryIter(firstPages []int, tid TransactionID) func() (*indexEntry, error) {
+	var entries []*indexEntry
+	next := -1
+	return func() (*indexEntry, error) {
+		for len(entries) == 0 {
+			if next == -1 {
+				if len(firstPages) == 0 {
+					return nil, nil
+				}
+				next, firstPages = firstPages[0], firstPages[1:]
+			}
+			pg, h, err := f.pinPage(next, tid, ReadPerm)
+			if err != nil {
+				return nil, err
+			}
+			// copy the entries of each page, in case the transaction modifies
+			// the index while iterating
+			entries = append([]*indexEntry{}, pg.entries...)
+			next = pg.overflow
+			h.Release()
+		}
+		e := entries[0]
+		entries = entries[1:]
+		return e, nil
+	}
+}
+
+// Return an iterator over the record ids of the tuples whose key is equal to
+// value.
+func (f *HashFile) lookup(op BoolOp, value DBValue, tid TransactionID) (func() (recordID, error), error) {
+	if !f.supportsOp(op) {
+		return nil, GoDBError{IllegalOperationError, fmt.Sprintf("hash index does not support %s", op)}
+	}
+	// NULL is never equal to any key
+	if isNull(value) {
+		return func() (recordID, error) { return nil, nil }, nil
+	}
+	var firstPages []int
+	if key, ok := f.probeKey(value); ok {
+		pageNo, err := f.bucketPage(key, tid)
+		if err != nil {
+			return nil, err
+		}
+		firstPages = []int{pageNo}
+	} else {
+		// a value of another type may be equal to keys with a different hash,
+		// so every bucket is searched
+		dir, h, err := f.pinPage(0, tid, ReadPerm)
+		if err != nil {
+			return nil, err
+		}
+		firstPages = append(firstPages, dir.buckets...)
+		h.Release()
+	}
+	iter := f.entryIter(firstPages, tid)
+	return func() (recordID, error) {
+		for {
+			e, err := iter()
+			if err != nil || e == nil {
+				return nil, err
+			}
+			if e.key.EvalPred(value, OpEq) {
+				return e.rid, nil
+			}
+		}
+	}, nil
+}
+
+// Read the specified page number from the HashFile on disk.
+func (f *HashFile) readPage(pageNo int) (Page, error) {
+	b, err := readPageBytes(f.backingFile, pageNo)
+	if err != nil {
+		return nil, err
+	}
+	return f.pageFromBuffer(pageNo, bytes.NewBuffer(b))
+}
+
+// Construct the index page with the specified page number from its contents,
+// which were read from disk or from the log.
+func (f *HashFile) pageFromBuffer(pageNo int, buf *bytes.Buffer) (Page, error) {
+	pg := newHashPage(pageNo, false, f)
+	if err := pg.initFromBuffer(buf); err != nil {
+		return nil, err
+	}
+	return pg, nil
+}
+
+// Write the page back to its location in the backing file.
+func (f *HashFile) flushPage(p Page) error {
+	file, err := os.OpenFile(f.backingFile, os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	pg := p.(*hashPage)
+	buf, err := pg.toBuffer()
+	if err != nil {
+		return err
+	}
+	_, err = file.WriteAt(buf.Bytes(), int64(pg.pageNo*PageSize))
+	return err
+}
+
+// [Operator] descriptor method -- the index entries are tuples with the key,
+// and the page and slot numbers of the tuple in the table.
+func (f *HashFile) Descriptor() *TupleDesc {
+	return &f.entryDesc
+}
+
+// [Operator] iterator method -- return the entries of the index, bucket by
+// bucket.
+func (f *HashFile) Iterator(tid TransactionID) (func() (*Tuple, error), error) {
+	dir, h, err := f.pinPage(0, tid, ReadPerm)
+	if err != nil {
+		return nil, err
+	}
+	iter := f.entryIter(append([]int{}, dir.buckets...), tid)
+	h.Release()
+	return func() (*Tuple, error) {
+		e, err := iter()
+		if err != nil || e == nil {
+			return nil, err
+		}
+		return e.tuple(&f.entryDesc), nil
+	}, nil
+}
+
+// internal structure to use as key for a hash index page; see [btreeHash].
+type hashIndexHash struct {
+	file   *HashFile
+	pageNo int
+}
+
+// This method returns a key for a page to use in a map object, used by
+// BufferPool to determine if a page is cached or not.
+func (f *HashFile) pageKey(pgNo int) any {
+	return hashIndexHash{f, pgNo}
+}
@@ -0,0 +1,194 @@
+package godb
+
+import (
+	"fmt"
+	"os"
+	"testing"
+)
+
+// Create a table "test" with the name and age fields, and a hash index named
+// test_<field> on one of its fields.
+func makeHashTestVars(t *testing.T, field string) (*BufferPool, *HeapFile, *HashFile) {
+	t.Helper()
+	os.Remove(TestingFile)
+	bp, c, err := MakeTestDatabase(100, "catalog.txt")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	td, _, _ := makeTupleTestVars()
+	tbl, err := c.addTable("test", td)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if err := c.createIndex("test_"+field, "test", field, "hash"); err != nil {
+		t.Fatalf(err.Error())
+	}
+	info, err := c.GetIndexInfo("test_" + field)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	return bp, tbl.(*HeapFile), info.file.(*HashFile)
+}
+
+func countHashEntriesForTest(t *testing.T, idx Index, tid TransactionID) int {
+	t.Helper()
+	iter, err := idx.Iterator(tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	cnt := 0
+	for {
+		tup, err := iter()
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if tup == nil {
+			return cnt
+		}
+		cnt++
+	}
+}
+
+func TestHashIndexInsertLookup(t *testing.T) {
+	bp, hf, idx := makeHashTestVars(t, "age")
+	td, _, _ := makeTupleTestVars()
+
+	tups := make([]Tuple, 3000)
+	for i := range tups {
+		tups[i] = Tuple{Desc: td, Fields: []DBValue{StringField{fmt.Sprintf("name%d", i)}, IntField{int64((i * 7) % 1000)}}}
+	}
+	// NULL keys are not indexed
+	tups[2999].Fields[1] = NullField{}
+	tid := BeginTransactionForTest(t, bp)
+	insertIndexedTuplesForTest(t, hf, tups, tid)
+	flushAndCommitForTest(t, bp, tid)
+
+	tid = BeginTransactionForTest(t, bp)
+	defer bp.CommitTransaction(tid)
+	dir, _, err := idx.pinPage(0, tid, ReadPerm)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if len(dir.buckets) <= hashInitialBuckets {
+		t.Errorf("expected buckets to be split, but the index has %d buckets", len(dir.buckets))
+	}
+	if n := countHashEntriesForTest(t, idx, tid); n != 2999 {
+		t.Errorf("expected 2999 index entries, got %d", n)
+	}
+
+	lookups := []struct {
+		v        DBValue
+		expected int
+	}{
+		{IntField{0}, 3},
+		{IntField{7}, 3},
+		{IntField{993}, 2}, // the last tuple, with key 993, is NULL
+		{IntField{1000}, 0},
+		{NullField{}, 0},
+		// values of another type that are equal to a key are found too
+		{FloatField{7}, 3},
+		{FloatField{7.5}, 0},
+		{DecimalField{700, 2}, 3},
+	}
+	for _, l := range lookups {
+		if n := countLookupForTest(t, idx, OpEq, l.v, tid); n != l.expected {
+			t.Errorf("expected %d entries for age = %v, got %d", l.expected, l.v, n)
+		}
+	}
+	if _, err := idx.lookup(OpLt, IntField{7}, tid); err == nil {
+		t.Errorf("expected a range lookup in a hash index to fail")
+	}
+}
+
+func TestHashIndexDuplicateKeys(t *testing.T) {
+	bp, hf, idx := makeHashTestVars(t, "name")
+	td, _, _ := makeTupleTestVars()
+
+	// all the entries with the same key are in one bucket, which needs
+	// overflow pages
+	tups := make([]Tuple, 1500)
+	for i := range tups {
+		name := "same"
+		if i%3 == 0 {
+			name = fmt.Sprintf("other%d", i)
+		}
+		tups[i] = Tuple{Desc: td, Fields: []DBValue{StringField{name}, IntField{int64(i)}}}
+	}
+	tid := BeginTransactionForTest(t, bp)
+	insertIndexedTuplesForTest(t, hf, tups, tid)
+	flushAndCommitForTest(t, bp, tid)
+
+	tid = BeginTransactionForTest(t, bp)
+	defer bp.CommitTransaction(tid)
+	if n := countLookupForTest(t, idx, OpEq, StringField{"same"}, tid); n != 1000 {
+		t.Errorf("expected 1000 entries for name = same, got %d", n)
+	}
+	if n := countLookupForTest(t, idx, OpEq, StringField{"other3"}, tid); n != 1 {
+		t.Errorf("expected 1 entry for name = other3, got %d", n)
+	}
+	if n := countHashEntriesForTest(t, idx, tid); n != 1500 {
+		t.Errorf("expected 1500 index entries, got %d", n)
+	}
+}
+
+func TestHashIndexDeleteAndAbort(t *testing.T) {
+	bp, hf, idx := makeHashTestVars(t, "age")
+	td, _, _ := makeTupleTestVars()
+
+	tups := make([]Tuple, 1000)
+	for i := range tups {
+		tups[i] = Tuple{Desc: td, Fields: []DBValue{StringField{"name"}, IntField{int64(i % 100)}}}
+	}
+	tid := BeginTransactionForTest(t, bp)
+	insertIndexedTuplesForTest(t, hf, tups, tid)
+	flushAndCommitForTest(t, bp, tid)
+
+	tid = BeginTransactionForTest(t, bp)
+	for i := 0; i < len(tups); i += 2 {
+		if err := hf.deleteTuple(&tups[i], tid); err != nil {
+			t.Fatalf(err.Error())
+		}
+		if err := deleteFromIndexes(hf, &tups[i], tid); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	if err := deleteFromIndexes(hf, &tups[0], tid); err == nil {
+		t.Errorf("expected deleting an entry twice to fail")
+	}
+	flushAndCommitForTest(t, bp, tid)
+
+	tid = BeginTransactionForTest(t, bp)
+	if n := countLookupForTest(t, idx, OpEq, IntField{4}, tid); n != 0 {
+		t.Errorf("expected no entries for a deleted key, got %d", n)
+	}
+	if n := countLookupForTest(t, idx, OpEq, IntField{5}, tid); n != 10 {
+		t.Errorf("expected 10 entries for key 5, got %d", n)
+	}
+	dir, _, err := idx.pinPage(0, tid, ReadPerm)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	numBuckets := len(dir.buckets)
+
+	// entries inserted, and buckets split, by an aborted transaction are
+	// rolled back
+	more := make([]Tuple, 2000)
+	for i := range more {
+		more[i] = Tuple{Desc: td, Fields: []DBValue{StringField{"more"}, IntField{int64(i)}}}
+	}
+	insertIndexedTuplesForTest(t, hf, more, tid)
+	bp.AbortTransaction(tid)
+
+	tid = BeginTransactionForTest(t, bp)
+	defer bp.CommitTransaction(tid)
+	if n := countHashEntriesForTest(t, idx, tid); n != 500 {
+		t.Errorf("expected 500 index entries after abort, got %d", n)
+	}
+	dir, _, err = idx.pinPage(0, tid, ReadPerm)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if len(dir.buckets) != numBuckets {
+		t.Errorf("expected %d buckets after abort, got %d", numBuckets, len(dir.buckets))
+	}
+}
@@ -0,0 +1,273 @@
+package godb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sync"
+)
+
+/* hashPage implements the Page interface for the pages of a [HashFile].
+
+Page 0 of a hash index is its directory page, and every other page is a bucket
+page. All pages are PageSize bytes, and begin with the checksum of the page
+(see [ChecksumSize]). The directory page holds the state of the linear hashing
+scheme and the page number of the first page of each bucket:
+
++------------------------------------------------------------------------+
+| checksum (4 bytes) | kind (1 byte) | level (4 bytes) | next (4 bytes)  |
++------------------------------------------------------------------------+
+| numBuckets (4 bytes) | bucket 0 page (4 bytes) | ... | bucket n-1 page |
++------------------------------------------------------------------------+
+
+A bucket page holds index entries in no particular order, and has the same
+header as the leaves of a [BTreeFile]:
+
++--------------------------------------------------------------------------------+
+| checksum (4 bytes) | kind (1 byte) | numEntries (4 bytes) | overflow (4 bytes) |
++--------------------------------------------------------------------------------+
+| entry 0 | entry 1 | ... | entry n-1                                            |
++--------------------------------------------------------------------------------+
+| free space                                                                     |
++--------------------------------------------------------------------------------+
+
+The overflow link is the page number of the next page of the bucket, or -1 for
+the last page. Entries are serialized as tuples with the key, the page number
+and the slot number of the record id (see [HashFile.Descriptor]).
+*/
+
+type hashPage struct {
+	directory bool
+
+	// the directory page
+	level   int
+	next    int   // the next bucket to split
+	buckets []int // the first page of each bucket
+
+	// bucket pages
+	entries   []*indexEntry
+	overflow  int // the next page of the bucket, or -1
+	usedBytes int // bytes used by the entries
+
+	dirty   bool
+	pageNo  int
+	file    *HashFile
+	lastTxn TransactionID
+	bImage  Page
+	sync.Mutex
+}
+
+const (
+	hashBucketPage    int8 = 0
+	hashDirectoryPage int8 = 2
+
+	hashHeaderSize          = ChecksumSize + 9
+	hashDirectoryHeaderSize = ChecksumSize + 13
+)
+
+// The maximum number of buckets of a hash index, which is limited by the
+// number of page numbers that fit on the directory page.
+func hashMaxBuckets() int {
+	return (PageSize - hashDirectoryHeaderSize) / 4
+}
+
+// Construct a new, empty hash index page.
+func newHashPage(pageNo int, directory bool, f *HashFile) *hashPage {
+	return &hashPage{directory: directory, overflow: -1, pageNo: pageNo, file: f}
+}
+
+// Return the number of bytes an entry takes on a bucket page.
+func (p *hashPage) entrySize(e *indexEntry) int {
+	return e.tuple(&p.file.entryDesc).serializedSize()
+}
+
+// Return the number of bytes on a bucket page that are not used by the header
+// or entries.
+func (p *hashPage) getFreeSpace() int {
+	return PageSize - hashHeaderSize - p.usedBytes
+}
+
+func (p *hashPage) computeUsedBytes() {
+	p.usedBytes = 0
+	for _, e := range p.entries {
+		p.usedBytes += p.entrySize(e)
+	}
+}
+
+// Add an entry to a bucket page. Returns false if it doesn't fit.
+func (p *hashPage) insertEntry(e *indexEntry) bool {
+	size := p.entrySize(e)
+	if size > p.getFreeSpace() {
+		return false
+	}
+	p.entries = append(p.entries, e)
+	p.usedBytes += size
+	return true
+}
+
+// Remove an entry from a bucket page. Returns false if it isn't on the page.
+func (p *hashPage) deleteEntry(e *indexEntry) bool {
+	for i, e2 := range p.entries {
+		if e2.compare(e) == 0 {
+			p.usedBytes -= p.entrySize(e2)
+			p.entries = append(p.entries[:i], p.entries[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Page method - return whether or not the page is dirty
+func (p *hashPage) isDirty() bool {
+	p.Lock()
+	defer p.Unlock()
+	return p.dirty
+}
+
+// Page method - mark the page as dirty
+func (p *hashPage) setDirty(tid TransactionID, dirty bool) {
+	p.Lock()
+	defer p.Unlock()
+	p.lastTxn = tid
+	p.dirty = dirty
+}
+
+// Page method - return the HashFile for this page.
+func (p *hashPage) getFile() DBFile {
+	return p.file
+}
+
+// Returns the page number of the page.
+func (p *hashPage) PageNo() int {
+	return p.pageNo
+}
+
+// Returns the transaction that last dirtied the page.
+func (p *hashPage) lastTransaction() TransactionID {
+	return p.lastTxn
+}
+
+// Returns the before-image of the page. This is used for logging and recovery.
+func (p *hashPage) BeforeImage() Page {
+	return p.bImage
+}
+
+// Sets the before-image of the page to the current state of the page. Entries
+// are never modified in place, so the before-image can share them.
+func (p *hashPage) SetBeforeImage() {
+	p.bImage = &hashPage{
+		directory: p.directory,
+		level:     p.level,
+		next:      p.next,
+		buckets:   append([]int{}, p.buckets...),
+		entries:   append([]*indexEntry{}, p.entries...),
+		overflow:  p.overflow,
+		usedBytes: p.usedBytes,
+		dirty:     p.dirty,
+		pageNo:    p.pageNo,
+		file:      p.file,
+		lastTxn:   p.lastTxn,
+	}
+}
+
+// Allocate a new bytes.Buffer and write the page to it, in the format
+// described above.
+func (p *hashPage) toBuffer() (*bytes.Buffer, error) {
+	buf := new(bytes.Buffer)
+	// the checksum is filled in once the rest of the page is written
+	buf.Write(make([]byte, ChecksumSize))
+	var header []any
+	if p.directory {
+		if len(p.buckets) > hashMaxBuckets() {
+			return nil, GoDBError{MalformedDataError, "hash index has too many buckets for its directory page"}
+		}
+		header = []any{hashDirectoryPage, int32(p.level), int32(p.next), int32(len(p.buckets))}
+		for _, b := range p.buckets {
+			header = append(header, int32(b))
+		}
+	} else {
+		if p.getFreeSpace() < 0 {
+			return nil, GoDBError{MalformedDataError, "index entries are greater than page size"}
+		}
+		header = []any{hashBucketPage, int32(len(p.entries)), int32(p.overflow)}
+	}
+	for _, v := range header {
+		err := binary.Write(buf, binary.LittleEndian, v)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, e := range p.entries {
+		err := e.tuple(&p.file.entryDesc).writeTo(buf)
+		if err != nil {
+			return nil, err
+		}
+	}
+	buf.Write(make([]byte, PageSize-buf.Len()))
+	setPageChecksum(buf.Bytes())
+	return buf, nil
+}
+
+// Read the contents of the page from the supplied buffer. The checksum of the
+// page is verified by the caller.
+func (p *hashPage) initFromBuffer(buf *bytes.Buffer) error {
+	buf.Next(ChecksumSize)
+	var kind int8
+	err := binary.Read(buf, binary.LittleEndian, &kind)
+	if err != nil {
+		return err
+	}
+	p.directory = kind == hashDirectoryPage
+	p.entries = nil
+	p.buckets = nil
+	p.overflow = -1
+	switch kind {
+	case hashDirectoryPage:
+		var header [3]int32
+		err = binary.Read(buf, binary.LittleEndian, &header)
+		if err != nil {
+			return err
+		}
+		if header[2] < 0 || int(header[2]) > hashMaxBuckets() {
+			return GoDBError{MalformedDataError, fmt.Sprintf("invalid header in index page %d", p.pageNo)}
+		}
+		p.level, p.next = int(header[0]), int(header[1])
+		buckets := make([]int32, header[2])
+		err = binary.Read(buf, binary.LittleEndian, buckets)
+		if err != nil {
+			return err
+		}
+		p.buckets = make([]int, len(buckets))
+		for i, b := range buckets {
+			p.buckets[i] = int(b)
+		}
+	case hashBucketPage:
+		var numEntries, overflow int32
+		err = binary.Read(buf, binary.LittleEndian, &numEntries)
+		if err != nil {
+			return err
+		}
+		err = binary.Read(buf, binary.LittleEndian, &overflow)
+		if err != nil {
+			return err
+		}
+		if numEntries < 0 || int(numEntries) > PageSize {
+			return GoDBError{MalformedDataError, fmt.Sprintf("invalid header in index page %d", p.pageNo)}
+		}
+		p.overflow = int(overflow)
+		p.entries = make([]*indexEntry, numEntries)
+		for i := range p.entries {
+			t, err := readTupleFrom(buf, &p.file.entryDesc)
+			if err != nil {
+				return err
+			}
+			p.entries[i] = indexEntryFromTuple(t)
+		}
+	default:
+		return GoDBError{MalformedDataError, fmt.Sprintf("invalid header in index page %d", p.pageNo)}
+	}
+	p.computeUsedBytes()
+	p.dirty = false
+	p.SetBeforeImage()
+	return nil
+}
@@ -15,13 +15,21 @@ import (
 // HeapFile is a public class because external callers may wish to instantiate
 // database tables using the method [LoadFromCSV]
 type HeapFile struct {
-	td            *TupleDesc
-	numPages      int
-	backingFile   string
-	lastEmptyPage int
+	td          *TupleDesc
+	numPages    int
+	backingFile string
+	// the backing file, which is kept open so that reading or writing a page
+	// doesn't have to open it
+	file *os.File
+	// the approximate free space on each page, which is used to find a page
+	// to insert into
+	fsm *freeSpaceMap
 	// HeapFile should include the fields below;  you may want to add
 	// additional fields
 	bufPool *BufferPool
+	// the indexes on the file, which are maintained by the insert and delete
+	// operators
+	indexes []Index
 	sync.Mutex
 }
 
@@ -35,19 +43,38 @@ type heapFileRid struct {
 // - fromFile: backing file for the HeapFile.  May be empty or a previously created heap file.
 // - td: the TupleDesc for the HeapFile.
 // - bp: the BufferPool that is used to store pages read from the HeapFile
-// May return an error if the file cannot be opened or created.
+// May return an error if the file cannot be opened or created, or if it was
+// created with fields that don't match td.
+//
+// The first page of the file is a header page that records its fields (see
+// [heapFileHeader]), which is written when the file is created. The free
+// space map of the heap file is stored in a second file, with the same name
+// as the backing file and a .fsm suffix.
+//
+// The backing file stays open until the HeapFile is garbage collected.
 func NewHeapFile(fromFile string, td *TupleDesc, bp *BufferPool) (*HeapFile, error) {
-	f, err := os.OpenFile(fromFile, os.O_CREATE|os.O_WRONLY, 0644)
+	f, err := os.OpenFile(fromFile, os.O_CREATE|os.O_RDWR, 0644)
 	if err != nil {
 		return nil, err
 	}
-	defer f.Close()
 	fi, err := f.Stat()
 	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	err = initHeapFileHeader(fromFile, f, fi.Size(), td)
+	if err != nil {
+		f.Close()
 		return nil, err
 	}
-	numPages := fi.Size() / int64(PageSize)
-	return &HeapFile{td, int(numPages), fromFile, -1, bp, sync.Mutex{}}, nil
+	// the first page of the file is the header page
+	numPages := max(fi.Size()/int64(PageSize)-1, 0)
+	fsm, err := openFreeSpaceMap(fromFile, int(numPages))
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &HeapFile{td, int(numPages), fromFile, f, fsm, bp, nil, sync.Mutex{}}, nil
 }
 
 // Return the name of the backing file
@@ -62,10 +89,26 @@ func (f *HeapFile) NumPages() int {
 	return f.numPages
 }
 
+// Delete the backing file and the free space map of a heap file that is
+// dropped, together, so that a heap file created later with the same name
+// starts empty, with a map that matches it. The heap file can't be used
+// afterwards.
+func (f *HeapFile) remove() error {
+	f.Lock()
+	defer f.Unlock()
+	f.file.Close()
+	if err := os.Remove(f.backingFile); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	f.numPages = 0
+	return f.fsm.remove()
+}
+
 // Load the contents of a heap file from a specified CSV file.  Parameters are as follows:
 // - hasHeader:  whether or not the CSV file has a header
 // - sep: the character to use to separate fields
 // - skipLastField: if true, the final field is skipped (some TPC datasets include a trailing separator on each line)
+// Empty int, float, date, timestamp and interval fields are loaded as NULL; empty string fields are loaded as the empty string.
 // Returns an error if the field cannot be opened or if a line is malformed
 // We provide the implementation of this method, but it won't work until
 // [HeapFile.insertTuple] is implemented
@@ -92,19 +135,54 @@ func (f *HeapFile) LoadFromCSV(file *os.File, hasHeader bool, sep string, skipLa
 		}
 		var newFields []DBValue
 		for fno, field := range fields {
-			switch f.Descriptor().Fields[fno].Ftype {
+			switch f.Descriptor().Fields[fno].Ftype.baseType() {
 			case IntType:
 				field = strings.TrimSpace(field)
+				if field == "" {
+					// An empty numeric field is a missing value.
+					newFields = append(newFields, NullField{})
+					continue
+				}
 				floatVal, err := strconv.ParseFloat(field, 64)
 				if err != nil {
 					return GoDBError{TypeMismatchError, fmt.Sprintf("LoadFromCSV: couldn't convert value %s to int, tuple %d", field, cnt)}
 				}
 				intValue := int(floatVal)
 				newFields = append(newFields, IntField{int64(intValue)})
-			case StringType:
-				if len(field) > StringLength {
-					field = field[0:StringLength]
+			case FloatType:
+				field = strings.TrimSpace(field)
+				if field == "" {
+					newFields = append(newFields, NullField{})
+					continue
+				}
+				floatVal, err := strconv.ParseFloat(field, 64)
+				if err != nil {
+					return GoDBError{TypeMismatchError, fmt.Sprintf("LoadFromCSV: couldn't convert value %s to float, tuple %d", field, cnt)}
+				}
+				newFields = append(newFields, FloatField{floatVal})
+			case DateType, TimestampType, IntervalType:
+				field = strings.TrimSpace(field)
+				if field == "" {
+					newFields = append(newFields, NullField{})
+					continue
+				}
+				v, err := parseDateTimeValue(field, f.Descriptor().Fields[fno].Ftype)
+				if err != nil {
+					return GoDBError{TypeMismatchError, fmt.Sprintf("LoadFromCSV: %s, tuple %d", err.(GoDBError).errString, cnt)}
+				}
+				newFields = append(newFields, v)
+			case DecimalType:
+				field = strings.TrimSpace(field)
+				if field == "" {
+					newFields = append(newFields, NullField{})
+					continue
+				}
+				v, err := coerceValue(StringField{field}, f.Descriptor().Fields[fno].Ftype)
+				if err != nil {
+					return GoDBError{err.(GoDBError).code, fmt.Sprintf("LoadFromCSV: %s, tuple %d", err.(GoDBError).errString, cnt)}
 				}
+				newFields = append(newFields, v)
+			case StringType:
 				newFields = append(newFields, StringField{field})
 			}
 		}
@@ -112,7 +190,14 @@ func (f *HeapFile) LoadFromCSV(file *os.File, hasHeader bool, sep string, skipLa
 		tid := NewTID()
 		bp := f.bufPool
 		bp.BeginTransaction(tid)
-		f.insertTuple(&newT, tid)
+		err := f.insertTuple(&newT, tid)
+		if err == nil {
+			err = insertIntoIndexes(f, &newT, tid)
+		}
+		if err != nil {
+			bp.AbortTransaction(tid)
+			return err
+		}
 
 		// hack to force dirty pages to disk
 		// because CommitTransaction may not be implemented
@@ -134,109 +219,158 @@ func (f *HeapFile) LoadFromCSV(file *os.File, hasHeader bool, sep string, skipLa
 // the appropriate offset, read the bytes in, and construct a [heapPage] object,
 // using the [heapPage.initFromBuffer] method.
 func (f *HeapFile) readPage(pageNo int) (Page, error) {
-	file, err := os.OpenFile(f.backingFile, os.O_CREATE|os.O_RDONLY, 0644)
+	pages, err := f.readPages(pageNo, pageNo+1)
 	if err != nil {
 		return nil, err
 	}
-	defer file.Close()
-	b := make([]byte, PageSize)
-	n, err := file.ReadAt(b, int64(pageNo*PageSize))
+	return pages[0], nil
+}
+
+// Read the pages from page from up to, but not including, page to with a
+// single read. Used by the read-ahead of the buffer pool (see
+// [BufferPool.SetReadAhead]).
+func (f *HeapFile) readPages(from int, to int) ([]Page, error) {
+	b, err := readPageRange(f.file, from, to-from, heapPageOffset(from))
 	if err != nil {
 		return nil, err
 	}
-	if n != PageSize {
-		return nil, GoDBError{MalformedDataError, "not enough bytes read in ReadPage"}
+	pages := make([]Page, 0, to-from)
+	for pageNo := from; pageNo < to; pageNo++ {
+		off := (pageNo - from) * PageSize
+		pg, err := f.pageFromBuffer(pageNo, bytes.NewBuffer(b[off:off+PageSize]))
+		if err != nil {
+			return nil, err
+		}
+		// the versions of records that were written while snapshots needed
+		// them may be needed no more, or were written before the database
+		// was started, and the free space map is corrected, in case its
+		// entry for the page is stale
+		if !f.bufPool.snapshots.wroteVersions(f.pageKey(pageNo)) {
+			pg.(*heapPage).forgetVersions()
+		}
+		pg.(*heapPage).pruneVersions(&f.bufPool.snapshots)
+		f.fsm.update(pageNo, pg.(*heapPage).getFreeSpace())
+		pages = append(pages, pg)
 	}
+	return pages, nil
+}
+
+// Construct the heap page with the specified page number from its contents,
+// which were read from disk or from the log.
+func (f *HeapFile) pageFromBuffer(pageNo int, buf *bytes.Buffer) (Page, error) {
 	pg, err := newHeapPage(f.Descriptor(), pageNo, f)
 	if err != nil {
 		return nil, err
 	}
-	pg.initFromBuffer(bytes.NewBuffer(b))
+	err = pg.initFromBuffer(buf)
+	if err != nil {
+		return nil, err
+	}
 	return pg, nil
 }
 
-// Add the tuple to the HeapFile. This method should search through pages in the
-// heap file, looking for empty slots and adding the tuple in the first empty
-// slot if finds.
+// Add the tuple to the HeapFile. This method looks up a page with enough free
+// space for the tuple in the free space map of the file, and adds the tuple to
+// it. Pages that other transactions hold read or write locks on are passed
+// over, so that inserters don't wait for transactions that scan the file.
 //
-// If none are found, it should create a new [heapPage] and insert the tuple
-// there, and write the heapPage to the end of the HeapFile (e.g., using the
+// If no page has room, it creates a new [heapPage] and inserts the tuple
+// there, and writes the heapPage to the end of the HeapFile (using the
 // [flushPage] method.)
 //
-// To iterate through pages, it should use the [BufferPool.GetPage method]
-// rather than directly reading pages itself. For lab 1, you do not need to
-// worry about concurrent transactions modifying the Page or HeapFile. We will
-// add support for concurrent modifications in lab 3.
+// To iterate through pages, it uses the [BufferPool.GetPage method] rather than
+// directly reading pages itself.
 //
-// The page the tuple is inserted into should be marked as dirty.
+// The page is locked with an intention write lock, and the new record with a
+// write lock (see [LockTable]), so that other transactions can insert into
+// the same page, or change its other records, at the same time. The page the
+// tuple is inserted into is marked as dirty. A new page is appended only once
+// the end of the file is locked with an intention write lock (see
+// [BufferPool.lockFileEnd]).
 func (f *HeapFile) insertTuple(t *Tuple, tid TransactionID) error {
-	var start int
-
-	f.Lock()
-	if f.lastEmptyPage == -1 {
-		start = 0
-	} else {
-		start = f.lastEmptyPage
+	if recordTooLarge(t) {
+		return GoDBError{MalformedDataError, fmt.Sprintf("tuple of %d bytes is too large to fit on a page", t.serializedSize())}
 	}
-	endPage := f.numPages
-	f.Unlock()
 
-	for p := start; p < endPage; p++ {
-		pg, err := f.bufPool.GetPage(f, p, tid, ReadPerm)
-		if err != nil {
-			return err
-		}
-		if pg.(*heapPage).getNumEmptySlots() == 0 {
-			continue
-		}
-
-		pg, err = f.bufPool.GetPage(f, p, tid, WritePerm)
-		if err != nil {
-			return err
+	tried := make(map[int]bool)
+	skip := func(p int) bool {
+		return tried[p] || f.bufPool.pageLockedByOther(f, p, tid, intentWritePerm)
+	}
+	for {
+		p := f.fsm.search(t.serializedSize(), skip)
+		if p == -1 {
+			break
 		}
-		heapp := pg.(*heapPage)
-		_, err = heapp.insertTuple(t)
-		if err != nil && err != ErrPageFull {
+		tried[p] = true
+		inserted, err := f.insertIntoPage(t, p, tid)
+		if err != nil || inserted {
 			return err
 		}
-		if err == nil {
-			heapp.setDirty(tid, true)
-			f.Lock()
-			f.lastEmptyPage = p // this is fine because lastEmptyPage is a hint, not forcing
-			f.Unlock()
-			return nil
-		}
 	}
 
+	if err := f.bufPool.lockFileEnd(f, tid, intentWritePerm); err != nil {
+		return err
+	}
 	f.Lock()
 	//no free slots, create new page
 	heapp, err := newHeapPage(f.td, f.numPages, f)
+	if err != nil {
+		f.Unlock()
+		return err
+	}
 	err = f.flushPage(heapp) // flush an empty page to later add to buffer pool, helps maintain dirtiness
 	if err != nil {
 		f.Unlock()
 		return err
 	}
-	f.lastEmptyPage = f.numPages
 	p := f.numPages
 	f.numPages++
 	f.Unlock()
 
-	pg, err := f.bufPool.GetPage(f, p, tid, WritePerm)
+	inserted, err := f.insertIntoPage(t, p, tid)
+	if err == nil && !inserted {
+		// another transaction filled the new page first
+		return f.insertTuple(t, tid)
+	}
+	return err
+}
+
+// Insert the tuple into the specified page if it has room for it. Returns
+// false if it doesn't.
+func (f *HeapFile) insertIntoPage(t *Tuple, p int, tid TransactionID) (bool, error) {
+	pg, err := f.bufPool.PinPage(f, p, tid, intentWritePerm)
 	if err != nil {
-		return err
+		return false, err
+	}
+	defer pg.Release()
+	heapp := pg.Page.(*heapPage)
+	heapp.latch.Lock()
+	// while snapshots are running, room is left for the version the record
+	// needs if one doesn't see it once tid commits
+	extra := 0
+	if f.bufPool.snapshots.active() {
+		extra = versionHeaderSize
+	}
+	_, err = heapp.insertTupleInto(t, extra, func(slot int) bool {
+		// a slot whose record another transaction has locked, e.g., because
+		// it read the record before it was deleted, isn't used
+		return f.bufPool.lockTable.lockRecordIfFree(f, heapFileRid{p, slot}, tid, WritePerm)
+	})
+	if err == nil {
+		heapp.setOwner(t.Rid.(heapFileRid).slotNo, tid)
+	}
+	heapp.latch.Unlock()
+	f.fsm.update(p, heapp.availableSpace())
+	if err == ErrPageFull {
+		// the map overestimated the free space on the page
+		return false, nil
 	}
-	heapp = pg.(*heapPage)
-	_, err = heapp.insertTuple(t)
 	if err != nil {
-		return err
+		return false, err
 	}
 	heapp.setDirty(tid, true)
-
-	f.Lock()
-	f.lastEmptyPage = p
-	f.Unlock()
-
-	return nil
+	f.bufPool.recordChange(tid, f, t.Rid.(heapFileRid), t, true)
+	return true, nil
 }
 
 // Remove the provided tuple from the HeapFile.
@@ -248,6 +382,13 @@ func (f *HeapFile) insertTuple(t *Tuple, tid TransactionID) error {
 // to identify the heap page and slot within the page that the tuple came from.
 //
 // The page the tuple is deleted from should be marked as dirty.
+//
+// The page is locked with an intention write lock, and the record with a
+// write lock (see [LockTable]), so that other transactions can change the
+// other records of the page at the same time. A transaction that reads a
+// snapshot is aborted with a WriteConflictError if a transaction that
+// committed after its snapshot was taken changed the record, or with a
+// SnapshotTooOldError if its snapshot is too old (see [snapshotManager]).
 func (f *HeapFile) deleteTuple(t *Tuple, tid TransactionID) error {
 	if t.Rid == nil {
 		return GoDBError{TupleNotFoundError, "provided tuple has null rid, cannot delete"}
@@ -262,25 +403,43 @@ func (f *HeapFile) deleteTuple(t *Tuple, tid TransactionID) error {
 		return GoDBError{TupleNotFoundError, "provided tuple references a page that does not exists"}
 	}
 
-	pg, err := f.bufPool.GetPage(f, rid.pageNo, tid, WritePerm)
+	pg, err := f.bufPool.PinPage(f, rid.pageNo, tid, intentWritePerm)
 	if err != nil {
 		return err
 	}
-	hp, ok := pg.(*heapPage)
+	defer pg.Release()
+	hp, ok := pg.Page.(*heapPage)
 	if !ok {
 		return GoDBError{IncompatibleTypesError, "buffer pool returned non-heap page when heap page expected"}
 	}
-	hp.setDirty(tid, true)
-	err = hp.deleteTuple(rid)
+	err = f.bufPool.lockRecord(f, rid, tid, WritePerm)
 	if err != nil {
 		return err
 	}
-
-	f.Lock()
-	if rid.pageNo < f.lastEmptyPage {
-		f.lastEmptyPage = rid.pageNo
+	if snap := f.bufPool.snapshots.snapshotOf(tid); snap != nil {
+		if err := snap.check(); err != nil {
+			pg.Release()
+			f.bufPool.AbortTransaction(tid)
+			return err
+		}
+		if hp.changedAfter(rid.slotNo, snap) {
+			pg.Release()
+			return f.bufPool.writeConflict(tid, rid)
+		}
 	}
-	f.Unlock()
+	hp.latch.Lock()
+	deleted := hp.slot(rid.slotNo)
+	err = hp.deleteTupleAt(rid)
+	if err == nil {
+		hp.setOwner(rid.slotNo, tid)
+	}
+	hp.latch.Unlock()
+	if err != nil {
+		return err
+	}
+	hp.setDirty(tid, true)
+	f.fsm.update(rid.pageNo, hp.availableSpace())
+	f.bufPool.recordChange(tid, f, rid, deleted, false)
 
 	return nil
 }
@@ -290,21 +449,100 @@ func (f *HeapFile) deleteTuple(t *Tuple, tid TransactionID) error {
 // evict a page. The Page object should store information about its offset on
 // disk (e.g., that it is the ith page in the heap file), so you can determine
 // where to write it back.
+//
+// The free space map entry of the page is written along with it.
 func (f *HeapFile) flushPage(p Page) error {
 	// note that this method is not thread safe
-	file, err := os.OpenFile(f.backingFile, os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		return err
-	}
-	defer file.Close()
 	hp := p.(*heapPage)
 
 	buf, err := hp.toBuffer()
 	if err != nil {
 		return err
 	}
-	_, err = file.WriteAt(buf.Bytes(), int64(hp.pageNo*PageSize))
-	return err
+	f.bufPool.snapshots.pageWritten(f.pageKey(hp.pageNo))
+	_, err = f.file.WriteAt(buf.Bytes(), heapPageOffset(hp.pageNo))
+	if err != nil {
+		return err
+	}
+	return f.fsm.flush(hp.pageNo, hp.getFreeSpace())
+}
+
+// Return the tuple with the specified record ID, or nil if the tuple has been
+// deleted. Used to fetch the tuples found by an index.
+//
+// The page is locked with an intention read lock, and the record with a read
+// lock (see [LockTable]), so that other transactions can change the other
+// records of the page at the same time. A transaction that reads a snapshot
+// takes no locks, and gets the record of its snapshot.
+func (f *HeapFile) tupleAt(rid recordID, tid TransactionID) (*Tuple, error) {
+	heapRid, ok := rid.(heapFileRid)
+	if !ok {
+		return nil, GoDBError{TupleNotFoundError, "supplied rid is not a heapFileRid"}
+	}
+	if heapRid.pageNo < 0 || heapRid.pageNo >= f.NumPages() {
+		return nil, GoDBError{TupleNotFoundError, "supplied rid references a page that does not exist"}
+	}
+	if snap := f.bufPool.snapshots.snapshotOf(tid); snap != nil {
+		pg, err := f.bufPool.pinSnapshotPage(f, heapRid.pageNo, tid, false)
+		if err != nil {
+			return nil, err
+		}
+		defer pg.Release()
+		hp := pg.Page.(*heapPage)
+		hp.latch.RLock()
+		defer hp.latch.RUnlock()
+		if err := snap.check(); err != nil {
+			return nil, err
+		}
+		if t := hp.snapshotSlot(heapRid.slotNo, snap); t != nil {
+			return &Tuple{*f.td, t.Fields, t.Rid}, nil
+		}
+		return nil, nil
+	}
+	pg, err := f.bufPool.PinPage(f, heapRid.pageNo, tid, intentReadPerm)
+	if err != nil {
+		return nil, err
+	}
+	defer pg.Release()
+	if err := f.bufPool.lockRecord(f, heapRid, tid, ReadPerm); err != nil {
+		return nil, err
+	}
+	hp := pg.Page.(*heapPage)
+	if f.bufPool.isolationOf(tid) == ReadCommitted {
+		defer f.bufPool.lockTable.releaseReadLock(hp.recordKey(heapRid.slotNo), tid)
+	}
+	hp.latch.RLock()
+	defer hp.latch.RUnlock()
+	t := hp.slot(heapRid.slotNo)
+	if t == nil {
+		return nil, nil
+	}
+	return &Tuple{*f.td, t.Fields, t.Rid}, nil
+}
+
+// Return the indexes on the heap file.
+func (f *HeapFile) getIndexes() []Index {
+	f.Lock()
+	defer f.Unlock()
+	return f.indexes
+}
+
+func (f *HeapFile) addIndex(idx Index) {
+	f.Lock()
+	defer f.Unlock()
+	f.indexes = append(f.indexes, idx)
+}
+
+func (f *HeapFile) removeIndex(idx Index) {
+	f.Lock()
+	defer f.Unlock()
+	indexes := make([]Index, 0, len(f.indexes))
+	for _, i := range f.indexes {
+		if i != idx {
+			indexes = append(indexes, i)
+		}
+	}
+	f.indexes = indexes
 }
 
 // [Operator] descriptor method -- return the TupleDesc for this HeapFile
@@ -322,28 +560,83 @@ func (f *HeapFile) Descriptor() *TupleDesc {
 // transactions
 // You should esnure that Tuples returned by this method have their Rid object
 // set appropriate so that [deleteTuple] will work (see additional comments there).
+//
+// Each page is pinned while its tuples are returned. If the iterator isn't run
+// to the end, the last page stays pinned until the transaction ends. A large
+// scan takes a read lock on the whole file instead of on each page (see
+// [BufferPool.LockFile]). A transaction that reads a snapshot takes no locks,
+// and sees the records of its snapshot (see [snapshotManager]).
+//
+// At the Serializable isolation level, a scan that reaches the end of the file
+// locks the end too, and reads the pages that were appended in the meantime,
+// so that no records can be added to the file until the transaction ends. At
+// the other levels, the records are locked instead of the pages (see
+// [IsolationLevel]).
 func (f *HeapFile) Iterator(tid TransactionID) (func() (*Tuple, error), error) {
 	nPages := f.NumPages()
+	getPage := f.bufPool.PinPage
+	large := f.bufPool.isLargeScan(nPages)
+	snap := f.bufPool.snapshots.snapshotOf(tid)
+	level := f.bufPool.isolationOf(tid)
+	pagePerm := ReadPerm
+	if level != Serializable {
+		pagePerm = intentReadPerm
+	}
+	if snap != nil {
+		// a snapshot is read without locks
+		getPage = func(file DBFile, pageNo int, tid TransactionID, perm RWPerm) (*PageHandle, error) {
+			return f.bufPool.pinSnapshotPage(file, pageNo, tid, large)
+		}
+	} else if large {
+		// keep the scan from pushing every other page out of the buffer pool
+		getPage = f.bufPool.getScanPage
+		// and lock the whole file once, instead of each of its pages
+		if level == Serializable {
+			if err := f.bufPool.LockFile(f, tid, ReadPerm); err != nil {
+				return nil, err
+			}
+		}
+	}
 	pgNo := 0
+	endLocked := snap != nil || level != Serializable
+	// the page being read is pinned until all of its tuples are returned
+	var pg *PageHandle
 	var pgIter func() (*Tuple, error)
 	return func() (*Tuple, error) {
 		for {
 			if pgIter == nil {
+				if pgNo == nPages && !endLocked {
+					if err := f.bufPool.lockFileEnd(f, tid, ReadPerm); err != nil {
+						return nil, err
+					}
+					endLocked = true
+					nPages = f.NumPages()
+				}
 				if pgNo == nPages {
 					return nil, nil
 				}
-				p, err := f.bufPool.GetPage(f, pgNo, tid, ReadPerm)
+				var err error
+				pg, err = getPage(f, pgNo, tid, pagePerm)
 				if err != nil {
 					return nil, err
 				}
-				pgIter = p.(*heapPage).tupleIter() //assume this is a heapPage object
+				hp := pg.Page.(*heapPage) //assume this is a heapPage object
+				if snap != nil {
+					pgIter = hp.snapshotIter(snap)
+				} else if level != Serializable {
+					pgIter = f.recordIter(hp, tid, level)
+				} else {
+					pgIter = hp.tupleIter()
+				}
 				pgNo++
 			}
 			next, err := pgIter()
 			if err != nil {
+				pg.Release()
 				return nil, err
 			}
 			if next == nil {
+				pg.Release()
 				pgIter = nil
 			} else {
 				return &Tuple{*f.td, next.Fields, next.Rid}, nil
@@ -0,0 +1,166 @@
+package godb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"strings"
+)
+
+/* The first page of a heap file is a header page that describes the file, so
+that the file can be read without the catalog, and so that a file that doesn't
+match the catalog is rejected instead of being misread. Like the other pages,
+it is PageSize bytes, and begins with its checksum (see [ChecksumSize]):
+
++-------------------------------------------------------------------------------+
+| checksum (4 bytes) | magic (4 bytes) | version (2 bytes) | page size (4 bytes) |
++-------------------------------------------------------------------------------+
+| numFields (2 bytes) | field 0 | field 1 | ... | field n-1                      |
++-------------------------------------------------------------------------------+
+| free space                                                                    |
++-------------------------------------------------------------------------------+
+
+Each field is serialized as the length of its name (2 bytes), its name, and its
+type (4 bytes, see [DBType]). The heap pages follow the header page, so page i
+of the heap file is stored at offset (i+1)*PageSize.
+*/
+
+const (
+	heapFileMagic   uint32 = 0x42446f47 // "GoDB"
+	heapFileVersion uint16 = 1
+)
+
+// Return the offset of a heap page in its file, which is after the header
+// page.
+func heapPageOffset(pageNo int) int64 {
+	return int64(pageNo+1) * int64(PageSize)
+}
+
+// Serialize the header page of a heap file with the specified TupleDesc.
+func heapFileHeader(td *TupleDesc) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	// the checksum is filled in once the rest of the page is written
+	buf.Write(make([]byte, ChecksumSize))
+	header := []any{heapFileMagic, heapFileVersion, int32(PageSize), uint16(len(td.Fields))}
+	for _, v := range header {
+		err := binary.Write(buf, binary.LittleEndian, v)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, f := range td.Fields {
+		binary.Write(buf, binary.LittleEndian, uint16(len(f.Fname)))
+		buf.WriteString(f.Fname)
+		binary.Write(buf, binary.LittleEndian, int32(f.Ftype))
+	}
+	if buf.Len() > PageSize {
+		return nil, GoDBError{MalformedDataError, "the fields of the table do not fit on the header page of a heap file"}
+	}
+	buf.Write(make([]byte, PageSize-buf.Len()))
+	page := buf.Bytes()
+	setPageChecksum(page)
+	return page, nil
+}
+
+// Read the header page of the heap file fileName, and return the TupleDesc it
+// describes.
+//
+// Returns a MalformedDataError if the file isn't a heap file, or was written
+// with a different format version or page size.
+func readHeapFileHeader(fileName string) (*TupleDesc, error) {
+	page, err := readPageBytes(fileName, 0)
+	if err != nil {
+		return nil, err
+	}
+	buf := bytes.NewBuffer(page[ChecksumSize:])
+	var magic uint32
+	var version uint16
+	var pageSize int32
+	var numFields uint16
+	for _, v := range []any{&magic, &version, &pageSize, &numFields} {
+		err := binary.Read(buf, binary.LittleEndian, v)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if magic != heapFileMagic {
+		return nil, GoDBError{MalformedDataError, fmt.Sprintf("%s is not a heap file", fileName)}
+	}
+	if version != heapFileVersion {
+		return nil, GoDBError{MalformedDataError, fmt.Sprintf("%s has format version %d, but only version %d is supported", fileName, version, heapFileVersion)}
+	}
+	if int(pageSize) != PageSize {
+		return nil, GoDBError{MalformedDataError, fmt.Sprintf("%s was written with pages of %d bytes, but the page size is %d", fileName, pageSize, PageSize)}
+	}
+	td := &TupleDesc{}
+	for i := 0; i < int(numFields); i++ {
+		var nameLen uint16
+		err := binary.Read(buf, binary.LittleEndian, &nameLen)
+		if err != nil || int(nameLen) > buf.Len() {
+			return nil, GoDBError{MalformedDataError, fmt.Sprintf("invalid field in the header of %s", fileName)}
+		}
+		name := string(buf.Next(int(nameLen)))
+		var ftype int32
+		err = binary.Read(buf, binary.LittleEndian, &ftype)
+		if err != nil {
+			return nil, GoDBError{MalformedDataError, fmt.Sprintf("invalid field in the header of %s", fileName)}
+		}
+		td.Fields = append(td.Fields, FieldType{name, "", DBType(ftype)})
+	}
+	return td, nil
+}
+
+// Return true if the fields of two TupleDescs have the same names and types,
+// ignoring their table qualifiers.
+func sameSchema(td1 *TupleDesc, td2 *TupleDesc) bool {
+	if len(td1.Fields) != len(td2.Fields) {
+		return false
+	}
+	for i, f := range td1.Fields {
+		if f.Fname != td2.Fields[i].Fname || f.Ftype != td2.Fields[i].Ftype {
+			return false
+		}
+	}
+	return true
+}
+
+// Return the fields of a TupleDesc in the format of the catalog, e.g.,
+// "(name string, age int)".
+func schemaString(td *TupleDesc) string {
+	var buf strings.Builder
+	buf.WriteByte('(')
+	for i, f := range td.Fields {
+		if i != 0 {
+			buf.WriteString(", ")
+		}
+		buf.WriteString(f.Fname)
+		buf.WriteByte(' ')
+		buf.WriteString(f.Ftype.String())
+	}
+	buf.WriteByte(')')
+	return buf.String()
+}
+
+// Write the header page of a new heap file, or check the header page of an
+// existing one against the TupleDesc from the catalog.
+//
+// Returns a TypeMismatchError if the fields of the file don't match td.
+func initHeapFileHeader(fileName string, file *os.File, size int64, td *TupleDesc) error {
+	if size == 0 {
+		header, err := heapFileHeader(td)
+		if err != nil {
+			return err
+		}
+		_, err = file.WriteAt(header, 0)
+		return err
+	}
+	fileTd, err := readHeapFileHeader(fileName)
+	if err != nil {
+		return err
+	}
+	if !sameSchema(fileTd, td) {
+		return GoDBError{TypeMismatchError, fmt.Sprintf("the fields of %s %s do not match the catalog %s", fileName, schemaString(fileTd), schemaString(td))}
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package godb
+
+import (
+	"encoding/binary"
+	"os"
+	"testing"
+)
+
+func TestHeapFileHeader(t *testing.T) {
+	bp, hf := makeTestFile(t, 10)
+	_, t1, t2 := makeTupleTestVars()
+	tid := BeginTransactionForTest(t, bp)
+	insertTupleForTest(t, hf, &t1, tid)
+	insertTupleForTest(t, hf, &t2, tid)
+	flushAndCommitForTest(t, bp, tid)
+
+	td, err := readHeapFileHeader(TestingFile)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if !sameSchema(td, hf.Descriptor()) {
+		t.Errorf("expected the header to hold the fields %s, got %s", schemaString(hf.Descriptor()), schemaString(td))
+	}
+
+	// the file is reopened with the fields from the header
+	hf2, err := NewHeapFile(TestingFile, td, bp)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if hf2.NumPages() != 1 {
+		t.Errorf("expected the header page not to be counted, but the file has %d pages", hf2.NumPages())
+	}
+
+	// fields that don't match the header are refused
+	other := TupleDesc{Fields: []FieldType{{Fname: "name", Ftype: StringType}, {Fname: "age", Ftype: FloatType}}}
+	_, err = NewHeapFile(TestingFile, &other, bp)
+	if err == nil {
+		t.Fatalf("expected opening the file with other fields to fail")
+	}
+	if gdbErr, ok := err.(GoDBError); !ok || gdbErr.code != TypeMismatchError {
+		t.Errorf("expected a TypeMismatchError, got %v", err)
+	}
+
+	// a header with another version or page size is refused
+	header, err := heapFileHeader(td)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	binary.LittleEndian.PutUint16(header[ChecksumSize+4:], heapFileVersion+1)
+	setPageChecksum(header)
+	corruptFileForTest(t, TestingFile, 0, header)
+	if _, err := NewHeapFile(TestingFile, td, bp); err == nil {
+		t.Errorf("expected opening a file with another format version to fail")
+	}
+	binary.LittleEndian.PutUint16(header[ChecksumSize+4:], heapFileVersion)
+	binary.LittleEndian.PutUint32(header[ChecksumSize+6:], uint32(PageSize*2))
+	setPageChecksum(header)
+	corruptFileForTest(t, TestingFile, 0, header)
+	if _, err := NewHeapFile(TestingFile, td, bp); err == nil {
+		t.Errorf("expected opening a file with another page size to fail")
+	}
+
+	// a file without a header, e.g., one written by an older version
+	if err := os.WriteFile(TestingFile, make([]byte, PageSize), 0644); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if _, err := NewHeapFile(TestingFile, td, bp); err == nil {
+		t.Errorf("expected opening a file without a header to fail")
+	}
+}
+
+func TestNewCatalogFromDataFiles(t *testing.T) {
+	dir := t.TempDir()
+	bp, err := NewBufferPool(10)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	c := NewCatalog("catalog.txt", bp, dir)
+	tables := []TupleDesc{
+		{Fields: []FieldType{{Fname: "name", Ftype: StringType}, {Fname: "age", Ftype: IntType}}},
+		{Fields: []FieldType{{Fname: "id", Ftype: IntType}, {Fname: "price", Ftype: decimalType(10, 2)}, {Fname: "at", Ftype: TimestampType}}},
+	}
+	for i, td := range tables {
+		if _, err := c.addTable([]string{"people", "orders"}[i], td); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+
+	rebuilt, err := NewCatalogFromDataFiles("catalog.txt", bp, dir)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if rebuilt.String() != c.String() {
+		t.Errorf("expected the rebuilt catalog to be\n%s\ngot\n%s", c.String(), rebuilt.String())
+	}
+
+	// the rebuilt catalog can be saved and loaded
+	if err := rebuilt.SaveToFile("catalog.txt", dir); err != nil {
+		t.Fatalf(err.Error())
+	}
+	loaded, err := NewCatalogFromFile("catalog.txt", bp, dir)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if loaded.String() != c.String() {
+		t.Errorf("expected the saved catalog to be\n%s\ngot\n%s", c.String(), loaded.String())
+	}
+}
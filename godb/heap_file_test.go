@@ -3,6 +3,7 @@ package godb
 import (
 	"os"
 	"testing"
+	"time"
 )
 
 const TestingFile string = "test.dat"
@@ -24,6 +25,19 @@ func makeTestFile(t *testing.T, bufferPoolSize int) (*BufferPool, *HeapFile) {
 	return bp, tbl.(*HeapFile)
 }
 
+// Insert records into the heap file until it has n pages, in a transaction
+// whose pages are flushed before it commits (see [flushAndCommitForTest]).
+func fillPagesForTest(t *testing.T, bp *BufferPool, hf *HeapFile, n int) {
+	t.Helper()
+	td, _, _ := makeTupleTestVars()
+	tid := BeginTransactionForTest(t, bp)
+	for i := 0; hf.NumPages() < n; i++ {
+		tup := Tuple{Desc: td, Fields: []DBValue{StringField{"sam"}, IntField{int64(i)}}}
+		insertTupleForTest(t, hf, &tup, tid)
+	}
+	flushAndCommitForTest(t, bp, tid)
+}
+
 func makeTestVars(t *testing.T) (TupleDesc, Tuple, Tuple, *HeapFile, *BufferPool, TransactionID) {
 	bp, hf := makeTestFile(t, 3)
 	td, t1, t2 := makeTupleTestVars()
@@ -255,7 +269,8 @@ func TestHeapFileSize(t *testing.T) {
 	if err != nil {
 		t.Fatalf("unexpected error, stat, %s", err.Error())
 	}
-	if info.Size() != int64(PageSize) {
+	// the file holds the header page and the heap page
+	if info.Size() != int64(2*PageSize) {
 		t.Fatalf("heap file page is not %d bytes;  NOTE:  This error may be OK, but many implementations that don't write full pages break.", PageSize)
 	}
 }
@@ -318,3 +333,146 @@ func TestHeapFileIteratorExtra(t *testing.T) {
 		t.Fatalf("Iterator returned error at end, expected nil, nil, got nil, %s", err.Error())
 	}
 }
+
+func TestHeapFileRecordLocks(t *testing.T) {
+	bp, hf := makeTestFile(t, 10)
+	td, _, _ := makeTupleTestVars()
+	tid := BeginTransactionForTest(t, bp)
+	tups := make([]Tuple, 3)
+	for i := range tups {
+		tups[i] = Tuple{Desc: td, Fields: []DBValue{StringField{"sam"}, IntField{int64(i)}}}
+		insertTupleForTest(t, hf, &tups[i], tid)
+	}
+	flushAndCommitForTest(t, bp, tid)
+
+	// two transactions delete different records of the same page without
+	// waiting for each other
+	tid1 := BeginTransactionForTest(t, bp)
+	tid2 := BeginTransactionForTest(t, bp)
+	done := make(chan error)
+	go func() {
+		done <- hf.deleteTuple(&tups[0], tid1)
+	}()
+	go func() {
+		done <- hf.deleteTuple(&tups[1], tid2)
+	}()
+	for i := 0; i < 2; i++ {
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatalf(err.Error())
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("the deletes of different records are waiting for each other")
+		}
+	}
+	// but a reader of a deleted record waits
+	tid3 := BeginTransactionForTest(t, bp)
+	if bp.lockTable.TryLockRecord(hf, tups[0].Rid.(heapFileRid), tid3, ReadPerm) != Wait {
+		t.Errorf("expected a reader of a deleted record to wait")
+	}
+	bp.AbortTransaction(tid3)
+
+	bp.AbortTransaction(tid1)
+	if err := bp.CommitTransaction(tid2); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	// only the record deleted by the committed transaction is gone, even
+	// after the page is read from its file again
+	bp.FlushAllPages()
+	bp, _, err := MakeTestDatabase(10, "catalog.txt")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	hf, err = NewHeapFile(TestingFile, &td, bp)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	tid = BeginTransactionForTest(t, bp)
+	defer bp.CommitTransaction(tid)
+	var got []int64
+	iter, err := hf.Iterator(tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	for {
+		tup, err := iter()
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if tup == nil {
+			break
+		}
+		got = append(got, tup.Fields[1].(IntField).Value)
+	}
+	if len(got) != 2 || got[0] != 0 || got[1] != 2 {
+		t.Errorf("expected records 0 and 2 to remain, got %v", got)
+	}
+}
+
+func TestHeapFileTableLocks(t *testing.T) {
+	bp, hf := makeTestFile(t, 10)
+	td, _, _ := makeTupleTestVars()
+	tid := BeginTransactionForTest(t, bp)
+	for i := 0; hf.NumPages() < 5; i++ {
+		tup := Tuple{Desc: td, Fields: []DBValue{StringField{"sam"}, IntField{int64(i)}}}
+		insertTupleForTest(t, hf, &tup, tid)
+	}
+	flushAndCommitForTest(t, bp, tid)
+
+	// a large scan locks the whole file, and none of its pages
+	tid1 := BeginTransactionForTest(t, bp)
+	if _, err := hf.Iterator(tid1); err != nil {
+		t.Fatalf(err.Error())
+	}
+	tid2 := BeginTransactionForTest(t, bp)
+	if bp.lockTable.TryLockFile(hf, tid2, intentWritePerm) != Wait {
+		t.Errorf("expected a writer to wait for the scan")
+	}
+	bp.AbortTransaction(tid2)
+	bp.CommitTransaction(tid1)
+
+	// a transaction that changes many records gets a write lock on the file
+	bp.SetLockEscalation(4)
+	tid1 = BeginTransactionForTest(t, bp)
+	for i := 0; i < 10; i++ {
+		tup := Tuple{Desc: td, Fields: []DBValue{StringField{"new"}, IntField{int64(i)}}}
+		insertTupleForTest(t, hf, &tup, tid1)
+	}
+	tid2 = BeginTransactionForTest(t, bp)
+	if bp.lockTable.TryLockFile(hf, tid2, intentReadPerm) != Wait {
+		t.Errorf("expected a reader to wait for the escalated lock")
+	}
+	bp.AbortTransaction(tid2)
+	if err := bp.CommitTransaction(tid1); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	// the changes made under the file lock are committed
+	tid = BeginTransactionForTest(t, bp)
+	defer bp.CommitTransaction(tid)
+	if bp.lockTable.TryLockFile(hf, tid, WritePerm) != Grant {
+		t.Errorf("expected the locks to be released")
+	}
+	iter, err := hf.Iterator(tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	cnt := 0
+	for {
+		tup, err := iter()
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if tup == nil {
+			break
+		}
+		if tup.Fields[0].(StringField).Value == "new" {
+			cnt++
+		}
+	}
+	if cnt != 10 {
+		t.Errorf("expected 10 new records, got %d", cnt)
+	}
+}
@@ -14,64 +14,98 @@ interface requires.  You will want to use an interface like what we provide to
 implement the methods of [HeapFile] that insert, delete, and iterate through
 tuples.
 
-In GoDB all tuples are fixed length, which means that given a TupleDesc it is
-possible to figure out how many tuple "slots" fit on a given page.
+In GoDB tuples are variable length (see [Tuple.writeTo]), so heap pages use a
+slotted page layout. All pages are PageSize bytes. They begin with a header
+with the checksum of the page (see [ChecksumSize]), a 32 bit integer with the
+number of slots, and a second 32 bit integer with the number of used slots.
 
-In addition, all pages are PageSize bytes.  They begin with a header with a 32
-bit integer with the number of slots (tuples), and a second 32 bit integer with
-the number of used slots.
+The header is followed by the slot directory, which holds one entry per slot.
+Each entry is a 16 bit offset of the record from the start of the page and a
+16 bit record length; a length of zero marks an empty slot. Records are packed
+at the end of the page, growing towards the slot directory:
 
-Each tuple occupies the same number of bytes.  You can use the go function
-unsafe.Sizeof() to determine the size in bytes of an object.  So, a GoDB integer
-(represented as an int64) requires unsafe.Sizeof(int64(0)) bytes.  For strings,
-we encode them as byte arrays of StringLength, so they are size
-((int)(unsafe.Sizeof(byte('a')))) * StringLength bytes.  The size in bytes  of a
-tuple is just the sum of the size in bytes of its fields.
++-------------------------------------------------------------+
+| checksum (4 bytes) | numSlots (4 bytes) | numUsed (4 bytes) |
++-------------------------------------------------------------+
+| slot 0 (offset, length) | slot 1 | ... | slot n-1           |
++-------------------------------------------------------------+
+| free space                                                  |
++-------------------------------------------------------------+
+|                                   ... | record 1 | record 0 |
++-------------------------------------------------------------+
 
-Once you have figured out how big a record is, you can determine the number of
-slots on on the page as:
+While some snapshots don't see that a record was created or deleted (see
+[snapshotManager]), the record carries the IDs of the transactions that
+created and deleted it: the top bit of its length is set, and the record
+starts with a 64 bit creating and a 64 bit deleting transaction ID, either of
+which is -1 if there is none. A deleted record stays in its slot until every
+snapshot sees that it was deleted. The other records have no such header, so
+pages that no snapshot needs versions of are laid out as before.
 
-remPageSize = PageSize - 8 // bytes after header
-numSlots = remPageSize / bytesPerTuple //integer division will round down
-
-To serialize a page to a buffer, you can then:
-
-write the number of slots as an int32
-write the number of used slots as an int32
-write the tuples themselves to the buffer
-
-You will follow the inverse process to read pages from a buffer.
+Rather than dividing the page into a fixed number of slots, the page keeps
+track of the number of bytes used by its records and slot directory. A tuple
+can be inserted when there is room for its record, plus a new slot directory
+entry if no empty slot can be reused.
 
 Note that to process deletions you will likely delete tuples at a specific
 position (slot) in the heap page.  This means that after a page is read from
-disk, tuples should retain the same slot number. Because GoDB will never evict a
-dirty page, it's OK if tuples are renumbered when they are written back to disk.
+disk, tuples should retain the same slot number. Because records are
+repacked every time a page is written, free space left by deleted tuples is
+reclaimed without changing slot numbers.
+
+Transactions that lock records rather than pages (see [LockTable]) change the
+records of a page at the same time, so the slots of the page are protected by
+a latch, which is held only while a record is read or changed. The page
+remembers which transaction changed each slot until it commits or aborts, so
+that the changes of each transaction can be logged, or rolled back, without
+those of the others (see [heapPage.commitSlots]).
 
 */
 
 type heapPage struct {
-	desc     TupleDesc
-	numSlots int32
-	numUsed  int32
-	dirty    bool
-	tuples   []*Tuple
-	pageNo   int
-	file     *HeapFile
-	lastTxn  TransactionID
-	bImage   Page
+	desc      TupleDesc
+	numSlots  int32
+	numUsed   int32
+	usedBytes int // bytes used by the records on the page
+	dirty     bool
+	tuples    []*Tuple
+	pageNo    int
+	file      *HeapFile
+	lastTxn   TransactionID
+	bImage    Page
 	sync.Mutex
+
+	// the slots changed by transactions that lock records rather than the
+	// page, and haven't committed or aborted yet, and the transaction that
+	// changed each of them
+	owners map[int]TransactionID
+
+	// the versions of the records that some snapshots don't see as they are,
+	// keyed by slot. The records in them were deleted; the records that
+	// weren't are in tuples
+	versions map[int]*recordVersion
+
+	// protects the slots of the page, owners, and versions
+	latch sync.RWMutex
 }
 
-const HeaderSize = 8
+const (
+	HeaderSize = ChecksumSize + 8
+	SlotSize   = 4 // size of a slot directory entry
+
+	versionHeaderSize = 16     // size of the transaction IDs of a versioned record
+	versionedRecord   = 0x8000 // set in the length of a versioned record
+)
 
 // Construct a new heap page
 func newHeapPage(desc *TupleDesc, pageNo int, f *HeapFile) (*heapPage, error) {
 	var pg heapPage
 	pg.desc = *desc
-	pg.numSlots = int32((PageSize - HeaderSize) / desc.bytesPerTuple())
+	pg.numSlots = 0
 	pg.numUsed = 0
+	pg.usedBytes = 0
 	pg.dirty = false
-	pg.tuples = make([]*Tuple, pg.numSlots)
+	pg.tuples = make([]*Tuple, 0)
 	pg.pageNo = pageNo
 	pg.file = f
 	return &pg, nil
@@ -85,26 +119,116 @@ func (h *heapPage) getNumEmptySlots() int {
 	return int(h.numSlots - h.numUsed)
 }
 
+// Return the number of bytes on the page that are not used by the header, the
+// slot directory, or records.
+func (h *heapPage) getFreeSpace() int {
+	h.latch.RLock()
+	defer h.latch.RUnlock()
+	return h.freeSpace()
+}
+
+// Return the free space on the page, like [heapPage.getFreeSpace].
+//
+// Caller must hold the latch of the page.
+func (h *heapPage) freeSpace() int {
+	return PageSize - HeaderSize - int(h.numSlots)*SlotSize - h.usedBytes
+}
+
+// Return the free space on the page that new records can use. The records
+// deleted by transactions that haven't committed yet still take up space, so
+// that there is room to put them back if the transactions abort.
+func (h *heapPage) availableSpace() int {
+	h.latch.RLock()
+	defer h.latch.RUnlock()
+	return h.freeSpace() - h.reservedSpace()
+}
+
+// Return the space taken up by the records deleted by transactions that
+// haven't committed yet (see [heapPage.availableSpace]).
+//
+// Caller must hold the latch of the page.
+func (h *heapPage) reservedSpace() int {
+	reserved := 0
+	for slot := range h.owners {
+		if h.tuples[slot] == nil {
+			if t := h.bImage.(*heapPage).slot(slot); t != nil {
+				reserved += t.serializedSize()
+			}
+		}
+	}
+	return reserved
+}
+
+// Return the record in the specified slot, or nil if the slot is empty or
+// doesn't exist.
+//
+// Caller must hold the latch of the page.
+func (h *heapPage) slot(slot int) *Tuple {
+	if slot < 0 || slot >= len(h.tuples) {
+		return nil
+	}
+	return h.tuples[slot]
+}
+
+// Returns true if the tuple can never be stored on a heap page, even one that
+// is empty, with its version.
+func recordTooLarge(t *Tuple) bool {
+	return t.serializedSize()+versionHeaderSize > PageSize-HeaderSize-SlotSize
+}
+
 var ErrPageFull = GoDBError{PageFullError, "page is full"}
 
-// Insert the tuple into a free slot on the page, or return an error if there are
-// no free slots.  Set the tuples rid and return it.
+// Insert the tuple into a free slot on the page, or return an error if there is
+// not enough free space for it.  Set the tuples rid and return it.
 func (h *heapPage) insertTuple(t *Tuple) (recordID, error) {
-	for i := 0; i < int(h.numSlots); i++ {
-		if h.tuples[i] == nil {
-			h.tuples[i] = t
-			h.numUsed++
-			t.Rid = heapFileRid{h.pageNo, i}
-			return t.Rid, nil
+	h.latch.Lock()
+	defer h.latch.Unlock()
+	return h.insertTupleInto(t, 0, func(slot int) bool { return true })
+}
+
+// Insert the tuple like [heapPage.insertTuple], into the first free slot for
+// which use returns true, leaving at least extra bytes of free space on the
+// page. use is only called once there is room for the tuple. The slots of
+// records deleted by transactions that haven't committed yet, and of deleted
+// records that snapshots still see, are not free.
+//
+// Caller must hold the latch of the page.
+func (h *heapPage) insertTupleInto(t *Tuple, extra int, use func(slot int) bool) (recordID, error) {
+	size := t.serializedSize() + extra
+	free := h.freeSpace() - h.reservedSpace()
+	slot := -1
+	if size <= free {
+		for i := 0; i < int(h.numSlots); i++ {
+			if _, owned := h.owners[i]; h.tuples[i] == nil && h.versions[i] == nil && !owned && use(i) {
+				slot = i
+				break
+			}
+		}
+	}
+	if slot == -1 {
+		// a new slot is added to the slot directory
+		if size+SlotSize > free || !use(int(h.numSlots)) {
+			return 0, ErrPageFull
 		}
+		slot = int(h.numSlots)
 	}
-	fmt.Println("HI")
-	return 0, ErrPageFull
+	h.setSlot(slot, t)
+	t.Rid = heapFileRid{h.pageNo, slot}
+	return t.Rid, nil
 }
 
 // Delete the tuple at the specified record ID, or return an error if the ID is
 // invalid.
 func (h *heapPage) deleteTuple(rid recordID) error {
+	h.latch.Lock()
+	defer h.latch.Unlock()
+	return h.deleteTupleAt(rid)
+}
+
+// Delete the tuple at the specified record ID, like [heapPage.deleteTuple].
+//
+// Caller must hold the latch of the page.
+func (h *heapPage) deleteTupleAt(rid recordID) error {
 	heapRid, ok := rid.(heapFileRid)
 	if !ok {
 		return GoDBError{TupleNotFoundError, "supplied rid is not a heapFileRid"}
@@ -116,8 +240,7 @@ func (h *heapPage) deleteTuple(rid recordID) error {
 	if h.tuples[slot] == nil {
 		return GoDBError{TupleNotFoundError, "element already deleted"}
 	}
-	h.numUsed--
-	h.tuples[slot] = nil
+	h.setSlot(slot, nil)
 	return nil
 }
 
@@ -144,40 +267,76 @@ func (p *heapPage) getFile() DBFile {
 
 // Allocate a new bytes.Buffer and write the heap page to it. Returns an error
 // if the write to the the buffer fails. You will likely want to call this from
-// your [HeapFile.flushPage] method.  You should write the page header, using
-// the binary.Write method in LittleEndian order, followed by the tuples of the
-// page, written using the Tuple.writeTo method.
+// your [HeapFile.flushPage] method.  The page header and slot directory are
+// written using the binary.Write method in LittleEndian order, and the records
+// are written using the Tuple.writeTo method, packed at the end of the page.
 func (h *heapPage) toBuffer() (*bytes.Buffer, error) {
-	b := new(bytes.Buffer)
+	h.latch.RLock()
+	defer h.latch.RUnlock()
+	page := make([]byte, PageSize)
+	dir := new(bytes.Buffer)
 
-	err := binary.Write(b, binary.LittleEndian, (int32)(h.numSlots))
+	// the checksum is filled in once the rest of the page is written
+	dir.Write(make([]byte, ChecksumSize))
+	err := binary.Write(dir, binary.LittleEndian, (int32)(h.numSlots))
 	if err != nil {
 		return nil, err
 	}
-	err = binary.Write(b, binary.LittleEndian, (int32)(h.numUsed))
+	err = binary.Write(dir, binary.LittleEndian, (int32)(h.numUsed))
 	if err != nil {
 		return nil, err
 	}
 
+	end := PageSize
 	for i := 0; i < len(h.tuples); i++ {
-		t := h.tuples[i]
+		var offset, length uint16
+		t, v := h.tuples[i], h.versions[i]
+		if v != nil && v.deleted != nil {
+			t = v.deleted
+		}
 		if t != nil {
-			err = t.writeTo(b)
+			rec := new(bytes.Buffer)
+			if v != nil {
+				err = binary.Write(rec, binary.LittleEndian, [2]int64{int64(v.xmin), int64(v.xmax)})
+				if err != nil {
+					return nil, err
+				}
+			}
+			err = t.writeTo(rec)
 			if err != nil {
 				return nil, err
 			}
+			start := end - rec.Len()
+			if start < HeaderSize+len(h.tuples)*SlotSize {
+				return nil, GoDBError{MalformedDataError, "buffer is greater than page size"}
+			}
+			copy(page[start:end], rec.Bytes())
+			end = start
+			offset, length = uint16(start), uint16(rec.Len())
+			if v != nil {
+				length |= versionedRecord
+			}
+		}
+		err = binary.Write(dir, binary.LittleEndian, offset)
+		if err != nil {
+			return nil, err
+		}
+		err = binary.Write(dir, binary.LittleEndian, length)
+		if err != nil {
+			return nil, err
 		}
 	}
-	if b.Len() > PageSize {
-		return nil, GoDBError{MalformedDataError, "buffer is greater than page size"}
-	}
-	b.Write(make([]byte, PageSize-b.Len())) // pad to page size
+	copy(page, dir.Bytes())
+	setPageChecksum(page)
 
-	return b, nil
+	return bytes.NewBuffer(page), nil
 }
 
-// Read the contents of the HeapPage from the supplied buffer.
+// Read the contents of the HeapPage from the supplied buffer. The checksum of
+// the page is verified by the caller, since it knows where the page came from.
 func (h *heapPage) initFromBuffer(buf *bytes.Buffer) error {
+	page := buf.Bytes()
+	buf.Next(ChecksumSize)
 	var numSlotsHeader, numUsedHeader int32
 	err := binary.Read(buf, binary.LittleEndian, &numSlotsHeader)
 	if err != nil {
@@ -187,19 +346,65 @@ func (h *heapPage) initFromBuffer(buf *bytes.Buffer) error {
 	if err != nil {
 		return err
 	}
+	if numSlotsHeader < 0 || HeaderSize+int(numSlotsHeader)*SlotSize > len(page) {
+		return GoDBError{MalformedDataError, fmt.Sprintf("invalid slot count %d in heap page header", numSlotsHeader)}
+	}
 	tups := make([]*Tuple, numSlotsHeader)
-	for i := 0; i < int(numUsedHeader); i++ {
-		t, err := readTupleFrom(buf, &h.desc)
-		t.Rid = heapFileRid{h.pageNo, i}
+	var versions map[int]*recordVersion
+	usedBytes := 0
+	for i := 0; i < int(numSlotsHeader); i++ {
+		var offset, length uint16
+		err = binary.Read(buf, binary.LittleEndian, &offset)
 		if err != nil {
 			return err
 		}
-		tups[i] = t
+		err = binary.Read(buf, binary.LittleEndian, &length)
+		if err != nil {
+			return err
+		}
+		if length == 0 {
+			continue
+		}
+		versioned := length&versionedRecord != 0
+		length &^= versionedRecord
+		if int(offset)+int(length) > len(page) {
+			return GoDBError{MalformedDataError, fmt.Sprintf("slot %d points past the end of the page", i)}
+		}
+		rec := bytes.NewBuffer(page[offset : int(offset)+int(length)])
+		var ids [2]int64
+		if versioned {
+			err = binary.Read(rec, binary.LittleEndian, &ids)
+			if err != nil {
+				return err
+			}
+		}
+		t, err := readTupleFrom(rec, &h.desc)
+		if err != nil {
+			return err
+		}
+		t.Rid = heapFileRid{h.pageNo, i}
+		usedBytes += int(length)
+		if !versioned {
+			tups[i] = t
+			continue
+		}
+		if versions == nil {
+			versions = make(map[int]*recordVersion)
+		}
+		v := &recordVersion{TransactionID(ids[0]), TransactionID(ids[1]), nil}
+		if v.xmax != noTransaction {
+			v.deleted = t
+		} else {
+			tups[i] = t
+		}
+		versions[i] = v
 	}
 	h.numSlots = numSlotsHeader
 	h.numUsed = numUsedHeader
+	h.usedBytes = usedBytes
 	h.dirty = false
 	h.tuples = tups
+	h.versions = versions
 	h.SetBeforeImage()
 	return nil
 }
@@ -210,6 +415,8 @@ func (h *heapPage) initFromBuffer(buf *bytes.Buffer) error {
 func (p *heapPage) tupleIter() func() (*Tuple, error) {
 	i := 0
 	return func() (*Tuple, error) {
+		p.latch.RLock()
+		defer p.latch.RUnlock()
 		for {
 			if i >= len(p.tuples) {
 				return nil, nil
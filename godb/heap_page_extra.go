@@ -8,22 +8,39 @@ func (p *heapPage) BeforeImage() Page {
 // Sets the before-image of the page to the current state of the page. Be sure
 // that changing the page does not change the before-image.
 func (p *heapPage) SetBeforeImage() {
+	p.latch.RLock()
+	defer p.latch.RUnlock()
+	p.bImage = p.copyPage()
+}
+
+// Return a copy of the page, which shares none of its records.
+//
+// Caller must hold the latch of the page.
+func (p *heapPage) copyPage() *heapPage {
 	newPage := &heapPage{
-		desc:     p.desc,
-		numSlots: p.numSlots,
-		numUsed:  p.numUsed,
-		dirty:    p.dirty,
-		pageNo:   p.pageNo,
-		file:     p.file,
-		lastTxn:  p.lastTxn,
-		tuples:   make([]*Tuple, len(p.tuples)),
+		desc:      p.desc,
+		numSlots:  p.numSlots,
+		numUsed:   p.numUsed,
+		usedBytes: p.usedBytes,
+		dirty:     p.dirty,
+		pageNo:    p.pageNo,
+		file:      p.file,
+		lastTxn:   p.lastTxn,
+		tuples:    make([]*Tuple, len(p.tuples)),
 	}
 	for i, tup := range p.tuples {
 		if tup != nil {
 			newPage.tuples[i] = tup.Copy()
 		}
 	}
-	p.bImage = newPage
+	if len(p.versions) > 0 {
+		// versions aren't changed once they are made, so they are shared
+		newPage.versions = make(map[int]*recordVersion, len(p.versions))
+		for slot, v := range p.versions {
+			newPage.versions[slot] = v
+		}
+	}
+	return newPage
 }
 
 func (t *Tuple) Copy() *Tuple {
@@ -35,6 +52,18 @@ func (t *Tuple) Copy() *Tuple {
 			newFields[i] = IntField{Value: f.Value}
 		case StringField:
 			newFields[i] = StringField{Value: f.Value}
+		case FloatField:
+			newFields[i] = FloatField{Value: f.Value}
+		case DateField:
+			newFields[i] = DateField{Value: f.Value}
+		case TimestampField:
+			newFields[i] = TimestampField{Value: f.Value}
+		case IntervalField:
+			newFields[i] = f
+		case DecimalField:
+			newFields[i] = f
+		case NullField:
+			newFields[i] = NullField{}
 		}
 	}
 	return &Tuple{Desc: *newDesc, Fields: newFields, Rid: t.Rid}
@@ -44,3 +73,459 @@ func (t *Tuple) Copy() *Tuple {
 func (p *heapPage) PageNo() int {
 	return p.pageNo
 }
+
+// Returns the transaction that last dirtied the page.
+func (p *heapPage) lastTransaction() TransactionID {
+	return p.lastTxn
+}
+
+// Put a record in the specified slot, or empty the slot if t is nil, adding
+// slots to the slot directory if needed. The record has no version.
+//
+// Caller must hold the latch of the page.
+func (p *heapPage) setSlot(slot int, t *Tuple) {
+	p.setVersionedSlot(slot, t, nil)
+}
+
+// Put a record with the specified version in the specified slot, like
+// [heapPage.setSlot]. If the version is of a deleted record, t is nil, and
+// the slot holds the deleted record.
+//
+// Caller must hold the latch of the page.
+func (p *heapPage) setVersionedSlot(slot int, t *Tuple, v *recordVersion) {
+	for len(p.tuples) <= slot {
+		p.tuples = append(p.tuples, nil)
+		p.numSlots++
+	}
+	if size := p.slotSize(slot); size > 0 {
+		p.numUsed--
+		p.usedBytes -= size
+	}
+	p.tuples[slot] = t
+	if v != nil {
+		if p.versions == nil {
+			p.versions = make(map[int]*recordVersion)
+		}
+		p.versions[slot] = v
+	} else {
+		delete(p.versions, slot)
+	}
+	if size := p.slotSize(slot); size > 0 {
+		p.numUsed++
+		p.usedBytes += size
+	}
+}
+
+// Return the number of bytes the record in the specified slot takes up,
+// with its version, or 0 if the slot is empty.
+//
+// Caller must hold the latch of the page.
+func (p *heapPage) slotSize(slot int) int {
+	size := 0
+	if t := p.slot(slot); t != nil {
+		size += t.serializedSize()
+	}
+	if v := p.versions[slot]; v != nil {
+		size += versionHeaderSize
+		if v.deleted != nil {
+			size += v.deleted.serializedSize()
+		}
+	}
+	return size
+}
+
+// Put a copy of the record in the specified slot of another image of the
+// page, with its version, in the same slot of the page.
+//
+// Caller must hold the latch of the page.
+func (p *heapPage) copySlotFrom(from *heapPage, slot int) {
+	p.setVersionedSlot(slot, copySlot(from, slot), from.versions[slot])
+}
+
+// Return a copy of the record in the specified slot, or nil if it is empty.
+func copySlot(p *heapPage, slot int) *Tuple {
+	if t := p.slot(slot); t != nil {
+		return t.Copy()
+	}
+	return nil
+}
+
+// Return the slots whose records, or their versions, differ between two
+// images of a heap page.
+func changedSlots(a *heapPage, b *heapPage) []int {
+	var slots []int
+	for i := 0; i < max(len(a.tuples), len(b.tuples)); i++ {
+		ta, tb := a.slot(i), b.slot(i)
+		if (ta == nil) != (tb == nil) || (ta != nil && !ta.equals(tb)) || !a.versions[i].equals(b.versions[i]) {
+			slots = append(slots, i)
+		}
+	}
+	return slots
+}
+
+// Record that tid changed the record in the specified slot, which it holds a
+// write lock on (see [LockTable]).
+//
+// Caller must hold the latch of the page.
+func (p *heapPage) setOwner(slot int, tid TransactionID) {
+	if p.owners == nil {
+		p.owners = make(map[int]TransactionID)
+	}
+	p.owners[slot] = tid
+}
+
+// Return the before image of the page with the records that tid changed,
+// which other transactions can't have changed, in place of those of the
+// before image. Returns nil if tid didn't change any records of the page.
+//
+// Caller must hold the latch of the page.
+func (p *heapPage) ownerImage(tid TransactionID) *heapPage {
+	var after *heapPage
+	for slot, owner := range p.owners {
+		if owner != tid {
+			continue
+		}
+		if after == nil {
+			after = p.bImage.(*heapPage).copyPage()
+		}
+		after.setSlot(slot, copySlot(p, slot))
+	}
+	return after
+}
+
+// Return the images of the page to log for each transaction with uncommitted
+// changes to its records, with only the changes of that transaction (see
+// [heapPage.ownerImage]), keyed by the transaction. Changes to slots without
+// an owner are logged for the transaction that last dirtied the page.
+func (p *heapPage) uncommittedImages() map[TransactionID]Page {
+	p.latch.RLock()
+	defer p.latch.RUnlock()
+	images := make(map[TransactionID]Page)
+	before := p.bImage.(*heapPage)
+	for _, slot := range changedSlots(before, p) {
+		tid, owned := p.owners[slot]
+		if !owned {
+			tid = p.lastTransaction()
+		}
+		if images[tid] == nil {
+			images[tid] = before.copyPage()
+		}
+		images[tid].(*heapPage).setSlot(slot, copySlot(p, slot))
+	}
+	return images
+}
+
+// Make the changes tid made to the records of the page part of its before
+// image, when tid commits. Returns the old and new before images, which
+// describe the changes of tid alone, or nils if tid didn't change any
+// records of the page. The page is clean once no transaction has changes on
+// it. If some snapshots of m don't see the changes of tid, the records tid
+// created and deleted are versioned, and the deleted ones stay in their
+// slots (see [snapshotManager]); the snapshots are too old if there is no
+// room for the versions.
+func (p *heapPage) commitSlots(tid TransactionID, m *snapshotManager) (Page, Page) {
+	p.latch.Lock()
+	defer p.latch.Unlock()
+	after := p.ownerImage(tid)
+	if after == nil {
+		return nil, nil
+	}
+	before := p.bImage
+	if m.needsVersions(tid) {
+		room := p.freeSpace() - p.reservedSpace()
+		for slot, owner := range p.owners {
+			t, old := p.slot(slot), before.(*heapPage).slot(slot)
+			if owner != tid || (t == nil && old == nil) {
+				continue
+			}
+			if room < versionHeaderSize {
+				m.expire(tid)
+				continue
+			}
+			room -= versionHeaderSize
+			v := committedVersion(tid, old, before.(*heapPage).versions[slot])
+			p.setVersionedSlot(slot, t, v)
+			after.setVersionedSlot(slot, after.slot(slot), v)
+		}
+	}
+	p.bImage = after
+	p.clearOwner(tid)
+	if len(p.owners) == 0 {
+		p.setDirty(tid, false)
+	}
+	return before, after
+}
+
+// Put back the records that tid changed as they are in the before image of
+// the page, when tid aborts, leaving the changes of other transactions in
+// place. The page is clean once no transaction has changes on it.
+func (p *heapPage) abortSlots(tid TransactionID) {
+	p.latch.Lock()
+	defer p.latch.Unlock()
+	for slot, owner := range p.owners {
+		if owner == tid {
+			p.copySlotFrom(p.bImage.(*heapPage), slot)
+		}
+	}
+	p.clearOwner(tid)
+	if len(p.owners) == 0 {
+		p.setDirty(tid, false)
+	}
+}
+
+// Returns true if transactions that haven't committed changed records of the
+// page.
+func (p *heapPage) hasOwners() bool {
+	p.latch.RLock()
+	defer p.latch.RUnlock()
+	return len(p.owners) > 0
+}
+
+// Return the version of a record that tid changed once tid commits: the
+// record tid created, if its slot was empty, or the record old, with the
+// version oldVersion, which tid deleted.
+func committedVersion(tid TransactionID, old *Tuple, oldVersion *recordVersion) *recordVersion {
+	if old == nil {
+		return &recordVersion{tid, noTransaction, nil}
+	}
+	xmin := noTransaction
+	if oldVersion != nil {
+		xmin = oldVersion.xmin
+	}
+	return &recordVersion{xmin, tid, old.Copy()}
+}
+
+// The slots of an evicted heap page that transactions that haven't committed
+// changed, and the records that were in them before, with their versions,
+// which the buffer pool keeps until the page is read again (see
+// [heapPage.detachOwners]).
+type slotOwners struct {
+	owners   map[int]TransactionID
+	before   map[int]*Tuple
+	versions map[int]*recordVersion
+
+	// the versions of the records that transactions that committed after the
+	// page was evicted changed, for the snapshots that don't see their
+	// changes, and the room left for them on the page
+	committed map[int]*recordVersion
+	room      int
+}
+
+// Return the slots of the page that transactions that haven't committed
+// changed, with the records of the before image in them, when the page is
+// evicted. Returns nil if there are none.
+func (p *heapPage) detachOwners() *slotOwners {
+	p.latch.RLock()
+	defer p.latch.RUnlock()
+	if len(p.owners) == 0 {
+		return nil
+	}
+	o := &slotOwners{make(map[int]TransactionID), make(map[int]*Tuple), make(map[int]*recordVersion), make(map[int]*recordVersion), p.freeSpace() - p.reservedSpace()}
+	before := p.bImage.(*heapPage)
+	for slot, tid := range p.owners {
+		o.owners[slot] = tid
+		o.before[slot] = copySlot(before, slot)
+		if v := before.versions[slot]; v != nil {
+			o.versions[slot] = v
+		}
+	}
+	return o
+}
+
+// Attach the slots that were detached from the page when it was evicted, once
+// it is read again. The page was clean when it was evicted, so the page read
+// from its file has the changes of the transactions, and its before image is
+// the page with the old records put back. The changes of the transactions
+// that committed since are versioned, if snapshots still need them.
+func (p *heapPage) attachOwners(o *slotOwners) {
+	p.latch.Lock()
+	defer p.latch.Unlock()
+	for slot, v := range o.committed {
+		if v.deleted != nil {
+			p.setVersionedSlot(slot, nil, v)
+		} else if t := p.slot(slot); t != nil {
+			p.setVersionedSlot(slot, t, v)
+		}
+	}
+	before := p.copyPage()
+	for slot, tid := range o.owners {
+		p.setOwner(slot, tid)
+		before.setVersionedSlot(slot, o.before[slot], o.versions[slot])
+	}
+	p.bImage = before
+}
+
+// Version the records that tid, which is committing, changed on the evicted
+// page, like [heapPage.commitSlots], once the page is read again.
+func (o *slotOwners) keepVersions(tid TransactionID, m *snapshotManager) {
+	if !m.needsVersions(tid) {
+		return
+	}
+	for slot, owner := range o.owners {
+		if owner != tid {
+			continue
+		}
+		if o.room < versionHeaderSize {
+			m.expire(tid)
+			continue
+		}
+		o.room -= versionHeaderSize
+		o.committed[slot] = committedVersion(tid, o.before[slot], o.versions[slot])
+	}
+}
+
+// Forget the slots that tid changed. Returns true if there are none left, and
+// no versions to put on the page either.
+func (o *slotOwners) clear(tid TransactionID) bool {
+	for slot, owner := range o.owners {
+		if owner == tid {
+			delete(o.owners, slot)
+			delete(o.before, slot)
+			delete(o.versions, slot)
+		}
+	}
+	return len(o.owners) == 0 && len(o.committed) == 0
+}
+
+// Forget the slots that tid changed.
+//
+// Caller must hold the latch of the page.
+func (p *heapPage) clearOwner(tid TransactionID) {
+	for slot, owner := range p.owners {
+		if owner == tid {
+			delete(p.owners, slot)
+		}
+	}
+}
+
+// Return the key of the record in the specified slot of the page in the lock
+// table and the version store.
+func (p *heapPage) recordKey(slot int) recordKey {
+	return recordKey{p.file.pageKey(p.pageNo), heapFileRid{p.pageNo, slot}}
+}
+
+// Return the record in the specified slot that a snapshot sees, or nil if it
+// sees none (see [snapshotManager]). The snapshot sees the changes of its own
+// transaction, and of transactions that are committing and that it sees, on
+// the page, and the other records as they were committed when it was taken.
+//
+// Caller must hold the latch of the page.
+func (p *heapPage) snapshotSlot(slot int, s *snapshot) *Tuple {
+	committed, v := p.slot(slot), p.versions[slot]
+	if owner, owned := p.owners[slot]; owned {
+		if s.sees(owner) {
+			return committed
+		}
+		before := p.bImage.(*heapPage)
+		committed, v = before.slot(slot), before.versions[slot]
+	}
+	return s.visible(committed, v)
+}
+
+// Returns true if a transaction that committed after the snapshot was taken
+// created or deleted the record in the specified slot, so that the
+// snapshot's transaction can't change it.
+func (p *heapPage) changedAfter(slot int, s *snapshot) bool {
+	p.latch.RLock()
+	defer p.latch.RUnlock()
+	return s.changedAfter(p.versions[slot])
+}
+
+// Drop the versions of the records of the page, and of its before image,
+// that every running snapshot of m sees as they are, and the deleted records
+// that every snapshot sees were deleted (see [snapshotManager]). Returns
+// true if any were dropped.
+func (p *heapPage) pruneVersions(m *snapshotManager) bool {
+	p.latch.Lock()
+	defer p.latch.Unlock()
+	if !p.pruneSlots(m) {
+		return false
+	}
+	if old, ok := p.bImage.(*heapPage); ok {
+		// the before image may be being written, so a copy of it is pruned
+		old.latch.RLock()
+		before := old.copyPage()
+		old.latch.RUnlock()
+		before.pruneSlots(m)
+		p.bImage = before
+	}
+	return true
+}
+
+// Drop the versions that the snapshots of m don't need from the page, like
+// [heapPage.pruneVersions], leaving the before image as it is.
+//
+// Caller must hold the latch of the page.
+func (p *heapPage) pruneSlots(m *snapshotManager) bool {
+	pruned := false
+	for slot, v := range p.versions {
+		if !m.seenByAll(v) {
+			continue
+		}
+		p.dropVersion(slot, v)
+		pruned = true
+	}
+	return pruned
+}
+
+// Drop the versions of a page that was read from its file, or from the log,
+// and whose versions were written before the database was started: the
+// deleted records are dropped, and the others are kept without versions. The
+// transactions that made the versions ended before any snapshot was taken,
+// and their IDs may be those of other transactions now (see
+// [snapshotManager]).
+func (p *heapPage) forgetVersions() {
+	p.latch.Lock()
+	defer p.latch.Unlock()
+	for slot, v := range p.versions {
+		p.dropVersion(slot, v)
+	}
+}
+
+// Drop the version of a slot that every snapshot sees as it is.
+//
+// Caller must hold the latch of the page.
+func (p *heapPage) dropVersion(slot int, v *recordVersion) {
+	if v.deleted != nil {
+		p.setSlot(slot, nil)
+	} else {
+		p.setSlot(slot, p.slot(slot))
+	}
+}
+
+// Drop the versions that the snapshots of m don't need, like
+// [heapPage.pruneVersions]. Returns true if there are no slots left.
+func (o *slotOwners) pruneVersions(m *snapshotManager) bool {
+	for slot, v := range o.versions {
+		if m.seenByAll(v) {
+			delete(o.versions, slot)
+		}
+	}
+	for slot, v := range o.committed {
+		if m.seenByAll(v) {
+			delete(o.committed, slot)
+		}
+	}
+	return len(o.owners) == 0 && len(o.committed) == 0
+}
+
+// Return a function that iterates through the records of the page that a
+// snapshot sees, like [heapPage.tupleIter].
+func (p *heapPage) snapshotIter(s *snapshot) func() (*Tuple, error) {
+	i := 0
+	return func() (*Tuple, error) {
+		p.latch.RLock()
+		defer p.latch.RUnlock()
+		if err := s.check(); err != nil {
+			return nil, err
+		}
+		for i < len(p.tuples) {
+			t := p.snapshotSlot(i, s)
+			i++
+			if t != nil {
+				return t, nil
+			}
+		}
+		return nil, nil
+	}
+}
@@ -1,19 +1,27 @@
 package godb
 
 import (
+	"bytes"
+	"strings"
 	"testing"
-	"unsafe"
 )
 
+// Returns the number of copies of tup that fit on an empty heap page.
+func tuplesPerPage(tup *Tuple) int {
+	return (PageSize - HeaderSize) / (tup.serializedSize() + SlotSize)
+}
+
 func TestHeapPageInsert(t *testing.T) {
 	td, t1, t2, hf, _, _ := makeTestVars(t)
 	pg, err := newHeapPage(&td, 0, hf)
 	if err != nil {
 		t.Fatalf(err.Error())
 	}
-	var expectedSlots = (PageSize - 8) / (StringLength + int(unsafe.Sizeof(int64(0))))
-	if pg.getNumSlots() != expectedSlots {
-		t.Fatalf("Incorrect number of slots, expected %d, got %d", expectedSlots, pg.getNumSlots())
+	if pg.getNumSlots() != 0 {
+		t.Fatalf("Incorrect number of slots, expected 0, got %d", pg.getNumSlots())
+	}
+	if pg.getFreeSpace() != PageSize-HeaderSize {
+		t.Fatalf("Incorrect free space, expected %d, got %d", PageSize-HeaderSize, pg.getFreeSpace())
 	}
 
 	_, err = pg.insertTuple(&t1)
@@ -85,7 +93,7 @@ func TestHeapPageInsertTuple(t *testing.T) {
 	if err != nil {
 		t.Fatalf(err.Error())
 	}
-	free := page.getNumSlots()
+	free := tuplesPerPage(&Tuple{Desc: td, Fields: []DBValue{StringField{"sam"}, IntField{0}}})
 
 	for i := 0; i < free; i++ {
 		var addition = Tuple{
@@ -134,7 +142,7 @@ func TestHeapPageDeleteTuple(t *testing.T) {
 	if err != nil {
 		t.Fatalf(err.Error())
 	}
-	free := page.getNumSlots()
+	free := tuplesPerPage(&Tuple{Desc: td, Fields: []DBValue{StringField{"sam"}, IntField{0}}})
 
 	list := make([]recordID, free)
 	for i := 0; i < free; i++ {
@@ -200,7 +208,7 @@ func TestHeapPageSerialization(t *testing.T) {
 	if err != nil {
 		t.Fatalf(err.Error())
 	}
-	free := page.getNumSlots()
+	free := tuplesPerPage(&Tuple{Desc: td, Fields: []DBValue{StringField{"sam"}, IntField{0}}})
 
 	for i := 0; i < free-1; i++ {
 		var addition = Tuple{
@@ -258,7 +266,7 @@ func TestHeapPageBufferLen(t *testing.T) {
 	if err != nil {
 		t.Fatalf(err.Error())
 	}
-	free := page.getNumSlots()
+	free := tuplesPerPage(&Tuple{Desc: td, Fields: []DBValue{StringField{"sam"}, IntField{0}}})
 
 	for i := 0; i < free-1; i++ {
 		var addition = Tuple{
@@ -277,3 +285,63 @@ func TestHeapPageBufferLen(t *testing.T) {
 		t.Fatalf("HeapPage.toBuffer returns buffer of unexpected size;  NOTE:  This error may be OK, but many implementations that don't write full pages break.")
 	}
 }
+
+// Unit test for storing strings of different lengths on a page
+func TestHeapPageVarLenStrings(t *testing.T) {
+	td, _, _, hf, _, _ := makeTestVars(t)
+	page, err := newHeapPage(&td, 0, hf)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	long := strings.Repeat("x", 1000)
+	values := []string{"", "a", long, "sam"}
+	for i, v := range values {
+		tup := Tuple{Desc: td, Fields: []DBValue{StringField{v}, IntField{int64(i)}}}
+		if _, err := page.insertTuple(&tup); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+
+	buf, err := page.toBuffer()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	page2, err := newHeapPage(&td, 0, hf)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if err := page2.initFromBuffer(bytes.NewBuffer(buf.Bytes())); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if page2.getFreeSpace() != page.getFreeSpace() {
+		t.Errorf("expected free space %d after deserialization, got %d", page.getFreeSpace(), page2.getFreeSpace())
+	}
+	iter := page2.tupleIter()
+	for i, v := range values {
+		tup, _ := iter()
+		if tup == nil {
+			t.Fatalf("expected %d tuples, got %d", len(values), i)
+		}
+		if tup.Fields[0].(StringField).Value != v {
+			t.Errorf("expected string of length %d, got length %d", len(v), len(tup.Fields[0].(StringField).Value))
+		}
+	}
+
+	// a string that doesn't fit in the remaining space is rejected, and
+	// deleting a long record makes room for it
+	huge := Tuple{Desc: td, Fields: []DBValue{StringField{strings.Repeat("y", 3500)}, IntField{0}}}
+	if _, err := page.insertTuple(&huge); err != ErrPageFull {
+		t.Fatalf("expected page full error, got %v", err)
+	}
+	if err := page.deleteTuple(heapFileRid{0, 2}); err != nil {
+		t.Fatalf(err.Error())
+	}
+	rid, err := page.insertTuple(&huge)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if rid.(heapFileRid).slotNo != 2 {
+		t.Errorf("expected deleted slot 2 to be reused, got slot %d", rid.(heapFileRid).slotNo)
+	}
+}
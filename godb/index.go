@@ -0,0 +1,189 @@
+package godb
+
+import (
+	"fmt"
+	"math"
+)
+
+// An Index is a DBFile that maps the values of one field of a HeapFile to the
+// record ids of the tuples with those values.
+//
+// The insertTuple and deleteTuple methods of an index take a tuple of the
+// table, with its Rid set, and add or remove the index entry for it; tuples
+// whose indexed field is NULL are not indexed. Indexes are kept up to date by
+// the insert and delete operators, and are read by the [IndexScan] operator.
+type Index interface {
+	DBFile
+
+	// Return the name of the backing file of the index.
+	BackingFile() string
+
+	// Return the field of the table that is indexed.
+	keyField() FieldType
+
+	// Returns true if the index can find the tuples that satisfy a predicate
+	// with the specified operator.
+	supportsOp(op BoolOp) bool
+
+	// Return an iterator over the record ids of the tuples whose indexed field
+	// satisfies "field op value". The iterator returns nil, nil after the last
+	// record id.
+	lookup(op BoolOp, value DBValue, tid TransactionID) (func() (recordID, error), error)
+
+	// Estimate the number of index pages that are read by a lookup that
+	// matches the specified fraction of the entries in the index.
+	estimatePagesRead(selectivity float64) int
+}
+
+// An entry of an index: a key and the record id of the heap tuple it was
+// taken from.
+type indexEntry struct {
+	key DBValue
+	rid heapFileRid
+}
+
+// Compare two entries by key and then by record id, returning -1, 0 or 1 if e
+// is less than, equal to or greater than e2.
+func (e *indexEntry) compare(e2 *indexEntry) int {
+	if c := compareIndexKeys(e.key, e2.key); c != 0 {
+		return c
+	}
+	switch {
+	case e.rid.pageNo < e2.rid.pageNo:
+		return -1
+	case e.rid.pageNo > e2.rid.pageNo:
+		return 1
+	case e.rid.slotNo < e2.rid.slotNo:
+		return -1
+	case e.rid.slotNo > e2.rid.slotNo:
+		return 1
+	}
+	return 0
+}
+
+// Return the entry as a tuple with the key, page number and slot number.
+func (e *indexEntry) tuple(desc *TupleDesc) *Tuple {
+	return &Tuple{*desc, []DBValue{e.key, IntField{int64(e.rid.pageNo)}, IntField{int64(e.rid.slotNo)}}, nil}
+}
+
+// Return the index entry for a tuple of the table, whose indexed field is at
+// position fieldNo, or nil if its key is NULL.
+func indexEntryFor(t *Tuple, fieldNo int) (*indexEntry, error) {
+	if fieldNo >= len(t.Fields) {
+		return nil, GoDBError{TypeMismatchError, "tuple doesn't have the indexed field"}
+	}
+	key := t.Fields[fieldNo]
+	if isNull(key) {
+		return nil, nil
+	}
+	rid, ok := t.Rid.(heapFileRid)
+	if !ok {
+		return nil, GoDBError{TupleNotFoundError, "provided tuple is not a heap file tuple, based on rid"}
+	}
+	return &indexEntry{key, rid}, nil
+}
+
+// Return the descriptor of the tuples that index entries are serialized as:
+// the key, and the page number and slot number of the record id.
+func indexEntryDesc(keyField FieldType) TupleDesc {
+	return TupleDesc{[]FieldType{
+		{keyField.Fname, "", keyField.Ftype},
+		{"page", "", IntType},
+		{"slot", "", IntType},
+	}}
+}
+
+// Construct an index entry from its tuple (see [indexEntryDesc]).
+func indexEntryFromTuple(t *Tuple) *indexEntry {
+	return &indexEntry{t.Fields[0], heapFileRid{int(t.Fields[1].(IntField).Value), int(t.Fields[2].(IntField).Value)}}
+}
+
+// Open an index of the specified kind on a field of a table.
+func newIndexFile(kind string, fromFile string, table *HeapFile, field string, bp *BufferPool) (Index, error) {
+	switch kind {
+	case "btree":
+		return NewBTreeFile(fromFile, table, field, bp)
+	case "hash":
+		return NewHashFile(fromFile, table, field, bp)
+	}
+	return nil, GoDBError{ParseError, fmt.Sprintf("unsupported index type %s", kind)}
+}
+
+// Insert an entry for every tuple of the table into a new index, in a
+// transaction of its own.
+func buildIndex(bp *BufferPool, idx Index, table *HeapFile) error {
+	tid := NewTID()
+	if err := bp.BeginTransaction(tid); err != nil {
+		return err
+	}
+	iter, err := table.Iterator(tid)
+	if err != nil {
+		bp.AbortTransaction(tid)
+		return err
+	}
+	for {
+		t, err := iter()
+		if err != nil {
+			bp.AbortTransaction(tid)
+			return err
+		}
+		if t == nil {
+			break
+		}
+		if err := idx.insertTuple(t, tid); err != nil {
+			bp.AbortTransaction(tid)
+			return err
+		}
+	}
+	return bp.CommitTransaction(tid)
+}
+
+// Add entries for a tuple that was just inserted into file to the indexes on
+// the file.
+func insertIntoIndexes(file DBFile, t *Tuple, tid TransactionID) error {
+	hf, ok := file.(*HeapFile)
+	if !ok {
+		return nil
+	}
+	for _, idx := range hf.getIndexes() {
+		if err := idx.insertTuple(t, tid); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Remove the entries for a tuple that was just deleted from file from the
+// indexes on the file.
+func deleteFromIndexes(file DBFile, t *Tuple, tid TransactionID) error {
+	hf, ok := file.(*HeapFile)
+	if !ok {
+		return nil
+	}
+	for _, idx := range hf.getIndexes() {
+		if err := idx.deleteTuple(t, tid); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Compare two non-NULL index keys, returning -1, 0 or 1 if k1 is less than,
+// equal to or greater than k2.
+func compareIndexKeys(k1 DBValue, k2 DBValue) int {
+	if k1.EvalPred(k2, OpLt) {
+		return -1
+	} else if k1.EvalPred(k2, OpEq) {
+		return 0
+	}
+	return 1
+}
+
+// Estimate the cost of fetching the tuples that satisfy a predicate with the
+// specified selectivity through an index: the index pages that are read, plus
+// one heap page read for every matching tuple, since the tuples of the table
+// aren't stored in index order.
+func estimateIndexScanCost(idx Index, stats Stats, selectivity float64) float64 {
+	matches := math.Ceil(float64(stats.EstimateCardinality(selectivity)))
+	return float64(idx.estimatePagesRead(selectivity))*CostPerPage + matches*CostPerPage
+}
@@ -0,0 +1,90 @@
+package godb
+
+import "fmt"
+
+type IndexJoin struct {
+	// Expression that when applied to tuples from the outer operator returns
+	// the value that is looked up in the index
+	outerField Expr
+
+	outer Operator  // Operator for the outer input of the join
+	inner *HeapFile // Table that is probed through the index
+	index Index     // Index on the join field of the inner table
+
+	// Whether the inner table is the left side of the join, which puts its
+	// fields first in the joined tuples
+	innerLeft bool
+}
+
+// Constructor for an index nested-loop join, which joins the tuples of outer
+// with the tuples of inner whose indexed field is equal to outerField.
+//
+// Returns an error if the index can't find the tuples equal to a value.
+func NewIndexJoin(outer Operator, outerField Expr, inner *HeapFile, index Index, innerLeft bool) (*IndexJoin, error) {
+	if !index.supportsOp(OpEq) {
+		return nil, GoDBError{IllegalOperationError, fmt.Sprintf("index %s does not support equality lookups", index.BackingFile())}
+	}
+	return &IndexJoin{outerField, outer, inner, index, innerLeft}, nil
+}
+
+// Return a TupleDesc for this join, which has the fields of the left side of
+// the join followed by the fields of the right side.
+func (j *IndexJoin) Descriptor() *TupleDesc {
+	if j.innerLeft {
+		return j.inner.Descriptor().merge(j.outer.Descriptor())
+	}
+	return j.outer.Descriptor().merge(j.inner.Descriptor())
+}
+
+// Index nested-loop join implementation. This function iterates over the
+// outer operator once, and looks up the matching tuples of the inner table
+// in the index for each outer tuple, instead of scanning the inner table.
+func (j *IndexJoin) Iterator(tid TransactionID) (func() (*Tuple, error), error) {
+	outerIter, err := j.outer.Iterator(tid)
+	if err != nil {
+		return nil, err
+	}
+	var outerTup *Tuple
+	var ridIter func() (recordID, error)
+	return func() (*Tuple, error) {
+		for {
+			if ridIter == nil {
+				outerTup, err = outerIter()
+				if err != nil || outerTup == nil {
+					return nil, err
+				}
+				v, err := j.outerField.EvalExpr(outerTup)
+				if err != nil {
+					return nil, err
+				}
+				// NULL never compares equal to anything, so it can't join
+				if isNull(v) {
+					continue
+				}
+				ridIter, err = j.index.lookup(OpEq, v, tid)
+				if err != nil {
+					return nil, err
+				}
+			}
+			rid, err := ridIter()
+			if err != nil {
+				return nil, err
+			}
+			if rid == nil {
+				ridIter = nil
+				continue
+			}
+			innerTup, err := j.inner.tupleAt(rid, tid)
+			if err != nil {
+				return nil, err
+			}
+			if innerTup == nil {
+				continue
+			}
+			if j.innerLeft {
+				return joinTuples(innerTup, outerTup), nil
+			}
+			return joinTuples(outerTup, innerTup), nil
+		}
+	}, nil
+}
@@ -0,0 +1,51 @@
+package godb
+
+import "fmt"
+
+type IndexScan struct {
+	file  *HeapFile
+	index Index
+	op    BoolOp
+	value DBValue
+}
+
+// Construct an index scan operator, which returns the tuples of file whose
+// indexed field satisfies "field op value". The tuples are found with the
+// index rather than by scanning the whole file.
+func NewIndexScan(file *HeapFile, index Index, op BoolOp, value DBValue) (*IndexScan, error) {
+	if !index.supportsOp(op) {
+		return nil, GoDBError{IllegalOperationError, fmt.Sprintf("index %s does not support %s", index.BackingFile(), op)}
+	}
+	return &IndexScan{file, index, op, value}, nil
+}
+
+// Return a TupleDescriptor for this index scan, which is the descriptor of the
+// file.
+func (s *IndexScan) Descriptor() *TupleDesc {
+	return s.file.Descriptor()
+}
+
+// Index scan operator implementation. This function looks up the record ids
+// of the matching tuples in the index, and fetches the tuples from the heap
+// file, with their Rid set so that they can be deleted.
+func (s *IndexScan) Iterator(tid TransactionID) (func() (*Tuple, error), error) {
+	ridIter, err := s.index.lookup(s.op, s.value, tid)
+	if err != nil {
+		return nil, err
+	}
+	return func() (*Tuple, error) {
+		for {
+			rid, err := ridIter()
+			if err != nil || rid == nil {
+				return nil, err
+			}
+			t, err := s.file.tupleAt(rid, tid)
+			if err != nil {
+				return nil, err
+			}
+			if t != nil {
+				return t, nil
+			}
+		}
+	}, nil
+}
@@ -22,7 +22,7 @@ func (i *InsertOp) Descriptor() *TupleDesc {
 // iterator into the DBFile passed to the constuctor and then returns a
 // one-field tuple with a "count" field indicating the number of tuples that
 // were inserted.  Tuples should be inserted using the [DBFile.insertTuple]
-// method.
+// method, and added to the indexes on the DBFile.
 func (iop *InsertOp) Iterator(tid TransactionID) (func() (*Tuple, error), error) {
 	iter, err := iop.child.Iterator(tid)
 	if err != nil {
@@ -46,15 +46,32 @@ func (iop *InsertOp) Iterator(tid TransactionID) (func() (*Tuple, error), error)
 			if len(td.Fields) != len(t.Fields) {
 				return nil, GoDBError{TypeMismatchError, "inserted tuple doesn't have same number of fields as table."}
 			}
-			for i, f := range t.Desc.Fields {
-				if f.Ftype != td.Fields[i].Ftype {
-					return nil, GoDBError{TypeMismatchError, fmt.Sprintf("expected type %s in %dth inserted field, got %s", td.Fields[i].Ftype.String(), i, f.Ftype.String())}
+			for i, v := range t.Fields {
+				// NULL may be inserted into a field of any type
+				if isNull(v) {
+					continue
+				}
+				// e.g., ints can be stored in float fields and
+				// strings in date fields; decimals are rounded to the
+				// scale of their field
+				v, err := coerceValue(v, td.Fields[i].Ftype)
+				if err != nil {
+					return nil, err
+				}
+				t.Fields[i] = v
+				ftype := typeOfValue(v)
+				if ftype.baseType() != td.Fields[i].Ftype.baseType() {
+					return nil, GoDBError{TypeMismatchError, fmt.Sprintf("expected type %s in %dth inserted field, got %s", td.Fields[i].Ftype.String(), i, ftype.String())}
 				}
 			}
 			err = iop.insertFile.insertTuple(t, tid)
 			if err != nil {
 				return nil, err
 			}
+			err = insertIntoIndexes(iop.insertFile, t, tid)
+			if err != nil {
+				return nil, err
+			}
 			cnt = cnt + 1
 		}
 		didIterate = true
@@ -0,0 +1,130 @@
+package godb
+
+// The isolation level of a transaction, which sets which locks it takes to
+// read, and how long it holds them (see
+// [BufferPool.BeginTransactionWithIsolation]). Locks taken to change pages and
+// records are held until the transaction commits or aborts at every level, so
+// no transaction reads or overwrites the uncommitted changes of another.
+type IsolationLevel int
+
+const (
+	// Strict two-phase locking: the pages a transaction reads are locked
+	// until it ends, and a scan of a heap file locks the end of the file, so
+	// that no records can be added to what it read (no phantoms). This is the
+	// default.
+	Serializable IsolationLevel = iota
+
+	// The records a transaction reads are locked until it ends, so it reads
+	// the same values if it reads them again, but scans of heap files lock
+	// only the records they read, so records that other transactions insert
+	// in the meantime appear when a scan is repeated (phantoms).
+	RepeatableRead
+
+	// Read locks are released as soon as the page or record has been read, so
+	// a transaction reads only committed data, but it may read different
+	// values if it reads a record twice (non-repeatable reads), as well as
+	// phantoms. Records that no other transaction is changing are read
+	// without locking them.
+	ReadCommitted
+)
+
+func (l IsolationLevel) String() string {
+	switch l {
+	case Serializable:
+		return "SERIALIZABLE"
+	case RepeatableRead:
+		return "REPEATABLE READ"
+	case ReadCommitted:
+		return "READ COMMITTED"
+	}
+	return "UNKNOWN"
+}
+
+// Begin a transaction that runs at the specified isolation level (see
+// [IsolationLevel]). [BufferPool.BeginTransaction] begins transactions at the
+// Serializable level.
+//
+// Returns an error if the transaction is already running.
+func (bp *BufferPool) BeginTransactionWithIsolation(tid TransactionID, level IsolationLevel) error {
+	if err := bp.BeginTransaction(tid); err != nil {
+		return err
+	}
+	bp.tidLatch.Lock()
+	defer bp.tidLatch.Unlock()
+	if r, ok := bp.runningTids[tid]; ok {
+		r.isolation = level
+		bp.runningTids[tid] = r
+	}
+	return nil
+}
+
+// Return the isolation level of a running transaction.
+func (bp *BufferPool) isolationOf(tid TransactionID) IsolationLevel {
+	bp.tidLatch.Lock()
+	defer bp.tidLatch.Unlock()
+	return bp.runningTids[tid].isolation
+}
+
+// Lock the end of a file, past its last page, for tid, waiting until the lock
+// is granted like [BufferPool.GetPage]. A Serializable scan locks it for
+// reading once it has read the last page, and a transaction that appends a
+// page to the file takes an intention write lock on it first, so that no
+// pages are appended to a file that a running transaction scanned.
+func (bp *BufferPool) lockFileEnd(file DBFile, tid TransactionID, perm RWPerm) error {
+	return bp.waitForGrant(tid, "the end of the file", func() (LockResponse, *lockWaiter) {
+		resp, w := bp.lockTable.requestFileLock(file, tid, intentionFor(perm))
+		if resp == Grant {
+			resp, w = bp.lockTable.requestFileEndLock(file, tid, perm)
+		}
+		return resp, w
+	})
+}
+
+// Return a function that iterates through the records of a heap page, like
+// [heapPage.tupleIter], for a transaction that locks the records it reads
+// rather than the page, and holds an intention read lock on the page. Each
+// record is locked for reading before it is returned, so that it isn't read
+// while another transaction is changing it; at the ReadCommitted level, the
+// lock is released right away, and records that no other transaction is
+// changing aren't locked at all.
+func (f *HeapFile) recordIter(p *heapPage, tid TransactionID, level IsolationLevel) func() (*Tuple, error) {
+	i := 0
+	return func() (*Tuple, error) {
+		for {
+			p.latch.RLock()
+			if i >= len(p.tuples) {
+				p.latch.RUnlock()
+				return nil, nil
+			}
+			slot := i
+			i++
+			t := p.slot(slot)
+			owner, owned := p.owners[slot]
+			p.latch.RUnlock()
+
+			if !owned || owner == tid {
+				if level == ReadCommitted || t == nil {
+					if t != nil {
+						return t, nil
+					}
+					continue
+				}
+			}
+			// wait until no other transaction is changing the record, and
+			// read it again
+			rid := heapFileRid{p.pageNo, slot}
+			if err := f.bufPool.lockRecord(f, rid, tid, ReadPerm); err != nil {
+				return nil, err
+			}
+			p.latch.RLock()
+			t = p.slot(slot)
+			p.latch.RUnlock()
+			if level == ReadCommitted {
+				f.bufPool.lockTable.releaseReadLock(p.recordKey(slot), tid)
+			}
+			if t != nil {
+				return t, nil
+			}
+		}
+	}
+}
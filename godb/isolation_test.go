@@ -0,0 +1,156 @@
+package godb
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// Begin a transaction at the specified isolation level.
+func beginIsolatedForTest(t *testing.T, bp *BufferPool, level IsolationLevel) TransactionID {
+	t.Helper()
+	tid := NewTID()
+	if err := bp.BeginTransactionWithIsolation(tid, level); err != nil {
+		t.Fatalf(err.Error())
+	}
+	return tid
+}
+
+// Returns true if err is a LockTimeoutError, i.e., the request waited for
+// another transaction.
+func isLockTimeout(err error) bool {
+	var gerr GoDBError
+	return errors.As(err, &gerr) && gerr.code == LockTimeoutError
+}
+
+func TestIsolationLevelDirtyReads(t *testing.T) {
+	for _, level := range []IsolationLevel{ReadCommitted, RepeatableRead, Serializable} {
+		bp, hf, tups := makeSnapshotTestFile(t, 3)
+		bp.SetLockTimeout(100 * time.Millisecond)
+
+		// no level reads the uncommitted delete; the reader waits for the
+		// writer instead
+		writer := BeginTransactionForTest(t, bp)
+		if err := hf.deleteTuple(&tups[0], writer); err != nil {
+			t.Fatalf(err.Error())
+		}
+		reader := beginIsolatedForTest(t, bp, level)
+		if _, err := hf.tupleAt(tups[0].Rid, reader); !isLockTimeout(err) {
+			t.Errorf("%s: expected reading an uncommitted delete to wait, got %v", level, err)
+		}
+		iter, err := hf.Iterator(reader)
+		if err == nil {
+			_, err = iter()
+		}
+		if !isLockTimeout(err) {
+			t.Errorf("%s: expected a scan to wait for the uncommitted delete, got %v", level, err)
+		}
+		if err := bp.CommitTransaction(writer); err != nil {
+			t.Fatalf(err.Error())
+		}
+		if vals := scanValuesForTest(t, hf, reader); !equalValues(vals, []int64{1, 2}) {
+			t.Errorf("%s: expected records 1 and 2 once the delete committed, got %v", level, vals)
+		}
+		bp.CommitTransaction(reader)
+	}
+}
+
+func TestIsolationLevelNonRepeatableReads(t *testing.T) {
+	for _, level := range []IsolationLevel{ReadCommitted, RepeatableRead, Serializable} {
+		bp, hf, tups := makeSnapshotTestFile(t, 3)
+		bp.SetLockTimeout(100 * time.Millisecond)
+
+		reader := beginIsolatedForTest(t, bp, level)
+		if vals := scanValuesForTest(t, hf, reader); !equalValues(vals, []int64{0, 1, 2}) {
+			t.Fatalf("%s: expected records 0, 1 and 2, got %v", level, vals)
+		}
+		if got, err := hf.tupleAt(tups[1].Rid, reader); err != nil || got == nil {
+			t.Fatalf("%s: expected to read record 1, got %v, %v", level, got, err)
+		}
+
+		// only ReadCommitted lets a writer delete the records the reader
+		// read before the reader ends
+		writer := BeginTransactionForTest(t, bp)
+		err0 := hf.deleteTuple(&tups[0], writer)
+		err1 := hf.deleteTuple(&tups[1], writer)
+		if level == ReadCommitted {
+			if err0 != nil || err1 != nil {
+				t.Fatalf("%s: expected the deletes not to wait, got %v, %v", level, err0, err1)
+			}
+			if err := bp.CommitTransaction(writer); err != nil {
+				t.Fatalf(err.Error())
+			}
+		} else {
+			if !isLockTimeout(err0) || !isLockTimeout(err1) {
+				t.Errorf("%s: expected the deletes to wait for the reader, got %v, %v", level, err0, err1)
+			}
+			bp.AbortTransaction(writer)
+		}
+
+		expected := []int64{0, 1, 2}
+		if level == ReadCommitted {
+			expected = []int64{2}
+		}
+		if vals := scanValuesForTest(t, hf, reader); !equalValues(vals, expected) {
+			t.Errorf("%s: expected records %v when reading them again, got %v", level, expected, vals)
+		}
+		if got, err := hf.tupleAt(tups[1].Rid, reader); err != nil || (got == nil) != (level == ReadCommitted) {
+			t.Errorf("%s: unexpected record 1 when reading it again, got %v, %v", level, got, err)
+		}
+		bp.CommitTransaction(reader)
+	}
+}
+
+func TestIsolationLevelPhantoms(t *testing.T) {
+	for _, level := range []IsolationLevel{ReadCommitted, RepeatableRead, Serializable} {
+		bp, hf, _ := makeSnapshotTestFile(t, 3)
+		bp.SetLockTimeout(100 * time.Millisecond)
+		td := *hf.Descriptor()
+
+		reader := beginIsolatedForTest(t, bp, level)
+		if vals := scanValuesForTest(t, hf, reader); !equalValues(vals, []int64{0, 1, 2}) {
+			t.Fatalf("%s: expected records 0, 1 and 2, got %v", level, vals)
+		}
+
+		// only Serializable keeps a writer from adding records to the file,
+		// whether on a page the reader read or on a new one
+		writer := BeginTransactionForTest(t, bp)
+		tup := Tuple{Desc: td, Fields: []DBValue{StringField{"sam"}, IntField{3}}}
+		err := hf.insertTuple(&tup, writer)
+		if level == Serializable {
+			if !isLockTimeout(err) {
+				t.Errorf("%s: expected the insert to wait for the reader, got %v", level, err)
+			}
+			bp.AbortTransaction(writer)
+		} else {
+			if err != nil {
+				t.Fatalf("%s: expected the insert not to wait, got %v", level, err)
+			}
+			if err := bp.CommitTransaction(writer); err != nil {
+				t.Fatalf(err.Error())
+			}
+		}
+
+		expected := []int64{0, 1, 2, 3}
+		if level == Serializable {
+			expected = []int64{0, 1, 2}
+		}
+		if vals := scanValuesForTest(t, hf, reader); !equalValues(vals, expected) {
+			t.Errorf("%s: expected records %v when scanning again, got %v", level, expected, vals)
+		}
+		bp.CommitTransaction(reader)
+	}
+}
+
+func TestIsolationLevelReadCommittedReleasesReadLocks(t *testing.T) {
+	bp, hf, _ := makeSnapshotTestFile(t, 3)
+	reader := beginIsolatedForTest(t, bp, ReadCommitted)
+	scanValuesForTest(t, hf, reader)
+	if _, err := bp.GetPage(hf, 0, reader, ReadPerm); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if n := bp.lockTable.numPages(); n != 1 {
+		t.Errorf("expected only the intention lock on the table to be held, got locks on %d tables, pages and records", n)
+	}
+	bp.CommitTransaction(reader)
+}
@@ -10,13 +10,17 @@ type EqualityJoin struct {
 	// The maximum number of records of intermediate state that the join should
 	// use (only required for optional exercise).
 	maxBufferSize int
+
+	// limits the memory used for the records of the left operator, if not
+	// nil
+	memory *MemoryManager
 }
 
 // Constructor for a join of integer expressions.
 //
 // Returns an error if either the left or right expression is not an integer.
 func NewJoin(left Operator, leftField Expr, right Operator, rightField Expr, maxBufferSize int) (*EqualityJoin, error) {
-	return &EqualityJoin{leftField, rightField, &left, &right, maxBufferSize}, nil
+	return &EqualityJoin{leftField, rightField, &left, &right, maxBufferSize, nil}, nil
 }
 
 // Return a TupleDesc for this join. The returned descriptor should contain the
@@ -27,15 +31,26 @@ func (hj *EqualityJoin) Descriptor() *TupleDesc {
 	return (*hj.left).Descriptor().merge((*hj.right).Descriptor())
 }
 
-func (joinOp *EqualityJoin) loadOuterBatch(n int, iter func() (*Tuple, error)) (map[DBValue]([]*Tuple), bool, error) {
+// Load a batch of at most n records of the left operator into a hash table,
+// reserving memory for them with mem. The batch also ends when the memory
+// budget is used up; the record that didn't fit is kept in *pending, and
+// starts the next batch. Returns a MemoryLimitError if not even one record
+// fits.
+func (joinOp *EqualityJoin) loadOuterBatch(n int, iter func() (*Tuple, error), mem *memoryReservation, pending **Tuple) (map[DBValue]([]*Tuple), bool, error) {
 	hashmap := make(map[DBValue]([]*Tuple))
+	loaded := 0
 	for {
 		if n == 0 {
 			return hashmap, false, nil
 		}
-		t, err := iter()
-		if err != nil {
-			return nil, false, err
+		t := *pending
+		*pending = nil
+		if t == nil {
+			var err error
+			t, err = iter()
+			if err != nil {
+				return nil, false, err
+			}
 		}
 		if t == nil { //finished iterating - 2nd bool indicates we have exhausted the iterator
 			return hashmap, true, nil
@@ -45,12 +60,67 @@ func (joinOp *EqualityJoin) loadOuterBatch(n int, iter func() (*Tuple, error)) (
 		if err != nil {
 			return nil, false, err
 		}
+		// NULL never compares equal to anything, so it can't join
+		if isNull(v) {
+			continue
+		}
 
-		hashmap[v] = append(hashmap[v], t)
+		if err := mem.grow(tupleMemorySize(t)); err != nil {
+			if loaded == 0 {
+				return nil, false, err
+			}
+			*pending = t
+			return hashmap, false, nil
+		}
+		key := hashJoinKey(v)
+		hashmap[key] = append(hashmap[key], t)
+		loaded++
 		n--
 	}
 }
 
+// Return the key of a value in the hash table of a join. Ints, floats and
+// decimals compare equal when they have the same numeric value (see
+// [IntField.EvalPred]), so they are hashed as floats; since distinct large
+// ints or decimals may convert to the same float, the records found under a
+// numeric key are compared with the value again before they are joined (see
+// [EqualityJoin.joinMatches]).
+func hashJoinKey(v DBValue) DBValue {
+	switch v := v.(type) {
+	case IntField:
+		return FloatField{float64(v.Value)}
+	case DecimalField:
+		return FloatField{v.toFloat()}
+	case FloatField:
+		if v.Value == 0 {
+			// -0 and 0 are equal
+			return FloatField{0}
+		}
+	}
+	return v
+}
+
+// Return the records of the left operator in the hash table that join with
+// the value v of the right operator.
+func (joinOp *EqualityJoin) joinMatches(hashmap map[DBValue][]*Tuple, v DBValue) ([]*Tuple, error) {
+	key := hashJoinKey(v)
+	candidates := hashmap[key]
+	if _, numeric := key.(FloatField); !numeric || len(candidates) == 0 {
+		return candidates, nil
+	}
+	var matches []*Tuple
+	for _, t := range candidates {
+		lv, err := joinOp.leftField.EvalExpr(t)
+		if err != nil {
+			return nil, err
+		}
+		if lv.EvalPred(v, OpEq) {
+			matches = append(matches, t)
+		}
+	}
+	return matches, nil
+}
+
 // Join operator implementation. This function should iterate over the results
 // of the join. The join should be the result of joining joinOp.left and
 // joinOp.right, applying the joinOp.leftField and joinOp.rightField expressions
@@ -68,6 +138,11 @@ func (joinOp *EqualityJoin) loadOuterBatch(n int, iter func() (*Tuple, error)) (
 // maxBufferSize records, and should pass the testBigJoin test without timing
 // out. To pass this test, you will need to use something other than a nested
 // loops join.
+//
+// The memory the records of the left operator use is also reserved from the
+// memory manager of the operator, if it has one. When the memory budget is
+// used up, the batch ends early, so that the right operator is scanned more
+// often instead; the memory is given back after each batch.
 func (joinOp *EqualityJoin) Iterator(tid TransactionID) (func() (*Tuple, error), error) {
 
 	//build map on the left
@@ -79,6 +154,8 @@ func (joinOp *EqualityJoin) Iterator(tid TransactionID) (func() (*Tuple, error),
 	}
 	var matches []*Tuple
 	var curT *Tuple
+	var pending *Tuple
+	mem := memoryReservation{m: joinOp.memory, tid: tid}
 	exhausted := false
 	curMatch := 0
 	needLoad := true
@@ -86,11 +163,14 @@ func (joinOp *EqualityJoin) Iterator(tid TransactionID) (func() (*Tuple, error),
 	return func() (*Tuple, error) {
 		for {
 			if needLoad && exhausted {
+				mem.free()
 				return nil, nil
 			}
 			if needLoad {
-				hashmap, exhausted, err = joinOp.loadOuterBatch(joinOp.maxBufferSize, build_it)
+				mem.free()
+				hashmap, exhausted, err = joinOp.loadOuterBatch(joinOp.maxBufferSize, build_it, &mem, &pending)
 				if err != nil {
+					mem.free()
 					return nil, err
 				}
 				rightIter, err = (*joinOp.right).Iterator(tid)
@@ -115,7 +195,11 @@ func (joinOp *EqualityJoin) Iterator(tid TransactionID) (func() (*Tuple, error),
 					if err != nil {
 						return nil, err
 					}
-					matches = hashmap[v]
+					if isNull(v) {
+						matches = nil
+					} else if matches, err = joinOp.joinMatches(hashmap, v); err != nil {
+						return nil, err
+					}
 					curMatch = 0
 				}
 				if matches != nil && curMatch < len(matches) {
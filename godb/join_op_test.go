@@ -65,6 +65,104 @@ func TestJoin(t *testing.T) {
 
 }
 
+func TestJoinNull(t *testing.T) {
+	td, t1, _, hf, bp, tid := makeTestVars(t)
+	tNull := Tuple{Desc: td, Fields: []DBValue{StringField{"nobody"}, NullField{}}}
+	insertTupleForTest(t, hf, &t1, tid)
+	insertTupleForTest(t, hf, &tNull, tid)
+
+	os.Remove(JoinTestFile)
+	hf2, _ := NewHeapFile(JoinTestFile, &td, bp)
+	insertTupleForTest(t, hf2, &t1, tid)
+	insertTupleForTest(t, hf2, &tNull, tid)
+
+	leftField := FieldExpr{td.Fields[1]}
+	join, err := NewJoin(hf, &leftField, hf2, &leftField, 100)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	iter, err := join.Iterator(tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	cnt := 0
+	for {
+		tup, err := iter()
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if tup == nil {
+			break
+		}
+		if !tup.equals(joinTuples(&t1, &t1)) {
+			t.Errorf("unexpected join result %v", tup)
+		}
+		cnt++
+	}
+	if cnt != 1 {
+		t.Errorf("unexpected number of join results (%d, expected 1); NULL keys should not join", cnt)
+	}
+}
+
+// Ints join with floats of the same value, like they compare equal in
+// filters, and distinct ints that convert to the same float don't join.
+func TestJoinMixedNumericTypes(t *testing.T) {
+	td, _, _, hf, bp, tid := makeTestVars(t)
+	for _, v := range []int64{25, 26, 1 << 53, 1<<53 + 1} {
+		insertTupleForTest(t, hf, &Tuple{Desc: td, Fields: []DBValue{StringField{"sam"}, IntField{v}}}, tid)
+	}
+
+	os.Remove(JoinTestFile)
+	td2 := TupleDesc{Fields: []FieldType{{Fname: "name", Ftype: StringType}, {Fname: "score", Ftype: FloatType}}}
+	hf2, err := NewHeapFile(JoinTestFile, &td2, bp)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	for _, v := range []float64{25, 25.5, -0} {
+		insertTupleForTest(t, hf2, &Tuple{Desc: td2, Fields: []DBValue{StringField{"sam"}, FloatField{v}}}, tid)
+	}
+	const intsFile = "JoinTestInts.dat"
+	os.Remove(intsFile)
+	defer os.Remove(intsFile)
+	hf3, err := NewHeapFile(intsFile, &td, bp)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	insertTupleForTest(t, hf3, &Tuple{Desc: td, Fields: []DBValue{StringField{"sam"}, IntField{1<<53 + 1}}}, tid)
+
+	countJoin := func(right DBFile, rightField Expr) int {
+		t.Helper()
+		join, err := NewJoin(hf, &FieldExpr{td.Fields[1]}, right, rightField, 100)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		iter, err := join.Iterator(tid)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		cnt := 0
+		for {
+			tup, err := iter()
+			if err != nil {
+				t.Fatalf(err.Error())
+			}
+			if tup == nil {
+				return cnt
+			}
+			if !tup.Fields[1].EvalPred(tup.Fields[3], OpEq) {
+				t.Errorf("unexpected join result %v", tup)
+			}
+			cnt++
+		}
+	}
+	if cnt := countJoin(hf2, &FieldExpr{td2.Fields[1]}); cnt != 1 {
+		t.Errorf("expected 1 result of the int = float join, got %d", cnt)
+	}
+	if cnt := countJoin(hf3, &FieldExpr{td.Fields[1]}); cnt != 1 {
+		t.Errorf("expected 1 result of the join of large ints, got %d", cnt)
+	}
+}
+
 const BigJoinFile1 string = "jointest1.dat"
 const BigJoinFile2 string = "jointest2.dat"
 
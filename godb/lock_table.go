@@ -1,6 +1,16 @@
 package godb
 
-// The result of a page lock request
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// The number of locks on pages and records of one table that a transaction
+// may hold before they are escalated to a lock on the whole table by default
+// (see [BufferPool.SetLockEscalation]).
+const DefaultLockEscalation = 1000
+
+// The result of a lock request
 type LockResponse int
 
 const (
@@ -9,63 +19,178 @@ const (
 	Abort LockResponse = iota
 )
 
-// PageLocks represents the locks held on a page.
+// PageLocks represents the locks held on a page, a record, or a table.
 //
-// A page can have multiple read locks, but at most one write lock.
+// A page can have multiple read locks, but at most one write lock. It can
+// also have intention locks, which transactions that lock records of the page
+// hold on the page (see [LockTable]).
 type PageLocks struct {
+	table tableKey // the table of the page or record, or the table itself
+
 	read  []TransactionID
 	write *TransactionID
+
+	// the transactions that lock records of the page for reading, and for
+	// writing
+	intentRead  []TransactionID
+	intentWrite []TransactionID
+
+	// the lock requests that are waiting for the page, in the order they
+	// are granted
+	waiters []*lockWaiter
+}
+
+// A lock request that is waiting in the queue of a page or record (see
+// [LockTable.requestLock]).
+type lockWaiter struct {
+	key     any // the page key of the page, or the recordKey of the record
+	tid     TransactionID
+	perm    RWPerm
+	granted chan struct{} // closed when the lock is granted
+	wounded chan struct{} // closed when tid is wounded (see [LockTable.wound])
 }
 
-// LockTable is a table that keeps track of the locks held on each page, the
-// pages that each transaction has locks on, and the wait-for graph.
+// The key of a record of a heap file in the lock table. Records are in the
+// partition of their page, so that locking a record and its page takes a
+// single partition latch.
+type recordKey struct {
+	page any // the page key of the page the record is on
+	rid  heapFileRid
+}
+
+// The key of a table, i.e., of a file, in the lock table. This is the page key
+// of the first page of the file, wrapped so that it is different from the key
+// of that page; tables are in the partition of their first page.
+type tableKey struct {
+	page any
+}
+
+// Return the key of the table of a file in the lock table.
+func fileTableKey(file DBFile) tableKey {
+	return tableKey{file.pageKey(0)}
+}
+
+// The key of the end of a file in the lock table, past its last page (see
+// [BufferPool.lockFileEnd]). Like the table, it is in the partition of the
+// first page of the file.
+type endKey struct {
+	page any
+}
+
+// LockTable is a table that keeps track of the locks held on each table, page
+// and record, the tables, pages and records that each transaction has locks
+// on, and the wait-for graph.
+//
+// Records are locked for reading or writing like pages. A transaction that
+// locks a record first takes an intention lock on its page, intentReadPerm
+// before reading and intentWritePerm before writing. Intention locks are
+// compatible with each other, so transactions can lock different records of a
+// page at the same time, but an intention write lock conflicts with a read
+// lock on the page, and a write lock on the page conflicts with both, so that
+// a transaction that locks a whole page, e.g., to scan it, doesn't see
+// uncommitted changes to its records. The wait-for graph has an edge for
+// every conflicting lock, whether it's on a page or a record, so deadlocks
+// are detected at either granularity.
+//
+// Tables are above pages in the same way: a transaction takes an intention
+// lock on a table before it locks pages of the table (see
+// [BufferPool.GetPage]). A transaction that holds a read lock on a table
+// reads its pages and records without locking them, and one that holds a
+// write lock changes them without locking records, so that a scan or a bulk
+// job needs a single lock (see [BufferPool.LockFile]). Pages are still locked
+// for writing, so that the buffer pool knows which pages to log when the
+// transaction commits. sharedIntentWritePerm (SIX) is a read lock and an
+// intention write lock on the table together, for a transaction that reads
+// the whole table and changes some of its pages.
+//
+// Once a transaction holds more than a threshold of locks on the pages and
+// records of one table, they are escalated: the transaction takes a lock on
+// the whole table, if it can without waiting, and releases the locks on the
+// pages and records that the table lock covers (see [LockTable.escalate]).
+//
+// When a transaction has to wait for a lock, the deadlock policy decides
+// whether it waits, or is aborted, and which other transactions are aborted
+// (see [DeadlockPolicy]). By default, the transaction is aborted if waiting
+// would close a cycle in the wait-for graph.
+//
+// The pages are split into partitions (see [pagePartition]), each with its own
+// latch, so that transactions locking different pages don't wait for each
+// other. The wait-for graph, which spans all of the pages, has a latch of its
+// own, which is taken after the latch of a partition, never before. The
+// counts of locks for escalation have a latch that is taken after both.
 type LockTable struct {
-	locks       map[any]*PageLocks      // the locks on a page
-	tidPageList map[TransactionID][]any // the pages that a transaction has locks on
-	waitGraph   WaitFor
+	partitions [numPartitions]lockTablePartition
+	waitGraph  WaitFor
+	graphLatch sync.Mutex // protects waitGraph, and the fields below it
+
+	// the deadlock policy, the queued request of each waiting transaction,
+	// and the transactions that the policy wounded, which are counted in
+	// numWounded so that requests needn't take graphLatch to check them
+	policy     DeadlockPolicy
+	waiting    map[TransactionID]*lockWaiter
+	wounded    map[TransactionID]bool
+	numWounded atomic.Int32
+
+	// the number of bytes of the log that a transaction's changes take, for
+	// VictimLeastLog, or nil if it's unknown
+	logWritten func(tid TransactionID) int64
+
+	// the number of locks each transaction holds on the pages and records of
+	// each table, and the number above which they are escalated, or 0 to not
+	// escalate them, protected by countLatch
+	fineLocks     map[TransactionID]map[tableKey]int
+	escalateAfter int
+	countLatch    sync.Mutex
+}
+
+// The locks on the pages of one partition of a [LockTable].
+type lockTablePartition struct {
+	locks       map[any]*PageLocks      // the locks on a page or record
+	tidPageList map[TransactionID][]any // the pages and records that a transaction has locks on
+	sync.Mutex
 }
 
 // Create a new LockTable.
 func NewLockTable() *LockTable {
-	return &LockTable{
-		make(map[any]*PageLocks),
-		make(map[TransactionID][]any),
-		WaitFor{},
+	t := &LockTable{
+		waitGraph:     WaitFor{},
+		policy:        NewDeadlockDetection(VictimRequester),
+		waiting:       make(map[TransactionID]*lockWaiter),
+		wounded:       make(map[TransactionID]bool),
+		fineLocks:     make(map[TransactionID]map[tableKey]int),
+		escalateAfter: DefaultLockEscalation,
 	}
+	for i := range t.partitions {
+		t.partitions[i].locks = make(map[any]*PageLocks)
+		t.partitions[i].tidPageList = make(map[TransactionID][]any)
+	}
+	return t
+}
+
+// Return the partition of the lock table that holds the locks on the page or
+// record with the specified key.
+func (t *LockTable) partition(hashCode any) *lockTablePartition {
+	return &t.partitions[pagePartition(hashCode)]
 }
 
 // Release all locks held by the transaction. This is called when a transaction
 // is aborted or committed.
 func (t *LockTable) ReleaseLocks(tid TransactionID) {
-	for _, pg := range t.tidPageList[tid] {
-		locks := t.locks[pg]
-		if locks == nil {
-			continue
-		}
-
-		for i, testTid := range locks.read {
-			if testTid == tid {
-				// remove tid from readLocks by moving the last tid into the
-				// newly free slot and shortening the slice by 1
-				locks.read[i] = locks.read[len(locks.read)-1]
-				locks.read = locks.read[:len(locks.read)-1]
-			}
-		}
-
-		// remove tid from the write locks for this page
-		if locks.write != nil && *locks.write == tid {
-			locks.write = nil
-		}
-
-		// if there are no more locks on the page, remove the page from the
-		// lock table
-		if len(locks.read) == 0 && locks.write == nil {
-			delete(t.locks, pg)
-		}
+	for i := range t.partitions {
+		t.partitions[i].releaseLocks(t, tid)
 	}
 
-	delete(t.tidPageList, tid)
+	t.countLatch.Lock()
+	delete(t.fineLocks, tid)
+	t.countLatch.Unlock()
 
+	t.graphLatch.Lock()
+	defer t.graphLatch.Unlock()
+	delete(t.waiting, tid)
+	if t.wounded[tid] {
+		delete(t.wounded, tid)
+		t.numWounded.Add(-1)
+	}
 	t.waitGraph.RemoveTransaction(tid)
 	for _, waits := range t.waitGraph {
 		for i, wait := range waits {
@@ -80,28 +205,279 @@ func (t *LockTable) ReleaseLocks(tid TransactionID) {
 	//</silentstrip lab4>
 }
 
+// Release the locks held by the transaction on the pages and records of the
+// partition.
+func (p *lockTablePartition) releaseLocks(t *LockTable, tid TransactionID) {
+	p.Lock()
+	defer p.Unlock()
+	for _, pg := range p.tidPageList[tid] {
+		locks := p.locks[pg]
+		if locks == nil {
+			continue
+		}
+
+		locks.remove(tid)
+
+		// hand the page to the transactions waiting for it, and if there are
+		// no more locks on the page, remove the page from the lock table
+		p.grantWaiters(t, pg)
+	}
+
+	delete(p.tidPageList, tid)
+}
+
 // Return the page key for each page that the transaction has taken a write lock on.
 //
 // These are the pages that need to be written to disk when the transaction
 // commits or dropped from the buffer pool when the transaction aborts.
 func (t *LockTable) WriteLockedPages(tid TransactionID) []any {
+	return t.lockedPages(tid, func(locks *PageLocks) bool {
+		return locks.write != nil && *locks.write == tid
+	})
+}
+
+// Return the page key for each page that the transaction has taken an
+// intention write lock on. These are the pages on which it may have changed
+// records that other transactions changed as well.
+func (t *LockTable) intentWriteLockedPages(tid TransactionID) []any {
+	return t.lockedPages(tid, func(locks *PageLocks) bool {
+		return contains(locks.intentWrite, tid)
+	})
+}
+
+// Return the page key for each page that the transaction has locks on, for
+// which match returns true. Locks on records, tables and the ends of files
+// are skipped.
+func (t *LockTable) lockedPages(tid TransactionID, match func(locks *PageLocks) bool) []any {
 	var pages []any
-	for _, pg := range t.tidPageList[tid] {
-		locks, ok := t.locks[pg]
-		if ok && locks.write != nil && *locks.write == tid {
-			pages = append(pages, pg)
+	for i := range t.partitions {
+		p := &t.partitions[i]
+		p.Lock()
+		for _, pg := range p.tidPageList[tid] {
+			switch pg.(type) {
+			case recordKey, tableKey, endKey:
+				continue
+			}
+			locks, ok := p.locks[pg]
+			if ok && match(locks) {
+				pages = append(pages, pg)
+			}
 		}
+		p.Unlock()
 	}
 	return pages
 }
 
-func (bp *LockTable) addTidPage(tid TransactionID, hashCode any) {
+// Return true if a transaction other than tid holds a lock on the page, so that
+// a lock with the given permissions requested by tid would not be granted
+// immediately.
+func (t *LockTable) lockedByOther(file DBFile, pageNo int, tid TransactionID, perm RWPerm) bool {
+	hashCode := file.pageKey(pageNo)
+	p := t.partition(hashCode)
+	p.Lock()
+	defer p.Unlock()
+	locks := p.locks[hashCode]
+	if locks == nil {
+		return false
+	}
+	return !locks.compatible(tid, perm)
+}
+
+// Add a page to the pages that tid has locks on. Returns false if it was there
+// already.
+func (bp *lockTablePartition) addTidPage(tid TransactionID, hashCode any) bool {
 	for _, hc := range bp.tidPageList[tid] {
 		if hc == hashCode {
-			return
+			return false
 		}
 	}
 	bp.tidPageList[tid] = append(bp.tidPageList[tid], hashCode)
+	return true
+}
+
+// Return the locks on the page with the specified key, in the specified table,
+// adding the page to the lock table if it has none.
+func (p *lockTablePartition) pageLocks(hashCode any, table tableKey) *PageLocks {
+	locks := p.locks[hashCode]
+	if locks == nil {
+		locks = &PageLocks{table: table}
+		p.locks[hashCode] = locks
+	}
+	return locks
+}
+
+// Return the number of tables, pages and records that have locks or waiters.
+func (t *LockTable) numPages() int {
+	n := 0
+	for i := range t.partitions {
+		t.partitions[i].Lock()
+		n += len(t.partitions[i].locks)
+		t.partitions[i].Unlock()
+	}
+	return n
+}
+
+// Returns true if tid is in tids.
+func contains(tids []TransactionID, tid TransactionID) bool {
+	for _, t := range tids {
+		if t == tid {
+			return true
+		}
+	}
+	return false
+}
+
+// Remove tid from tids, by moving the last tid into its slot and shortening
+// the slice by 1.
+func removeTid(tids []TransactionID, tid TransactionID) []TransactionID {
+	for i, t := range tids {
+		if t == tid {
+			tids[i] = tids[len(tids)-1]
+			return tids[:len(tids)-1]
+		}
+	}
+	return tids
+}
+
+// Returns true if two different transactions can't hold locks with
+// permissions a and b on the same page or record at the same time.
+func permsConflict(a RWPerm, b RWPerm) bool {
+	switch {
+	case a == sharedIntentWritePerm:
+		return permsConflict(ReadPerm, b) || permsConflict(intentWritePerm, b)
+	case b == sharedIntentWritePerm:
+		return permsConflict(b, a)
+	case a == WritePerm || b == WritePerm:
+		return true
+	case a == ReadPerm:
+		return b == intentWritePerm
+	case a == intentWritePerm:
+		return b == ReadPerm
+	}
+	return false
+}
+
+// Call f for each lock that is held on the page, with the transaction that
+// holds it and its permissions.
+func (locks *PageLocks) forEach(f func(tid TransactionID, perm RWPerm)) {
+	for _, tid := range locks.intentRead {
+		f(tid, intentReadPerm)
+	}
+	for _, tid := range locks.intentWrite {
+		f(tid, intentWritePerm)
+	}
+	for _, tid := range locks.read {
+		f(tid, ReadPerm)
+	}
+	if locks.write != nil {
+		f(*locks.write, WritePerm)
+	}
+}
+
+// Returns true if no lock is held on the page.
+func (locks *PageLocks) empty() bool {
+	return len(locks.read) == 0 && locks.write == nil && len(locks.intentRead) == 0 && len(locks.intentWrite) == 0
+}
+
+// Returns true if tid holds a lock on the page.
+func (locks *PageLocks) holds(tid TransactionID) bool {
+	held := false
+	locks.forEach(func(t TransactionID, perm RWPerm) {
+		held = held || t == tid
+	})
+	return held
+}
+
+// Returns true if the locks held by other transactions allow tid to take a
+// lock on the page with the given permissions.
+func (locks *PageLocks) compatible(tid TransactionID, perm RWPerm) bool {
+	return len(locks.blockers(tid, perm)) == 0
+}
+
+// Return the transactions whose locks on the page keep tid from taking a lock
+// with the given permissions.
+func (locks *PageLocks) blockers(tid TransactionID, perm RWPerm) []TransactionID {
+	var tids []TransactionID
+	locks.forEach(func(t TransactionID, held RWPerm) {
+		if t != tid && permsConflict(perm, held) {
+			tids = append(tids, t)
+		}
+	})
+	return tids
+}
+
+// Give tid a lock on the page with the given permissions, which must be
+// compatible with the locks already held. A sharedIntentWritePerm lock is held
+// as a read lock and an intention write lock.
+func (p *lockTablePartition) grant(t *LockTable, locks *PageLocks, hashCode any, tid TransactionID, perm RWPerm) {
+	switch perm {
+	case sharedIntentWritePerm:
+		p.grant(t, locks, hashCode, tid, ReadPerm)
+		p.grant(t, locks, hashCode, tid, intentWritePerm)
+		return
+	case ReadPerm:
+		if contains(locks.read, tid) {
+			return
+		}
+		locks.read = append(locks.read, tid)
+	case WritePerm:
+		if locks.write != nil && *locks.write == tid {
+			return
+		}
+		locks.write = &tid
+	case intentReadPerm:
+		if contains(locks.intentRead, tid) {
+			return
+		}
+		locks.intentRead = append(locks.intentRead, tid)
+	case intentWritePerm:
+		if contains(locks.intentWrite, tid) {
+			return
+		}
+		locks.intentWrite = append(locks.intentWrite, tid)
+	}
+	if p.addTidPage(tid, hashCode) {
+		if _, table := hashCode.(tableKey); !table {
+			t.countLocks(tid, locks.table, 1)
+		}
+	}
+}
+
+// Release the read lock and the intention read lock that tid holds on the
+// page or record with the specified key, if any, before it ends, e.g., because
+// it reads only committed data (see [ReadCommitted]). Its other locks on the
+// page or record are kept.
+func (t *LockTable) releaseReadLock(hashCode any, tid TransactionID) {
+	p := t.partition(hashCode)
+	p.Lock()
+	defer p.Unlock()
+	locks := p.locks[hashCode]
+	if locks == nil || !(contains(locks.read, tid) || contains(locks.intentRead, tid)) {
+		return
+	}
+	locks.read = removeTid(locks.read, tid)
+	locks.intentRead = removeTid(locks.intentRead, tid)
+	if !locks.holds(tid) {
+		held := p.tidPageList[tid][:0]
+		for _, key := range p.tidPageList[tid] {
+			if key != hashCode {
+				held = append(held, key)
+			}
+		}
+		p.tidPageList[tid] = held
+		t.countLocks(tid, locks.table, -1)
+	}
+	p.grantWaiters(t, hashCode)
+}
+
+// Remove the locks tid holds on the page.
+func (locks *PageLocks) remove(tid TransactionID) {
+	locks.read = removeTid(locks.read, tid)
+	locks.intentRead = removeTid(locks.intentRead, tid)
+	locks.intentWrite = removeTid(locks.intentWrite, tid)
+	if locks.write != nil && *locks.write == tid {
+		locks.write = nil
+	}
 }
 
 // Try to lock a page with the given permissions. If the lock is granted, return
@@ -112,74 +488,432 @@ func (bp *LockTable) addTidPage(tid TransactionID, hashCode any) {
 // either Wait or Abort. Upon receiving Wait, the caller should wait and then
 // try again. Upon receiving Abort, the caller should abort the transaction by
 // calling AbortTransaction.
+//
+// The caller should hold an intention lock on the table of the page (see
+// [LockTable.TryLockFile]). Nothing is locked for reading if tid holds a lock
+// on the table that covers it (see [LockTable.coveredByTable]).
 func (t *LockTable) TryLock(file DBFile, pageNo int, tid TransactionID, perm RWPerm) LockResponse {
-	hashCode := file.pageKey(pageNo)
+	return t.tryFineLock(fileTableKey(file), file.pageKey(pageNo), tid, perm)
+}
 
-	locks := t.locks[hashCode]
-	if locks == nil {
-		locks = &PageLocks{}
-		t.locks[hashCode] = locks
+// Try to lock a record of a heap file with the given permissions, like
+// [LockTable.TryLock]. The caller should hold an intention lock on the page
+// of the record.
+func (t *LockTable) TryLockRecord(file DBFile, rid heapFileRid, tid TransactionID, perm RWPerm) LockResponse {
+	return t.tryFineLock(fileTableKey(file), recordKey{file.pageKey(rid.pageNo), rid}, tid, perm)
+}
+
+// Try to lock the table of a file with the given permissions, like
+// [LockTable.TryLock]. intentReadPerm and intentWritePerm take the intention
+// locks needed to lock pages of the table; ReadPerm, WritePerm and
+// sharedIntentWritePerm lock the whole table.
+func (t *LockTable) TryLockFile(file DBFile, tid TransactionID, perm RWPerm) LockResponse {
+	table := fileTableKey(file)
+	return t.tryLock(table, table, tid, perm)
+}
+
+// Try to lock the page or record with the specified key in a table, unless a
+// lock on the table covers it, and escalate the locks on the table if tid
+// holds too many.
+func (t *LockTable) tryFineLock(table tableKey, hashCode any, tid TransactionID, perm RWPerm) LockResponse {
+	if t.coveredByTable(table, hashCode, tid, perm) {
+		return Grant
 	}
+	resp := t.tryLock(table, hashCode, tid, perm)
+	if resp == Grant {
+		t.escalate(tid, table)
+	}
+	return resp
+}
+
+// Try to lock the table, page or record with the specified key (see
+// [LockTable.TryLock]).
+func (t *LockTable) tryLock(table tableKey, hashCode any, tid TransactionID, perm RWPerm) LockResponse {
+	p := t.partition(hashCode)
+	p.Lock()
+	defer p.Unlock()
+	locks := p.pageLocks(hashCode, table)
+
+	t.graphLatch.Lock()
+	defer t.graphLatch.Unlock()
 
 	// we will reset our waiting status depending on whether we get this lock
 	delete(t.waitGraph, tid)
 
-	switch perm {
-	case ReadPerm:
-		// if the page has no writers (or we are the writer), take a read lock
-		if locks.write == nil || *locks.write == tid {
-			//add read locks
-			found := false
-			for _, checkTid := range locks.read {
-				if checkTid == tid {
-					found = true
-				}
-			}
-			if !found {
-				locks.read = append(locks.read, tid)
-				t.addTidPage(tid, hashCode)
-			}
-			return Grant
-		}
+	if t.wounded[tid] {
+		return Abort
+	}
+	if locks.compatible(tid, perm) {
+		p.grant(t, locks, hashCode, tid, perm)
+		return Grant
+	}
 
-		// if we can't take the read lock, we are waiting for the writer
-		t.waitGraph.AddEdges(tid, []TransactionID{*locks.write})
+	// if we can't take the lock, we are waiting for the transactions that
+	// hold conflicting locks
+	blockers := locks.blockers(tid, perm)
+	t.waitGraph.AddEdges(tid, blockers)
 
-	case WritePerm:
-		// we can write when noone holds a read lock, or we are the exclusive reader
-		readOk := len(locks.read) == 0 || (len(locks.read) == 1 && locks.read[0] == tid)
+	// if locking fails, let the deadlock policy decide whether we may wait
+	if t.resolveWait(tid, blockers) {
+		return Abort
+	}
+
+	return Wait
+}
+
+// Request a lock on a page with the given permissions, like
+// [LockTable.TryLock], but queue the request if it can't be granted right
+// away. Queued requests are granted in FIFO order as locks are released, and
+// a new request is queued even if it could be granted while other
+// transactions are waiting for the page, so that waiting transactions are not
+// starved. A transaction that already holds a lock on the page, e.g., one
+// upgrading a read lock to a write lock, goes to the front of the queue.
+//
+// Returns Grant, Abort if waiting would deadlock, or Wait and the queued
+// request, whose granted channel is closed when the lock is granted.
+func (t *LockTable) requestLock(file DBFile, pageNo int, tid TransactionID, perm RWPerm) (LockResponse, *lockWaiter) {
+	return t.requestFineLock(fileTableKey(file), file.pageKey(pageNo), tid, perm)
+}
+
+// Request a lock on a record of a heap file with the given permissions, like
+// [LockTable.requestLock]. The caller should hold an intention lock on the
+// page of the record.
+func (t *LockTable) requestRecordLock(file DBFile, rid heapFileRid, tid TransactionID, perm RWPerm) (LockResponse, *lockWaiter) {
+	return t.requestFineLock(fileTableKey(file), recordKey{file.pageKey(rid.pageNo), rid}, tid, perm)
+}
+
+// Request a lock on the end of a file with the given permissions, like
+// [LockTable.requestLock] (see [BufferPool.lockFileEnd]).
+func (t *LockTable) requestFileEndLock(file DBFile, tid TransactionID, perm RWPerm) (LockResponse, *lockWaiter) {
+	return t.requestFineLock(fileTableKey(file), endKey{file.pageKey(0)}, tid, perm)
+}
+
+// Request a lock on the table of a file with the given permissions, like
+// [LockTable.requestLock] (see [LockTable.TryLockFile]).
+func (t *LockTable) requestFileLock(file DBFile, tid TransactionID, perm RWPerm) (LockResponse, *lockWaiter) {
+	table := fileTableKey(file)
+	return t.request(table, table, tid, perm)
+}
+
+// Lock a record of a heap file for tid with the given permissions, if that
+// can be done without waiting: no other transaction holds or waits for a lock
+// on it that conflicts. Returns true if the lock was granted.
+func (t *LockTable) lockRecordIfFree(file DBFile, rid heapFileRid, tid TransactionID, perm RWPerm) bool {
+	table := fileTableKey(file)
+	hashCode := recordKey{file.pageKey(rid.pageNo), rid}
+	if t.coveredByTable(table, hashCode, tid, perm) {
+		return true
+	}
+	p := t.partition(hashCode)
+	p.Lock()
+	locks := p.pageLocks(hashCode, table)
+	granted := len(locks.waiters) == 0 && locks.compatible(tid, perm)
+	if granted {
+		p.grant(t, locks, hashCode, tid, perm)
+	}
+	p.Unlock()
+	if granted {
+		t.escalate(tid, table)
+	}
+	return granted
+}
+
+// Request a lock on the page or record with the specified key in a table,
+// unless a lock on the table covers it, and escalate the locks on the table
+// if tid holds too many.
+func (t *LockTable) requestFineLock(table tableKey, hashCode any, tid TransactionID, perm RWPerm) (LockResponse, *lockWaiter) {
+	if t.coveredByTable(table, hashCode, tid, perm) {
+		return Grant, nil
+	}
+	resp, w := t.request(table, hashCode, tid, perm)
+	if resp == Grant {
+		t.escalate(tid, table)
+	}
+	return resp, w
+}
+
+// Request a lock on the table, page or record with the specified key (see
+// [LockTable.requestLock]).
+func (t *LockTable) request(table tableKey, hashCode any, tid TransactionID, perm RWPerm) (LockResponse, *lockWaiter) {
+	p := t.partition(hashCode)
+	p.Lock()
+	defer p.Unlock()
+	locks := p.pageLocks(hashCode, table)
 
-		// we can writen when there are no writers or we are the writer
-		writeOk := locks.write == nil || *locks.write == tid
+	if t.isWounded(tid) {
+		return Abort, nil
+	}
 
-		if readOk && writeOk {
-			// if we don't hold the write lock, take it and update our page list
-			if locks.write == nil || *locks.write != tid {
-				locks.write = &tid
-				t.addTidPage(tid, hashCode)
+	// a transaction that isn't waiting has no edges in the wait-for graph, so
+	// the graph isn't needed to grant a lock right away
+	holder := locks.holds(tid)
+	if (len(locks.waiters) == 0 || holder) && locks.compatible(tid, perm) {
+		p.grant(t, locks, hashCode, tid, perm)
+		return Grant, nil
+	}
+
+	w := &lockWaiter{hashCode, tid, perm, make(chan struct{}), make(chan struct{})}
+	waitsFor := locks.blockers(tid, perm)
+	if holder {
+		locks.waiters = append([]*lockWaiter{w}, locks.waiters...)
+	} else {
+		// we are also waiting for the conflicting requests ahead of us
+		for _, ahead := range locks.waiters {
+			if ahead.tid != tid && permsConflict(perm, ahead.perm) {
+				waitsFor = append(waitsFor, ahead.tid)
 			}
-			return Grant
 		}
+		locks.waiters = append(locks.waiters, w)
+	}
+
+	t.graphLatch.Lock()
+	delete(t.waitGraph, tid)
+	t.waitGraph.AddEdges(tid, waitsFor)
+	t.waiting[tid] = w
+	abort := t.resolveWait(tid, waitsFor)
+	t.graphLatch.Unlock()
+
+	if abort {
+		p.cancelWait(t, w)
+		return Abort, nil
+	}
+	return Wait, w
+}
+
+// Grant the queued requests for the page with the specified key, in order,
+// until one conflicts with the locks that are held. Removes the page from the
+// lock table if it has no locks or waiters left.
+//
+// Caller must hold the latch of the partition.
+func (p *lockTablePartition) grantWaiters(t *LockTable, hashCode any) {
+	locks := p.locks[hashCode]
+	if locks == nil {
+		return
+	}
+	for len(locks.waiters) > 0 {
+		w := locks.waiters[0]
+		if !locks.compatible(w.tid, w.perm) {
+			break
+		}
+		locks.waiters = locks.waiters[1:]
+		p.grant(t, locks, hashCode, w.tid, w.perm)
+		t.graphLatch.Lock()
+		delete(t.waitGraph, w.tid)
+		delete(t.waiting, w.tid)
+		t.graphLatch.Unlock()
+		close(w.granted)
+	}
+	if locks.empty() && len(locks.waiters) == 0 {
+		delete(p.locks, hashCode)
+	}
+}
 
-		// if we can't take the write lock, we are waiting for the
-		// readers and writer
-		if locks.write != nil {
-			t.waitGraph.AddEdges(tid, []TransactionID{*locks.write})
+// Remove a request from the queue of its page, e.g., because it timed out.
+// Returns false if the lock was granted before the request was removed.
+func (t *LockTable) cancelWait(w *lockWaiter) bool {
+	p := t.partition(w.key)
+	p.Lock()
+	defer p.Unlock()
+	return p.cancelWait(t, w)
+}
+
+// Remove a request from the queue of its page, like [LockTable.cancelWait].
+//
+// Caller must hold the latch of the partition.
+func (p *lockTablePartition) cancelWait(t *LockTable, w *lockWaiter) bool {
+	locks := p.locks[w.key]
+	if locks == nil {
+		return false
+	}
+	for i, queued := range locks.waiters {
+		if queued == w {
+			locks.waiters = append(locks.waiters[:i], locks.waiters[i+1:]...)
+			t.graphLatch.Lock()
+			delete(t.waitGraph, w.tid)
+			delete(t.waiting, w.tid)
+			t.graphLatch.Unlock()
+			// the requests behind this one may be compatible with the locks
+			// that are held
+			p.grantWaiters(t, w.key)
+			return true
 		}
+	}
+	return false
+}
+
+// Returns true if a lock that tid holds on a table covers a lock with the
+// given permissions on the page or record with the specified key, so that the
+// page or record needn't be locked. A read lock on the table covers reads,
+// and a write lock covers everything, except that pages are still locked for
+// writing (see [LockTable]).
+func (t *LockTable) coveredByTable(table tableKey, hashCode any, tid TransactionID, perm RWPerm) bool {
+	p := t.partition(table)
+	p.Lock()
+	defer p.Unlock()
+	locks := p.locks[table]
+	if locks == nil {
+		return false
+	}
+	read := perm == ReadPerm || perm == intentReadPerm
+	if locks.write != nil && *locks.write == tid {
+		_, record := hashCode.(recordKey)
+		return read || record
+	}
+	return read && contains(locks.read, tid)
+}
+
+// Add n to the number of locks tid holds on the pages and records of a table.
+func (t *LockTable) countLocks(tid TransactionID, table tableKey, n int) {
+	t.countLatch.Lock()
+	defer t.countLatch.Unlock()
+	if t.fineLocks[tid] == nil {
+		t.fineLocks[tid] = make(map[tableKey]int)
+	}
+	t.fineLocks[tid][table] += n
+}
+
+// Set the number of locks on the pages and records of one table that a
+// transaction may hold before they are escalated, or 0 to not escalate them.
+func (t *LockTable) setEscalation(n int) {
+	t.countLatch.Lock()
+	defer t.countLatch.Unlock()
+	t.escalateAfter = max(n, 0)
+}
 
-		var readWaits []TransactionID
-		for _, t := range locks.read {
-			if t != tid {
-				readWaits = append(readWaits, t)
+// Escalate the locks tid holds on the pages and records of a table to a lock
+// on the table, if it holds more of them than the escalation threshold. tid
+// takes a write lock on the table if it holds an intention write lock on it,
+// and a read lock otherwise. Nothing happens if the table lock can't be taken
+// without waiting; escalation is tried again when tid takes its next lock.
+func (t *LockTable) escalate(tid TransactionID, table tableKey) {
+	t.countLatch.Lock()
+	n, limit := t.fineLocks[tid][table], t.escalateAfter
+	t.countLatch.Unlock()
+	if limit == 0 || n <= limit {
+		return
+	}
+
+	p := t.partition(table)
+	p.Lock()
+	locks := p.pageLocks(table, table)
+	writer := locks.write != nil && *locks.write == tid
+	perm := ReadPerm
+	if contains(locks.intentWrite, tid) || writer {
+		perm = WritePerm
+	}
+	if writer || (perm == ReadPerm && contains(locks.read, tid)) {
+		// the table is locked already; only page write locks are left
+		p.Unlock()
+		return
+	}
+	granted := len(locks.waiters) == 0 && locks.compatible(tid, perm)
+	if granted {
+		p.grant(t, locks, table, tid, perm)
+	} else if locks.empty() && len(locks.waiters) == 0 {
+		delete(p.locks, table)
+	}
+	p.Unlock()
+	if granted {
+		t.releaseCovered(tid, table, perm)
+	}
+}
+
+// Release the locks tid holds on the pages and records of a table that a lock
+// on the table with the given permissions covers (see
+// [LockTable.coveredByTable]).
+func (t *LockTable) releaseCovered(tid TransactionID, table tableKey, perm RWPerm) {
+	released := 0
+	for i := range t.partitions {
+		p := &t.partitions[i]
+		p.Lock()
+		held := p.tidPageList[tid][:0]
+		for _, key := range p.tidPageList[tid] {
+			locks := p.locks[key]
+			if _, isTable := key.(tableKey); isTable || locks == nil || locks.table != table {
+				held = append(held, key)
+				continue
+			}
+			locks.read = removeTid(locks.read, tid)
+			locks.intentRead = removeTid(locks.intentRead, tid)
+			if _, record := key.(recordKey); record && perm == WritePerm {
+				locks.remove(tid)
 			}
+			if locks.holds(tid) {
+				held = append(held, key)
+			} else {
+				released++
+			}
+			p.grantWaiters(t, key)
 		}
-		t.waitGraph.AddEdges(tid, readWaits)
+		p.tidPageList[tid] = held
+		p.Unlock()
 	}
+	t.countLocks(tid, table, -released)
+}
 
-	// if locking fails, check for deadlock
-	if t.waitGraph.DetectDeadlock(tid) {
-		return Abort
+// Set the deadlock policy (see [DeadlockPolicy]).
+func (t *LockTable) setDeadlockPolicy(policy DeadlockPolicy) {
+	t.graphLatch.Lock()
+	defer t.graphLatch.Unlock()
+	t.policy = policy
+}
+
+// Let the deadlock policy decide whether tid, whose edges to the transactions
+// in waitsFor are in the wait-for graph, may wait for them, and wound the
+// other transactions it aborts. Returns true if tid must abort instead.
+//
+// Caller must hold graphLatch.
+func (t *LockTable) resolveWait(tid TransactionID, waitsFor []TransactionID) bool {
+	if t.wounded[tid] {
+		// wounded since its request was made
+		return true
+	}
+	abort := false
+	for _, victim := range t.policy.resolve(t, tid, waitsFor) {
+		if victim == tid {
+			abort = true
+		} else {
+			t.wound(victim)
+		}
 	}
+	return abort
+}
 
-	return Wait
+// Mark tid to be aborted to break or prevent a deadlock. It is told to abort
+// by the response to its next lock request, or by the wounded channel of the
+// request it is waiting on, so that it rolls back its own changes; it is
+// aborted only once it learns of it, and commits if it doesn't request
+// another lock.
+//
+// Caller must hold graphLatch.
+func (t *LockTable) wound(tid TransactionID) {
+	if t.wounded[tid] {
+		return
+	}
+	t.wounded[tid] = true
+	t.numWounded.Add(1)
+	if w := t.waiting[tid]; w != nil {
+		close(w.wounded)
+	}
+}
+
+// Returns true if tid was wounded (see [LockTable.wound]).
+func (t *LockTable) isWounded(tid TransactionID) bool {
+	if t.numWounded.Load() == 0 {
+		return false
+	}
+	t.graphLatch.Lock()
+	defer t.graphLatch.Unlock()
+	return t.wounded[tid]
+}
+
+// Return the number of locks tid holds on pages and records.
+func (t *LockTable) locksHeld(tid TransactionID) int {
+	t.countLatch.Lock()
+	defer t.countLatch.Unlock()
+	n := 0
+	for _, count := range t.fineLocks[tid] {
+		n += count
+	}
+	return n
 }
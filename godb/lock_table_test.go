@@ -96,3 +96,206 @@ func TestLockTableDeadlock(t *testing.T) {
 		t.Errorf("Expected to abort")
 	}
 }
+
+func TestLockTableQueue(t *testing.T) {
+	lt := NewLockTable()
+	tid1, tid2, tid3, tid4 := NewTID(), NewTID(), NewTID(), NewTID()
+	f1 := &MemFile{0, nil, nil}
+	if resp, _ := lt.requestLock(f1, 0, tid1, ReadPerm); resp != Grant {
+		t.Errorf("Expected lock to be granted")
+	}
+	resp, w2 := lt.requestLock(f1, 0, tid2, WritePerm)
+	if resp != Wait {
+		t.Fatalf("Expected to wait")
+	}
+	// a reader that arrives after a waiting writer queues behind it
+	resp, w3 := lt.requestLock(f1, 0, tid3, ReadPerm)
+	if resp != Wait {
+		t.Fatalf("Expected to wait behind the writer")
+	}
+	resp, w4 := lt.requestLock(f1, 0, tid4, ReadPerm)
+	if resp != Wait {
+		t.Fatalf("Expected to wait behind the writer")
+	}
+
+	lt.ReleaseLocks(tid1)
+	select {
+	case <-w2.granted:
+	default:
+		t.Fatalf("Expected the writer to be granted the lock first")
+	}
+	select {
+	case <-w3.granted:
+		t.Fatalf("Expected the reader to wait for the writer")
+	default:
+	}
+
+	// both readers are granted once the writer is done
+	lt.ReleaseLocks(tid2)
+	for _, w := range []*lockWaiter{w3, w4} {
+		select {
+		case <-w.granted:
+		default:
+			t.Errorf("Expected the readers to be granted the lock")
+		}
+	}
+
+	// a request that gives up leaves the queue
+	resp, w1 := lt.requestLock(f1, 0, tid1, WritePerm)
+	if resp != Wait {
+		t.Fatalf("Expected to wait")
+	}
+	if !lt.cancelWait(w1) {
+		t.Errorf("Expected the request to still be queued")
+	}
+	lt.ReleaseLocks(tid3)
+	lt.ReleaseLocks(tid4)
+	if n := lt.numPages(); n != 0 {
+		t.Errorf("Expected no locks or waiters to remain, got %d pages", n)
+	}
+}
+
+func TestLockTableIntentionLocks(t *testing.T) {
+	lt := NewLockTable()
+	tid1, tid2, tid3 := NewTID(), NewTID(), NewTID()
+	f1 := &MemFile{0, nil, nil}
+	if lt.TryLock(f1, 0, tid1, intentWritePerm) != Grant {
+		t.Errorf("Expected lock to be granted")
+	}
+	if lt.TryLock(f1, 0, tid2, intentWritePerm) != Grant {
+		t.Errorf("Expected two writers of records on the page to be granted the lock")
+	}
+	if lt.TryLock(f1, 0, tid3, intentReadPerm) != Grant {
+		t.Errorf("Expected a reader of a record on the page to be granted the lock")
+	}
+	// a scan of the whole page waits for the writers of its records
+	if lt.TryLock(f1, 0, tid3, ReadPerm) != Wait {
+		t.Errorf("Expected to wait")
+	}
+	lt.ReleaseLocks(tid1)
+	lt.ReleaseLocks(tid2)
+	if lt.TryLock(f1, 0, tid3, ReadPerm) != Grant {
+		t.Errorf("Expected lock to be granted")
+	}
+	if lt.TryLock(f1, 0, tid1, intentWritePerm) != Wait {
+		t.Errorf("Expected a writer of a record to wait for the scan")
+	}
+}
+
+func TestLockTableRecordLocks(t *testing.T) {
+	lt := NewLockTable()
+	tid1, tid2 := NewTID(), NewTID()
+	f1 := &MemFile{0, nil, nil}
+	r1, r2 := heapFileRid{0, 1}, heapFileRid{0, 2}
+	if lt.TryLockRecord(f1, r1, tid1, WritePerm) != Grant {
+		t.Errorf("Expected lock to be granted")
+	}
+	if lt.TryLockRecord(f1, r2, tid2, WritePerm) != Grant {
+		t.Errorf("Expected a lock on another record of the page to be granted")
+	}
+	if lt.TryLockRecord(f1, r1, tid2, ReadPerm) != Wait {
+		t.Errorf("Expected to wait")
+	}
+	if lt.TryLockRecord(f1, r2, tid1, ReadPerm) != Abort {
+		t.Errorf("Expected to abort")
+	}
+	lt.ReleaseLocks(tid1)
+	if lt.TryLockRecord(f1, r1, tid2, ReadPerm) != Grant {
+		t.Errorf("Expected lock to be granted")
+	}
+	lt.ReleaseLocks(tid2)
+	if n := lt.numPages(); n != 0 {
+		t.Errorf("Expected no locks or waiters to remain, got %d pages", n)
+	}
+}
+
+func TestLockTableFileLocks(t *testing.T) {
+	lt := NewLockTable()
+	tid1, tid2, tid3 := NewTID(), NewTID(), NewTID()
+	f1 := &MemFile{0, nil, nil}
+	if lt.TryLockFile(f1, tid1, intentReadPerm) != Grant {
+		t.Errorf("Expected lock to be granted")
+	}
+	if lt.TryLockFile(f1, tid2, intentWritePerm) != Grant {
+		t.Errorf("Expected lock to be granted")
+	}
+	if lt.TryLockFile(f1, tid3, ReadPerm) != Wait {
+		t.Errorf("Expected a reader of the table to wait for a writer of its pages")
+	}
+	lt.ReleaseLocks(tid2)
+	if lt.TryLockFile(f1, tid3, ReadPerm) != Grant {
+		t.Errorf("Expected lock to be granted")
+	}
+	// the table lock covers the pages of the table
+	if lt.TryLock(f1, 0, tid3, ReadPerm) != Grant {
+		t.Errorf("Expected lock to be granted")
+	}
+	if n := lt.numPages(); n != 1 {
+		t.Errorf("Expected only the table to be locked, got %d locks", n)
+	}
+
+	// a reader of the table that changes some of its pages conflicts with
+	// every lock but an intention read lock
+	if lt.TryLockFile(f1, tid1, sharedIntentWritePerm) != Wait {
+		t.Errorf("Expected to wait")
+	}
+	lt.ReleaseLocks(tid3)
+	if lt.TryLockFile(f1, tid1, sharedIntentWritePerm) != Grant {
+		t.Errorf("Expected lock to be granted")
+	}
+	if lt.TryLockFile(f1, tid2, intentReadPerm) != Grant {
+		t.Errorf("Expected lock to be granted")
+	}
+	if lt.TryLockFile(f1, tid2, intentWritePerm) != Wait {
+		t.Errorf("Expected to wait")
+	}
+}
+
+func TestLockTableEscalation(t *testing.T) {
+	lt := NewLockTable()
+	lt.setEscalation(3)
+	tid1, tid2 := NewTID(), NewTID()
+	f1 := &MemFile{0, nil, nil}
+	f2 := &MemFile{1, nil, nil}
+
+	// a reader of many pages gets a read lock on the table
+	if lt.TryLockFile(f1, tid1, intentReadPerm) != Grant {
+		t.Errorf("Expected lock to be granted")
+	}
+	for p := 0; p < 4; p++ {
+		if lt.TryLock(f1, p, tid1, ReadPerm) != Grant {
+			t.Errorf("Expected lock to be granted")
+		}
+	}
+	if n := lt.numPages(); n != 1 {
+		t.Errorf("Expected the page locks to be escalated to a table lock, got %d locks", n)
+	}
+	if lt.TryLockFile(f1, tid2, intentWritePerm) != Wait {
+		t.Errorf("Expected a writer to wait for the escalated lock")
+	}
+
+	// a writer of many records gets a write lock on the table
+	if lt.TryLockFile(f2, tid2, intentWritePerm) != Grant {
+		t.Errorf("Expected lock to be granted")
+	}
+	if lt.TryLock(f2, 0, tid2, intentWritePerm) != Grant {
+		t.Errorf("Expected lock to be granted")
+	}
+	for slot := 0; slot < 3; slot++ {
+		if lt.TryLockRecord(f2, heapFileRid{0, slot}, tid2, WritePerm) != Grant {
+			t.Errorf("Expected lock to be granted")
+		}
+	}
+	if lt.TryLockFile(f2, tid1, intentReadPerm) != Wait {
+		t.Errorf("Expected a reader to wait for the escalated lock")
+	}
+	// the page stays locked, so that it is written when tid2 commits
+	if pages := lt.intentWriteLockedPages(tid2); len(pages) != 1 {
+		t.Errorf("Expected the page to stay locked, got %v", pages)
+	}
+	lt.ReleaseLocks(tid1)
+	lt.ReleaseLocks(tid2)
+	if n := lt.numPages(); n != 0 {
+		t.Errorf("Expected no locks or waiters to remain, got %d", n)
+	}
+}
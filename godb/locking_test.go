@@ -153,3 +153,40 @@ func TestLockingAcquireWriteAndReadLocks(t *testing.T) {
 		tid1, hf, 0, ReadPerm,
 		true)
 }
+
+func TestLockingWaitAndTimeout(t *testing.T) {
+	bp, hf, tid1, tid2 := lockingTestSetUp(t)
+	if _, err := bp.GetPage(hf, 0, tid1, WritePerm); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	// a blocked request is woken when the lock is released
+	lg := startGrabber(bp, tid2, hf, 0, ReadPerm)
+	time.Sleep(100 * time.Millisecond)
+	if lg.acquired() {
+		t.Fatalf("Expected the reader to wait for the writer")
+	}
+	if err := bp.CommitTransaction(tid1); err != nil {
+		t.Fatalf(err.Error())
+	}
+	time.Sleep(100 * time.Millisecond)
+	if !lg.acquired() {
+		t.Fatalf("Expected the reader to be woken when the writer committed")
+	}
+
+	// a request gives up after the lock timeout, without aborting
+	bp.SetLockTimeout(50 * time.Millisecond)
+	tid3 := BeginTransactionForTest(t, bp)
+	_, err := bp.GetPage(hf, 0, tid3, WritePerm)
+	if gdbErr, ok := err.(GoDBError); !ok || gdbErr.code != LockTimeoutError {
+		t.Fatalf("Expected a LockTimeoutError, got %v", err)
+	}
+	if !bp.IsRunning(tid3) {
+		t.Errorf("Expected the transaction to keep running after a lock timeout")
+	}
+	bp.CommitTransaction(tid2)
+	if _, err := bp.GetPage(hf, 0, tid3, WritePerm); err != nil {
+		t.Errorf("Expected the lock to be granted after the reader committed, got %v", err)
+	}
+	bp.CommitTransaction(tid3)
+}
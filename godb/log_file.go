@@ -7,6 +7,7 @@ import (
 	"io"
 	"log"
 	"os"
+	"sync"
 )
 
 /*
@@ -32,12 +33,17 @@ variable-length, and have the following high-level structure:
 +--------------------------------------------------------+
 
 Records start with a type, which will be one of the following: AbortRecord,
-CommitRecord, UpdateRecord, BeginRecord. The type is followed by the ID of
-the transaction that created the record.
+CommitRecord, UpdateRecord, BeginRecord, CheckpointRecord, SavepointRecord,
+RollbackToSavepointRecord, ReleaseSavepointRecord. The type is followed by the
+ID of the transaction that created the record, which is 0 for checkpoints.
 
 The contents of the body depends on the type. Abort, Commit, and Begin
-records are empty. Update records consist of the before and after pages. A
-page has the following format:
+records are empty. Checkpoint records consist of the number of transactions
+that were running when the checkpoint was taken (4 bytes), followed by their
+IDs (4 bytes each). Savepoint, RollbackToSavepoint, and ReleaseSavepoint
+records consist of the length of the name of the savepoint (4 bytes),
+followed by the name. Update records consist of the before and after pages. A
+page, which may belong to a heap file or an index, has the following format:
 
 +--------------------------------------------------------+
 | File num (4 bytes)                                     |
@@ -49,7 +55,9 @@ page has the following format:
 +--------------------------------------------------------+
 
 The file number of a page is an internal identifier for the page's file that
-is tracked by the catalog.
+is tracked by the catalog (see [Catalog.fileId]). The page contents include
+the checksum of the page, which is verified when the page is read back from
+the log.
 */
 
 type LogFile struct {
@@ -58,6 +66,11 @@ type LogFile struct {
 	offset     int64
 	bufferPool *BufferPool
 	catalog    *Catalog
+
+	// the number of bytes of update records each running transaction has
+	// logged, which the lock table reads without holding the logLatch
+	updated      map[TransactionID]int64
+	updatedLatch sync.Mutex
 }
 
 type LogRecordType int8
@@ -67,6 +80,14 @@ const (
 	CommitRecord LogRecordType = iota
 	UpdateRecord LogRecordType = iota
 	BeginRecord  LogRecordType = iota
+
+	CheckpointRecord LogRecordType = iota
+
+	// SAVEPOINT, ROLLBACK TO SAVEPOINT, and RELEASE SAVEPOINT (see
+	// [BufferPool.Savepoint])
+	SavepointRecord           LogRecordType = iota
+	RollbackToSavepointRecord LogRecordType = iota
+	ReleaseSavepointRecord    LogRecordType = iota
 )
 
 func (t LogRecordType) String() string {
@@ -79,6 +100,14 @@ func (t LogRecordType) String() string {
 		return "update"
 	case BeginRecord:
 		return "begin"
+	case CheckpointRecord:
+		return "checkpoint"
+	case SavepointRecord:
+		return "savepoint"
+	case RollbackToSavepointRecord:
+		return "rollback to savepoint"
+	case ReleaseSavepointRecord:
+		return "release savepoint"
 	default:
 		return "unknown"
 	}
@@ -94,7 +123,7 @@ func NewLogFile(fileName string, bufferPool *BufferPool, catalog *Catalog) (*Log
 		return nil, err
 	}
 	var buf bytes.Buffer
-	return &LogFile{file, buf, 0, bufferPool, catalog}, nil
+	return &LogFile{file: file, buf: buf, bufferPool: bufferPool, catalog: catalog, updated: make(map[TransactionID]int64)}, nil
 }
 
 func (w *LogFile) write(data any) {
@@ -169,6 +198,25 @@ func (w *LogFile) writeFooter(offset int64) {
 	w.write(offset)
 }
 
+// A page that can be written to the log. The pages of every file that is
+// modified by transactions implement this interface, in addition to [Page], so
+// that their before and after images can be logged and restored.
+type loggedPage interface {
+	Page
+	PageNo() int
+	toBuffer() (*bytes.Buffer, error)
+	BeforeImage() Page
+	SetBeforeImage()
+	lastTransaction() TransactionID
+}
+
+// A file whose pages can be read back from the log.
+type loggedFile interface {
+	DBFile
+	BackingFile() string
+	pageFromBuffer(pageNo int, buf *bytes.Buffer) (Page, error)
+}
+
 func (w *LogFile) readPage() (Page, error) {
 	var fileId int32
 	if err := w.read(&fileId); err != nil {
@@ -178,48 +226,57 @@ func (w *LogFile) readPage() (Page, error) {
 	if err := w.read(&pageNo); err != nil {
 		return nil, err
 	}
-	f, err := w.catalog.GetTableInfoId(int(fileId))
+	f, err := w.catalog.fileById(int(fileId))
 	if err != nil {
 		return nil, err
 	}
-	pg, err := newHeapPage(f.file.Descriptor(), int(pageNo), f.file.(*HeapFile))
-	if err != nil {
-		return nil, err
+	lf, ok := f.(loggedFile)
+	if !ok {
+		return nil, fmt.Errorf("unsupported file type: %T", f)
 	}
+	offset := w.offset
 	buf := make([]byte, PageSize)
 	if err := w.read(buf); err != nil {
 		return nil, err
 	}
-	if err := pg.initFromBuffer(bytes.NewBuffer(buf)); err != nil {
+	if !pageChecksumOK(buf) {
+		return nil, GoDBError{MalformedDataError, fmt.Sprintf("checksum mismatch in the image of page %d of %s at offset %d of log %s", pageNo, lf.BackingFile(), offset, w.file.Name())}
+	}
+	return lf.pageFromBuffer(int(pageNo), bytes.NewBuffer(buf))
+}
+
+// Return a page in the format it is written to the log in.
+func (w *LogFile) encodePage(page Page) ([]byte, error) {
+	p, ok := page.(loggedPage)
+	if !ok {
+		return nil, fmt.Errorf("unsupported page type: %T", page)
+	}
+	id, err := w.catalog.fileId(page.getFile())
+	if err != nil {
+		return nil, err
+	}
+	buf, err := p.toBuffer()
+	if err != nil {
 		return nil, err
 	}
-	return pg, nil
+	var b bytes.Buffer
+	binary.Write(&b, binary.LittleEndian, int32(id))
+	binary.Write(&b, binary.LittleEndian, int32(p.PageNo()))
+	b.Write(buf.Bytes())
+	return b.Bytes(), nil
 }
 
 func (w *LogFile) writePage(page Page) error {
-	switch p := page.(type) {
-	case *heapPage:
-		// if w.catalog == nil {
-		// 	return fmt.Errorf("catalog must be non-nil")
-		// }
-		f, err := w.catalog.GetTableInfoDBFile(page.getFile())
-		if err != nil {
-			return err
-		}
-		w.write(int32(f.id))
-		w.write(int32(p.PageNo()))
-		buf, err := p.toBuffer()
-		if err != nil {
-			return err
-		}
-		w.write(buf.Bytes())
-	default:
-		return fmt.Errorf("unsupported page type: %T", page)
+	b, err := w.encodePage(page)
+	if err != nil {
+		return err
 	}
+	w.write(b)
 	return nil
 }
 
 func (w *LogFile) LogAbort(tid TransactionID) {
+	w.forget(tid)
 	offset := w.offset
 	// log.Printf("LogAbort@%d: %v", offset, tid)
 	w.writeHeader(AbortRecord, tid)
@@ -227,6 +284,7 @@ func (w *LogFile) LogAbort(tid TransactionID) {
 }
 
 func (w *LogFile) LogCommit(tid TransactionID) {
+	w.forget(tid)
 	offset := w.offset
 	// log.Printf("LogCommit@%d: %v", offset, tid)
 	w.writeHeader(CommitRecord, tid)
@@ -241,15 +299,43 @@ func (w *LogFile) LogUpdate(tid TransactionID, before Page, after Page) error {
 	if before == nil || after == nil {
 		return fmt.Errorf("before and after images must be non-nil")
 	}
+	// the pages are encoded before anything is written, so that a page that
+	// can't be logged doesn't leave a partial record in the log
+	b, err := w.encodePage(before)
+	if err != nil {
+		return err
+	}
+	a, err := w.encodePage(after)
+	if err != nil {
+		return err
+	}
 	offset := w.offset
 	// log.Printf("LogUpdate@%d for %v: page %v", offset, tid, before.(*heapPage).pageNo)
 	w.writeHeader(UpdateRecord, tid)
-	w.writePage(before)
-	w.writePage(after)
+	w.write(b)
+	w.write(a)
 	w.write(offset)
+	w.updatedLatch.Lock()
+	w.updated[tid] += w.offset - offset
+	w.updatedLatch.Unlock()
 	return nil
 }
 
+// Return the number of bytes of update records that tid has logged since it
+// began.
+func (w *LogFile) written(tid TransactionID) int64 {
+	w.updatedLatch.Lock()
+	defer w.updatedLatch.Unlock()
+	return w.updated[tid]
+}
+
+// Forget the update records of tid, which is ending.
+func (w *LogFile) forget(tid TransactionID) {
+	w.updatedLatch.Lock()
+	defer w.updatedLatch.Unlock()
+	delete(w.updated, tid)
+}
+
 // Write a Begin record that records the transaction ID.
 func (w *LogFile) LogBegin(tid TransactionID) {
 	offset := w.offset
@@ -258,6 +344,75 @@ func (w *LogFile) LogBegin(tid TransactionID) {
 	w.writeFooter(offset)
 }
 
+// Write a Checkpoint record that records the transactions that are running.
+// All of the changes that were logged before the checkpoint must be on disk,
+// so that recovery can start redoing changes at the checkpoint (see
+// [BufferPool.Checkpoint]).
+//
+// Note: does not force the log to disk.
+func (w *LogFile) LogCheckpoint(running []TransactionID) {
+	offset := w.offset
+	w.writeHeader(CheckpointRecord, 0)
+	w.write(int32(len(running)))
+	for _, tid := range running {
+		w.write(int32(tid))
+	}
+	w.writeFooter(offset)
+}
+
+// Write a Savepoint record that records that tid set the savepoint with the
+// specified name.
+//
+// Note: does not force the log to disk.
+func (w *LogFile) LogSavepoint(tid TransactionID, name string) {
+	w.logSavepointRecord(SavepointRecord, tid, name)
+}
+
+// Write a RollbackToSavepoint record that records that tid undid the changes
+// it made after the savepoint with the specified name.
+//
+// Note: does not force the log to disk.
+func (w *LogFile) LogRollbackToSavepoint(tid TransactionID, name string) {
+	w.logSavepointRecord(RollbackToSavepointRecord, tid, name)
+}
+
+// Write a ReleaseSavepoint record that records that tid released the
+// savepoint with the specified name.
+//
+// Note: does not force the log to disk.
+func (w *LogFile) LogReleaseSavepoint(tid TransactionID, name string) {
+	w.logSavepointRecord(ReleaseSavepointRecord, tid, name)
+}
+
+func (w *LogFile) logSavepointRecord(typ LogRecordType, tid TransactionID, name string) {
+	offset := w.offset
+	w.writeHeader(typ, tid)
+	w.writeString(name)
+	w.writeFooter(offset)
+}
+
+// Return the offset of the last checkpoint in the log, and the transactions
+// that were running when it was taken. Returns 0 and no transactions if there
+// is no checkpoint.
+func (f *LogFile) lastCheckpoint() (int64, []TransactionID, error) {
+	iter, err := f.ReverseIterator()
+	if err != nil {
+		return 0, nil, err
+	}
+	for {
+		record, err := iter()
+		if err != nil {
+			return 0, nil, err
+		}
+		if record == nil {
+			return 0, nil, nil
+		}
+		if checkpoint, ok := record.(*CheckpointLogRecord); ok {
+			return checkpoint.Offset(), checkpoint.Running, nil
+		}
+	}
+}
+
 func (f *LogFile) writeString(s string) {
 	f.write(int32(len(s)))
 	f.write([]byte(s))
@@ -278,7 +433,7 @@ func (f *LogFile) readString() (string, error) {
 func (f *LogFile) writeFieldType(t FieldType) {
 	f.writeString(t.Fname)
 	f.writeString(t.TableQualifier)
-	f.write(int8(t.Ftype))
+	f.write(int32(t.Ftype))
 }
 
 func (f *LogFile) readFieldType(t *FieldType) error {
@@ -290,7 +445,7 @@ func (f *LogFile) readFieldType(t *FieldType) error {
 	if t.TableQualifier, err = f.readString(); err != nil {
 		return err
 	}
-	var ftype int8
+	var ftype int32
 	if err := f.read(&ftype); err != nil {
 		return err
 	}
@@ -349,6 +504,17 @@ type UpdateLogRecord struct {
 	After  Page
 }
 
+type CheckpointLogRecord struct {
+	GenericLogRecord
+	Running []TransactionID // the transactions running at the checkpoint
+}
+
+// A Savepoint, RollbackToSavepoint, or ReleaseSavepoint record.
+type SavepointLogRecord struct {
+	GenericLogRecord
+	Name string // the name of the savepoint
+}
+
 // Returns an iterator over the records in a log file.
 //
 // If the end of the file is reached, the iterator will return nil, nil. If the
@@ -388,6 +554,30 @@ func (f *LogFile) ForwardIterator() func() (LogRecord, error) {
 				return partial("after page", err)
 			}
 			ret = &update
+		} else if record.Type() == CheckpointRecord {
+			var checkpoint CheckpointLogRecord
+			checkpoint.GenericLogRecord = record
+
+			var n int32
+			if err := f.read(&n); err != nil {
+				return partial("number of running transactions", err)
+			}
+			checkpoint.Running = make([]TransactionID, n)
+			for i := range checkpoint.Running {
+				if err := f.readTransactionID(&checkpoint.Running[i]); err != nil {
+					return partial("running transaction id", err)
+				}
+			}
+			ret = &checkpoint
+		} else if record.Type() == SavepointRecord || record.Type() == RollbackToSavepointRecord || record.Type() == ReleaseSavepointRecord {
+			var savepoint SavepointLogRecord
+			var err error
+			savepoint.GenericLogRecord = record
+
+			if savepoint.Name, err = f.readString(); err != nil {
+				return partial("savepoint name", err)
+			}
+			ret = &savepoint
 		}
 
 		var recordOffset int64
@@ -458,7 +648,12 @@ func (f *LogFile) OutputPrettyLog() error {
 			log.Printf("%d RECORD %s (%d) offset=%d\n", pos, record.Type().String(), record.Tid(), record.Offset())
 		} else if record.Type() == UpdateRecord {
 			update := record.(*UpdateLogRecord)
-			log.Printf("%d RECORD %s (%d) offset=%d page=%v\n", pos, record.Type().String(), record.Tid(), record.Offset(), update.Before.(*heapPage).getFile().pageKey(update.Before.(*heapPage).pageNo))
+			log.Printf("%d RECORD %s (%d) offset=%d page=%v\n", pos, record.Type().String(), record.Tid(), record.Offset(), update.Before.getFile().pageKey(update.Before.(loggedPage).PageNo()))
+		} else if record.Type() == CheckpointRecord {
+			checkpoint := record.(*CheckpointLogRecord)
+			log.Printf("%d RECORD %s offset=%d running=%v\n", pos, record.Type().String(), record.Offset(), checkpoint.Running)
+		} else if savepoint, ok := record.(*SavepointLogRecord); ok {
+			log.Printf("%d RECORD %s (%d) offset=%d name=%s\n", pos, record.Type().String(), record.Tid(), record.Offset(), savepoint.Name)
 		} else {
 			log.Printf("unexpected record: %#v", record)
 		}
@@ -24,7 +24,7 @@ func TestLogEvict(t *testing.T) {
 		t.Error(err)
 	}
 	for hf.NumPages() < 2 {
-		if err := hf.insertTuple(&Tuple{Desc: *hf.Descriptor(), Fields: []DBValue{IntField{1}}}, tid1); err != nil {
+		if err := hf.insertTuple(&Tuple{Desc: *hf.Descriptor(), Fields: []DBValue{StringField{"sam"}, IntField{1}}}, tid1); err != nil {
 			t.Error(err)
 		}
 	}
@@ -109,7 +109,7 @@ func TestLogRecoverUndoRedo(t *testing.T) {
 
 	// insert a page of tuples for each transaction. each transaction should
 	// have tuples on separate pages.
-	tuplesPerPage := PageSize / hf.Descriptor().bytesPerTuple()
+	tuplesPerPage := tuplesPerPage(&Tuple{Desc: *hf.Descriptor(), Fields: []DBValue{StringField{"sam"}, IntField{0}}})
 	tid := NewTID()
 	if err := bp.BeginTransaction(tid); err != nil {
 		t.Error(err)
@@ -227,7 +227,7 @@ func TestLogRecoverUndo(t *testing.T) {
 	if err := bp.BeginTransaction(tid); err != nil {
 		t.Error(err)
 	}
-	for i := 0; i < 1000; i++ {
+	for i := 0; i < 2500; i++ {
 		if err := hf.insertTuple(&Tuple{Desc: *hf.Descriptor(), Fields: []DBValue{StringField{"sam"}, IntField{int64(i)}}}, tid); err != nil {
 			t.Error(err)
 		}
@@ -287,7 +287,7 @@ func TestLogRecoverRedo(t *testing.T) {
 	if err := bp.BeginTransaction(tid); err != nil {
 		t.Error(err)
 	}
-	for i := 0; i < 1000; i++ {
+	for i := 0; i < 2500; i++ {
 		if err := hf.insertTuple(&Tuple{Desc: *hf.Descriptor(), Fields: []DBValue{StringField{"sam"}, IntField{int64(i)}}}, tid); err != nil {
 			t.Error(err)
 		}
@@ -332,8 +332,8 @@ func TestLogRecoverRedo(t *testing.T) {
 	if err != nil {
 		t.Error(err)
 	}
-	if i != 1000 {
-		t.Fatalf("expected 1000 tuples, got %d", i)
+	if i != 2500 {
+		t.Fatalf("expected 2500 tuples, got %d", i)
 	}
 	bp.CommitTransaction(tid)
 }
@@ -0,0 +1,262 @@
+package godb
+
+import (
+	"fmt"
+	"sync"
+)
+
+// A MemoryManager enforces a single byte budget on the memory used by a
+// [BufferPool] and by the operators that keep state in memory: [OrderBy],
+// [Aggregator], [Project] with DISTINCT and [EqualityJoin]. The operators
+// reserve memory for the tuples they hold, and the buffer pool holds as many
+// pages as fit in the part of the budget that the operators aren't using, so
+// that the buffer pool shrinks while a big query runs, and grows again once
+// it is done. A query that needs more memory than is left fails with a
+// MemoryLimitError, instead of running the process out of memory; a join
+// instead joins its inputs in more passes.
+//
+// Pages are counted as PageSize bytes, and tuples as their serialized size
+// plus a fixed overhead, so the budget is approximate.
+type MemoryManager struct {
+	budget int64
+
+	// the bytes reserved by the operators of each transaction, and in total
+	reserved map[TransactionID]int64
+	total    int64
+
+	bp *BufferPool // the buffer pool that uses the rest of the budget, if any
+
+	sync.Mutex
+}
+
+// The buffer pool never shrinks below this many pages, so that operators
+// can't take all of the memory it needs to run queries.
+const minBufferPoolPages = 8
+
+// The bytes a tuple is assumed to use in addition to its serialized size, for
+// the Tuple and its slice of fields.
+const tupleMemoryOverhead = 64
+
+// Operators reserve memory in chunks of this many bytes, so that they don't
+// have to go to the memory manager for every tuple.
+const memoryReservationChunk = 64 * 1024
+
+// Create a memory manager with the specified budget in bytes.
+//
+// Returns an error if the budget is too small for the smallest buffer pool.
+func NewMemoryManager(budget int64) (*MemoryManager, error) {
+	if budget < minBufferPoolPages*int64(PageSize) {
+		return nil, GoDBError{IllegalOperationError, fmt.Sprintf("a memory budget must be at least %d bytes", minBufferPoolPages*PageSize)}
+	}
+	return &MemoryManager{budget: budget, reserved: make(map[TransactionID]int64)}, nil
+}
+
+// Return the budget of the memory manager in bytes.
+func (m *MemoryManager) Budget() int64 {
+	return m.budget
+}
+
+// Return the number of bytes the operators have reserved.
+func (m *MemoryManager) Reserved() int64 {
+	m.Lock()
+	defer m.Unlock()
+	return m.total
+}
+
+// Return the number of pages the buffer pool may hold.
+//
+// Caller must hold the memory manager's lock.
+func (m *MemoryManager) poolPages() int {
+	return int((m.budget - m.total) / int64(PageSize))
+}
+
+// Reserve n bytes for an operator of transaction tid, shrinking the buffer pool
+// to make room. Returns a MemoryLimitError if the budget doesn't have room for
+// them, and the smallest buffer pool.
+func (m *MemoryManager) reserve(tid TransactionID, n int64) error {
+	m.Lock()
+	floor := int64(0)
+	if m.bp != nil {
+		floor = minBufferPoolPages * int64(PageSize)
+	}
+	if m.total+n+floor > m.budget {
+		m.Unlock()
+		return GoDBError{MemoryLimitError, fmt.Sprintf("the query needs more memory than the %d bytes left of the %d byte budget", m.budget-floor-m.total, m.budget)}
+	}
+	m.total += n
+	m.reserved[tid] += n
+	bp := m.bp
+	m.Unlock()
+	if bp != nil {
+		// pages that can't be written now are evicted later
+		bp.resize()
+	}
+	return nil
+}
+
+// Give back n bytes that an operator of transaction tid reserved, which the
+// buffer pool may use again.
+func (m *MemoryManager) release(tid TransactionID, n int64) {
+	m.Lock()
+	n = min(n, m.reserved[tid])
+	m.total -= n
+	m.reserved[tid] -= n
+	if m.reserved[tid] == 0 {
+		delete(m.reserved, tid)
+	}
+	bp := m.bp
+	m.Unlock()
+	if bp != nil {
+		bp.resize()
+	}
+}
+
+// Give back the memory the operators of a transaction still hold, e.g.,
+// because the transaction didn't read all of a query's results. Called when
+// the transaction commits or aborts.
+func (m *MemoryManager) releaseAll(tid TransactionID) {
+	m.Lock()
+	n := m.reserved[tid]
+	m.Unlock()
+	if n > 0 {
+		m.release(tid, n)
+	}
+}
+
+// The memory an operator has reserved for its state. The zero value, or one
+// without a memory manager, places no limit on the operator.
+type memoryReservation struct {
+	m        *MemoryManager
+	tid      TransactionID
+	reserved int64 // the bytes reserved from m
+	used     int64 // the bytes the operator is using
+}
+
+// Record that the operator uses n more bytes, reserving more memory if
+// needed. Returns a MemoryLimitError if there isn't enough memory left.
+func (r *memoryReservation) grow(n int64) error {
+	if r.m == nil {
+		return nil
+	}
+	if r.used+n > r.reserved {
+		more := max(r.used+n-r.reserved, memoryReservationChunk)
+		if err := r.m.reserve(r.tid, more); err != nil {
+			// try to reserve just what is needed
+			more = r.used + n - r.reserved
+			if r.m.reserve(r.tid, more) != nil {
+				return err
+			}
+		}
+		r.reserved += more
+	}
+	r.used += n
+	return nil
+}
+
+// Give back all of the memory the operator reserved.
+func (r *memoryReservation) free() {
+	if r.m != nil && r.reserved > 0 {
+		r.m.release(r.tid, r.reserved)
+	}
+	r.reserved, r.used = 0, 0
+}
+
+// Return the number of bytes a tuple is assumed to use in memory.
+func tupleMemorySize(t *Tuple) int64 {
+	return int64(t.serializedSize()) + tupleMemoryOverhead
+}
+
+// Make the buffer pool share the budget of a memory manager with the operators
+// that use the memory manager (see [MemoryManager]). From now on, the buffer
+// pool holds as many pages as fit in the part of the budget that the operators
+// aren't using, but at least a few, instead of the number of pages it was
+// created with. The memory the operators of a transaction reserved is given
+// back when the transaction commits or aborts.
+//
+// Returns an error if either the buffer pool or the memory manager is already
+// shared.
+func (bp *BufferPool) SetMemoryManager(m *MemoryManager) error {
+	m.Lock()
+	if m.bp != nil {
+		m.Unlock()
+		return GoDBError{IllegalOperationError, "the memory manager is already used by a buffer pool"}
+	}
+	if m.budget-m.total < minBufferPoolPages*int64(PageSize) {
+		m.Unlock()
+		return GoDBError{MemoryLimitError, "the operators use too much of the memory budget for the buffer pool"}
+	}
+	if !bp.memory.CompareAndSwap(nil, m) {
+		m.Unlock()
+		return GoDBError{IllegalOperationError, "the buffer pool already has a memory manager"}
+	}
+	m.bp = bp
+	m.Unlock()
+	return bp.resize()
+}
+
+// Return the memory manager of the buffer pool, or nil if it doesn't have
+// one. The parser passes it to the operators of the queries it plans.
+func (bp *BufferPool) MemoryManager() *MemoryManager {
+	return bp.memory.Load()
+}
+
+// Return the number of pages the buffer pool may hold.
+func (bp *BufferPool) capacity() int {
+	bp.frameLatch.Lock()
+	defer bp.frameLatch.Unlock()
+	return bp.maxPages
+}
+
+// Set the number of pages the buffer pool may hold to the part of the memory
+// budget that the operators aren't using, and evict pages until it holds no
+// more than that. Pages that don't match their files are written first.
+// Pinned pages stay; the buffer pool evicts more pages the next time it reads
+// a page instead.
+func (bp *BufferPool) resize() error {
+	m := bp.memory.Load()
+	if m == nil {
+		return nil
+	}
+	for {
+		bp.frameLatch.Lock()
+		m.Lock()
+		bp.maxPages = max(m.poolPages(), minBufferPoolPages)
+		m.Unlock()
+		if bp.numFrames <= bp.maxPages {
+			bp.frameLatch.Unlock()
+			return nil
+		}
+
+		key, ok := bp.policy.victim(func(key any) bool {
+			p := bp.partition(key)
+			p.Lock()
+			defer p.Unlock()
+			return p.evictable(key, true)
+		})
+		if ok {
+			if bp.evictCleanPage(key) {
+				bp.numFrames--
+				bp.counters.update(func(s *BufferPoolStats) { s.Evictions++ })
+			}
+			bp.frameLatch.Unlock()
+			continue
+		}
+
+		key, ok = bp.policy.victim(func(key any) bool {
+			p := bp.partition(key)
+			p.Lock()
+			defer p.Unlock()
+			return p.evictable(key, false)
+		})
+		bp.frameLatch.Unlock()
+		if !ok {
+			return nil
+		}
+		bp.checkpointLatch.RLock()
+		err := bp.writePages([]any{key})
+		bp.checkpointLatch.RUnlock()
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package godb
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+// Make a memory manager with a budget of the specified number of pages.
+func makeTestMemoryManager(t *testing.T, pages int) *MemoryManager {
+	t.Helper()
+	m, err := NewMemoryManager(int64(pages * PageSize))
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	return m
+}
+
+// Insert n tuples of about 1000 bytes, numbered from 0, into hf.
+func insertBigTuplesForTest(t *testing.T, hf *HeapFile, n int, tid TransactionID) {
+	t.Helper()
+	td, _, _ := makeTupleTestVars()
+	for i := 0; i < n; i++ {
+		tup := Tuple{Desc: td, Fields: []DBValue{StringField{strings.Repeat("x", 1000)}, IntField{int64(i)}}}
+		insertTupleForTest(t, hf, &tup, tid)
+	}
+}
+
+func isMemoryLimitError(err error) bool {
+	var gerr GoDBError
+	return errors.As(err, &gerr) && gerr.code == MemoryLimitError
+}
+
+func TestMemoryManagerReserve(t *testing.T) {
+	if _, err := NewMemoryManager(int64(PageSize)); err == nil {
+		t.Errorf("expected a budget smaller than the smallest buffer pool to be rejected")
+	}
+	m := makeTestMemoryManager(t, 10)
+	tid1, tid2 := NewTID(), NewTID()
+	if err := m.reserve(tid1, int64(6*PageSize)); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if err := m.reserve(tid2, int64(6*PageSize)); !isMemoryLimitError(err) {
+		t.Errorf("expected a MemoryLimitError when the budget is used up, got %v", err)
+	}
+	if err := m.reserve(tid2, int64(4*PageSize)); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if m.Reserved() != int64(10*PageSize) {
+		t.Errorf("expected %d bytes to be reserved, got %d", 10*PageSize, m.Reserved())
+	}
+	m.release(tid1, int64(2*PageSize))
+	m.releaseAll(tid2)
+	if m.Reserved() != int64(4*PageSize) {
+		t.Errorf("expected %d bytes to be reserved, got %d", 4*PageSize, m.Reserved())
+	}
+	// a transaction can't give back more than it reserved
+	m.release(tid1, int64(10*PageSize))
+	if m.Reserved() != 0 {
+		t.Errorf("expected no memory to be reserved, got %d bytes", m.Reserved())
+	}
+}
+
+func TestMemoryManagerResizesBufferPool(t *testing.T) {
+	bp, hf := makeTestFile(t, 100)
+	tid := BeginTransactionForTest(t, bp)
+	insertBigTuplesForTest(t, hf, 80, tid)
+	flushAndCommitForTest(t, bp, tid)
+
+	tid = BeginTransactionForTest(t, bp)
+	defer bp.CommitTransaction(tid)
+	for p := 0; p < hf.NumPages(); p++ {
+		if _, err := bp.GetPage(hf, p, tid, ReadPerm); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	if hf.NumPages() <= minBufferPoolPages {
+		t.Fatalf("expected the file to have more than %d pages, got %d", minBufferPoolPages, hf.NumPages())
+	}
+
+	m := makeTestMemoryManager(t, 12)
+	if err := bp.SetMemoryManager(m); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if err := bp.SetMemoryManager(m); err == nil {
+		t.Errorf("expected a second memory manager to be rejected")
+	}
+	if bp.capacity() != 12 || bp.numCachedPages() > 12 {
+		t.Errorf("expected the buffer pool to shrink to 12 pages, got %d of %d", bp.numCachedPages(), bp.capacity())
+	}
+
+	// the buffer pool makes room for the operators, down to its smallest size
+	if err := m.reserve(tid, int64(2*PageSize)); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if bp.capacity() != 10 || bp.numCachedPages() > 10 {
+		t.Errorf("expected the buffer pool to shrink to 10 pages, got %d of %d", bp.numCachedPages(), bp.capacity())
+	}
+	if err := m.reserve(tid, int64(4*PageSize)); !isMemoryLimitError(err) {
+		t.Errorf("expected a MemoryLimitError when the buffer pool can't shrink further, got %v", err)
+	}
+
+	// and grows again once the memory is given back
+	m.releaseAll(tid)
+	if bp.capacity() != 12 {
+		t.Errorf("expected the buffer pool to grow to 12 pages, got %d", bp.capacity())
+	}
+}
+
+func TestMemoryManagerOrderByLimit(t *testing.T) {
+	bp, hf := makeTestFile(t, 100)
+	tid := BeginTransactionForTest(t, bp)
+	defer bp.CommitTransaction(tid)
+	insertBigTuplesForTest(t, hf, 40, tid)
+
+	exprs := []Expr{&FieldExpr{hf.Descriptor().Fields[1]}}
+	oby, err := NewOrderBy(exprs, hf, []bool{false})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	m := makeTestMemoryManager(t, 8)
+	oby.memory = m
+	if _, err := oby.Iterator(tid); !isMemoryLimitError(err) {
+		t.Errorf("expected a MemoryLimitError when the tuples don't fit in memory, got %v", err)
+	}
+	if m.Reserved() != 0 {
+		t.Errorf("expected the memory to be given back, got %d bytes reserved", m.Reserved())
+	}
+
+	// the tuples fit in a bigger budget
+	m = makeTestMemoryManager(t, 100)
+	oby.memory = m
+	iter, err := oby.Iterator(tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if m.Reserved() == 0 {
+		t.Errorf("expected memory to be reserved for the tuples")
+	}
+	cnt := 0
+	for {
+		tup, err := iter()
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if tup == nil {
+			break
+		}
+		if v := tup.Fields[1].(IntField).Value; v != int64(39-cnt) {
+			t.Errorf("expected tuple %d to be %d, got %d", cnt, 39-cnt, v)
+		}
+		cnt++
+	}
+	if cnt != 40 {
+		t.Errorf("expected 40 tuples, got %d", cnt)
+	}
+	if m.Reserved() != 0 {
+		t.Errorf("expected the memory to be given back, got %d bytes reserved", m.Reserved())
+	}
+}
+
+func TestMemoryManagerJoinInBatches(t *testing.T) {
+	bp, hf := makeTestFile(t, 100)
+	tid := BeginTransactionForTest(t, bp)
+	defer bp.CommitTransaction(tid)
+	insertBigTuplesForTest(t, hf, 40, tid)
+	td := *hf.Descriptor()
+	os.Remove(JoinTestFile)
+	hf2, err := NewHeapFile(JoinTestFile, &td, bp)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	insertBigTuplesForTest(t, hf2, 40, tid)
+
+	field := FieldExpr{td.Fields[1]}
+	join, err := NewJoin(hf, &field, hf2, &field, 100)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	// the left tuples don't fit in memory at once, so they are joined in
+	// several batches
+	m := makeTestMemoryManager(t, 8)
+	join.memory = m
+	iter, err := join.Iterator(tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	cnt := 0
+	for {
+		tup, err := iter()
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if tup == nil {
+			break
+		}
+		if tup.Fields[1] != tup.Fields[3] {
+			t.Errorf("expected joined tuples to match, got %v", tup)
+		}
+		cnt++
+	}
+	if cnt != 40 {
+		t.Errorf("expected 40 results, got %d", cnt)
+	}
+	if m.Reserved() != 0 {
+		t.Errorf("expected the memory to be given back, got %d bytes reserved", m.Reserved())
+	}
+}
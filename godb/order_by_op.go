@@ -9,6 +9,8 @@ type OrderBy struct {
 	child   Operator
 	//add additional fields here
 	ascending []bool
+
+	memory *MemoryManager // limits the memory used for the tuples, if not nil
 }
 
 type TupSortState struct {
@@ -22,7 +24,7 @@ type TupSortState struct {
 // ascending bitmap indicates whether the ith field in the orderByFields list
 // should be in ascending (true) or descending (false) order.
 func NewOrderBy(orderByFields []Expr, child Operator, ascending []bool) (*OrderBy, error) {
-	return &OrderBy{orderByFields, child, ascending}, nil
+	return &OrderBy{orderByFields, child, ascending, nil}, nil
 
 }
 
@@ -68,20 +70,30 @@ func (ts TupSortState) Less(i, j int) bool {
 // the sort algorithm will invoke to produce a sorted list. See the first
 // example, example of SortMultiKeys, and documentation at:
 // https://pkg.go.dev/sort
+//
+// The memory the tuples use is reserved from the memory manager of the
+// operator, if it has one, and given back once the last tuple is returned.
+// Returns a MemoryLimitError if the tuples don't fit in the memory budget.
 func (o *OrderBy) Iterator(tid TransactionID) (func() (*Tuple, error), error) {
 	var tups []*Tuple
 	childIter, err := o.child.Iterator(tid)
 	if err != nil {
 		return nil, err
 	}
+	mem := memoryReservation{m: o.memory, tid: tid}
 	for {
 		t, err := childIter()
 		if err != nil {
+			mem.free()
 			return nil, err
 		}
 		if t == nil {
 			break
 		}
+		if err := mem.grow(tupleMemorySize(t)); err != nil {
+			mem.free()
+			return nil, err
+		}
 		tups = append(tups, t)
 	}
 	tstate := TupSortState{o, tups}
@@ -93,6 +105,7 @@ func (o *OrderBy) Iterator(tid TransactionID) (func() (*Tuple, error), error) {
 			curTup++
 			return t, nil
 		} else {
+			mem.free()
 			return nil, nil
 		}
 	}, nil
@@ -0,0 +1,69 @@
+package godb
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"os"
+)
+
+// Every page of a heap file or index begins with a checksum of the rest of the
+// page: a 4 byte CRC-32C, in little endian order. The checksum is set when a
+// page is serialized by its toBuffer method, and verified whenever a page is
+// read from disk or from the log, so that a corrupt page, or a page that was
+// only partially written before a crash, is reported as an error instead of
+// being read as garbage.
+const ChecksumSize = 4
+
+var checksumTable = crc32.MakeTable(crc32.Castagnoli)
+
+// Compute the checksum of a serialized page, and store it at the start of the
+// page.
+func setPageChecksum(page []byte) {
+	binary.LittleEndian.PutUint32(page, crc32.Checksum(page[ChecksumSize:], checksumTable))
+}
+
+// Returns true if the checksum stored at the start of a serialized page
+// matches its contents.
+func pageChecksumOK(page []byte) bool {
+	return len(page) >= ChecksumSize && binary.LittleEndian.Uint32(page) == crc32.Checksum(page[ChecksumSize:], checksumTable)
+}
+
+// Read the specified page of an index from disk, and verify its checksum.
+// Returns a MalformedDataError that names the file and page if the checksum
+// doesn't match.
+func readPageBytes(fileName string, pageNo int) ([]byte, error) {
+	return readPageBytesAt(fileName, pageNo, int64(pageNo*PageSize))
+}
+
+// Read the specified page from the specified offset of a file, and verify its
+// checksum. Used for files that don't store page i at offset i*PageSize, such
+// as heap files (see [heapPageOffset]).
+func readPageBytesAt(fileName string, pageNo int, offset int64) ([]byte, error) {
+	file, err := os.OpenFile(fileName, os.O_CREATE|os.O_RDONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return readPageRange(file, pageNo, 1, offset)
+}
+
+// Read n consecutive pages, starting with page pageNo at the specified offset,
+// from a file that is already open, with a single read, and verify their
+// checksums. Returns the pages one after the other.
+func readPageRange(file *os.File, pageNo int, n int, offset int64) ([]byte, error) {
+	b := make([]byte, n*PageSize)
+	read, err := file.ReadAt(b, offset)
+	if err != nil {
+		return nil, err
+	}
+	if read != len(b) {
+		return nil, GoDBError{MalformedDataError, "not enough bytes read in ReadPage"}
+	}
+	for i := 0; i < n; i++ {
+		if !pageChecksumOK(b[i*PageSize : (i+1)*PageSize]) {
+			return nil, GoDBError{MalformedDataError, fmt.Sprintf("checksum mismatch in page %d of %s; the page is corrupt or was partially written", pageNo+i, file.Name())}
+		}
+	}
+	return b, nil
+}
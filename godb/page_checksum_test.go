@@ -0,0 +1,105 @@
+package godb
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+// Overwrite bytes of a file at the specified offset.
+func corruptFileForTest(t *testing.T, fileName string, offset int64, b []byte) {
+	t.Helper()
+	f, err := os.OpenFile(fileName, os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer f.Close()
+	if _, err := f.WriteAt(b, offset); err != nil {
+		t.Fatalf(err.Error())
+	}
+}
+
+func TestHeapPageChecksum(t *testing.T) {
+	bp, hf := makeTestFile(t, 10)
+	fillPagesForTest(t, bp, hf, 3)
+
+	for pageNo := 0; pageNo < 3; pageNo++ {
+		if _, err := hf.readPage(pageNo); err != nil {
+			t.Fatalf("failed to read intact page %d, %s", pageNo, err.Error())
+		}
+	}
+
+	checkCorrupt := func(pageNo int) {
+		t.Helper()
+		_, err := hf.readPage(pageNo)
+		if err == nil {
+			t.Fatalf("expected reading corrupt page %d to fail", pageNo)
+		}
+		gdbErr, ok := err.(GoDBError)
+		if !ok || gdbErr.code != MalformedDataError {
+			t.Errorf("expected a MalformedDataError, got %v", err)
+		}
+		if !strings.Contains(err.Error(), hf.BackingFile()) || !strings.Contains(err.Error(), fmt.Sprintf("page %d", pageNo)) {
+			t.Errorf("expected the error to name the file and page, got %s", err.Error())
+		}
+	}
+
+	// a single flipped bit in a record
+	corruptFileForTest(t, hf.BackingFile(), heapPageOffset(2)-10, []byte{0x01})
+	checkCorrupt(1)
+
+	// a torn write, where only the first half of the page reached the disk
+	corruptFileForTest(t, hf.BackingFile(), heapPageOffset(0)+int64(PageSize/2), make([]byte, PageSize/2))
+	checkCorrupt(0)
+
+	if _, err := hf.readPage(2); err != nil {
+		t.Errorf("failed to read intact page 2, %s", err.Error())
+	}
+}
+
+func TestLogPageChecksum(t *testing.T) {
+	os.Remove("log_checksum.dat")
+	defer os.Remove("log_checksum.dat")
+	bp, c, err := MakeTestDatabase(10, "catalog.txt")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	hf, err := c.addTable("log_checksum", TupleDesc{Fields: []FieldType{{Fname: "t1", Ftype: IntType}}})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	tid := BeginTransactionForTest(t, bp)
+	insertTupleForTest(t, hf, &Tuple{Desc: *hf.Descriptor(), Fields: []DBValue{IntField{1}}}, tid)
+	bp.CommitTransaction(tid)
+
+	logFile := bp.LogFile()
+	readUpdate := func() (LogRecord, error) {
+		t.Helper()
+		if err := logFile.seek(0, io.SeekStart); err != nil {
+			t.Fatalf(err.Error())
+		}
+		iter := logFile.ForwardIterator()
+		for {
+			record, err := iter()
+			if err != nil || record == nil || record.Type() == UpdateRecord {
+				return record, err
+			}
+		}
+	}
+	record, err := readUpdate()
+	if err != nil || record == nil {
+		t.Fatalf("expected to read an update record, got %v, %v", record, err)
+	}
+
+	// flip a byte in the after image of the page, which follows the type,
+	// transaction id, and the file and page numbers and contents of the
+	// before image
+	afterOffset := record.Offset() + 1 + 4 + 2*(4+4) + int64(PageSize)
+	corruptFileForTest(t, logFile.file.Name(), afterOffset+int64(PageSize)-10, []byte{0xff})
+	_, err = readUpdate()
+	if err == nil || !strings.Contains(err.Error(), "checksum mismatch") || !strings.Contains(err.Error(), hf.(*HeapFile).BackingFile()) {
+		t.Errorf("expected a checksum mismatch naming %s, got %v", hf.(*HeapFile).BackingFile(), err)
+	}
+}
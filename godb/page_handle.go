@@ -0,0 +1,77 @@
+package godb
+
+// A PageHandle is a page that is pinned in the buffer pool, which is returned
+// by [BufferPool.PinPage]. A pinned page is never evicted, so operators that
+// read a page over several calls, or fetch it more than once, pin it while it
+// is in use, and release the handle once they are done with it.
+type PageHandle struct {
+	Page
+	bp       *BufferPool
+	key      any
+	tid      TransactionID
+	readLock bool // the read lock on the page is released with the handle
+	released bool
+}
+
+// Unpin the page. Releasing a handle more than once, or after its transaction
+// has committed or aborted, has no effect. The read lock that a transaction at
+// the ReadCommitted isolation level took on the page is released too.
+func (h *PageHandle) Release() {
+	p := h.bp.partition(h.key)
+	p.Lock()
+	if h.released {
+		p.Unlock()
+		return
+	}
+	h.released = true
+	p.unpin(h.tid, h.key)
+	p.Unlock()
+	if h.readLock {
+		h.bp.lockTable.releaseReadLock(h.key, h.tid)
+	}
+}
+
+// Add a pin on the page with the specified key on behalf of the transaction.
+//
+// Caller must hold the latch of the partition.
+func (p *bufferPoolPartition) pin(tid TransactionID, key any) {
+	if p.tidPins[tid] == nil {
+		p.tidPins[tid] = make(map[any]int)
+	}
+	p.tidPins[tid][key]++
+	p.pins[key]++
+}
+
+// Remove a pin the transaction holds on the page with the specified key.
+//
+// Caller must hold the latch of the partition.
+func (p *bufferPoolPartition) unpin(tid TransactionID, key any) {
+	if p.tidPins[tid][key] == 0 {
+		return
+	}
+	p.tidPins[tid][key]--
+	if p.tidPins[tid][key] == 0 {
+		delete(p.tidPins[tid], key)
+	}
+	p.pins[key]--
+	if p.pins[key] == 0 {
+		delete(p.pins, key)
+	}
+}
+
+// Remove the pins the transaction still holds, e.g., those of an iterator that
+// wasn't run to the end. Called when the transaction commits or aborts.
+func (bp *BufferPool) unpinAll(tid TransactionID) {
+	for i := range bp.partitions {
+		p := &bp.partitions[i]
+		p.Lock()
+		for key, n := range p.tidPins[tid] {
+			p.pins[key] -= n
+			if p.pins[key] <= 0 {
+				delete(p.pins, key)
+			}
+		}
+		delete(p.tidPins, tid)
+		p.Unlock()
+	}
+}
@@ -0,0 +1,192 @@
+package godb
+
+import (
+	"log"
+	"time"
+)
+
+// Settings of the background page writer (see [BufferPool.StartPageWriter]).
+type PageWriterConfig struct {
+	Interval      time.Duration // how often the writer runs
+	PagesPerRound int           // the most pages written each time it runs
+
+	// how often a checkpoint is taken (see [BufferPool.Checkpoint]), or 0 to
+	// never take one
+	CheckpointInterval time.Duration
+}
+
+// Start a goroutine that trickles the pages that don't match their files to
+// disk, so that evictions rarely have to write a page first, and that takes a
+// checkpoint periodically, so that [BufferPool.Recover] only has to redo the
+// changes logged since the last checkpoint. The writer runs until
+// [BufferPool.StopPageWriter] is called.
+//
+// Returns an error if the settings are invalid, the writer is already running,
+// or the buffer pool has no log file yet.
+func (bp *BufferPool) StartPageWriter(config PageWriterConfig) error {
+	if config.Interval <= 0 || config.PagesPerRound <= 0 || config.CheckpointInterval < 0 {
+		return GoDBError{IllegalOperationError, "the page writer needs a positive interval and number of pages per round"}
+	}
+	bp.writerLatch.Lock()
+	defer bp.writerLatch.Unlock()
+	if bp.writerStop != nil {
+		return GoDBError{IllegalOperationError, "the page writer is already running"}
+	}
+	if bp.logfile == nil {
+		return GoDBError{IllegalOperationError, "the page writer can't start until the buffer pool is recovered from its log"}
+	}
+	bp.writerStop = make(chan struct{})
+	bp.writerDone = make(chan struct{})
+	go bp.runPageWriter(config, bp.writerStop, bp.writerDone)
+	return nil
+}
+
+// Stop the background page writer, waiting for it to finish the round it is
+// running. Does nothing if the writer isn't running.
+func (bp *BufferPool) StopPageWriter() {
+	bp.writerLatch.Lock()
+	stop, done := bp.writerStop, bp.writerDone
+	bp.writerStop, bp.writerDone = nil, nil
+	bp.writerLatch.Unlock()
+	if stop == nil {
+		return
+	}
+	close(stop)
+	<-done
+}
+
+func (bp *BufferPool) runPageWriter(config PageWriterConfig, stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+	writes := time.NewTicker(config.Interval)
+	defer writes.Stop()
+	var checkpoints <-chan time.Time
+	if config.CheckpointInterval > 0 {
+		ticker := time.NewTicker(config.CheckpointInterval)
+		defer ticker.Stop()
+		checkpoints = ticker.C
+	}
+	for {
+		select {
+		case <-stop:
+			return
+		case <-writes.C:
+			if err := bp.writeSomePages(config.PagesPerRound); err != nil {
+				log.Printf("page writer: %v", err)
+			}
+		case <-checkpoints:
+			if err := bp.Checkpoint(); err != nil {
+				log.Printf("page writer: checkpoint failed: %v", err)
+			}
+		}
+	}
+}
+
+// Write at most n of the unpinned pages that don't match their files to disk.
+// Pinned pages are left alone, since they are likely being modified.
+func (bp *BufferPool) writeSomePages(n int) error {
+	keys := bp.findPages(func(p *bufferPoolPartition, key any, page Page) bool {
+		if p.pins[key] != 0 {
+			return false
+		}
+		_, unflushed := p.unflushed[key]
+		return unflushed || page.isDirty()
+	})
+	if len(keys) > n {
+		keys = keys[:n]
+	}
+	bp.checkpointLatch.RLock()
+	defer bp.checkpointLatch.RUnlock()
+	return bp.writePages(keys)
+}
+
+// Take a checkpoint: write every page whose committed changes are logged but
+// not on disk yet, then log a Checkpoint record with the running transactions,
+// and force the log. Changes logged before the checkpoint need not be redone
+// by [BufferPool.Recover].
+func (bp *BufferPool) Checkpoint() error {
+	bp.checkpointLatch.Lock()
+	defer bp.checkpointLatch.Unlock()
+	if bp.logfile == nil {
+		return GoDBError{IllegalOperationError, "can't take a checkpoint before the buffer pool is recovered from its log"}
+	}
+	keys := bp.findPages(func(p *bufferPoolPartition, key any, page Page) bool {
+		_, unflushed := p.unflushed[key]
+		return unflushed
+	})
+	if err := bp.writePages(keys); err != nil {
+		return err
+	}
+	bp.tidLatch.Lock()
+	running := make([]TransactionID, 0, len(bp.runningTids))
+	for tid := range bp.runningTids {
+		running = append(running, tid)
+	}
+	bp.tidLatch.Unlock()
+	bp.logLatch.Lock()
+	defer bp.logLatch.Unlock()
+	bp.LogFile().LogCheckpoint(running)
+	return bp.LogFile().Force()
+}
+
+// Write the pages with the specified keys to their files. Following the WAL
+// protocol, the uncommitted changes on dirty pages are logged, and the log is
+// forced, before any page is written (this is the STEAL policy). The pages are
+// clean afterwards; their before images are kept, so that the transactions
+// that dirtied them can still be rolled back. Pages that were dropped from the
+// buffer pool in the meantime are skipped.
+//
+// The pages are pinned while they are written, so that they aren't evicted
+// before they are on disk. Caller must hold checkpointLatch, shared or
+// exclusively.
+func (bp *BufferPool) writePages(keys []any) error {
+	bp.logLatch.Lock()
+	defer bp.logLatch.Unlock()
+
+	var pages []Page
+	var written []any
+	var err error
+	for _, key := range keys {
+		p := bp.partition(key)
+		p.Lock()
+		page, ok := p.pages[key]
+		if ok && page.isDirty() {
+			err = bp.logUncommitted(page)
+			if err == nil {
+				page.setDirty(page.(loggedPage).lastTransaction(), false)
+			}
+		}
+		if ok && err == nil {
+			delete(p.unflushed, key)
+			p.pins[key]++
+			pages = append(pages, page)
+			written = append(written, key)
+		}
+		p.Unlock()
+		if err != nil {
+			break
+		}
+	}
+	if err == nil && len(pages) > 0 {
+		err = bp.LogFile().Force()
+	}
+	for i, key := range written {
+		if err == nil {
+			err = bp.flushPage(pages[i])
+			if err == nil {
+				bp.counters.update(func(s *BufferPoolStats) { s.DirtyFlushes++ })
+			}
+		}
+		p := bp.partition(key)
+		p.Lock()
+		if err != nil {
+			// the page still has to be written
+			p.unflushed[key] = nil
+		}
+		p.pins[key]--
+		if p.pins[key] == 0 {
+			delete(p.pins, key)
+		}
+		p.Unlock()
+	}
+	return err
+}
@@ -0,0 +1,146 @@
+package godb
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+// Insert n tuples into table t in a transaction that commits, without
+// flushing the buffer pool.
+func insertAndCommitForPageWriterTest(t *testing.T, bp *BufferPool, hf DBFile, n int) {
+	t.Helper()
+	tid := BeginTransactionForTest(t, bp)
+	for i := 0; i < n; i++ {
+		tup := Tuple{Desc: *hf.Descriptor(), Fields: []DBValue{StringField{"sam"}, IntField{int64(i)}}}
+		insertTupleForTest(t, hf, &tup, tid)
+	}
+	if err := bp.CommitTransaction(tid); err != nil {
+		t.Fatalf(err.Error())
+	}
+}
+
+// Count the tuples in table t of a recovered database.
+func countTuplesForPageWriterTest(t *testing.T, bp *BufferPool, c *Catalog) int {
+	t.Helper()
+	hf, err := c.GetTable("t")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	tid := BeginTransactionForTest(t, bp)
+	defer bp.CommitTransaction(tid)
+	iter, err := hf.Iterator(tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	n := 0
+	for {
+		tup, err := iter()
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if tup == nil {
+			return n
+		}
+		n++
+	}
+}
+
+func TestPageWriter(t *testing.T) {
+	bp, c, err := MakeTestDatabase(100, "catalog.txt")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	hf, err := c.GetTable("t")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	insertAndCommitForPageWriterTest(t, bp, hf, 2500)
+
+	if err := bp.StartPageWriter(PageWriterConfig{}); err == nil {
+		t.Errorf("expected a page writer without an interval to be rejected")
+	}
+	if err := bp.StartPageWriter(PageWriterConfig{Interval: 5 * time.Millisecond, PagesPerRound: 2}); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if err := bp.StartPageWriter(PageWriterConfig{Interval: 5 * time.Millisecond, PagesPerRound: 2}); err == nil {
+		t.Errorf("expected starting a second page writer to fail")
+	}
+
+	// the committed pages are trickled to disk
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		left := bp.numUnflushedPages()
+		if left == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the page writer to write every page, %d are left", left)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	bp.StopPageWriter()
+	bp.StopPageWriter()
+	if s := bp.Stats(); s.DirtyFlushes < int64(hf.NumPages()) {
+		t.Errorf("expected at least %d pages to be written, got %d", hf.NumPages(), s.DirtyFlushes)
+	}
+
+	// the changes are on disk, so they survive the loss of the log
+	os.Remove("test.log")
+	bp, c, err = RecoverTestDatabase(100, "catalog.txt")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if n := countTuplesForPageWriterTest(t, bp, c); n != 2500 {
+		t.Errorf("expected 2500 tuples on disk, got %d", n)
+	}
+}
+
+func TestCheckpointRecovery(t *testing.T) {
+	bp, c, err := MakeTestDatabase(100, "catalog.txt")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	hf, err := c.GetTable("t")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	insertAndCommitForPageWriterTest(t, bp, hf, 2500)
+
+	// a transaction that is running at the checkpoint, and writes to disk
+	// before the crash
+	tid := BeginTransactionForTest(t, bp)
+	if err := bp.Checkpoint(); err != nil {
+		t.Fatalf(err.Error())
+	}
+	dirtied := make(map[int]bool)
+	for i := 0; i < 10; i++ {
+		tup := Tuple{Desc: *hf.Descriptor(), Fields: []DBValue{StringField{"joe"}, IntField{int64(i)}}}
+		insertTupleForTest(t, hf, &tup, tid)
+		dirtied[tup.Rid.(heapFileRid).pageNo] = true
+	}
+	if err := bp.writeSomePages(100); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	offset, running, err := bp.LogFile().lastCheckpoint()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if offset == 0 || len(running) != 1 || running[0] != tid {
+		t.Errorf("expected a checkpoint with running transaction %d, got offset %d and %v", tid, offset, running)
+	}
+
+	// only the running transaction's changes are redone, and then undone; the
+	// committed changes before the checkpoint are not redone
+	bp, c, err = RecoverTestDatabase(100, "catalog.txt")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if w := bp.Stats().Total().Writes; w != int64(2*len(dirtied)) {
+		t.Errorf("expected recovery to write the %d pages of the running transaction twice, got %d writes", len(dirtied), w)
+	}
+	if n := countTuplesForPageWriterTest(t, bp, c); n != 2500 {
+		t.Errorf("expected 2500 tuples after recovery, got %d", n)
+	}
+}
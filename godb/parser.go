@@ -3,6 +3,7 @@ package godb
 import (
 	"fmt"
 	"reflect"
+	"regexp"
 	"strconv"
 	"strings"
 	"unsafe"
@@ -29,6 +30,7 @@ const (
 	ExprFunc  SelectExprType = iota
 	ExprStar  SelectExprType = iota
 	ExprAggr  SelectExprType = iota
+	ExprNull  SelectExprType = iota
 )
 
 type LogicalSelectNode struct {
@@ -59,6 +61,14 @@ func NewConstSelectNode(value string, alias string) LogicalSelectNode {
 	return lsn
 }
 
+func NewNullSelectNode(alias string) LogicalSelectNode {
+	lsn := LogicalSelectNode{}
+	lsn.exprType = ExprNull
+	lsn.value = "NULL"
+	lsn.alias = alias
+	return lsn
+}
+
 func NewStarSelectNode(table string) LogicalSelectNode {
 	lsn := LogicalSelectNode{}
 	lsn.exprType = ExprStar
@@ -98,6 +108,8 @@ func (t SelectExprType) String() string {
 		return "ExprStar"
 	case ExprAggr:
 		return "ExprAggr"
+	case ExprNull:
+		return "ExprNull"
 	default:
 		return "Unknown"
 	}
@@ -119,11 +131,31 @@ func (op BoolOp) String() string {
 		return "<"
 	case OpLike:
 		return " LIKE "
+	case OpIsNull:
+		return " IS NULL"
+	case OpIsNotNull:
+		return " IS NOT NULL"
 	default:
 		return "??"
 	}
 }
 
+// Return the operator that compares b with a as op compares a with b, e.g.,
+// > for <.
+func (op BoolOp) mirrored() BoolOp {
+	switch op {
+	case OpGt:
+		return OpLt
+	case OpLt:
+		return OpGt
+	case OpGe:
+		return OpLe
+	case OpLe:
+		return OpGe
+	}
+	return op
+}
+
 func (s *LogicalJoinNode) String() string {
 	return fmt.Sprintf("%v%v%v", s.left, s.predOp, s.right)
 }
@@ -182,7 +214,7 @@ func checkNameInTablesOrSubqueries(table string, field string, c *Catalog, subqu
 // If catalog is non null, will try to resolve table name from catalog
 // otherwise, will not.
 func (lsn *LogicalSelectNode) getTableField(c *Catalog, subqueries []*LogicalPlan, ts []*LogicalTableNode) (string, string, error) {
-	if lsn.exprType == ExprConst {
+	if lsn.exprType == ExprConst || lsn.exprType == ExprNull {
 		return "", "", nil
 	}
 	if lsn.exprType == ExprFunc || lsn.exprType == ExprAggr {
@@ -295,9 +327,31 @@ func parseWhere(c *Catalog, subqueries []*LogicalPlan, ts []*LogicalTableNode, e
 			}
 			return nil, []*LogicalJoinNode{{left, right, op}}, nil
 		} else {
+			// filters compare a field with a constant on the right, which is
+			// converted to the type of the field
+			if left.exprType == ExprConst && right.exprType != ExprConst && op != OpLike {
+				left, right, op = right, left, op.mirrored()
+			}
 			return []*LogicalFilterNode{{*left, *right, op}}, nil, nil
 		}
 
+	case *sqlparser.IsExpr:
+		// IS NULL / IS NOT NULL become filters whose right hand side is NULL
+		var op BoolOp
+		switch expr.Operator {
+		case sqlparser.IsNullStr:
+			op = OpIsNull
+		case sqlparser.IsNotNullStr:
+			op = OpIsNotNull
+		default:
+			return nil, nil, GoDBError{ParseError, fmt.Sprintf("unsupported predicate IS %s", strings.ToUpper(expr.Operator))}
+		}
+		left, err := parseExpr(c, expr.Expr, "")
+		if err != nil {
+			return nil, nil, err
+		}
+		return []*LogicalFilterNode{{*left, NewNullSelectNode(""), op}}, nil, nil
+
 	default:
 		return nil, nil, GoDBError{ParseError, "where expression with non value or column on RHS (disjunctions and nested where expressions are not supported)"}
 	}
@@ -451,6 +505,17 @@ func parseExpr(c *Catalog, expr sqlparser.Expr, alias string) (*LogicalSelectNod
 		}
 		field := NewConstSelectNode(str, alias)
 		return &field, nil
+	case *sqlparser.NullVal:
+		field := NewNullSelectNode(alias)
+		return &field, nil
+	case *sqlparser.IntervalExpr:
+		// INTERVAL 1 DAY, represented as a call to the interval function
+		// on the string "1 day"
+		quantity := sqlparser.String(expr.Expr)
+		quantity = strings.Trim(quantity, "'")
+		value := NewConstSelectNode(quantity+" "+strings.ToLower(expr.Unit), "")
+		field := NewFuncSelectNode("interval", []*LogicalSelectNode{&value}, alias)
+		return &field, nil
 	default:
 		return nil, GoDBError{ParseError, fmt.Sprintf("unsupported expression type %s in select list", reflect.TypeOf(expr))}
 	}
@@ -622,6 +687,12 @@ func fieldNameToField(table string, field string, node *PlanNode) (FieldType, er
 	return FieldType{}, GoDBError{ParseError, fmt.Sprintf("no field in catalog matching '%s'", field)}
 }
 
+// Returns true if s is written as a floating point number, e.g., 1.5 or 2e10.
+// Used to avoid treating strings like 'inf' or 'nan' as floats.
+func isFloatLiteral(s string) bool {
+	return s != "" && strings.Trim(s, "0123456789.eE+-") == ""
+}
+
 type PlanNode struct {
 	op   *OperatorCard
 	desc *TupleDesc
@@ -688,6 +759,9 @@ func (s *LogicalSelectNode) generateExpr(c *Catalog, inputDesc *TupleDesc, table
 		if e == nil {
 			constType = IntType
 			fval = IntField{int64(intFval)}
+		} else if floatFval, e := strconv.ParseFloat(s.value, 64); e == nil && isFloatLiteral(s.value) {
+			constType = FloatType
+			fval = FloatField{floatFval}
 		} else {
 			fval = StringField{s.value}
 		}
@@ -697,6 +771,13 @@ func (s *LogicalSelectNode) generateExpr(c *Catalog, inputDesc *TupleDesc, table
 		}
 		ce := ConstExpr{fval, constType}
 		return &ce, fieldName, nil
+	case ExprNull:
+		fieldName := s.value
+		if s.alias != "" {
+			fieldName = s.alias
+		}
+		ce := ConstExpr{NullField{}, UnknownType}
+		return &ce, fieldName, nil
 	case ExprFunc:
 		fieldName := *s.funcOp
 		if s.alias != "" {
@@ -757,7 +838,10 @@ func opToStr(op BoolOp) string {
 		return "<"
 	case OpLike:
 		return " LIKE "
-
+	case OpIsNull:
+		return " IS NULL"
+	case OpIsNotNull:
+		return " IS NOT NULL"
 	}
 	return "??"
 }
@@ -793,6 +877,14 @@ func OutputPhysicalPlan(printf func(format string, a ...any), o Operator, indent
 	case *HeapFile:
 		printf("%sHeap Scan %s, card:%d\n", indent, op.BackingFile(), oc.Cardinality)
 
+	case *IndexJoin:
+		printf("%sIndex Join using %s, %s == %s, card:%d\n", indent, op.index.BackingFile(), exprToStr(op.outerField), op.index.keyField().Fname, oc.Cardinality)
+		indent = indent + "\t"
+		OutputPhysicalPlan(printf, op.outer, indent)
+		printf("%sHeap Scan %s using %s\n", indent, op.inner.BackingFile(), op.index.BackingFile())
+	case *IndexScan:
+		printf("%sIndex Scan %s using %s, %s %s %v, card:%d\n", indent, op.file.BackingFile(), op.index.BackingFile(), op.index.keyField().Fname, opToStr(op.op), op.value, oc.Cardinality)
+
 	case *OrderBy:
 		orderStr := ""
 		if len(op.orderBy) > 0 {
@@ -876,6 +968,78 @@ func (s *DummyStats) EstimateSelectivity(field string, op BoolOp, val DBValue) (
 	return 1.0, nil
 }
 
+// Return the indexes on a field of a table file.
+func indexesOn(file DBFile, field string) []Index {
+	hf, ok := file.(*HeapFile)
+	if !ok {
+		return nil
+	}
+	var indexes []Index
+	for _, idx := range hf.getIndexes() {
+		if idx.keyField().Fname == field {
+			indexes = append(indexes, idx)
+		}
+	}
+	return indexes
+}
+
+// Return an index scan of file for the predicate "field op value", using the
+// cheapest index on field that supports op, if its estimated cost is less than
+// the cost of scanning the table. Returns nil if the table should be scanned
+// and filtered instead.
+func chooseIndexScan(file DBFile, field string, op BoolOp, value DBValue, stats Stats, selectivity float64) (*IndexScan, error) {
+	if stats == nil {
+		return nil, nil
+	}
+	var best Index
+	bestCost := stats.EstimateScanCost()
+	for _, idx := range indexesOn(file, field) {
+		if !idx.supportsOp(op) {
+			continue
+		}
+		if cost := estimateIndexScanCost(idx, stats, selectivity); cost < bestCost {
+			best, bestCost = idx, cost
+		}
+	}
+	if best == nil {
+		return nil, nil
+	}
+	return NewIndexScan(file.(*HeapFile), best, op, value)
+}
+
+// Return an index nested-loop join that probes the cheapest index on a field
+// of the inner table for each tuple of outer, and its estimated cost, if that
+// cost is less than the cost of scanning the inner table for a hash join. The
+// inner operator must be a scan of the inner table, without filters. Returns
+// nil if a hash join should be used instead.
+func chooseIndexJoin(outer *OperatorCard, outerExpr Expr, inner *OperatorCard, innerFile DBFile, innerField string, innerStats Stats, innerLeft bool) (*IndexJoin, float64, error) {
+	if innerFile == nil || inner.Op != innerFile || innerStats == nil {
+		return nil, 0, nil
+	}
+	// the fraction of the inner table that each probe finds
+	var selectivity float64
+	if ds, ok := innerStats.(distinctStats); ok {
+		selectivity = 1.0 / float64(ds.EstimateDistinct(innerField))
+	} else if outer.Cardinality > 0 && inner.Cardinality > 0 {
+		selectivity = float64(EstimateJoinCardinality(outer.Cardinality, inner.Cardinality)) / float64(outer.Cardinality) / float64(inner.Cardinality)
+	}
+	var best Index
+	bestCost := innerStats.EstimateScanCost()
+	for _, idx := range indexesOn(innerFile, innerField) {
+		if !idx.supportsOp(OpEq) {
+			continue
+		}
+		if cost := float64(outer.Cardinality) * estimateIndexScanCost(idx, innerStats, selectivity); cost < bestCost {
+			best, bestCost = idx, cost
+		}
+	}
+	if best == nil {
+		return nil, 0, nil
+	}
+	join, err := NewIndexJoin(outer, outerExpr, innerFile.(*HeapFile), best, innerLeft)
+	return join, bestCost, err
+}
+
 type TableAndField struct {
 	table string
 	field string
@@ -885,6 +1049,7 @@ func makePhysicalPlan(c *Catalog, plan *LogicalPlan) (*OperatorCard, error) {
 	tableMap := make(map[string]*PlanNode) // mapping from table aliases to operators
 	tableStats := make(map[string]Stats)   // mapping from table aliases to table stats
 	sel := make(map[string]float64)        // mapping from table aliases to selectivities
+	baseFiles := make(map[string]DBFile)   // mapping from table aliases to their files
 
 	for _, p := range plan.subqueries {
 		subPhysP, err := makePhysicalPlan(c, p)
@@ -899,10 +1064,10 @@ func makePhysicalPlan(c *Catalog, plan *LogicalPlan) (*OperatorCard, error) {
 	}
 
 	for _, t := range plan.tables {
-		var stats Stats
-		stats = c.GetTableStats(t.tableName)
-		if stats == nil {
-			stats = &DummyStats{}
+		var stats Stats = &DummyStats{}
+		// tables created since stats were last computed have no stats
+		if tableStats := c.GetTableStats(t.tableName); tableStats != nil {
+			stats = tableStats
 		}
 
 		name := t.tableName
@@ -920,10 +1085,28 @@ func makePhysicalPlan(c *Catalog, plan *LogicalPlan) (*OperatorCard, error) {
 		}
 		tableMap[name] = &PlanNode{NewOperatorCard(*t.file, card), td}
 		sel[name] = 1.0
+		baseFiles[name] = *t.file
 	}
 
-	//now apply each filter to appropriate table
+	// apply the filters on indexed fields first, so that an index scan can
+	// replace the scan of their table
+	filters := make([]*LogicalFilterNode, 0, len(plan.filters))
+	var unindexedFilters []*LogicalFilterNode
 	for _, f := range plan.filters {
+		tabName, fieldName, err := f.fieldExpr.getTableField(c, plan.subqueries, plan.tables)
+		if err != nil {
+			return nil, err
+		}
+		if len(indexesOn(baseFiles[tabName], fieldName)) > 0 {
+			filters = append(filters, f)
+		} else {
+			unindexedFilters = append(unindexedFilters, f)
+		}
+	}
+	filters = append(filters, unindexedFilters...)
+
+	//now apply each filter to appropriate table
+	for _, f := range filters {
 		tabName, fieldName, err := f.fieldExpr.getTableField(c, plan.subqueries, plan.tables)
 		if err != nil {
 			return nil, err
@@ -940,6 +1123,10 @@ func makePhysicalPlan(c *Catalog, plan *LogicalPlan) (*OperatorCard, error) {
 		if err != nil {
 			return nil, err
 		}
+		rightExpr, err = coerceConstExpr(rightExpr, leftExpr.GetExprType().Ftype)
+		if err != nil {
+			return nil, err
+		}
 
 		op := node.op
 		desc := *op.Descriptor()
@@ -960,9 +1147,22 @@ func makePhysicalPlan(c *Catalog, plan *LogicalPlan) (*OperatorCard, error) {
 		}
 		sel[table] *= filterSel
 
-		newOp, err := NewFilter(rightExpr, f.predOp, leftExpr, op)
-		if err != nil {
-			return nil, err
+		// use an index instead of scanning the table, if one is cheaper
+		var newOp Operator
+		if file := baseFiles[table]; file != nil && op.Op == file && constExpr != nil {
+			indexScan, err := chooseIndexScan(file, field, f.predOp, constExpr.val, table_stats, filterSel)
+			if err != nil {
+				return nil, err
+			}
+			if indexScan != nil {
+				newOp = indexScan
+			}
+		}
+		if newOp == nil {
+			newOp, err = NewFilter(rightExpr, f.predOp, leftExpr, op)
+			if err != nil {
+				return nil, err
+			}
 		}
 
 		tableMap[table] = &PlanNode{NewOperatorCard(newOp, int(float64(op.Cardinality)*filterSel)), &desc}
@@ -1055,10 +1255,29 @@ func makePhysicalPlan(c *Catalog, plan *LogicalPlan) (*OperatorCard, error) {
 			return nil, err
 		}
 
-		newOp, err := NewJoin(op1, leftExpr, op2, rightExpr, JoinBufferSize)
+		// probe an index on one side of the join for each tuple of the other
+		// side, if that is cheaper than scanning it for a hash join
+		var newOp Operator
+		rightJoin, rightCost, err := chooseIndexJoin(op1, leftExpr, op2, baseFiles[rTabName], rFieldName, tableStats[rTabName], false)
+		if err != nil {
+			return nil, err
+		}
+		leftJoin, leftCost, err := chooseIndexJoin(op2, rightExpr, op1, baseFiles[lTabName], lFieldName, tableStats[lTabName], true)
 		if err != nil {
 			return nil, err
 		}
+		if rightJoin != nil && (leftJoin == nil || rightCost <= leftCost) {
+			newOp = rightJoin
+		} else if leftJoin != nil {
+			newOp = leftJoin
+		} else {
+			join, err := NewJoin(op1, leftExpr, op2, rightExpr, JoinBufferSize)
+			if err != nil {
+				return nil, err
+			}
+			join.memory = c.memoryManager()
+			newOp = join
+		}
 
 		newNode := &PlanNode{NewOperatorCard(newOp, EstimateJoinCardinality(node1.op.Cardinality, node2.op.Cardinality)), newOp.Descriptor()}
 		for key, node := range tableMap {
@@ -1135,6 +1354,11 @@ func makePhysicalPlan(c *Catalog, plan *LogicalPlan) (*OperatorCard, error) {
 				if err != nil {
 					return nil, err
 				}
+				// COUNT(*) counts every tuple, whereas COUNT(field) skips
+				// NULLs, so count a non-NULL constant instead of a field
+				if *s.funcOp == "count" && s.args[0].field == "*" {
+					aggExpr = &ConstExpr{IntField{1}, IntType}
+				}
 
 				switch *s.funcOp {
 				case "max":
@@ -1183,7 +1407,9 @@ func makePhysicalPlan(c *Catalog, plan *LogicalPlan) (*OperatorCard, error) {
 		if len(gbys) == 0 {
 			topOp = NewOperatorCard(NewAggregator(aggs, topOp), 1)
 		} else {
-			topOp = NewOperatorCard(NewGroupedAggregator(aggs, gbys, topOp), 0)
+			agg := NewGroupedAggregator(aggs, gbys, topOp)
+			agg.memory = c.memoryManager()
+			topOp = NewOperatorCard(agg, 0)
 		}
 	}
 
@@ -1208,6 +1434,7 @@ func makePhysicalPlan(c *Catalog, plan *LogicalPlan) (*OperatorCard, error) {
 		if err != nil {
 			return nil, err
 		}
+		projOp.(*Project).memory = c.memoryManager()
 		topOp = NewOperatorCard(projOp, topOp.Cardinality)
 	}
 
@@ -1228,6 +1455,7 @@ func makePhysicalPlan(c *Catalog, plan *LogicalPlan) (*OperatorCard, error) {
 		if err != nil {
 			return nil, err
 		}
+		orderOp.memory = c.memoryManager()
 		topOp = NewOperatorCard(orderOp, topOp.Cardinality)
 	}
 
@@ -1341,6 +1569,10 @@ func parseDelete(c *Catalog, delStmt *sqlparser.Delete) (Operator, error) {
 		if err != nil {
 			return nil, err
 		}
+		rightExpr, err = coerceConstExpr(rightExpr, leftExpr.GetExprType().Ftype)
+		if err != nil {
+			return nil, err
+		}
 
 		//op := node.op
 		//dbField, _ := fieldNameToField(f.table, f.field, &PlanNode{op, &desc})
@@ -1364,9 +1596,67 @@ const (
 	AbortXactionType     QueryType = iota
 	CreateTableQueryType QueryType = iota
 	DropTableQueryType   QueryType = iota
-	UnknownQueryType     QueryType = iota
+	CreateIndexQueryType QueryType = iota
+	DropIndexQueryType   QueryType = iota
+	// SET TRANSACTION ISOLATION LEVEL, for the transactions begun after it
+	// (see [IsolationLevel])
+	SetReadCommittedType  QueryType = iota
+	SetRepeatableReadType QueryType = iota
+	SetSerializableType   QueryType = iota
+	// SAVEPOINT, ROLLBACK TO SAVEPOINT, and RELEASE SAVEPOINT, whose plan is
+	// a [SavepointPlan] that names the savepoint
+	SavepointQueryType           QueryType = iota
+	RollbackToSavepointQueryType QueryType = iota
+	ReleaseSavepointQueryType    QueryType = iota
+	// START TRANSACTION WITH CONSISTENT SNAPSHOT, which begins a transaction
+	// that reads a snapshot (see [BufferPool.BeginSnapshotTransaction])
+	BeginSnapshotXactionType QueryType = iota
+	// BEGIN ISOLATION LEVEL, which begins a transaction with that level
+	BeginReadCommittedXactionType  QueryType = iota
+	BeginRepeatableReadXactionType QueryType = iota
+	BeginSerializableXactionType   QueryType = iota
+	UnknownQueryType               QueryType = iota
 )
 
+// DDL actions for CREATE INDEX and DROP INDEX statements, which are
+// recognized by [parseIndexDDL].
+const (
+	createIndexAction = "create index"
+	dropIndexAction   = "drop index"
+)
+
+var createIndexRegexp = regexp.MustCompile(`(?i)^\s*create\s+index\s+(\w+)\s+on\s+(\w+)\s*\(\s*(\w+)\s*\)(?:\s+using\s+(\w+))?\s*;?\s*$`)
+var dropIndexRegexp = regexp.MustCompile(`(?i)^\s*drop\s+index\s+(\w+)(?:\s+on\s+(\w+))?\s*;?\s*$`)
+
+// sqlparser doesn't keep the name or the columns of CREATE INDEX and DROP
+// INDEX statements, so they are recognized here instead, and returned as the
+// equivalent DDL for processDDL. The index name and type are stored in the
+// VindexSpec of the DDL, and the indexed column in its VindexCols.
+//
+// Returns nil if the query isn't an index statement.
+func parseIndexDDL(query string) *sqlparser.DDL {
+	if m := createIndexRegexp.FindStringSubmatch(query); m != nil {
+		kind := strings.ToLower(m[4])
+		if kind == "" {
+			kind = "btree"
+		}
+		return &sqlparser.DDL{
+			Action:     createIndexAction,
+			Table:      sqlparser.TableName{Name: sqlparser.NewTableIdent(m[2])},
+			VindexSpec: &sqlparser.VindexSpec{Name: sqlparser.NewColIdent(strings.ToLower(m[1])), Type: sqlparser.NewColIdent(kind)},
+			VindexCols: []sqlparser.ColIdent{sqlparser.NewColIdent(m[3])},
+		}
+	}
+	if m := dropIndexRegexp.FindStringSubmatch(query); m != nil {
+		return &sqlparser.DDL{
+			Action:     dropIndexAction,
+			Table:      sqlparser.TableName{Name: sqlparser.NewTableIdent(m[2])},
+			VindexSpec: &sqlparser.VindexSpec{Name: sqlparser.NewColIdent(strings.ToLower(m[1]))},
+		}
+	}
+	return nil
+}
+
 func processDDL(c *Catalog, ddl *sqlparser.DDL) (QueryType, error) {
 	switch ddl.Action {
 	case "create":
@@ -1388,6 +1678,41 @@ func processDDL(c *Catalog, ddl *sqlparser.DDL) (QueryType, error) {
 				fallthrough
 			case "varchar":
 				colType = StringType
+			case "float":
+				fallthrough
+			case "double":
+				fallthrough
+			case "real":
+				colType = FloatType
+			case "date":
+				colType = DateType
+			case "timestamp":
+				fallthrough
+			case "datetime":
+				colType = TimestampType
+			case "decimal":
+				fallthrough
+			case "numeric":
+				var err error
+				precision, scale := defaultDecimalPrecision, 0
+				if col.Type.Length != nil {
+					precision, err = strconv.Atoi(string(col.Type.Length.Val))
+					if err != nil {
+						return UnknownQueryType, GoDBError{ParseError, fmt.Sprintf("invalid decimal precision %s", col.Type.Length.Val)}
+					}
+				}
+				if col.Type.Scale != nil {
+					scale, err = strconv.Atoi(string(col.Type.Scale.Val))
+					if err != nil {
+						return UnknownQueryType, GoDBError{ParseError, fmt.Sprintf("invalid decimal scale %s", col.Type.Scale.Val)}
+					}
+				}
+				colType, err = newDecimalType(precision, scale)
+				if err != nil {
+					return UnknownQueryType, err
+				}
+			// sqlparser doesn't accept interval columns in CREATE TABLE,
+			// but they can be declared in the catalog file
 			default:
 				return UnknownQueryType, GoDBError{ParseError, fmt.Sprintf("unsupported column type %s", col.Type.Type)}
 
@@ -1408,12 +1733,128 @@ func processDDL(c *Catalog, ddl *sqlparser.DDL) (QueryType, error) {
 			return UnknownQueryType, err
 		}
 		return DropTableQueryType, nil
+
+	case createIndexAction:
+		tabName := sqlparser.String(ddl.Table.Name)
+		err := c.createIndex(ddl.VindexSpec.Name.String(), tabName, ddl.VindexCols[0].String(), ddl.VindexSpec.Type.String())
+		if err != nil {
+			return UnknownQueryType, err
+		}
+		return CreateIndexQueryType, nil
+
+	case dropIndexAction:
+		tabName := sqlparser.String(ddl.Table.Name)
+		err := c.dropIndex(ddl.VindexSpec.Name.String(), tabName)
+		if err != nil {
+			return UnknownQueryType, err
+		}
+		return DropIndexQueryType, nil
 	default:
 		return UnknownQueryType, GoDBError{ParseError, fmt.Sprintf("unsupported ddl statement %s", ddl.Action)}
 	}
 }
 
+var savepointRegexp = regexp.MustCompile(`(?i)^\s*savepoint\s+(\w+)\s*;?\s*$`)
+var rollbackToSavepointRegexp = regexp.MustCompile(`(?i)^\s*rollback\s+(?:work\s+)?to\s+(?:savepoint\s+)?(\w+)\s*;?\s*$`)
+var releaseSavepointRegexp = regexp.MustCompile(`(?i)^\s*release\s+savepoint\s+(\w+)\s*;?\s*$`)
+
+// The plan that [Parse] returns for a SAVEPOINT, ROLLBACK TO SAVEPOINT, or
+// RELEASE SAVEPOINT statement. Savepoint names are case-insensitive, and Name
+// is in lower case. The plan produces no tuples; the caller sets, rolls back
+// to, or releases the savepoint of its transaction.
+type SavepointPlan struct {
+	Name string
+}
+
+func (p *SavepointPlan) Descriptor() *TupleDesc {
+	return &TupleDesc{}
+}
+
+func (p *SavepointPlan) Iterator(tid TransactionID) (func() (*Tuple, error), error) {
+	return func() (*Tuple, error) { return nil, nil }, nil
+}
+
+// sqlparser doesn't support SAVEPOINT, ROLLBACK TO SAVEPOINT, or RELEASE
+// SAVEPOINT statements, so they are recognized here instead.
+//
+// Returns UnknownQueryType if the query isn't a savepoint statement.
+func parseSavepoint(query string) (QueryType, *SavepointPlan) {
+	if m := savepointRegexp.FindStringSubmatch(query); m != nil {
+		return SavepointQueryType, &SavepointPlan{strings.ToLower(m[1])}
+	}
+	if m := rollbackToSavepointRegexp.FindStringSubmatch(query); m != nil {
+		return RollbackToSavepointQueryType, &SavepointPlan{strings.ToLower(m[1])}
+	}
+	if m := releaseSavepointRegexp.FindStringSubmatch(query); m != nil {
+		return ReleaseSavepointQueryType, &SavepointPlan{strings.ToLower(m[1])}
+	}
+	return UnknownQueryType, nil
+}
+
+var beginSnapshotRegexp = regexp.MustCompile(`(?i)^\s*start\s+transaction\s+with\s+consistent\s+snapshot\s*;?\s*$`)
+
+// sqlparser doesn't support START TRANSACTION WITH CONSISTENT SNAPSHOT, so it
+// is recognized here instead. Returns true if the query is one.
+func parseBeginSnapshot(query string) bool {
+	return beginSnapshotRegexp.MatchString(query)
+}
+
+var beginIsolationRegexp = regexp.MustCompile(`(?i)^\s*(?:begin(?:\s+(?:work|transaction))?|start\s+transaction)\s+isolation\s+level\s+(read\s+committed|repeatable\s+read|serializable)\s*;?\s*$`)
+
+// sqlparser doesn't support BEGIN or START TRANSACTION with an isolation
+// level, so they are recognized here instead.
+//
+// Returns UnknownQueryType if the query isn't one.
+func parseBeginIsolation(query string) QueryType {
+	m := beginIsolationRegexp.FindStringSubmatch(query)
+	if m == nil {
+		return UnknownQueryType
+	}
+	switch strings.ToLower(strings.Join(strings.Fields(m[1]), " ")) {
+	case "read committed":
+		return BeginReadCommittedXactionType
+	case "repeatable read":
+		return BeginRepeatableReadXactionType
+	}
+	return BeginSerializableXactionType
+}
+
+// sqlparser parses SET TRANSACTION ISOLATION LEVEL as the assignment of the
+// level, in lower case, to tx_isolation. Other SET statements aren't
+// supported.
+func parseSetIsolation(stmt *sqlparser.Set) (QueryType, error) {
+	if len(stmt.Exprs) != 1 || !stmt.Exprs[0].Name.EqualString("tx_isolation") {
+		return UnknownQueryType, GoDBError{ParseError, "only SET TRANSACTION ISOLATION LEVEL is supported"}
+	}
+	level := strings.Trim(sqlparser.String(stmt.Exprs[0].Expr), "'")
+	switch level {
+	case "read committed":
+		return SetReadCommittedType, nil
+	case "repeatable read":
+		return SetRepeatableReadType, nil
+	case "serializable":
+		return SetSerializableType, nil
+	}
+	return UnknownQueryType, GoDBError{ParseError, fmt.Sprintf("unsupported isolation level %s", strings.ToUpper(level))}
+}
+
 func Parse(c *Catalog, query string) (QueryType, Operator, error) {
+	if qtype, plan := parseSavepoint(query); qtype != UnknownQueryType {
+		return qtype, plan, nil
+	}
+	if parseBeginSnapshot(query) {
+		return BeginSnapshotXactionType, nil, nil
+	}
+	if qtype := parseBeginIsolation(query); qtype != UnknownQueryType {
+		return qtype, nil, nil
+	}
+	if ddl := parseIndexDDL(query); ddl != nil {
+		qtype, err := processDDL(c, ddl)
+		if err != nil {
+			return UnknownQueryType, nil, err
+		}
+		return qtype, nil, nil
+	}
 	stmt, err := sqlparser.Parse(query)
 	if err != nil {
 		return UnknownQueryType, nil, err
@@ -1449,6 +1890,12 @@ func Parse(c *Catalog, query string) (QueryType, Operator, error) {
 		return CommitXactionType, nil, nil
 	case *sqlparser.Rollback:
 		return AbortXactionType, nil, nil
+	case *sqlparser.Set:
+		qtype, err := parseSetIsolation(stmt)
+		if err != nil {
+			return UnknownQueryType, nil, err
+		}
+		return qtype, nil, nil
 	case *sqlparser.DDL:
 		qtype, err := processDDL(c, stmt)
 		if err != nil {
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"os"
+	"strings"
 	"testing"
 	"text/tabwriter"
 	"time"
@@ -15,14 +16,21 @@ func MakeTestDatabase(bufferPoolSize int, catalog string) (*BufferPool, *Catalog
 		return nil, nil, err
 	}
 
-	// load the catalog so we know which tables to remove
-	c := NewCatalog(catalog, bp, "./")
-	if err := c.parseCatalogFile(); err != nil {
+	// read the names of the tables to remove from the catalog; the tables
+	// aren't opened, since their files may have been created with other
+	// fields
+	contents, err := os.ReadFile(catalog)
+	if err != nil {
 		return nil, nil, err
 	}
-
-	for tableName := range c.tableMap {
-		os.Remove(c.tableNameToFile(tableName))
+	c := NewCatalog(catalog, bp, "./")
+	for _, line := range strings.Split(strings.ToLower(string(contents)), "\n") {
+		if catalogIndexRegexp.MatchString(line) {
+			continue
+		}
+		if tableName, _, ok := strings.Cut(line, "("); ok {
+			os.Remove(c.tableNameToFile(strings.TrimSpace(tableName)))
+		}
 	}
 
 	// reload the catalog to reopen the table files
@@ -309,3 +317,529 @@ func TestParse(t *testing.T) {
 		}
 	}
 }
+
+func TestParseNull(t *testing.T) {
+	bp, c, err := MakeParserTestDatabase(10)
+	if err != nil {
+		t.Fatalf("failed to create test database, %s", err.Error())
+	}
+
+	tid := BeginTransactionForTest(t, bp)
+	_, plan, err := Parse(c, "insert into t values ('nobody', null)")
+	if err != nil {
+		t.Fatalf("failed to parse insert, %s", err.Error())
+	}
+	iter, err := plan.Iterator(tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if _, err := iter(); err != nil {
+		t.Fatalf(err.Error())
+	}
+	bp.CommitTransaction(tid)
+
+	// number of tuples loaded from testdb.txt, none of which are NULL
+	tid = BeginTransactionForTest(t, bp)
+	_, plan, err = Parse(c, "select count(*) from t2")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	iter, err = plan.Iterator(tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	tup, err := iter()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	bp.CommitTransaction(tid)
+	nonNull := tup.Fields[0].(IntField).Value
+
+	queries := []struct {
+		sql      string
+		expected int64
+	}{
+		{"select count(*) from t where age is null", 1},
+		{"select count(*) from t where t.age is not null", nonNull},
+		{"select count(age) from t", nonNull},
+		{"select count(*) from t", nonNull + 1},
+	}
+
+	for _, q := range queries {
+		tid := BeginTransactionForTest(t, bp)
+		_, plan, err := Parse(c, q.sql)
+		if err != nil {
+			t.Fatalf("failed to parse %s, %s", q.sql, err.Error())
+		}
+		iter, err := plan.Iterator(tid)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		tup, err := iter()
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if tup == nil || tup.Fields[0].(IntField).Value != q.expected {
+			t.Errorf("%s returned %v, expected %d", q.sql, tup, q.expected)
+		}
+		bp.CommitTransaction(tid)
+	}
+}
+
+// Run a query in its own transaction, returning all of its result tuples.
+func runQueryForTest(t *testing.T, bp *BufferPool, c *Catalog, sql string) []*Tuple {
+	t.Helper()
+	tid := BeginTransactionForTest(t, bp)
+	defer bp.CommitTransaction(tid)
+	_, plan, err := Parse(c, sql)
+	if err != nil {
+		t.Fatalf("failed to parse %s, %s", sql, err.Error())
+	}
+	if plan == nil {
+		return nil
+	}
+	iter, err := plan.Iterator(tid)
+	if err != nil {
+		t.Fatalf("failed to get iterator for %s, %s", sql, err.Error())
+	}
+	var tups []*Tuple
+	for {
+		tup, err := iter()
+		if err != nil {
+			t.Fatalf("failed to run %s, %s", sql, err.Error())
+		}
+		if tup == nil {
+			break
+		}
+		tups = append(tups, tup)
+	}
+	return tups
+}
+
+func TestParseDropAndRecreateTable(t *testing.T) {
+	bp, c, err := MakeParserTestDatabase(10)
+	if err != nil {
+		t.Fatalf("failed to create test database, %s", err.Error())
+	}
+	os.Remove(c.tableNameToFile("dropped"))
+	runQueryForTest(t, bp, c, "create table dropped (name varchar, age int)")
+	defer os.Remove(c.tableNameToFile("dropped"))
+	runQueryForTest(t, bp, c, "insert into dropped values ('a', 1), ('b', 2)")
+	// the pages of the table are both on disk and in the buffer pool
+	bp.FlushAllPages()
+
+	// re-created with the same fields, the table starts empty
+	runQueryForTest(t, bp, c, "drop table dropped")
+	runQueryForTest(t, bp, c, "create table dropped (name varchar, age int)")
+	if tups := runQueryForTest(t, bp, c, "select name from dropped"); len(tups) != 0 {
+		t.Errorf("expected the re-created table to be empty, got %v", tups)
+	}
+	runQueryForTest(t, bp, c, "insert into dropped values ('c', 3)")
+	if tups := runQueryForTest(t, bp, c, "select name from dropped"); len(tups) != 1 || tups[0].Fields[0] != (StringField{"c"}) {
+		t.Errorf("expected only c in the re-created table, got %v", tups)
+	}
+
+	// re-created with other fields, the header of the file has them
+	runQueryForTest(t, bp, c, "drop table dropped")
+	runQueryForTest(t, bp, c, "create table dropped (id int, score float)")
+	defer c.dropTable("dropped")
+	runQueryForTest(t, bp, c, "insert into dropped values (1, 2.5)")
+	tups := runQueryForTest(t, bp, c, "select id, score from dropped")
+	if len(tups) != 1 || tups[0].Fields[0] != (IntField{1}) || tups[0].Fields[1] != (FloatField{2.5}) {
+		t.Errorf("expected (1, 2.5) in the re-created table, got %v", tups)
+	}
+}
+
+func TestParseFloat(t *testing.T) {
+	bp, c, err := MakeParserTestDatabase(10)
+	if err != nil {
+		t.Fatalf("failed to create test database, %s", err.Error())
+	}
+	os.Remove(c.tableNameToFile("prices"))
+	runQueryForTest(t, bp, c, "create table prices (item varchar, price float, weight double, rating real)")
+	defer os.Remove(c.tableNameToFile("prices"))
+	defer c.dropTable("prices")
+	runQueryForTest(t, bp, c, "insert into prices values ('apple', 1.25, 0.5, 4), ('pear', 2.5, 1.5e1, 3.75), ('fig', 3, null, 1)")
+
+	tups := runQueryForTest(t, bp, c, "select item from prices where price > 1.25")
+	if len(tups) != 2 {
+		t.Errorf("expected 2 prices > 1.25, got %d", len(tups))
+	}
+	tups = runQueryForTest(t, bp, c, "select item from prices where price >= 3")
+	if len(tups) != 1 || tups[0].Fields[0] != (StringField{"fig"}) {
+		t.Errorf("expected fig to have price >= 3, got %v", tups)
+	}
+
+	tups = runQueryForTest(t, bp, c, "select sum(price), avg(price), max(weight), sum(price * 2) from prices")
+	expected := []DBValue{FloatField{6.75}, FloatField{2.25}, FloatField{15}, FloatField{13.5}}
+	if len(tups) != 1 {
+		t.Fatalf("expected one result, got %d", len(tups))
+	}
+	for i, v := range expected {
+		if tups[0].Fields[i] != v {
+			t.Errorf("expected %v in field %d, got %v", v, i, tups[0].Fields[i])
+		}
+	}
+
+	tups = runQueryForTest(t, bp, c, "select item, rating from prices order by rating")
+	if len(tups) != 3 || tups[0].Fields[0] != (StringField{"fig"}) || tups[2].Fields[0] != (StringField{"apple"}) {
+		t.Errorf("unexpected order by result %v", tups)
+	}
+}
+
+func TestParseDecimal(t *testing.T) {
+	bp, c, err := MakeParserTestDatabase(10)
+	if err != nil {
+		t.Fatalf("failed to create test database, %s", err.Error())
+	}
+	os.Remove(c.tableNameToFile("ledger"))
+	runQueryForTest(t, bp, c, "create table ledger (account varchar, amount decimal(10,2), qty int)")
+	defer os.Remove(c.tableNameToFile("ledger"))
+	defer c.dropTable("ledger")
+	runQueryForTest(t, bp, c, "insert into ledger values ('a', 0.1, 3), ('b', 0.2, 1), ('c', 19.995, 2), ('d', null, 5)")
+
+	tups := runQueryForTest(t, bp, c, "select account, amount from ledger where amount = 0.3")
+	if len(tups) != 0 {
+		t.Errorf("expected no amount of 0.3, got %v", tups)
+	}
+	tups = runQueryForTest(t, bp, c, "select amount from ledger where account = 'c'")
+	if len(tups) != 1 || tups[0].Fields[0] != (DecimalField{2000, 2}) {
+		t.Errorf("expected 19.995 to be rounded to 20.00, got %v", tups)
+	}
+	tups = runQueryForTest(t, bp, c, "select account from ledger where amount > 0.15")
+	if len(tups) != 2 {
+		t.Errorf("expected 2 amounts > 0.15, got %d", len(tups))
+	}
+
+	// unlike floats, sums of decimals are exact
+	tups = runQueryForTest(t, bp, c, "select sum(amount), avg(amount), sum(amount * qty), max(amount / qty) from ledger")
+	if len(tups) != 1 {
+		t.Fatalf("expected one result, got %d", len(tups))
+	}
+	expected := []string{"20.30", "6.766667", "40.50", "10.000000"}
+	for i, v := range expected {
+		if tups[0].Fields[i].(DecimalField).String() != v {
+			t.Errorf("expected %s in field %d, got %v", v, i, tups[0].Fields[i])
+		}
+	}
+	if tups[0].Desc.Fields[0].Ftype != decimalType(18, 2) {
+		t.Errorf("expected sum of decimal(10,2) to be decimal(18,2), got %s", tups[0].Desc.Fields[0].Ftype)
+	}
+	tups = runQueryForTest(t, bp, c, "select account, amount from ledger order by amount")
+	if len(tups) != 4 || tups[0].Fields[0] != (StringField{"a"}) || tups[2].Fields[0] != (StringField{"c"}) {
+		t.Errorf("unexpected order by result %v", tups)
+	}
+
+	tid := BeginTransactionForTest(t, bp)
+	defer bp.AbortTransaction(tid)
+	_, plan, err := Parse(c, "insert into ledger values ('e', 123456789.5, 1)")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	iter, err := plan.Iterator(tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if _, err := iter(); err == nil || err.(GoDBError).code != NumericOverflowError {
+		t.Errorf("expected inserting 123456789.5 into a decimal(10,2) to overflow, got %v", err)
+	}
+}
+
+func TestParseDateTime(t *testing.T) {
+	bp, c, err := MakeParserTestDatabase(10)
+	if err != nil {
+		t.Fatalf("failed to create test database, %s", err.Error())
+	}
+	os.Remove(c.tableNameToFile("events"))
+	runQueryForTest(t, bp, c, "create table events (name varchar, day date, ts timestamp)")
+	defer os.Remove(c.tableNameToFile("events"))
+	defer c.dropTable("events")
+	runQueryForTest(t, bp, c, "insert into events values ('a', '2025-12-31', '2025-12-31 23:59:59'), ('b', '2026-01-15', '2026-01-15 08:00:00'), ('c', '2026-01-20', '2026-01-20 17:45:00'), ('d', '2026-02-03', '2026-02-03 09:15:00')")
+
+	tups := runQueryForTest(t, bp, c, "select name from events where ts >= '2026-01-01'")
+	if len(tups) != 3 {
+		t.Errorf("expected 3 events in 2026, got %d", len(tups))
+	}
+	tups = runQueryForTest(t, bp, c, "select name from events where day < '2026-01-20'")
+	if len(tups) != 2 {
+		t.Errorf("expected 2 events before 2026-01-20, got %d", len(tups))
+	}
+	tups = runQueryForTest(t, bp, c, "select name from events where '2026-01-01' <= ts")
+	if len(tups) != 3 {
+		t.Errorf("expected 3 events in 2026 with the constant on the left, got %d", len(tups))
+	}
+	tups = runQueryForTest(t, bp, c, "select name from events where '2026-01-20' > day")
+	if len(tups) != 2 {
+		t.Errorf("expected 2 events before 2026-01-20 with the constant on the left, got %d", len(tups))
+	}
+
+	tups = runQueryForTest(t, bp, c, "select date_trunc('month', ts) month, count(*) from events group by date_trunc('month', ts)")
+	counts := make(map[string]int64)
+	for _, tup := range tups {
+		counts[tup.PrettyPrintString(false)] = tup.Fields[1].(IntField).Value
+	}
+	expected := map[string]int64{"2025-12-01 00:00:00,1": 1, "2026-01-01 00:00:00,2": 2, "2026-02-01 00:00:00,1": 1}
+	for k, v := range expected {
+		if counts[k] != v {
+			t.Errorf("expected group %s to have count %d, got %v", k, v, counts)
+		}
+	}
+
+	tups = runQueryForTest(t, bp, c, "select extract('year', day), extract('hour', ts), ts + interval 1 day, day + 30, ts - timestamp('2026-01-01') from events where name = 'c'")
+	if len(tups) != 1 {
+		t.Fatalf("expected one result, got %d", len(tups))
+	}
+	if got := tups[0].PrettyPrintString(false); got != "2026,17,2026-01-21 17:45:00,2026-02-19,19 days 17:45:00" {
+		t.Errorf("unexpected result of date expressions: %s", got)
+	}
+
+	tups = runQueryForTest(t, bp, c, "select name, ts from events order by ts desc")
+	if len(tups) != 4 || tups[0].Fields[0] != (StringField{"d"}) || tups[3].Fields[0] != (StringField{"a"}) {
+		t.Errorf("unexpected order by result %v", tups)
+	}
+
+	_, _, err = Parse(c, "select name from events where day = 'not a date'")
+	if err == nil {
+		t.Errorf("expected comparison with an invalid date literal to fail")
+	}
+}
+
+func TestParseIndex(t *testing.T) {
+	bp, c, err := MakeParserTestDatabase(500)
+	if err != nil {
+		t.Fatalf("failed to create test database, %s", err.Error())
+	}
+	os.Remove(c.tableNameToFile("people"))
+	os.Remove(c.indexNameToFile("people_age"))
+	runQueryForTest(t, bp, c, "create table people (name varchar, age int)")
+	defer os.Remove(c.tableNameToFile("people"))
+	defer os.Remove(c.indexNameToFile("people_age"))
+	defer c.dropTable("people")
+
+	values := make([]string, 2000)
+	for i := range values {
+		values[i] = fmt.Sprintf("('name%d', %d)", i, i%500)
+	}
+	runQueryForTest(t, bp, c, "insert into people values "+strings.Join(values, ", "))
+	if err := c.ComputeTableStats(); err != nil {
+		t.Fatalf(err.Error())
+	}
+	runQueryForTest(t, bp, c, "create index people_age on people (age)")
+
+	planFor := func(sql string) string {
+		_, plan, err := Parse(c, sql)
+		if err != nil {
+			t.Fatalf("failed to parse %s, %s", sql, err.Error())
+		}
+		var sb strings.Builder
+		OutputPhysicalPlan(func(format string, a ...any) { fmt.Fprintf(&sb, format, a...) }, plan, "")
+		return sb.String()
+	}
+	query := "select name from people where age = 7"
+	if plan := planFor(query); !strings.Contains(plan, "Index Scan") {
+		t.Errorf("expected a selective equality to use the index, got plan:\n%s", plan)
+	}
+	if tups := runQueryForTest(t, bp, c, query); len(tups) != 4 {
+		t.Errorf("expected 4 people of age 7, got %d", len(tups))
+	}
+	if plan := planFor("select name from people where age > 3"); strings.Contains(plan, "Index Scan") {
+		t.Errorf("expected an unselective range to scan the table, got plan:\n%s", plan)
+	}
+
+	// deletes through SQL remove the index entries
+	runQueryForTest(t, bp, c, "delete from people where age = 7")
+	if tups := runQueryForTest(t, bp, c, query); len(tups) != 0 {
+		t.Errorf("expected no people of age 7 after delete, got %d", len(tups))
+	}
+	if tups := runQueryForTest(t, bp, c, "select name from people where age = 8"); len(tups) != 4 {
+		t.Errorf("expected 4 people of age 8, got %d", len(tups))
+	}
+
+	if _, _, err := Parse(c, "create index people_age on people (name)"); err == nil {
+		t.Errorf("expected creating a duplicate index to fail")
+	}
+	runQueryForTest(t, bp, c, "drop index people_age")
+	if plan := planFor(query); strings.Contains(plan, "Index Scan") {
+		t.Errorf("expected a dropped index not to be used, got plan:\n%s", plan)
+	}
+}
+
+func TestParseIndexJoin(t *testing.T) {
+	bp, c, err := MakeParserTestDatabase(500)
+	if err != nil {
+		t.Fatalf("failed to create test database, %s", err.Error())
+	}
+	for _, name := range []string{"users", "orders"} {
+		os.Remove(c.tableNameToFile(name))
+		defer os.Remove(c.tableNameToFile(name))
+		defer c.dropTable(name)
+	}
+	os.Remove(c.indexNameToFile("users_id"))
+	defer os.Remove(c.indexNameToFile("users_id"))
+	runQueryForTest(t, bp, c, "create table users (id int, name varchar)")
+	runQueryForTest(t, bp, c, "create table orders (user_id int, amount int)")
+
+	values := make([]string, 5000)
+	for i := range values {
+		values[i] = fmt.Sprintf("(%d, '%s%d')", i, strings.Repeat("u", 50), i)
+	}
+	runQueryForTest(t, bp, c, "insert into users values "+strings.Join(values, ", "))
+	values = make([]string, 4000)
+	for i := range values {
+		values[i] = fmt.Sprintf("(%d, %d)", (i*37)%5000, i%1000)
+	}
+	runQueryForTest(t, bp, c, "insert into orders values "+strings.Join(values, ", "))
+	if err := c.ComputeTableStats(); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	planFor := func(sql string) string {
+		_, plan, err := Parse(c, sql)
+		if err != nil {
+			t.Fatalf("failed to parse %s, %s", sql, err.Error())
+		}
+		var sb strings.Builder
+		OutputPhysicalPlan(func(format string, a ...any) { fmt.Fprintf(&sb, format, a...) }, plan, "")
+		return sb.String()
+	}
+	join := "select u.name, o.amount from orders o, users u where o.amount = 5 and o.user_id = u.id"
+	expected := runQueryForTest(t, bp, c, join)
+	if len(expected) != 4 {
+		t.Fatalf("expected 4 results of the join, got %d", len(expected))
+	}
+
+	runQueryForTest(t, bp, c, "create index users_id on users (id) using hash")
+	if plan := planFor("select name from users where id = 42"); !strings.Contains(plan, "Index Scan") {
+		t.Errorf("expected an equality filter to use the hash index, got plan:\n%s", plan)
+	}
+	if plan := planFor("select name from users where id < 42"); strings.Contains(plan, "Index Scan") {
+		t.Errorf("expected a range filter not to use the hash index, got plan:\n%s", plan)
+	}
+	if tups := runQueryForTest(t, bp, c, "select name from users where id = 42"); len(tups) != 1 {
+		t.Errorf("expected 1 user with id 42, got %d", len(tups))
+	}
+
+	// a few orders are joined with users by probing the index, rather than
+	// scanning all the users
+	if plan := planFor(join); !strings.Contains(plan, "Index Join") {
+		t.Errorf("expected the join to use the index, got plan:\n%s", plan)
+	}
+	tups := runQueryForTest(t, bp, c, join)
+	if len(tups) != len(expected) {
+		t.Fatalf("expected %d results of the index join, got %d", len(expected), len(tups))
+	}
+	found := make(map[string]bool)
+	for _, tup := range expected {
+		found[tup.PrettyPrintString(false)] = true
+	}
+	for _, tup := range tups {
+		if !found[tup.PrettyPrintString(false)] {
+			t.Errorf("unexpected result of the index join %s", tup.PrettyPrintString(false))
+		}
+	}
+
+	// joining all the orders is cheaper with a hash join
+	if plan := planFor("select u.name, o.amount from orders o, users u where o.user_id = u.id"); strings.Contains(plan, "Index Join") {
+		t.Errorf("expected joining all orders not to use the index, got plan:\n%s", plan)
+	}
+}
+
+func TestParseSetIsolationLevel(t *testing.T) {
+	_, c, err := MakeParserTestDatabase(10)
+	if err != nil {
+		t.Fatalf("failed to create test database, %s", err.Error())
+	}
+	for sql, expected := range map[string]QueryType{
+		"begin": BeginXactionType,
+		"set transaction isolation level read committed":       SetReadCommittedType,
+		"SET TRANSACTION ISOLATION LEVEL REPEATABLE READ":      SetRepeatableReadType,
+		"set session transaction isolation level serializable": SetSerializableType,
+	} {
+		qtype, op, err := Parse(c, sql)
+		if err != nil {
+			t.Errorf("failed to parse %s, %s", sql, err.Error())
+		} else if qtype != expected || op != nil {
+			t.Errorf("expected %s to be query type %d, got %d", sql, expected, qtype)
+		}
+	}
+	for _, sql := range []string{"set transaction isolation level read uncommitted", "set autocommit = 1"} {
+		if _, _, err := Parse(c, sql); err == nil {
+			t.Errorf("expected %s to fail", sql)
+		}
+	}
+}
+
+func TestParseBeginIsolationLevel(t *testing.T) {
+	_, c, err := MakeParserTestDatabase(10)
+	if err != nil {
+		t.Fatalf("failed to create test database, %s", err.Error())
+	}
+	for sql, expected := range map[string]QueryType{
+		"begin isolation level read committed":               BeginReadCommittedXactionType,
+		"BEGIN TRANSACTION ISOLATION LEVEL REPEATABLE READ;": BeginRepeatableReadXactionType,
+		"start transaction isolation level  serializable":    BeginSerializableXactionType,
+		"begin work isolation level read committed":          BeginReadCommittedXactionType,
+	} {
+		qtype, op, err := Parse(c, sql)
+		if err != nil {
+			t.Errorf("failed to parse %s, %s", sql, err.Error())
+		} else if qtype != expected || op != nil {
+			t.Errorf("expected %s to be query type %d, got %d", sql, expected, qtype)
+		}
+	}
+	if _, _, err := Parse(c, "begin isolation level read uncommitted"); err == nil {
+		t.Errorf("expected begin isolation level read uncommitted to fail")
+	}
+}
+
+func TestParseBeginSnapshot(t *testing.T) {
+	_, c, err := MakeParserTestDatabase(10)
+	if err != nil {
+		t.Fatalf("failed to create test database, %s", err.Error())
+	}
+	for sql, expected := range map[string]QueryType{
+		"start transaction with consistent snapshot":  BeginSnapshotXactionType,
+		"START TRANSACTION WITH CONSISTENT SNAPSHOT;": BeginSnapshotXactionType,
+		"start transaction":                           BeginXactionType,
+	} {
+		qtype, op, err := Parse(c, sql)
+		if err != nil {
+			t.Errorf("failed to parse %s, %s", sql, err.Error())
+		} else if qtype != expected || op != nil {
+			t.Errorf("expected %s to be query type %d, got %d", sql, expected, qtype)
+		}
+	}
+	if _, _, err := Parse(c, "start transaction with snapshot"); err == nil {
+		t.Errorf("expected start transaction with snapshot to fail")
+	}
+}
+
+func TestParseSavepoint(t *testing.T) {
+	_, c, err := MakeParserTestDatabase(10)
+	if err != nil {
+		t.Fatalf("failed to create test database, %s", err.Error())
+	}
+	for sql, expected := range map[string]QueryType{
+		"savepoint a":              SavepointQueryType,
+		"ROLLBACK TO SAVEPOINT A;": RollbackToSavepointQueryType,
+		"rollback work to a":       RollbackToSavepointQueryType,
+		"release savepoint a":      ReleaseSavepointQueryType,
+		"rollback":                 AbortXactionType,
+	} {
+		qtype, op, err := Parse(c, sql)
+		if err != nil {
+			t.Errorf("failed to parse %s, %s", sql, err.Error())
+			continue
+		}
+		if qtype != expected {
+			t.Errorf("expected %s to be query type %d, got %d", sql, expected, qtype)
+		}
+		if expected == AbortXactionType {
+			if op != nil {
+				t.Errorf("expected no plan for %s, got %v", sql, op)
+			}
+		} else if plan, ok := op.(*SavepointPlan); !ok || plan.Name != "a" {
+			t.Errorf("expected the plan of %s to be savepoint a, got %v", sql, op)
+		}
+	}
+}
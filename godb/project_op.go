@@ -7,6 +7,8 @@ type Project struct {
 	//add additional fields here
 	outDesc  TupleDesc
 	distinct bool
+
+	memory *MemoryManager // limits the memory used for DISTINCT, if not nil
 }
 
 // Construct a projection operator. It saves the list of selected field, child,
@@ -26,7 +28,7 @@ func NewProjectOp(selectFields []Expr, outputNames []string, distinct bool, chil
 		outFields[i].Ftype = expr.GetExprType().Ftype
 		outFields[i].Fname = outputNames[i]
 	}
-	return &Project{selectFields, outputNames, child, TupleDesc{outFields}, distinct}, nil
+	return &Project{selectFields, outputNames, child, TupleDesc{outFields}, distinct, nil}, nil
 }
 
 // Return a TupleDescriptor for this projection. The returned descriptor should
@@ -45,6 +47,10 @@ func (p *Project) Descriptor() *TupleDesc {
 // implement this you will need to record in some data structure with the
 // distinct tuples seen so far. Note that support for the distinct keyword is
 // optional as specified in the lab 2 assignment.
+//
+// The memory the distinct tuples use is reserved from the memory manager of
+// the operator, if it has one, and given back once the last tuple is returned.
+// Returns a MemoryLimitError if they don't fit in the memory budget.
 func (p *Project) Iterator(tid TransactionID) (func() (*Tuple, error), error) {
 	childIter, err := p.child.Iterator(tid)
 	if err != nil {
@@ -54,11 +60,13 @@ func (p *Project) Iterator(tid TransactionID) (func() (*Tuple, error), error) {
 	var distinctTups []*Tuple
 	didDistinct := false
 	curDistinct := 0
+	mem := memoryReservation{m: p.memory, tid: tid}
 	return func() (*Tuple, error) {
 		if (p.distinct && !didDistinct) || (!p.distinct) {
 			for {
 				tup, err := childIter()
 				if err != nil {
+					mem.free()
 					return nil, err
 				}
 				if tup == nil {
@@ -83,6 +91,10 @@ func (p *Project) Iterator(tid TransactionID) (func() (*Tuple, error), error) {
 					key := outTup.tupleKey()
 					distinctTup := (distinctState[key])
 					if distinctTup == nil {
+						if err := mem.grow(tupleMemorySize(&outTup)); err != nil {
+							mem.free()
+							return nil, err
+						}
 						distinctState[key] = &outTup
 						distinctTups = append(distinctTups, &outTup)
 					}
@@ -93,6 +105,7 @@ func (p *Project) Iterator(tid TransactionID) (func() (*Tuple, error), error) {
 		}
 		//distinct, iterating results
 		if curDistinct >= len(distinctTups) {
+			mem.free()
 			return nil, nil
 		}
 
@@ -0,0 +1,185 @@
+package godb
+
+import (
+	"log"
+	"sync"
+)
+
+// The number of pages the buffer pool reads ahead of a sequential scan by
+// default (see [BufferPool.SetReadAhead]).
+const DefaultReadAhead = 8
+
+// The number of consecutive pages a transaction has to read from a file before
+// the buffer pool starts to read ahead.
+const readAheadTrigger = 4
+
+// A run of consecutive pages that a transaction has read from a file.
+type sequentialRun struct {
+	next       int // the page that continues the run
+	length     int // the number of pages in the run
+	prefetched int // the pages before this one have been read ahead
+}
+
+// Detects sequential access to files, and decides which pages to read ahead.
+type readAhead struct {
+	pages int // the number of pages to read ahead, or 0 to not read ahead
+	runs  map[TransactionID]map[DBFile]*sequentialRun
+	sync.Mutex
+}
+
+// A file that can read a range of consecutive pages with a single read, which
+// the buffer pool uses to read ahead.
+type pageRangeReader interface {
+	DBFile
+	readPages(from int, to int) ([]Page, error)
+}
+
+// Set the number of pages the buffer pool reads ahead when a transaction reads
+// the pages of a file in order, as a sequential scan does. The pages are read
+// in the background, so that the scan doesn't wait for each page to be read,
+// and with a single read if the file supports it, as [HeapFile] does. Read
+// ahead starts once a transaction has read a few consecutive pages, and stays
+// the specified number of pages ahead of it. The default is
+// [DefaultReadAhead]; 0 turns read ahead off.
+//
+// Pages are only read ahead into free frames, or in place of the pages of the
+// file that the scan has passed, so that reading ahead never evicts other
+// pages. The replacement policy treats the pages that are read ahead as pages
+// read by a scan, which are evicted first.
+func (bp *BufferPool) SetReadAhead(pages int) {
+	bp.readAhead.Lock()
+	defer bp.readAhead.Unlock()
+	bp.readAhead.pages = max(pages, 0)
+}
+
+// Record that tid is reading the specified page of a file. If it is reading
+// the file sequentially, return the range of pages from page from up to, but
+// not including, page to that should be read ahead; otherwise from == to.
+func (r *readAhead) access(tid TransactionID, file DBFile, pageNo int) (int, int) {
+	r.Lock()
+	defer r.Unlock()
+	if r.pages == 0 {
+		return 0, 0
+	}
+	if r.runs[tid] == nil {
+		r.runs[tid] = make(map[DBFile]*sequentialRun)
+	}
+	run := r.runs[tid][file]
+	if run == nil || run.next != pageNo {
+		run = &sequentialRun{prefetched: pageNo + 1}
+		r.runs[tid][file] = run
+	}
+	run.next = pageNo + 1
+	run.length++
+	// read ahead again once half of the pages read ahead have been used
+	if run.length < readAheadTrigger || run.prefetched-pageNo > r.pages/2 {
+		return 0, 0
+	}
+	from := max(run.prefetched, pageNo+1)
+	run.prefetched = pageNo + 1 + r.pages
+	return from, run.prefetched
+}
+
+// Forget the runs of a transaction that has committed or aborted.
+func (r *readAhead) forget(tid TransactionID) {
+	r.Lock()
+	defer r.Unlock()
+	delete(r.runs, tid)
+}
+
+// Read the pages from page from up to, but not including, page to of a file
+// into the buffer pool, without locking them. Pages that are already cached
+// are skipped. Stops when there is no room for a page.
+func (bp *BufferPool) prefetchPages(file DBFile, from int, to int) {
+	// skip the pages the scan has caught up with
+	for ; from < to; from++ {
+		if _, cached := bp.cachedPage(file.pageKey(from)); !cached {
+			break
+		}
+	}
+	if from >= to {
+		return
+	}
+	keys := make([]any, 0, to-from)
+	generations := make([]int, 0, to-from)
+	for pageNo := from; pageNo < to; pageNo++ {
+		key := file.pageKey(pageNo)
+		p := bp.partition(key)
+		p.Lock()
+		keys = append(keys, key)
+		generations = append(generations, p.generation)
+		p.Unlock()
+	}
+
+	var pages []Page
+	var err error
+	if f, ok := file.(pageRangeReader); ok {
+		pages, err = bp.readPages(f, from, to)
+	} else {
+		for pageNo := from; pageNo < to && err == nil; pageNo++ {
+			var pg Page
+			pg, err = bp.readPage(file, pageNo)
+			pages = append(pages, pg)
+		}
+	}
+	if err != nil {
+		log.Printf("read ahead of pages %d to %d failed: %v", from, to-1, err)
+		return
+	}
+
+	// pages that the scan passed long ago have been evicted already
+	passed := max(from-bp.capacity(), 0)
+	for i, pg := range pages {
+		if !bp.reservePrefetchFrame(file, &passed, from) {
+			return
+		}
+		p := bp.partition(keys[i])
+		p.Lock()
+		_, cached := p.pages[keys[i]]
+		if cached || p.generation != generations[i] {
+			// the page was requested, or written, while it was being read
+			p.Unlock()
+			bp.releaseFrame()
+			continue
+		}
+		p.addPage(keys[i], pg)
+		p.prefetched[keys[i]] = nil
+		p.Unlock()
+		bp.counters.update(func(s *BufferPoolStats) { s.Prefetches++ })
+		// the page is evicted first, unless the scan reaches it
+		bp.pageAccessed(keys[i], true)
+	}
+}
+
+// Reserve room for a page that is read ahead, like [BufferPool.reserveFrame],
+// but only by evicting one of the pages of file from page *passed up to, but
+// not including, page before, which the scan has passed, that matches its
+// file. *passed is advanced past the pages that were looked at. Returns false
+// if there is no such room.
+func (bp *BufferPool) reservePrefetchFrame(file DBFile, passed *int, before int) bool {
+	bp.frameLatch.Lock()
+	defer bp.frameLatch.Unlock()
+	if bp.numFrames < bp.maxPages {
+		bp.numFrames++
+		return true
+	}
+	if bp.numFrames > bp.maxPages {
+		// the buffer pool is shrinking (see [BufferPool.resize])
+		return false
+	}
+	for ; *passed < before; *passed++ {
+		key := file.pageKey(*passed)
+		p := bp.partition(key)
+		p.Lock()
+		_, cached := p.pages[key]
+		_, prefetched := p.prefetched[key]
+		evictable := cached && !prefetched && p.evictable(key, true)
+		p.Unlock()
+		if evictable && bp.evictCleanPage(key) {
+			bp.counters.update(func(s *BufferPoolStats) { s.Evictions++ })
+			*passed++
+			return true
+		}
+	}
+	return false
+}
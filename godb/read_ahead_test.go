@@ -0,0 +1,103 @@
+package godb
+
+import "testing"
+
+func TestReadAheadDetectsSequentialAccess(t *testing.T) {
+	r := readAhead{pages: 8, runs: make(map[TransactionID]map[DBFile]*sequentialRun)}
+	tid := NewTID()
+	f := &MemFile{}
+	for p := 0; p < readAheadTrigger-1; p++ {
+		if from, to := r.access(tid, f, p); from != to {
+			t.Errorf("expected no read ahead before %d consecutive pages, got pages %d to %d at page %d", readAheadTrigger, from, to, p)
+		}
+	}
+	if from, to := r.access(tid, f, readAheadTrigger-1); from != readAheadTrigger || to != readAheadTrigger+8 {
+		t.Errorf("expected pages %d to %d to be read ahead, got %d to %d", readAheadTrigger, readAheadTrigger+8, from, to)
+	}
+	// nothing more is read ahead until half of the pages are used
+	if from, to := r.access(tid, f, readAheadTrigger); from != to {
+		t.Errorf("expected no read ahead right after reading ahead, got pages %d to %d", from, to)
+	}
+
+	// a jump starts a new run
+	if from, to := r.access(tid, f, 100); from != to {
+		t.Errorf("expected no read ahead after a jump, got pages %d to %d", from, to)
+	}
+	r.forget(tid)
+	if len(r.runs) != 0 {
+		t.Errorf("expected the runs of the transaction to be forgotten")
+	}
+}
+
+func TestReadAheadPrefetchesPages(t *testing.T) {
+	bp, hf := makeTestFile(t, 100)
+	td, _, _ := makeTupleTestVars()
+	fillPagesForTest(t, bp, hf, 10)
+
+	// read ahead into a buffer pool with room for 4 pages
+	bp = makePolicyTestBufferPool(t, 4, NewLRUPolicy())
+	bp.SetReadAhead(0)
+	hf, err := NewHeapFile(TestingFile, &td, bp)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	tid := BeginTransactionForTest(t, bp)
+	defer bp.CommitTransaction(tid)
+	if _, err := bp.GetPage(hf, 0, tid, ReadPerm); err != nil {
+		t.Fatalf(err.Error())
+	}
+	// page 0 is cached, so pages 1 to 5 are read with one read; there is room
+	// for 4 of them once page 0 is evicted
+	bp.prefetchPages(hf, 0, 6)
+	s := bp.Stats()
+	if s.Prefetches != 4 || s.Evictions != 1 {
+		t.Errorf("expected 4 pages to be read ahead and 1 eviction, got %+v", s)
+	}
+	if f := s.Files[hf.BackingFile()]; f.Reads != 6 {
+		t.Errorf("expected 1 read and 5 pages read ahead, got %d reads", f.Reads)
+	}
+	for p := 1; p <= 4; p++ {
+		if _, ok := bp.cachedPage(hf.pageKey(p)); !ok {
+			t.Errorf("expected page %d to be read ahead", p)
+		}
+	}
+
+	// the pages read ahead are hits, and make room for other pages once used
+	for p := 1; p <= 3; p++ {
+		if _, err := bp.GetPage(hf, p, tid, ReadPerm); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	bp.prefetchPages(hf, 4, 6)
+	s = bp.Stats()
+	if s.Hits != 3 || s.Misses != 1 || s.Prefetches != 5 {
+		t.Errorf("expected 3 hits, 1 miss and 5 pages read ahead, got %+v", s)
+	}
+
+	// a page that is read ahead and not used is evicted first
+	bp.prefetchPages(hf, 6, 7)
+	if v, ok := bp.policy.victim(func(key any) bool { return true }); !ok || v != hf.pageKey(6) {
+		t.Errorf("expected the unused page that was read ahead to be evicted first, got %v", v)
+	}
+
+	// a scan reads every page, whether or not it was read ahead
+	bp.SetReadAhead(DefaultReadAhead)
+	iter, err := hf.Iterator(tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	cnt := 0
+	for {
+		tup, err := iter()
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if tup == nil {
+			break
+		}
+		cnt++
+	}
+	if cnt == 0 {
+		t.Errorf("expected the scan to return tuples")
+	}
+}
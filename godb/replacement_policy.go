@@ -0,0 +1,211 @@
+package godb
+
+import "container/list"
+
+// A ReplacementPolicy chooses which page the [BufferPool] evicts when it is
+// full. The buffer pool tells the policy about every access to a page and
+// every page it drops, and asks it for a victim when it needs room for a new
+// page. The methods are called while holding the buffer pool's frameLatch.
+//
+// Accesses by large sequential scans are flagged, so that a policy can keep a
+// scan from pushing every other page out of the buffer pool. All of the
+// policies here treat a page that a scan brings into the buffer pool as the
+// next page to evict, and don't count a scan's access to a page that is
+// already cached; a scan thus recycles its own pages.
+type ReplacementPolicy interface {
+	// Record an access to the page with the specified key, which is added
+	// to the policy if it's new.
+	pageAccessed(key any, scan bool)
+
+	// Forget the page with the specified key, which was dropped from the
+	// buffer pool.
+	pageRemoved(key any)
+
+	// Return the key of the page to evict, considering only the pages for
+	// which evictable returns true. Returns false if there is no such page.
+	victim(evictable func(key any) bool) (any, bool)
+}
+
+// The least recently used page is evicted.
+type lruPolicy struct {
+	order *list.List // the most recently used page is at the front
+	elems map[any]*list.Element
+}
+
+// Construct an LRU replacement policy, which evicts the least recently used
+// page. This is the default policy of [NewBufferPool].
+func NewLRUPolicy() ReplacementPolicy {
+	return &lruPolicy{list.New(), make(map[any]*list.Element)}
+}
+
+func (p *lruPolicy) pageAccessed(key any, scan bool) {
+	if e, ok := p.elems[key]; ok {
+		if !scan {
+			p.order.MoveToFront(e)
+		}
+		return
+	}
+	if scan {
+		p.elems[key] = p.order.PushBack(key)
+	} else {
+		p.elems[key] = p.order.PushFront(key)
+	}
+}
+
+func (p *lruPolicy) pageRemoved(key any) {
+	if e, ok := p.elems[key]; ok {
+		p.order.Remove(e)
+		delete(p.elems, key)
+	}
+}
+
+func (p *lruPolicy) victim(evictable func(key any) bool) (any, bool) {
+	for e := p.order.Back(); e != nil; e = e.Prev() {
+		if evictable(e.Value) {
+			return e.Value, true
+		}
+	}
+	return nil, false
+}
+
+// The clock algorithm approximates LRU with a reference bit per page. The
+// clock hand sweeps over the pages, clearing the bits that are set, and
+// evicts the first page whose bit is already clear.
+type clockPolicy struct {
+	keys       []any  // the page in each slot of the clock, or nil
+	referenced []bool // the reference bit of each slot
+	slots      map[any]int
+	free       []int // slots whose page was removed
+	hand       int
+}
+
+// Construct a clock replacement policy, which evicts a page that hasn't been
+// accessed since the last time the clock hand passed it.
+func NewClockPolicy() ReplacementPolicy {
+	return &clockPolicy{slots: make(map[any]int)}
+}
+
+func (p *clockPolicy) pageAccessed(key any, scan bool) {
+	if s, ok := p.slots[key]; ok {
+		if !scan {
+			p.referenced[s] = true
+		}
+		return
+	}
+	var s int
+	if len(p.free) > 0 {
+		s = p.free[len(p.free)-1]
+		p.free = p.free[:len(p.free)-1]
+	} else {
+		s = len(p.keys)
+		p.keys = append(p.keys, nil)
+		p.referenced = append(p.referenced, false)
+	}
+	p.keys[s] = key
+	p.referenced[s] = !scan
+	p.slots[key] = s
+	if scan {
+		// a scanned page is the next page the hand reaches
+		p.hand = s
+	}
+}
+
+func (p *clockPolicy) pageRemoved(key any) {
+	if s, ok := p.slots[key]; ok {
+		p.keys[s] = nil
+		p.referenced[s] = false
+		p.free = append(p.free, s)
+		delete(p.slots, key)
+	}
+}
+
+func (p *clockPolicy) victim(evictable func(key any) bool) (any, bool) {
+	// the first sweep may only clear reference bits, so two are needed to
+	// be sure of finding a victim
+	for i := 0; i < 2*len(p.keys); i++ {
+		s := p.hand
+		p.hand = (p.hand + 1) % len(p.keys)
+		key := p.keys[s]
+		if key == nil || !evictable(key) {
+			continue
+		}
+		if p.referenced[s] {
+			p.referenced[s] = false
+			continue
+		}
+		return key, true
+	}
+	return nil, false
+}
+
+// LRU-K evicts the page whose K-th most recent access is the oldest, so that
+// a page has to be accessed K times before it is considered hot. Pages that
+// have been accessed fewer than K times are evicted first, least recently
+// used first.
+type lruKPolicy struct {
+	k       int
+	now     int64
+	history map[any][]int64 // the times of the last k accesses, most recent first
+}
+
+// Construct an LRU-K replacement policy, which evicts the page whose K-th most
+// recent access is the oldest. LRU-2 is a common choice, which keeps pages
+// that are only accessed once from displacing pages that are accessed
+// repeatedly.
+//
+// Returns an error if k is less than 1.
+func NewLRUKPolicy(k int) (ReplacementPolicy, error) {
+	if k < 1 {
+		return nil, GoDBError{IllegalOperationError, "the K of an LRU-K policy must be at least 1"}
+	}
+	return &lruKPolicy{k: k, history: make(map[any][]int64)}, nil
+}
+
+func (p *lruKPolicy) pageAccessed(key any, scan bool) {
+	h, ok := p.history[key]
+	if scan {
+		if !ok {
+			// a scanned page is older than every other page
+			p.history[key] = []int64{0}
+		}
+		return
+	}
+	p.now++
+	h = append([]int64{p.now}, h...)
+	if len(h) > p.k {
+		h = h[:p.k]
+	}
+	p.history[key] = h
+}
+
+func (p *lruKPolicy) pageRemoved(key any) {
+	delete(p.history, key)
+}
+
+// Return true if the page with history h1 should be evicted before the page
+// with history h2.
+func (p *lruKPolicy) evictBefore(h1 []int64, h2 []int64) bool {
+	full1, full2 := len(h1) == p.k, len(h2) == p.k
+	switch {
+	case full1 && full2:
+		return h1[p.k-1] < h2[p.k-1]
+	case full1 != full2:
+		return full2
+	default:
+		return h1[0] < h2[0]
+	}
+}
+
+func (p *lruKPolicy) victim(evictable func(key any) bool) (any, bool) {
+	var victim any
+	var victimHistory []int64
+	for key, h := range p.history {
+		if !evictable(key) {
+			continue
+		}
+		if victimHistory == nil || p.evictBefore(h, victimHistory) {
+			victim, victimHistory = key, h
+		}
+	}
+	return victim, victimHistory != nil
+}
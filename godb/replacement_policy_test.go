@@ -0,0 +1,170 @@
+package godb
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func makeReplacementPoliciesForTest(t *testing.T) map[string]ReplacementPolicy {
+	t.Helper()
+	lru2, err := NewLRUKPolicy(2)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	return map[string]ReplacementPolicy{"lru": NewLRUPolicy(), "clock": NewClockPolicy(), "lru-2": lru2}
+}
+
+func checkVictimForTest(t *testing.T, name string, p ReplacementPolicy, expected any, evictable func(key any) bool) {
+	t.Helper()
+	if evictable == nil {
+		evictable = func(key any) bool { return true }
+	}
+	v, ok := p.victim(evictable)
+	if !ok {
+		t.Fatalf("%s: expected victim %v, got none", name, expected)
+	}
+	if v != expected {
+		t.Errorf("%s: expected victim %v, got %v", name, expected, v)
+	}
+}
+
+func TestReplacementPolicyVictims(t *testing.T) {
+	lru := NewLRUPolicy()
+	for _, k := range []string{"a", "b", "c", "a"} {
+		lru.pageAccessed(k, false)
+	}
+	checkVictimForTest(t, "lru", lru, "b", nil)
+	checkVictimForTest(t, "lru", lru, "c", func(key any) bool { return key != "b" })
+
+	// the first sweep of the hand clears the reference bits
+	clock := NewClockPolicy()
+	for _, k := range []string{"a", "b", "c"} {
+		clock.pageAccessed(k, false)
+	}
+	checkVictimForTest(t, "clock", clock, "a", nil)
+	clock.pageRemoved("a")
+	clock.pageAccessed("d", false)
+	checkVictimForTest(t, "clock", clock, "b", nil)
+
+	// pages accessed fewer than K times go first; LRU would evict b
+	lru2, err := NewLRUKPolicy(2)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	for _, k := range []string{"a", "a", "b", "b", "c", "a"} {
+		lru2.pageAccessed(k, false)
+	}
+	checkVictimForTest(t, "lru-2", lru2, "c", nil)
+	lru2.pageRemoved("c")
+	checkVictimForTest(t, "lru-2", lru2, "a", nil)
+	if _, err := NewLRUKPolicy(0); err == nil {
+		t.Errorf("expected an LRU-K policy with K = 0 to be rejected")
+	}
+
+	for name, p := range makeReplacementPoliciesForTest(t) {
+		// pages brought in by a scan are evicted first, and a scan doesn't
+		// make a cached page hotter
+		for _, k := range []string{"hot1", "hot2", "hot1", "hot2"} {
+			p.pageAccessed(k, false)
+		}
+		p.pageAccessed("scan", true)
+		p.pageAccessed("hot1", true)
+		checkVictimForTest(t, name, p, "scan", nil)
+		p.pageRemoved("scan")
+		if _, ok := p.victim(func(key any) bool { return key == "scan" }); ok {
+			t.Errorf("%s: expected a removed page not to be a victim", name)
+		}
+	}
+}
+
+// Create a buffer pool with the specified replacement policy and an empty
+// log.
+func makePolicyTestBufferPool(t *testing.T, numPages int, policy ReplacementPolicy) *BufferPool {
+	t.Helper()
+	bp, err := NewBufferPool(numPages, policy)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	os.Remove("test.log")
+	lf, err := NewLogFile("test.log", bp, NewCatalog("catalog.txt", bp, "./"))
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if err := bp.Recover(lf); err != nil {
+		t.Fatalf(err.Error())
+	}
+	return bp
+}
+
+func TestBufferPoolScanResistance(t *testing.T) {
+	// a table that is twice as large as the buffer pool, and a small table
+	// that is read repeatedly
+	bp, big := makeTestFile(t, 100)
+	td, _, _ := makeTupleTestVars()
+	os.Remove(TestingFile2)
+	small, err := NewHeapFile(TestingFile2, &td, bp)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	tid := BeginTransactionForTest(t, bp)
+	for i := 0; big.NumPages() < 40; i++ {
+		tup := Tuple{Desc: td, Fields: []DBValue{StringField{strings.Repeat("x", 1000)}, IntField{int64(i)}}}
+		insertTupleForTest(t, big, &tup, tid)
+	}
+	for i := 0; small.NumPages() < 2; i++ {
+		tup := Tuple{Desc: td, Fields: []DBValue{StringField{strings.Repeat("y", 1000)}, IntField{int64(i)}}}
+		insertTupleForTest(t, small, &tup, tid)
+	}
+	flushAndCommitForTest(t, bp, tid)
+
+	if _, err := NewBufferPool(20, NewLRUPolicy(), NewClockPolicy()); err == nil {
+		t.Errorf("expected a buffer pool with two replacement policies to be rejected")
+	}
+
+	for name, policy := range makeReplacementPoliciesForTest(t) {
+		bp := makePolicyTestBufferPool(t, 20, policy)
+		big, err := NewHeapFile(TestingFile, &td, bp)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		small, err := NewHeapFile(TestingFile2, &td, bp)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		tid := BeginTransactionForTest(t, bp)
+		for i := 0; i < 2; i++ {
+			for p := 0; p < small.NumPages(); p++ {
+				if _, err := bp.GetPage(small, p, tid, ReadPerm); err != nil {
+					t.Fatalf(err.Error())
+				}
+			}
+		}
+		for i := 0; i < 2; i++ {
+			iter, err := big.Iterator(tid)
+			if err != nil {
+				t.Fatalf(err.Error())
+			}
+			cnt := 0
+			for {
+				tup, err := iter()
+				if err != nil {
+					t.Fatalf(err.Error())
+				}
+				if tup == nil {
+					break
+				}
+				cnt++
+			}
+			if cnt == 0 {
+				t.Fatalf("%s: expected the scan to return tuples", name)
+			}
+		}
+		for p := 0; p < small.NumPages(); p++ {
+			if _, ok := bp.cachedPage(small.pageKey(p)); !ok {
+				t.Errorf("%s: expected page %d of the small table to stay in the buffer pool during the scans", name, p)
+			}
+		}
+		bp.CommitTransaction(tid)
+	}
+}
@@ -0,0 +1,211 @@
+package godb
+
+import "fmt"
+
+// Savepoints and partial rollback.
+//
+// A transaction's changes are logged when it commits (see
+// [BufferPool.CommitTransaction]), so the log can't be read back to undo only
+// some of them. Instead, once a transaction sets a savepoint, the buffer pool
+// remembers the records it inserts into and deletes from heap files, in the
+// order it changes them. Rolling back to a savepoint undoes the changes made
+// after it, newest first, along with their index entries, and records that it
+// did in the log. The transaction keeps all of its locks, including those on
+// the records whose changes were undone, whose slots stay reserved for it
+// until it ends.
+//
+// Only heap files are rolled back record by record; the changes to other
+// files, e.g., indexes, are undone through the heap files they belong to.
+type savepoints struct {
+	saved   []savepoint    // the savepoints that are set, oldest first
+	changes []recordChange // the changes made since the oldest savepoint
+}
+
+// A savepoint that a transaction set.
+type savepoint struct {
+	name    string
+	changes int // the number of changes made before it was set
+}
+
+// A record that a transaction inserted into or deleted from a heap file.
+type recordChange struct {
+	file     *HeapFile
+	rid      heapFileRid
+	t        *Tuple
+	inserted bool // false if the record was deleted
+}
+
+// Return the index of the newest savepoint with the specified name, or -1 if
+// there is none.
+func (s *savepoints) find(name string) int {
+	for i := len(s.saved) - 1; i >= 0; i-- {
+		if s.saved[i].name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// Return the savepoints of a running transaction, or an error if it isn't
+// running.
+//
+// Caller must hold tidLatch.
+func (bp *BufferPool) savepointsOf(tid TransactionID) (*savepoints, error) {
+	r, ok := bp.runningTids[tid]
+	if !ok {
+		return nil, GoDBError{IllegalTransactionError, "Transaction is not running or has aborted."}
+	}
+	if r.savepoints == nil {
+		r.savepoints = &savepoints{}
+		bp.runningTids[tid] = r
+	}
+	return r.savepoints, nil
+}
+
+// Remember that tid inserted the record t into, or deleted it from, the
+// specified slot of a heap file, if it has set a savepoint that the change may
+// have to be undone for.
+func (bp *BufferPool) recordChange(tid TransactionID, file *HeapFile, rid heapFileRid, t *Tuple, inserted bool) {
+	bp.tidLatch.Lock()
+	defer bp.tidLatch.Unlock()
+	if s := bp.runningTids[tid].savepoints; s != nil && len(s.saved) > 0 {
+		s.changes = append(s.changes, recordChange{file, rid, t, inserted})
+	}
+}
+
+// Set a savepoint with the specified name for a running transaction, which
+// [BufferPool.RollbackToSavepoint] can undo its later changes to. A savepoint
+// with the same name that was set before is replaced.
+//
+// Returns an IllegalTransactionError if the transaction isn't running.
+func (bp *BufferPool) Savepoint(tid TransactionID, name string) error {
+	bp.tidLatch.Lock()
+	s, err := bp.savepointsOf(tid)
+	if err != nil {
+		bp.tidLatch.Unlock()
+		return err
+	}
+	if i := s.find(name); i >= 0 {
+		s.saved = append(s.saved[:i], s.saved[i+1:]...)
+	}
+	if len(s.saved) == 0 {
+		s.changes = nil
+	}
+	s.saved = append(s.saved, savepoint{name, len(s.changes)})
+	bp.tidLatch.Unlock()
+
+	bp.logLatch.Lock()
+	defer bp.logLatch.Unlock()
+	bp.LogFile().LogSavepoint(tid, name)
+	return nil
+}
+
+// Undo the changes a running transaction made to heap files after it set the
+// savepoint with the specified name, and release the savepoints it set after
+// that one. The savepoint itself is kept, so the transaction can roll back to
+// it again. The transaction keeps its locks.
+//
+// Returns an IllegalTransactionError if the transaction isn't running, and an
+// IllegalOperationError if it has no savepoint with that name. If a change
+// can't be undone, the transaction is aborted.
+func (bp *BufferPool) RollbackToSavepoint(tid TransactionID, name string) error {
+	bp.tidLatch.Lock()
+	s, err := bp.savepointsOf(tid)
+	if err != nil {
+		bp.tidLatch.Unlock()
+		return err
+	}
+	i := s.find(name)
+	if i < 0 {
+		bp.tidLatch.Unlock()
+		return noSavepoint(name)
+	}
+	undo := append([]recordChange(nil), s.changes[s.saved[i].changes:]...)
+	bp.tidLatch.Unlock()
+
+	bp.logLatch.Lock()
+	bp.LogFile().LogRollbackToSavepoint(tid, name)
+	bp.logLatch.Unlock()
+
+	for j := len(undo) - 1; j >= 0; j-- {
+		if err := bp.undoChange(tid, undo[j]); err != nil {
+			bp.AbortTransaction(tid)
+			return err
+		}
+	}
+
+	// forget the changes and the later savepoints only once every change has
+	// been undone
+	bp.tidLatch.Lock()
+	defer bp.tidLatch.Unlock()
+	if i := s.find(name); i >= 0 {
+		s.changes = s.changes[:s.saved[i].changes]
+		s.saved = s.saved[:i+1]
+	}
+	return nil
+}
+
+// Release the savepoint with the specified name, and the savepoints set after
+// it, of a running transaction. Its changes are kept.
+//
+// Returns an IllegalTransactionError if the transaction isn't running, and an
+// IllegalOperationError if it has no savepoint with that name.
+func (bp *BufferPool) ReleaseSavepoint(tid TransactionID, name string) error {
+	bp.tidLatch.Lock()
+	s, err := bp.savepointsOf(tid)
+	if err != nil {
+		bp.tidLatch.Unlock()
+		return err
+	}
+	i := s.find(name)
+	if i < 0 {
+		bp.tidLatch.Unlock()
+		return noSavepoint(name)
+	}
+	s.saved = s.saved[:i]
+	if len(s.saved) == 0 {
+		s.changes = nil
+	}
+	bp.tidLatch.Unlock()
+
+	bp.logLatch.Lock()
+	defer bp.logLatch.Unlock()
+	bp.LogFile().LogReleaseSavepoint(tid, name)
+	return nil
+}
+
+func noSavepoint(name string) error {
+	return GoDBError{IllegalOperationError, fmt.Sprintf("savepoint %s does not exist", name)}
+}
+
+// Undo a change that tid made to a record of a heap file: put back the record
+// it deleted, or empty the slot of the record it inserted, and update the
+// indexes on the file. The slot stays owned by tid, which still holds the
+// write lock on the record.
+func (bp *BufferPool) undoChange(tid TransactionID, c recordChange) error {
+	pg, err := bp.PinPage(c.file, c.rid.pageNo, tid, intentWritePerm)
+	if err != nil {
+		return err
+	}
+	hp, ok := pg.Page.(*heapPage)
+	if !ok {
+		pg.Release()
+		return GoDBError{IncompatibleTypesError, "buffer pool returned non-heap page when heap page expected"}
+	}
+	hp.latch.Lock()
+	if c.inserted {
+		hp.setSlot(c.rid.slotNo, nil)
+	} else {
+		hp.setSlot(c.rid.slotNo, c.t)
+	}
+	hp.latch.Unlock()
+	hp.setDirty(tid, true)
+	pg.Release()
+	c.file.fsm.update(c.rid.pageNo, hp.availableSpace())
+
+	c.t.Rid = c.rid
+	if c.inserted {
+		return deleteFromIndexes(c.file, c.t, tid)
+	}
+	return insertIntoIndexes(c.file, c.t, tid)
+}
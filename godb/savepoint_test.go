@@ -0,0 +1,197 @@
+package godb
+
+import (
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+)
+
+// Insert a record with the specified value of the second field.
+func insertValueForTest(t *testing.T, hf *HeapFile, v int64, tid TransactionID) *Tuple {
+	t.Helper()
+	td, _, _ := makeTupleTestVars()
+	tup := &Tuple{Desc: td, Fields: []DBValue{StringField{"sam"}, IntField{v}}}
+	insertTupleForTest(t, hf, tup, tid)
+	return tup
+}
+
+func checkValuesForTest(t *testing.T, hf *HeapFile, tid TransactionID, expected []int64) {
+	t.Helper()
+	if vals := scanValuesForTest(t, hf, tid); !reflect.DeepEqual(vals, expected) {
+		t.Errorf("expected %v, got %v", expected, vals)
+	}
+}
+
+func TestSavepointRollback(t *testing.T) {
+	bp, hf, tups := makeSnapshotTestFile(t, 5)
+	tid := BeginTransactionForTest(t, bp)
+	if err := hf.deleteTuple(&tups[0], tid); err != nil {
+		t.Fatalf(err.Error())
+	}
+	insertValueForTest(t, hf, 10, tid)
+	if err := bp.Savepoint(tid, "a"); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if err := hf.deleteTuple(&tups[1], tid); err != nil {
+		t.Fatalf(err.Error())
+	}
+	insertValueForTest(t, hf, 11, tid)
+	insertValueForTest(t, hf, 12, tid)
+	checkValuesForTest(t, hf, tid, []int64{2, 3, 4, 10, 11, 12})
+	locks := bp.lockTable.numLocks(tid)
+
+	if err := bp.RollbackToSavepoint(tid, "a"); err != nil {
+		t.Fatalf(err.Error())
+	}
+	checkValuesForTest(t, hf, tid, []int64{1, 2, 3, 4, 10})
+	if n := bp.lockTable.numLocks(tid); n != locks {
+		t.Errorf("expected the transaction to keep its %d locks, got %d", locks, n)
+	}
+
+	// the savepoint is kept
+	insertValueForTest(t, hf, 13, tid)
+	if err := bp.RollbackToSavepoint(tid, "a"); err != nil {
+		t.Fatalf(err.Error())
+	}
+	checkValuesForTest(t, hf, tid, []int64{1, 2, 3, 4, 10})
+
+	if err := bp.CommitTransaction(tid); err != nil {
+		t.Fatalf(err.Error())
+	}
+	checkValuesForTest(t, hf, BeginTransactionForTest(t, bp), []int64{1, 2, 3, 4, 10})
+}
+
+func TestSavepointNestedAndRelease(t *testing.T) {
+	bp, hf, _ := makeSnapshotTestFile(t, 1)
+	tid := BeginTransactionForTest(t, bp)
+	for i, name := range []string{"a", "b", "c"} {
+		if err := bp.Savepoint(tid, name); err != nil {
+			t.Fatalf(err.Error())
+		}
+		insertValueForTest(t, hf, int64(i+1), tid)
+	}
+	if err := bp.RollbackToSavepoint(tid, "b"); err != nil {
+		t.Fatalf(err.Error())
+	}
+	checkValuesForTest(t, hf, tid, []int64{0, 1})
+	// the savepoints after b are released
+	var gerr GoDBError
+	if err := bp.RollbackToSavepoint(tid, "c"); !errors.As(err, &gerr) || gerr.code != IllegalOperationError {
+		t.Errorf("expected rolling back to a released savepoint to fail, got %v", err)
+	}
+
+	// setting a savepoint again moves it
+	insertValueForTest(t, hf, 4, tid)
+	if err := bp.Savepoint(tid, "a"); err != nil {
+		t.Fatalf(err.Error())
+	}
+	insertValueForTest(t, hf, 5, tid)
+	if err := bp.RollbackToSavepoint(tid, "a"); err != nil {
+		t.Fatalf(err.Error())
+	}
+	checkValuesForTest(t, hf, tid, []int64{0, 1, 4})
+
+	if err := bp.ReleaseSavepoint(tid, "b"); err != nil {
+		t.Fatalf(err.Error())
+	}
+	for _, name := range []string{"a", "b"} {
+		if err := bp.RollbackToSavepoint(tid, name); err == nil {
+			t.Errorf("expected rolling back to released savepoint %s to fail", name)
+		}
+	}
+	if err := bp.ReleaseSavepoint(tid, "b"); err == nil {
+		t.Errorf("expected releasing a released savepoint to fail")
+	}
+	if !bp.IsRunning(tid) {
+		t.Fatalf("expected the transaction to be running")
+	}
+	checkValuesForTest(t, hf, tid, []int64{0, 1, 4})
+
+	bp.AbortTransaction(tid)
+	if err := bp.Savepoint(tid, "a"); !errors.As(err, &gerr) || gerr.code != IllegalTransactionError {
+		t.Errorf("expected setting a savepoint in an aborted transaction to fail, got %v", err)
+	}
+	checkValuesForTest(t, hf, BeginTransactionForTest(t, bp), []int64{0})
+}
+
+func TestSavepointRollbackIndexes(t *testing.T) {
+	bp, _, hf, idx := makeBTreeTestVars(t, "age")
+	td, _, _ := makeTupleTestVars()
+	tups := make([]Tuple, 10)
+	for i := range tups {
+		tups[i] = Tuple{Desc: td, Fields: []DBValue{StringField{"sam"}, IntField{int64(i)}}}
+	}
+	tid := BeginTransactionForTest(t, bp)
+	insertIndexedTuplesForTest(t, hf, tups[:5], tid)
+	if err := bp.Savepoint(tid, "a"); err != nil {
+		t.Fatalf(err.Error())
+	}
+	insertIndexedTuplesForTest(t, hf, tups[5:], tid)
+	for i := 0; i < 3; i++ {
+		if err := hf.deleteTuple(&tups[i], tid); err != nil {
+			t.Fatalf(err.Error())
+		}
+		if err := deleteFromIndexes(hf, &tups[i], tid); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	if n := checkIndexOrderForTest(t, idx, tid); n != 7 {
+		t.Errorf("expected 7 index entries, got %d", n)
+	}
+
+	if err := bp.RollbackToSavepoint(tid, "a"); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if n := checkIndexOrderForTest(t, idx, tid); n != 5 {
+		t.Errorf("expected 5 index entries after rolling back, got %d", n)
+	}
+	for i := range tups {
+		expected := 0
+		if i < 5 {
+			expected = 1
+		}
+		if n := countLookupForTest(t, idx, OpEq, IntField{int64(i)}, tid); n != expected {
+			t.Errorf("expected %d index entries for %d, got %d", expected, i, n)
+		}
+	}
+	checkValuesForTest(t, hf, tid, []int64{0, 1, 2, 3, 4})
+}
+
+func TestSavepointLogRecords(t *testing.T) {
+	bp, hf, _ := makeSnapshotTestFile(t, 1)
+	tid := BeginTransactionForTest(t, bp)
+	bp.Savepoint(tid, "a")
+	insertValueForTest(t, hf, 1, tid)
+	bp.RollbackToSavepoint(tid, "a")
+	bp.ReleaseSavepoint(tid, "a")
+	if err := bp.CommitTransaction(tid); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	logFile := bp.LogFile()
+	if err := logFile.seek(0, io.SeekStart); err != nil {
+		t.Fatalf(err.Error())
+	}
+	iter := logFile.ForwardIterator()
+	var types []LogRecordType
+	for {
+		record, err := iter()
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if record == nil {
+			break
+		}
+		if savepoint, ok := record.(*SavepointLogRecord); ok {
+			if savepoint.Tid() != tid || savepoint.Name != "a" {
+				t.Errorf("unexpected savepoint record %+v", savepoint)
+			}
+			types = append(types, savepoint.Type())
+		}
+	}
+	expected := []LogRecordType{SavepointRecord, RollbackToSavepointRecord, ReleaseSavepointRecord}
+	if !reflect.DeepEqual(types, expected) {
+		t.Errorf("expected savepoint records %v, got %v", expected, types)
+	}
+}
@@ -0,0 +1,405 @@
+package godb
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Snapshot isolation.
+//
+// A transaction begun with [BufferPool.BeginSnapshotTransaction] reads a
+// consistent snapshot of the heap files, as of the time it began, without
+// taking read locks, so that long read-only queries and the transactions that
+// change the tables they read don't wait for each other. Its changes still
+// take write locks, and it is aborted with a WriteConflictError if it changes
+// a record that a transaction that committed after it began changed too
+// (first committer wins).
+//
+// Every transaction that commits gets the next commit sequence number. A
+// snapshot is the sequence number of the last transaction that committed
+// when it was taken, and sees the changes of the transactions with sequence
+// numbers up to it, and its own. While running snapshots don't see the
+// changes of a transaction that commits, the records it created and deleted
+// carry its ID on their pages, and on disk (see [heapPage]): a record it
+// created carries it as the creating transaction, and a record it deleted
+// stays in its slot, with it as the deleting transaction. The IDs are
+// garbage-collected when the snapshots that need them end, or when a page
+// is read and no snapshot needs them anymore (see [heapPage.pruneVersions]).
+// If there is no room on a page for the IDs, the snapshots that need them
+// are too old: their transactions fail with a SnapshotTooOldError when they
+// read or change records next.
+//
+// Transaction IDs are handed out from 0 again whenever the database is
+// started (see [NewTID]), so the IDs on the pages written before it was
+// started can't be told from the IDs of its own transactions. The snapshot
+// manager remembers the heap pages it wrote; the versions on other pages are
+// dropped when they are read, since the transactions that made them ended
+// before any snapshot was taken (see [heapPage.forgetVersions]). Recovery
+// drops the versions on the pages it writes too.
+//
+// Only heap files are versioned; other files, e.g., indexes, are read with
+// locks as usual, and a snapshot transaction sees the records they point to
+// as of its snapshot.
+type snapshotManager struct {
+	// the sequence number of the last transaction that committed
+	lastCommit uint64
+
+	// the snapshot of each snapshot transaction that is running
+	snapshots map[TransactionID]uint64
+
+	// the sequence numbers of the transactions that committed after the
+	// oldest running snapshot was taken, or that are committing, and the
+	// transactions that are committing: their changes aren't all part of the
+	// before images of their pages yet
+	commits    map[TransactionID]uint64
+	committing map[TransactionID]any
+
+	// the snapshot transactions whose snapshots are too old to read, because
+	// the versions they need didn't fit on their pages
+	expired map[TransactionID]any
+
+	// the heap pages that were written to their files since the database
+	// was started, whose versions carry the IDs of its transactions. This is
+	// a set, so the value is not important
+	written map[any]any
+
+	sync.RWMutex
+}
+
+// Used as the creating or deleting transaction of a version when there is
+// none, or the transaction committed before every snapshot was taken.
+const noTransaction TransactionID = -1
+
+// The version of a record of a heap page that some snapshots don't see as it
+// is. Versions aren't changed once they are made.
+type recordVersion struct {
+	xmin TransactionID // the transaction that created the record
+	xmax TransactionID // the transaction that deleted it
+
+	// the record, if it was deleted, which the snapshots that don't see that
+	// it was deleted see
+	deleted *Tuple
+}
+
+// Returns true if two versions, either of which may be nil, are the same.
+func (v *recordVersion) equals(other *recordVersion) bool {
+	if v == nil || other == nil {
+		return v == other
+	}
+	return v.xmin == other.xmin && v.xmax == other.xmax && (v.deleted == nil) == (other.deleted == nil)
+}
+
+// The snapshot that a transaction reads (see [snapshotManager]).
+type snapshot struct {
+	tid TransactionID
+	seq uint64
+	m   *snapshotManager
+}
+
+func newSnapshotManager() snapshotManager {
+	return snapshotManager{
+		snapshots:  make(map[TransactionID]uint64),
+		commits:    make(map[TransactionID]uint64),
+		committing: make(map[TransactionID]any),
+		expired:    make(map[TransactionID]any),
+		written:    make(map[any]any),
+	}
+}
+
+// Record that the heap page with the specified key is being written to its
+// file.
+func (m *snapshotManager) pageWritten(key any) {
+	m.Lock()
+	defer m.Unlock()
+	m.written[key] = nil
+}
+
+// Returns true if the versions of the heap page with the specified key, which
+// was read from its file, were written since the database was started.
+func (m *snapshotManager) wroteVersions(key any) bool {
+	m.RLock()
+	defer m.RUnlock()
+	_, ok := m.written[key]
+	return ok
+}
+
+// Take a snapshot for transaction tid.
+func (m *snapshotManager) begin(tid TransactionID) {
+	m.Lock()
+	defer m.Unlock()
+	m.snapshots[tid] = m.lastCommit
+}
+
+// Return the snapshot of a transaction, or nil if it doesn't read one.
+func (m *snapshotManager) snapshotOf(tid TransactionID) *snapshot {
+	m.RLock()
+	defer m.RUnlock()
+	seq, ok := m.snapshots[tid]
+	if !ok {
+		return nil
+	}
+	return &snapshot{tid, seq, m}
+}
+
+// Give tid the next commit sequence number, when it starts to commit. Its
+// changes are visible to the snapshots taken from now on. Must be followed by
+// [snapshotManager.finishCommit] once its changes are committed on every
+// page.
+func (m *snapshotManager) startCommit(tid TransactionID) {
+	m.Lock()
+	defer m.Unlock()
+	m.lastCommit++
+	m.commits[tid] = m.lastCommit
+	m.committing[tid] = nil
+}
+
+// Record that the changes of tid are committed on every page.
+func (m *snapshotManager) finishCommit(tid TransactionID) {
+	m.Lock()
+	defer m.Unlock()
+	delete(m.committing, tid)
+	m.collect()
+}
+
+// End the snapshot of tid, if it has one, when it commits or aborts, and
+// forget the sequence numbers that no snapshot needs anymore. Returns true if
+// tid had a snapshot, so that the versions it needed can be dropped (see
+// [BufferPool.pruneVersions]).
+func (m *snapshotManager) end(tid TransactionID) bool {
+	m.Lock()
+	defer m.Unlock()
+	if _, ok := m.snapshots[tid]; !ok {
+		return false
+	}
+	delete(m.snapshots, tid)
+	delete(m.expired, tid)
+	m.collect()
+	return true
+}
+
+// Returns true if snapshot transactions are running, so that the records
+// that other transactions change may have to be versioned.
+func (m *snapshotManager) active() bool {
+	m.RLock()
+	defer m.RUnlock()
+	return len(m.snapshots) > 0
+}
+
+// Record that a record that tid, which is committing, created or deleted
+// couldn't be versioned, so that the snapshots that don't see the changes
+// of tid are too old.
+func (m *snapshotManager) expire(tid TransactionID) {
+	m.Lock()
+	defer m.Unlock()
+	for snap, seq := range m.snapshots {
+		if seq < m.commits[tid] {
+			m.expired[snap] = nil
+		}
+	}
+}
+
+// Return the sequence number of the oldest running snapshot, and false if no
+// snapshots are running.
+//
+// Caller must hold the lock of the snapshot manager.
+func (m *snapshotManager) oldest() (uint64, bool) {
+	oldest, ok := uint64(0), false
+	for _, seq := range m.snapshots {
+		if !ok || seq < oldest {
+			oldest, ok = seq, true
+		}
+	}
+	return oldest, ok
+}
+
+// Returns true if a transaction with a committed version committed before
+// the snapshot with the specified sequence number was taken. Transactions
+// whose sequence numbers were forgotten committed before every snapshot.
+//
+// Caller must hold the lock of the snapshot manager.
+func (m *snapshotManager) committedBefore(tid TransactionID, seq uint64) bool {
+	committed, ok := m.commits[tid]
+	return !ok || committed <= seq
+}
+
+// Forget the sequence numbers that no running snapshot needs: those of the
+// transactions that committed before the oldest snapshot was taken.
+//
+// Caller must hold the lock of the snapshot manager.
+func (m *snapshotManager) collect() {
+	oldest, ok := m.oldest()
+	for tid, seq := range m.commits {
+		if _, committing := m.committing[tid]; !committing && (!ok || seq <= oldest) {
+			delete(m.commits, tid)
+		}
+	}
+}
+
+// Returns true if a running snapshot doesn't see the changes of tid, which is
+// committing, so that the records it creates and deletes have to be
+// versioned (see [heapPage.commitSlots]). Snapshots taken later see them.
+func (m *snapshotManager) needsVersions(tid TransactionID) bool {
+	m.RLock()
+	defer m.RUnlock()
+	oldest, ok := m.oldest()
+	return ok && oldest < m.commits[tid]
+}
+
+// Returns true if every running snapshot sees the record with the specified
+// version as it is, i.e., sees the change of the transaction that created
+// it, or, if it was deleted, of the transaction that deleted it, so that the
+// version can be dropped.
+func (m *snapshotManager) seenByAll(v *recordVersion) bool {
+	m.RLock()
+	defer m.RUnlock()
+	oldest, ok := m.oldest()
+	changed := v.xmin
+	if v.deleted != nil {
+		changed = v.xmax
+	}
+	return !ok || m.committedBefore(changed, oldest)
+}
+
+// Returns true if the snapshot sees the changes of tid, which may not have
+// committed.
+func (s *snapshot) sees(tid TransactionID) bool {
+	if tid == s.tid {
+		return true
+	}
+	s.m.RLock()
+	defer s.m.RUnlock()
+	seq, ok := s.m.commits[tid]
+	return ok && seq <= s.seq
+}
+
+// Return the record that the snapshot sees in a slot, given the committed
+// record in it, if it wasn't deleted, and its version, or nil if it sees
+// none. It sees a record if it sees that it was created, and not that it was
+// deleted.
+func (s *snapshot) visible(committed *Tuple, v *recordVersion) *Tuple {
+	if v == nil {
+		return committed
+	}
+	s.m.RLock()
+	defer s.m.RUnlock()
+	if v.xmin != noTransaction && !s.m.committedBefore(v.xmin, s.seq) {
+		return nil
+	}
+	if v.deleted != nil && !s.m.committedBefore(v.xmax, s.seq) {
+		return v.deleted
+	}
+	return committed
+}
+
+// Return a SnapshotTooOldError if the snapshot can't be read anymore, because
+// some of the versions it needs couldn't be kept (see
+// [snapshotManager.expire]).
+func (s *snapshot) check() error {
+	s.m.RLock()
+	defer s.m.RUnlock()
+	if _, ok := s.m.expired[s.tid]; ok {
+		return GoDBError{SnapshotTooOldError, "records the snapshot needs were changed, and their versions didn't fit on their pages"}
+	}
+	return nil
+}
+
+// Returns true if a transaction that committed after the snapshot was taken
+// created or deleted the record with the specified version, so that the
+// snapshot's transaction can't change it too.
+func (s *snapshot) changedAfter(v *recordVersion) bool {
+	if v == nil {
+		return false
+	}
+	s.m.RLock()
+	defer s.m.RUnlock()
+	changed := v.xmin
+	if v.deleted != nil {
+		changed = v.xmax
+	}
+	return changed != noTransaction && !s.m.committedBefore(changed, s.seq)
+}
+
+// Begin a transaction that reads a snapshot of the heap files as of now,
+// without taking read locks (see [snapshotManager]). Its changes take write
+// locks as usual, and it is aborted with a WriteConflictError if it changes a
+// record that a transaction that committed after it began changed too.
+//
+// Returns an error if the transaction is already running.
+func (bp *BufferPool) BeginSnapshotTransaction(tid TransactionID) error {
+	if err := bp.BeginTransaction(tid); err != nil {
+		return err
+	}
+	bp.snapshots.begin(tid)
+	return nil
+}
+
+// Drop the versions of records that no running snapshot needs anymore from
+// the heap pages in the buffer pool, and from the evicted ones, once a
+// snapshot ended (see [heapPage.pruneVersions]). The pages aren't dirtied;
+// the versions that were written to disk are dropped when the pages are read
+// again.
+func (bp *BufferPool) pruneVersions() {
+	var pruned []*heapPage
+	for i := range bp.partitions {
+		p := &bp.partitions[i]
+		p.Lock()
+		for _, pg := range p.pages {
+			if hp, ok := pg.(*heapPage); ok && hp.pruneVersions(&bp.snapshots) {
+				pruned = append(pruned, hp)
+			}
+		}
+		for key, o := range p.evictedOwners {
+			if o.pruneVersions(&bp.snapshots) {
+				delete(p.evictedOwners, key)
+			}
+		}
+		p.Unlock()
+	}
+	for _, hp := range pruned {
+		// the space of the deleted records is free now
+		hp.file.fsm.update(hp.pageNo, hp.availableSpace())
+	}
+}
+
+// Abort tid, which tried to change the record with the specified record ID
+// of a file, which a transaction that committed after its snapshot was taken
+// changed, and return the WriteConflictError to return to its caller.
+func (bp *BufferPool) writeConflict(tid TransactionID, rid heapFileRid) error {
+	bp.AbortTransaction(tid)
+	return GoDBError{WriteConflictError, fmt.Sprintf("record %d of page %d was changed by a transaction that committed after the snapshot was taken", rid.slotNo, rid.pageNo)}
+}
+
+// Retrieve and pin a page for a transaction that reads a snapshot, like
+// [BufferPool.PinPage], but without locking it. The records of the page that
+// the snapshot sees are read with [heapPage.snapshotSlot].
+func (bp *BufferPool) pinSnapshotPage(file DBFile, pageNo int, tid TransactionID, scan bool) (*PageHandle, error) {
+	if !bp.IsRunning(tid) {
+		return nil, GoDBError{IllegalTransactionError, "Transaction is not running or has aborted."}
+	}
+
+	if from, to := bp.readAhead.access(tid, file, pageNo); from < to {
+		go bp.prefetchPages(file, from, min(to, file.NumPages()))
+	}
+
+	for {
+		pg, err := bp.loadPage(file, pageNo, scan)
+		if err != nil {
+			return nil, err
+		}
+		hashCode := file.pageKey(pageNo)
+		p := bp.partition(hashCode)
+		p.Lock()
+		if p.pages[hashCode] != pg {
+			// the page was evicted in the meantime
+			p.Unlock()
+			continue
+		}
+		if !bp.IsRunning(tid) {
+			p.Unlock()
+			return nil, GoDBError{IllegalTransactionError, "Transaction has aborted."}
+		}
+		p.pin(tid, hashCode)
+		p.Unlock()
+		return &PageHandle{pg, bp, hashCode, tid, false, false}, nil
+	}
+}
@@ -0,0 +1,375 @@
+package godb
+
+import (
+	"errors"
+	"sort"
+	"testing"
+	"time"
+)
+
+// Make a heap file with the committed records 0 to n-1.
+func makeSnapshotTestFile(t *testing.T, n int) (*BufferPool, *HeapFile, []Tuple) {
+	t.Helper()
+	bp, hf := makeTestFile(t, 10)
+	td, _, _ := makeTupleTestVars()
+	tid := BeginTransactionForTest(t, bp)
+	tups := make([]Tuple, n)
+	for i := range tups {
+		tups[i] = Tuple{Desc: td, Fields: []DBValue{StringField{"sam"}, IntField{int64(i)}}}
+		insertTupleForTest(t, hf, &tups[i], tid)
+	}
+	flushAndCommitForTest(t, bp, tid)
+	return bp, hf, tups
+}
+
+// Return the sorted values of the second field of the records tid sees, and
+// fail if reading them takes longer than a few seconds.
+func scanValuesForTest(t *testing.T, hf *HeapFile, tid TransactionID) []int64 {
+	t.Helper()
+	done := make(chan []int64)
+	errs := make(chan error)
+	go func() {
+		var vals []int64
+		iter, err := hf.Iterator(tid)
+		if err != nil {
+			errs <- err
+			return
+		}
+		for {
+			tup, err := iter()
+			if err != nil {
+				errs <- err
+				return
+			}
+			if tup == nil {
+				break
+			}
+			vals = append(vals, tup.Fields[1].(IntField).Value)
+		}
+		sort.Slice(vals, func(i, j int) bool { return vals[i] < vals[j] })
+		done <- vals
+	}()
+	select {
+	case vals := <-done:
+		return vals
+	case err := <-errs:
+		t.Fatalf(err.Error())
+	case <-time.After(5 * time.Second):
+		t.Fatalf("the scan is waiting for a lock")
+	}
+	return nil
+}
+
+// Return the number of versioned records on the pages of the heap file in
+// the buffer pool.
+func countVersionsForTest(bp *BufferPool, hf *HeapFile) int {
+	n := 0
+	for i := 0; i < hf.NumPages(); i++ {
+		if pg, ok := bp.cachedPage(hf.pageKey(i)); ok {
+			hp := pg.(*heapPage)
+			hp.latch.RLock()
+			n += len(hp.versions)
+			hp.latch.RUnlock()
+		}
+	}
+	return n
+}
+
+func equalValues(a []int64, b []int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestSnapshotReadsWithoutLocks(t *testing.T) {
+	bp, hf, tups := makeSnapshotTestFile(t, 3)
+	td := *hf.Descriptor()
+
+	// a writer changes records, and a snapshot doesn't see the changes, or
+	// wait for them
+	writer := BeginTransactionForTest(t, bp)
+	if err := hf.deleteTuple(&tups[0], writer); err != nil {
+		t.Fatalf(err.Error())
+	}
+	tup := Tuple{Desc: td, Fields: []DBValue{StringField{"sam"}, IntField{3}}}
+	insertTupleForTest(t, hf, &tup, writer)
+
+	reader := NewTID()
+	if err := bp.BeginSnapshotTransaction(reader); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if vals := scanValuesForTest(t, hf, reader); !equalValues(vals, []int64{0, 1, 2}) {
+		t.Errorf("expected the snapshot to see records 0, 1 and 2, got %v", vals)
+	}
+	if err := bp.CommitTransaction(writer); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	// the snapshot still sees the records as they were when it was taken,
+	// while a snapshot taken now sees the changes
+	if vals := scanValuesForTest(t, hf, reader); !equalValues(vals, []int64{0, 1, 2}) {
+		t.Errorf("expected the snapshot to still see records 0, 1 and 2, got %v", vals)
+	}
+	if got, err := hf.tupleAt(tups[0].Rid, reader); err != nil || got == nil || got.Fields[1] != tups[0].Fields[1] {
+		t.Errorf("expected the snapshot to see the deleted record, got %v, %v", got, err)
+	}
+	if got, err := hf.tupleAt(tup.Rid, reader); err != nil || got != nil {
+		t.Errorf("expected the snapshot not to see the new record, got %v, %v", got, err)
+	}
+	later := NewTID()
+	if err := bp.BeginSnapshotTransaction(later); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if vals := scanValuesForTest(t, hf, later); !equalValues(vals, []int64{1, 2, 3}) {
+		t.Errorf("expected the new snapshot to see records 1, 2 and 3, got %v", vals)
+	}
+
+	// a writer doesn't wait for the snapshots either
+	writer = BeginTransactionForTest(t, bp)
+	done := make(chan error)
+	go func() {
+		done <- hf.deleteTuple(&tups[1], writer)
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("the writer is waiting for the snapshots")
+	}
+	if err := bp.CommitTransaction(writer); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if vals := scanValuesForTest(t, hf, reader); !equalValues(vals, []int64{0, 1, 2}) {
+		t.Errorf("expected the snapshot to still see records 0, 1 and 2, got %v", vals)
+	}
+
+	// the old versions are garbage-collected once the snapshots end
+	bp.CommitTransaction(reader)
+	if countVersionsForTest(bp, hf) == 0 {
+		t.Errorf("expected the versions the newer snapshot needs to be kept")
+	}
+	bp.CommitTransaction(later)
+	if n := countVersionsForTest(bp, hf); n != 0 {
+		t.Errorf("expected the old versions to be garbage-collected, got %d", n)
+	}
+	if n := len(bp.snapshots.commits); n != 0 {
+		t.Errorf("expected the commits to be forgotten, got %d", n)
+	}
+}
+
+func TestSnapshotWriteConflict(t *testing.T) {
+	bp, hf, tups := makeSnapshotTestFile(t, 3)
+
+	tid := NewTID()
+	if err := bp.BeginSnapshotTransaction(tid); err != nil {
+		t.Fatalf(err.Error())
+	}
+	writer := BeginTransactionForTest(t, bp)
+	if err := hf.deleteTuple(&tups[0], writer); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if err := bp.CommitTransaction(writer); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	// the snapshot may change a record nobody else changed, but not the one
+	// the writer deleted after the snapshot was taken
+	if err := hf.deleteTuple(&tups[1], tid); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if vals := scanValuesForTest(t, hf, tid); !equalValues(vals, []int64{0, 2}) {
+		t.Errorf("expected the snapshot to see its own changes, got %v", vals)
+	}
+	err := hf.deleteTuple(&tups[0], tid)
+	var gerr GoDBError
+	if !errors.As(err, &gerr) || gerr.code != WriteConflictError {
+		t.Fatalf("expected a WriteConflictError, got %v", err)
+	}
+	if bp.IsRunning(tid) {
+		t.Errorf("expected the transaction to be aborted")
+	}
+
+	// its change was rolled back
+	tid = BeginTransactionForTest(t, bp)
+	defer bp.CommitTransaction(tid)
+	if vals := scanValuesForTest(t, hf, tid); !equalValues(vals, []int64{1, 2}) {
+		t.Errorf("expected records 1 and 2, got %v", vals)
+	}
+}
+
+func TestSnapshotVersionsOnDisk(t *testing.T) {
+	bp, hf, tups := makeSnapshotTestFile(t, 3)
+	td := *hf.Descriptor()
+	reader := NewTID()
+	if err := bp.BeginSnapshotTransaction(reader); err != nil {
+		t.Fatalf(err.Error())
+	}
+	writer := BeginTransactionForTest(t, bp)
+	if err := hf.deleteTuple(&tups[0], writer); err != nil {
+		t.Fatalf(err.Error())
+	}
+	tup := Tuple{Desc: td, Fields: []DBValue{StringField{"sam"}, IntField{3}}}
+	insertTupleForTest(t, hf, &tup, writer)
+	if err := bp.CommitTransaction(writer); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	// the records carry the transactions that created and deleted them on
+	// disk, while the snapshot needs them
+	bp.FlushAllPages()
+	pg, err := hf.readPage(0)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	hp := pg.(*heapPage)
+	deleted, inserted := tups[0].Rid.(heapFileRid).slotNo, tup.Rid.(heapFileRid).slotNo
+	if v := hp.versions[deleted]; v == nil || v.xmax != writer || v.deleted == nil || !v.deleted.equals(&tups[0]) {
+		t.Errorf("expected the deleted record to be kept with its deleting transaction, got %+v", v)
+	}
+	if v := hp.versions[inserted]; v == nil || v.xmin != writer || v.xmax != noTransaction {
+		t.Errorf("expected the new record to carry its creating transaction, got %+v", v)
+	}
+
+	// the snapshot sees the records it saw once the page is read again
+	bp.removePage(hf.pageKey(0))
+	if vals := scanValuesForTest(t, hf, reader); !equalValues(vals, []int64{0, 1, 2}) {
+		t.Errorf("expected the snapshot to see records 0, 1 and 2, got %v", vals)
+	}
+	if err := bp.CommitTransaction(reader); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	// once no snapshot needs them, the versions are dropped when the page is
+	// read
+	pg, err = hf.readPage(0)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	hp = pg.(*heapPage)
+	if len(hp.versions) != 0 || hp.getNumSlots()-hp.getNumEmptySlots() != 3 {
+		t.Errorf("expected 3 records without versions, got %d records and %d versions", hp.getNumSlots()-hp.getNumEmptySlots(), len(hp.versions))
+	}
+}
+
+func TestSnapshotVersionsAfterRestart(t *testing.T) {
+	// the table is in the catalog file, so that recovery finds it
+	bp, c, err := MakeTestDatabase(10, "catalog.txt")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	file, err := c.GetTable("t")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	hf := file.(*HeapFile)
+	td := *hf.Descriptor()
+	tid := BeginTransactionForTest(t, bp)
+	tups := make([]Tuple, 3)
+	for i := range tups {
+		tups[i] = Tuple{Desc: td, Fields: []DBValue{StringField{"sam"}, IntField{int64(i)}}}
+		insertTupleForTest(t, hf, &tups[i], tid)
+	}
+	flushAndCommitForTest(t, bp, tid)
+
+	reader := NewTID()
+	if err := bp.BeginSnapshotTransaction(reader); err != nil {
+		t.Fatalf(err.Error())
+	}
+	writer := BeginTransactionForTest(t, bp)
+	if err := hf.deleteTuple(&tups[0], writer); err != nil {
+		t.Fatalf(err.Error())
+	}
+	tup := Tuple{Desc: td, Fields: []DBValue{StringField{"sam"}, IntField{3}}}
+	insertTupleForTest(t, hf, &tup, writer)
+	if err := bp.CommitTransaction(writer); err != nil {
+		t.Fatalf(err.Error())
+	}
+	bp.FlushAllPages()
+
+	// the database is started again while the versions are on disk, and
+	// transaction IDs are handed out again, so a transaction that commits
+	// after the snapshot is taken has the ID of the writer
+	bp, c, err = RecoverTestDatabase(10, "catalog.txt")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	file, err = c.GetTable("t")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	hf = file.(*HeapFile)
+	reader = NewTID()
+	if err := bp.BeginSnapshotTransaction(reader); err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer bp.CommitTransaction(reader)
+	if err := bp.BeginTransaction(writer); err != nil {
+		t.Fatalf(err.Error())
+	}
+	other, err := c.GetTable("t2")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	insertTupleForTest(t, other.(*HeapFile), &Tuple{Desc: td, Fields: []DBValue{StringField{"sam"}, IntField{4}}}, writer)
+	if err := bp.CommitTransaction(writer); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if vals := scanValuesForTest(t, hf, reader); !equalValues(vals, []int64{1, 2, 3}) {
+		t.Errorf("expected a snapshot taken after the restart to see records 1, 2 and 3, got %v", vals)
+	}
+	if n := countVersionsForTest(bp, hf); n != 0 {
+		t.Errorf("expected the versions written before the restart to be dropped, got %d", n)
+	}
+}
+
+func TestSnapshotTooOld(t *testing.T) {
+	bp, hf, _ := makeSnapshotTestFile(t, 1)
+	td := *hf.Descriptor()
+
+	// a writer fills the first page before the snapshot is taken, so there is
+	// no room for the versions of its records once it commits
+	writer := BeginTransactionForTest(t, bp)
+	for i := 1; hf.NumPages() == 1; i++ {
+		insertTupleForTest(t, hf, &Tuple{Desc: td, Fields: []DBValue{StringField{"sam"}, IntField{int64(i)}}}, writer)
+	}
+	reader := NewTID()
+	if err := bp.BeginSnapshotTransaction(reader); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if err := bp.CommitTransaction(writer); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	iter, err := hf.Iterator(reader)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	for {
+		tup, err := iter()
+		var gerr GoDBError
+		if errors.As(err, &gerr) && gerr.code == SnapshotTooOldError {
+			break
+		}
+		if err != nil || tup == nil {
+			t.Fatalf("expected the snapshot to be too old, got %v", err)
+		}
+	}
+
+	// a snapshot taken now sees the records
+	later := NewTID()
+	if err := bp.BeginSnapshotTransaction(later); err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer bp.CommitTransaction(later)
+	if vals := scanValuesForTest(t, hf, later); len(vals) < 2 {
+		t.Errorf("expected the new snapshot to see the new records, got %v", vals)
+	}
+}
@@ -1,9 +1,11 @@
 package godb
 
 import (
+	"encoding/binary"
 	"fmt"
 	"log"
-	"math"
+
+	"github.com/tylertreat/BoomFilters"
 )
 
 /*
@@ -20,10 +22,19 @@ type Stats interface {
 	EstimateSelectivity(field string, op BoolOp, value DBValue) (float64, error)
 }
 
+// Stats that can also estimate the number of distinct values of a field. This
+// is used to estimate how many tuples an index lookup of a single value finds,
+// when the value isn't known until the query runs.
+type distinctStats interface {
+	EstimateDistinct(field string) int
+}
+
 type TableStats struct {
 	basePages  int
 	baseTups   int
 	histograms map[string]any
+	nullCounts map[string]int // number of NULL values in each field
+	distinct   map[string]int // approximate number of distinct non-NULL values in each field
 	tupleDesc  *TupleDesc
 }
 
@@ -35,14 +46,13 @@ const CostPerPage = 1000
 // though our tests assume that you have at least 100 bins in your histograms.
 const NumHistBins = 100
 
-func tableMinMax(tid TransactionID, dbFile DBFile) ([]int64, []int64, error) {
+// Compute the minimum and maximum non-NULL value of each numeric, date or time
+// field of dbFile. The min and max of string fields, and of fields that only
+// contain NULLs, are nil.
+func tableMinMax(tid TransactionID, dbFile DBFile) ([]DBValue, []DBValue, error) {
 	td := dbFile.Descriptor()
-	mins := make([]int64, len(td.Fields))
-	maxs := make([]int64, len(td.Fields))
-	for i := range mins {
-		mins[i] = math.MaxInt32
-		maxs[i] = math.MinInt32
-	}
+	mins := make([]DBValue, len(td.Fields))
+	maxs := make([]DBValue, len(td.Fields))
 
 	iter, err := dbFile.Iterator(tid)
 	if err != nil {
@@ -54,20 +64,61 @@ func tableMinMax(tid TransactionID, dbFile DBFile) ([]int64, []int64, error) {
 		}
 
 		for i, f := range td.Fields {
-			if f.Ftype == IntType {
-				v := tup.Fields[i].(IntField).Value
-				mins[i] = min(mins[i], v)
-				maxs[i] = max(maxs[i], v)
+			v := tup.Fields[i]
+			if isNull(v) || f.Ftype == StringType {
+				continue
+			}
+			if mins[i] == nil || mins[i].EvalPred(v, OpGt) {
+				mins[i] = v
+			}
+			if maxs[i] == nil || maxs[i].EvalPred(v, OpLt) {
+				maxs[i] = v
 			}
 		}
 	}
-	for i := range mins {
-		if mins[i] > maxs[i] {
-			mins[i] = 0
-			maxs[i] = 0
+	return mins, maxs, nil
+}
+
+// Return the int64 used to represent value in the [IntHistogram] of a field of
+// type t. Int, date, timestamp and interval fields all use IntHistograms;
+// intervals are represented by their approximate length.
+//
+// Returns false if value can't be compared with values of type t.
+func histogramInt(value DBValue, t DBType) (int64, bool) {
+	switch value := value.(type) {
+	case IntField:
+		return value.Value, t == IntType
+	case FloatField:
+		// approximate comparisons with a float by truncating it
+		return int64(value.Value), t == IntType
+	case DateField:
+		if t == TimestampType {
+			return value.toTimestamp().Value, true
 		}
+		return value.Value, t == DateType
+	case TimestampField:
+		if t == DateType {
+			return value.toDate().Value, true
+		}
+		return value.Value, t == TimestampType
+	case IntervalField:
+		return value.approxMicros(), t == IntervalType
 	}
-	return mins, maxs, nil
+	return 0, false
+}
+
+// Return the float64 used to represent value in the [FloatHistogram] of a
+// float or decimal field. Returns false if value isn't a number.
+func histogramFloat(value DBValue) (float64, bool) {
+	switch value := value.(type) {
+	case FloatField:
+		return value.Value, true
+	case IntField:
+		return float64(value.Value), true
+	case DecimalField:
+		return value.toFloat(), true
+	}
+	return 0, false
 }
 
 // Create a new TableStats object, that keeps track of statistics on each column of a table.
@@ -88,9 +139,25 @@ func ComputeTableStats(bp *BufferPool, dbFile DBFile) (*TableStats, error) {
 	// Create histograms using field min/max
 	hists := make(map[string]any, len(td.Fields))
 	for i, f := range td.Fields {
-		switch f.Ftype {
-		case IntType:
-			h, err := NewIntHistogram(NumHistBins, mins[i], maxs[i])
+		switch f.Ftype.baseType() {
+		case IntType, DateType, TimestampType, IntervalType:
+			var vMin, vMax int64
+			if mins[i] != nil {
+				vMin, _ = histogramInt(mins[i], f.Ftype)
+				vMax, _ = histogramInt(maxs[i], f.Ftype)
+			}
+			h, err := NewIntHistogram(NumHistBins, vMin, vMax)
+			if err != nil {
+				return nil, err
+			}
+			hists[f.Fname] = h
+		case FloatType, DecimalType:
+			var vMin, vMax float64
+			if mins[i] != nil {
+				vMin, _ = histogramFloat(mins[i])
+				vMax, _ = histogramFloat(maxs[i])
+			}
+			h, err := NewFloatHistogram(NumHistBins, vMin, vMax)
 			if err != nil {
 				return nil, err
 			}
@@ -106,22 +173,45 @@ func ComputeTableStats(bp *BufferPool, dbFile DBFile) (*TableStats, error) {
 		}
 	}
 
+	// the distinct values of each field are counted with a HyperLogLog
+	// sketch of the hashes of the values, which are equal for equal values
+	sketches := make(map[string]*boom.HyperLogLog, len(td.Fields))
+	for _, f := range td.Fields {
+		sketch, err := boom.NewDefaultHyperLogLog(0.02)
+		if err != nil {
+			return nil, err
+		}
+		sketches[f.Fname] = sketch
+	}
+
 	iter, err := dbFile.Iterator(tid)
 	if err != nil {
 		return nil, err
 	}
 
+	hash := make([]byte, 8)
 	baseTups := 0
+	nullCounts := make(map[string]int, len(td.Fields))
 	for tup, err := iter(); tup != nil; tup, err = iter() {
 		if err != nil {
 			return nil, err
 		}
 
 		for i, f := range td.Fields {
-			switch f.Ftype {
-			case IntType:
-				v := tup.Fields[i].(IntField).Value
+			// NULLs are counted separately and not added to histograms
+			if isNull(tup.Fields[i]) {
+				nullCounts[f.Fname]++
+				continue
+			}
+			binary.LittleEndian.PutUint64(hash, hashIndexKey(tup.Fields[i]))
+			sketches[f.Fname].Add(hash)
+			switch f.Ftype.baseType() {
+			case IntType, DateType, TimestampType, IntervalType:
+				v, _ := histogramInt(tup.Fields[i], f.Ftype)
 				hists[f.Fname].(*IntHistogram).AddValue(v)
+			case FloatType, DecimalType:
+				v, _ := histogramFloat(tup.Fields[i])
+				hists[f.Fname].(*FloatHistogram).AddValue(v)
 			case StringType:
 				v := tup.Fields[i].(StringField).Value
 				hists[f.Fname].(*StringHistogram).AddValue(v)
@@ -132,7 +222,12 @@ func ComputeTableStats(bp *BufferPool, dbFile DBFile) (*TableStats, error) {
 		baseTups++
 	}
 
-	return &TableStats{dbFile.NumPages(), baseTups, hists, td}, nil
+	distinct := make(map[string]int, len(td.Fields))
+	for _, f := range td.Fields {
+		distinct[f.Fname] = min(int(sketches[f.Fname].Count()), baseTups-nullCounts[f.Fname])
+	}
+
+	return &TableStats{dbFile.NumPages(), baseTups, hists, nullCounts, distinct, td}, nil
 }
 
 // Estimates the cost of sequentially scanning the file, given that the cost to
@@ -153,9 +248,32 @@ func (t *TableStats) EstimateCardinality(selectivity float64) int {
 	return int(float64(t.baseTups) * selectivity)
 }
 
+// Estimate the number of distinct non-NULL values of a field; at least 1.
+func (t *TableStats) EstimateDistinct(field string) int {
+	return max(1, t.distinct[field])
+}
+
 // Given a field name, boolean predicate, and a constant, look up the relevant
 // histogram and estimate the selectivity of the filter.
+//
+// IS NULL and IS NOT NULL are estimated from the number of NULLs in the field;
+// histograms only describe the non-NULL values, and any other comparison never
+// matches a NULL.
 func (t *TableStats) EstimateSelectivity(field string, op BoolOp, value DBValue) (float64, error) {
+	nullFrac := 0.0
+	if t.baseTups > 0 {
+		nullFrac = float64(t.nullCounts[field]) / float64(t.baseTups)
+	}
+	switch op {
+	case OpIsNull:
+		return nullFrac, nil
+	case OpIsNotNull:
+		return 1.0 - nullFrac, nil
+	}
+	if isNull(value) {
+		return 0.0, nil
+	}
+
 	hist, ok := t.histograms[field]
 	if !ok {
 		log.Printf("WARNING: no histogram found for field %s", field)
@@ -164,18 +282,29 @@ func (t *TableStats) EstimateSelectivity(field string, op BoolOp, value DBValue)
 
 	switch h := hist.(type) {
 	case *IntHistogram:
-		value, ok := value.(IntField)
+		ftype := IntType
+		if i, err := findFieldInTd(FieldType{field, "", UnknownType}, t.tupleDesc); err == nil {
+			ftype = t.tupleDesc.Fields[i].Ftype
+		}
+		v, ok := histogramInt(value, ftype)
+		if !ok {
+			return 1.0, fmt.Errorf("field '%s' is %s, but value %v is not", field, ftype, value)
+		}
+		return h.EstimateSelectivity(op, v) * (1.0 - nullFrac), nil
+
+	case *FloatHistogram:
+		v, ok := histogramFloat(value)
 		if !ok {
-			return 1.0, fmt.Errorf("field '%s' is int, but value %v is not an IntField", field, value)
+			return 1.0, fmt.Errorf("field '%s' is numeric, but value %v is not", field, value)
 		}
-		return h.EstimateSelectivity(op, value.Value), nil
+		return h.EstimateSelectivity(op, v) * (1.0 - nullFrac), nil
 
 	case *StringHistogram:
 		value, ok := value.(StringField)
 		if !ok {
 			return 1.0, fmt.Errorf("field is string, but value is not a StringField")
 		}
-		return h.EstimateSelectivity(op, value.Value), nil
+		return h.EstimateSelectivity(op, value.Value) * (1.0 - nullFrac), nil
 	}
 
 	return 1.0, fmt.Errorf("unexpected histogram type")
@@ -43,8 +43,8 @@ func TestTableStatsCard(t *testing.T) {
 func TestTableStatsCost(t *testing.T) {
 	ts := setupTableStatsTest(t)
 	cost := ts.EstimateScanCost()
-	if cost != 4000.0 {
-		t.Errorf("Expected 4000.0, got %f", cost)
+	if cost != 2000.0 {
+		t.Errorf("Expected 2000.0, got %f", cost)
 	}
 }
 
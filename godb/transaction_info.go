@@ -0,0 +1,222 @@
+package godb
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// The state of a running transaction in the [BufferPool].
+type runningTransaction struct {
+	isolation  IsolationLevel
+	started    time.Time
+	savepoints *savepoints // nil until it sets a savepoint
+}
+
+// A running transaction, as listed by [BufferPool.Transactions].
+type TransactionInfo struct {
+	ID         TransactionID
+	Isolation  IsolationLevel
+	Snapshot   bool // it reads a snapshot (see [BufferPool.BeginSnapshotTransaction])
+	Started    time.Time
+	Locks      int  // the tables, pages and records it holds locks on
+	DirtyPages int  // the pages in the buffer pool that it changed
+	Waiting    bool // it is waiting for a lock
+}
+
+// A lock that a transaction holds on, or has requested for, a table, page or
+// record, as listed by [BufferPool.Locks].
+type LockInfo struct {
+	Object  string // the locked table, page or record
+	Mode    string // S, X, IS, IX, or SIX
+	TID     TransactionID
+	Waiting bool // the lock is requested, and not granted yet
+}
+
+// Return the name of the lock mode of a permission, as used by [LockInfo].
+func lockMode(perm RWPerm) string {
+	switch perm {
+	case ReadPerm:
+		return "S"
+	case WritePerm:
+		return "X"
+	case intentReadPerm:
+		return "IS"
+	case intentWritePerm:
+		return "IX"
+	case sharedIntentWritePerm:
+		return "SIX"
+	}
+	return "?"
+}
+
+// Describe the table, page or record with the specified key in the lock
+// table, for [LockInfo].
+func describeLockKey(key any) string {
+	switch k := key.(type) {
+	case heapHash:
+		return fmt.Sprintf("page %d of %s", k.PageNo, k.FileName)
+	case btreeHash:
+		return fmt.Sprintf("page %d of %s", k.pageNo, k.file.BackingFile())
+	case hashIndexHash:
+		return fmt.Sprintf("page %d of %s", k.pageNo, k.file.BackingFile())
+	case MemPageKey:
+		return fmt.Sprintf("page %d of memory file %d", k.pgNo, k.fileNo)
+	case recordKey:
+		return fmt.Sprintf("record %d of %s", k.rid.slotNo, describeLockKey(k.page))
+	case tableKey:
+		return "table of " + describeLockKey(k.page)
+	case endKey:
+		return "end of " + describeLockKey(k.page)
+	}
+	return fmt.Sprintf("%v", key)
+}
+
+// Return the locks that are held or requested on the tables, pages and
+// records of the lock table, ordered by the object they lock.
+func (t *LockTable) lockInfo() []LockInfo {
+	var infos []LockInfo
+	for i := range t.partitions {
+		p := &t.partitions[i]
+		p.Lock()
+		for key, locks := range p.locks {
+			object := describeLockKey(key)
+			locks.forEach(func(tid TransactionID, perm RWPerm) {
+				infos = append(infos, LockInfo{object, lockMode(perm), tid, false})
+			})
+			for _, w := range locks.waiters {
+				infos = append(infos, LockInfo{object, lockMode(w.perm), w.tid, true})
+			}
+		}
+		p.Unlock()
+	}
+	sort.SliceStable(infos, func(i, j int) bool {
+		a, b := infos[i], infos[j]
+		if a.Object != b.Object {
+			return a.Object < b.Object
+		}
+		if a.Waiting != b.Waiting {
+			return !a.Waiting
+		}
+		return !a.Waiting && a.TID < b.TID
+	})
+	return infos
+}
+
+// Return the number of tables, pages and records that tid holds locks on.
+func (t *LockTable) numLocks(tid TransactionID) int {
+	n := 0
+	for i := range t.partitions {
+		p := &t.partitions[i]
+		p.Lock()
+		n += len(p.tidPageList[tid])
+		p.Unlock()
+	}
+	return n
+}
+
+// Return a copy of the wait-for graph.
+func (t *LockTable) waitsFor() WaitFor {
+	t.graphLatch.Lock()
+	defer t.graphLatch.Unlock()
+	graph := make(WaitFor, len(t.waitGraph))
+	for tid, waits := range t.waitGraph {
+		if len(waits) > 0 {
+			graph[tid] = append([]TransactionID(nil), waits...)
+		}
+	}
+	return graph
+}
+
+// Returns true if tid is waiting for a lock.
+func (t *LockTable) isWaiting(tid TransactionID) bool {
+	t.graphLatch.Lock()
+	defer t.graphLatch.Unlock()
+	return t.waiting[tid] != nil
+}
+
+// Wound tid if it is waiting for a lock (see [LockTable.wound]). Returns false
+// if it isn't waiting.
+func (t *LockTable) woundWaiting(tid TransactionID) bool {
+	t.graphLatch.Lock()
+	defer t.graphLatch.Unlock()
+	if t.waiting[tid] == nil {
+		return false
+	}
+	t.wound(tid)
+	return true
+}
+
+// Return the running transactions, ordered by ID, e.g., to see which of them
+// hold the locks that a hanging query waits for (see [BufferPool.Locks]).
+func (bp *BufferPool) Transactions() []TransactionInfo {
+	bp.tidLatch.Lock()
+	infos := make([]TransactionInfo, 0, len(bp.runningTids))
+	for tid, r := range bp.runningTids {
+		infos = append(infos, TransactionInfo{ID: tid, Isolation: r.isolation, Started: r.started})
+	}
+	bp.tidLatch.Unlock()
+
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ID < infos[j].ID })
+	for i := range infos {
+		info := &infos[i]
+		info.Snapshot = bp.snapshots.snapshotOf(info.ID) != nil
+		info.Locks = bp.lockTable.numLocks(info.ID)
+		info.DirtyPages = bp.dirtyPages(info.ID)
+		info.Waiting = bp.lockTable.isWaiting(info.ID)
+	}
+	return infos
+}
+
+// Return the number of pages in the buffer pool that tid changed, i.e., that
+// it holds write or intention write locks on, and that are dirty.
+func (bp *BufferPool) dirtyPages(tid TransactionID) int {
+	keys := make(map[any]any)
+	for _, key := range bp.lockTable.WriteLockedPages(tid) {
+		keys[key] = nil
+	}
+	for _, key := range bp.lockTable.intentWriteLockedPages(tid) {
+		keys[key] = nil
+	}
+	n := 0
+	for key := range keys {
+		p := bp.partition(key)
+		p.Lock()
+		if pg := p.pages[key]; pg != nil && pg.isDirty() {
+			n++
+		}
+		p.Unlock()
+	}
+	return n
+}
+
+// Return the locks that are held or requested on tables, pages and records,
+// ordered by the object they lock, with the held locks before the requests
+// that wait for them, in the order they will be granted.
+func (bp *BufferPool) Locks() []LockInfo {
+	return bp.lockTable.lockInfo()
+}
+
+// Return a copy of the wait-for graph: the transactions that each waiting
+// transaction waits for.
+func (bp *BufferPool) WaitsFor() WaitFor {
+	return bp.lockTable.waitsFor()
+}
+
+// Abort a running transaction on behalf of another session, e.g., one that
+// holds the locks a hanging query waits for. If it is waiting for a lock, it
+// is woken, and aborts itself like a transaction that the deadlock policy
+// aborts (see [DeadlockPolicy]); otherwise it is aborted right away, and its
+// next operation fails with an IllegalTransactionError.
+//
+// Returns an IllegalTransactionError if the transaction isn't running.
+func (bp *BufferPool) KillTransaction(tid TransactionID) error {
+	if !bp.IsRunning(tid) {
+		return GoDBError{IllegalTransactionError, fmt.Sprintf("transaction %d is not running", tid)}
+	}
+	if bp.lockTable.woundWaiting(tid) {
+		return nil
+	}
+	bp.AbortTransaction(tid)
+	return nil
+}
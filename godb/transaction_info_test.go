@@ -0,0 +1,109 @@
+package godb
+
+import (
+	"testing"
+	"time"
+)
+
+// Return the running transaction with the specified ID, and fail if it isn't
+// listed.
+func transactionInfoForTest(t *testing.T, bp *BufferPool, tid TransactionID) TransactionInfo {
+	t.Helper()
+	for _, info := range bp.Transactions() {
+		if info.ID == tid {
+			return info
+		}
+	}
+	t.Fatalf("transaction %d is not listed", tid)
+	return TransactionInfo{}
+}
+
+func TestTransactionInfo(t *testing.T) {
+	bp, hf, tid1, _, t1 := transactionTestSetUp(t)
+	start := time.Now()
+	reader := NewTID()
+	if err := bp.BeginTransactionWithIsolation(reader, ReadCommitted); err != nil {
+		t.Fatalf(err.Error())
+	}
+	insertTupleForTest(t, hf, &t1, tid1)
+
+	info := transactionInfoForTest(t, bp, tid1)
+	if info.Isolation != Serializable || info.Snapshot || info.Waiting {
+		t.Errorf("unexpected state of the writer, %+v", info)
+	}
+	if info.Locks == 0 || info.DirtyPages != 1 {
+		t.Errorf("expected the writer to hold locks and to have dirtied 1 page, got %+v", info)
+	}
+	info = transactionInfoForTest(t, bp, reader)
+	if info.Isolation != ReadCommitted || info.Locks != 0 || info.DirtyPages != 0 {
+		t.Errorf("unexpected state of the reader, %+v", info)
+	}
+	if info.Started.Before(start.Add(-time.Second)) || info.Started.After(time.Now()) {
+		t.Errorf("unexpected start time of the reader, %v", info.Started)
+	}
+
+	bp.CommitTransaction(reader)
+	for _, info := range bp.Transactions() {
+		if info.ID == reader {
+			t.Errorf("expected the committed transaction not to be listed")
+		}
+	}
+}
+
+func TestTransactionInfoLocksAndKill(t *testing.T) {
+	bp, hf, tid1, tid2, _ := transactionTestSetUp(t)
+	if _, err := bp.GetPage(hf, 0, tid1, WritePerm); err != nil {
+		t.Fatalf(err.Error())
+	}
+	done := make(chan error)
+	go func() {
+		_, err := bp.GetPage(hf, 0, tid2, ReadPerm)
+		done <- err
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	page := describeLockKey(hf.pageKey(0))
+	held, waiting := false, false
+	for _, l := range bp.Locks() {
+		if l.Object == page {
+			held = held || (l == LockInfo{page, "X", tid1, false})
+			waiting = waiting || (l == LockInfo{page, "S", tid2, true})
+		}
+	}
+	if !held || !waiting {
+		t.Errorf("expected the write lock of %d and the request of %d on %s, got %v", tid1, tid2, page, bp.Locks())
+	}
+	if waits := bp.WaitsFor()[tid2]; len(waits) != 1 || waits[0] != tid1 {
+		t.Errorf("expected %d to wait for %d, got %v", tid2, tid1, waits)
+	}
+	if !transactionInfoForTest(t, bp, tid2).Waiting {
+		t.Errorf("expected %d to be waiting", tid2)
+	}
+
+	// a waiting transaction is woken and aborts itself
+	if err := bp.KillTransaction(tid2); err != nil {
+		t.Fatalf(err.Error())
+	}
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Errorf("expected the request of the killed transaction to fail")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("the killed transaction is still waiting")
+	}
+	if bp.IsRunning(tid2) {
+		t.Errorf("expected the killed transaction to be aborted")
+	}
+
+	// an idle one is aborted right away, releasing its locks
+	if err := bp.KillTransaction(tid1); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if bp.IsRunning(tid1) || len(bp.Locks()) != 0 {
+		t.Errorf("expected the killed transaction to be aborted, and its locks released, got %v", bp.Locks())
+	}
+	if err := bp.KillTransaction(tid1); err == nil {
+		t.Errorf("expected killing a transaction that isn't running to fail")
+	}
+}
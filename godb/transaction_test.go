@@ -166,7 +166,7 @@ func transactionTestSetUpVarLen(t *testing.T, tupCnt int, pgCnt int) (*BufferPoo
 }
 
 func transactionTestSetUp(t *testing.T) (*BufferPool, *HeapFile, TransactionID, TransactionID, Tuple) {
-	bp, hf, tid1, tid2, t1, _ := transactionTestSetUpVarLen(t, 300, 3)
+	bp, hf, tid1, tid2, t1, _ := transactionTestSetUpVarLen(t, 450, 3)
 	return bp, hf, tid1, tid2, t1
 }
 
@@ -368,10 +368,10 @@ func TestTransactionFiveThreads(t *testing.T) {
 	validateTransactions(t, 5)
 }
 
-func TestTransactionAllDirtyFails(t *testing.T) {
-	if os.Getenv("LAB") == "5" {
-		t.Skip("Test is valid up through Lab 4. Skipping.")
-	}
+// The buffer pool is STEAL: when every page is dirty, one is logged, written,
+// and evicted to make room, and its uncommitted changes are undone on disk if
+// the transaction that made them aborts.
+func TestTransactionAllDirtySteals(t *testing.T) {
 	td, t1, _, hf, bp, tid := makeTestVars(t)
 
 	for hf.NumPages() < 3 {
@@ -382,8 +382,13 @@ func TestTransactionAllDirtyFails(t *testing.T) {
 	}
 	bp.CommitTransaction(tid) // make three clean pages
 
+	// the second file is in the catalog, so that its pages can be logged
 	os.Remove(TestingFile2)
-	hf2, _ := NewHeapFile(TestingFile2, &td, bp)
+	f, err := bp.LogFile().catalog.addTable("test2", td)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	hf2 := f.(*HeapFile)
 	tid2 := NewTID()
 	bp.BeginTransaction(tid2)
 
@@ -394,9 +399,24 @@ func TestTransactionAllDirtyFails(t *testing.T) {
 		}
 	}
 
-	_, err := bp.GetPage(hf, 0, tid2, ReadPerm) // since bp capacity = 3, should return error due to all dirty pages
-	if err == nil {
-		t.Errorf("Expected error due to all dirty pages")
+	flushes := bp.Stats().DirtyFlushes
+	// since bp capacity = 3, a dirty page has to be written to make room
+	if _, err := bp.GetPage(hf, 0, tid2, ReadPerm); err != nil {
+		t.Fatalf("Expected a dirty page to be evicted, got %s", err.Error())
+	}
+	if bp.Stats().DirtyFlushes == flushes {
+		t.Errorf("Expected a dirty page to be written before it was evicted")
+	}
+
+	bp.AbortTransaction(tid2)
+	tid3 := NewTID()
+	bp.BeginTransaction(tid3)
+	iter, err := hf2.Iterator(tid3)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if tup, err := iter(); err != nil || tup != nil {
+		t.Errorf("Expected the aborted inserts to be undone on disk, got %v, %v", tup, err)
 	}
 }
 
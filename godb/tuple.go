@@ -13,21 +13,40 @@ import (
 	"unsafe"
 )
 
-// DBType is the type of a tuple field, in GoDB, e.g., IntType or StringType
+// DBType is the type of a tuple field, in GoDB, e.g., IntType, StringType,
+// FloatType or DateType. Decimal types also encode their precision and scale;
+// see [DecimalType].
 type DBType int
 
 const (
-	IntType     DBType = iota
-	StringType  DBType = iota
-	UnknownType DBType = iota //used internally, during parsing, because sometimes the type is unknown
+	IntType       DBType = iota
+	StringType    DBType = iota
+	FloatType     DBType = iota
+	DateType      DBType = iota
+	TimestampType DBType = iota
+	IntervalType  DBType = iota
+	UnknownType   DBType = iota //used internally, during parsing, because sometimes the type is unknown
 )
 
 func (t DBType) String() string {
+	if t == DecimalType {
+		return "decimal"
+	} else if t.isDecimal() {
+		return fmt.Sprintf("decimal(%d,%d)", t.precision(), t.scale())
+	}
 	switch t {
 	case IntType:
 		return "int"
 	case StringType:
 		return "string"
+	case FloatType:
+		return "float"
+	case DateType:
+		return "date"
+	case TimestampType:
+		return "timestamp"
+	case IntervalType:
+		return "interval"
 	}
 	return "unknown"
 }
@@ -62,19 +81,6 @@ func (d1 *TupleDesc) equals(d2 *TupleDesc) bool {
 
 }
 
-func (desc *TupleDesc) bytesPerTuple() int {
-	size := 0
-	for i := 0; i < len(desc.Fields); i++ {
-		switch desc.Fields[i].Ftype {
-		case IntType:
-			size += (int)(unsafe.Sizeof(int64(0)))
-		case StringType:
-			size += ((int)(unsafe.Sizeof(byte('a')))) * StringLength
-		}
-	}
-	return size
-}
-
 // Given a FieldType f and a TupleDesc desc, find the best
 // matching field in desc for f.  A match is defined as
 // having the same Ftype and the same name, preferring a match
@@ -146,6 +152,98 @@ type StringField struct {
 	Value string
 }
 
+// Float field value, stored as a 64 bit IEEE 754 double
+type FloatField struct {
+	Value float64
+}
+
+// Date field value, stored as the number of days since 1970-01-01
+type DateField struct {
+	Value int64
+}
+
+// Timestamp field value, stored as the number of microseconds since
+// 1970-01-01 00:00:00 UTC
+type TimestampField struct {
+	Value int64
+}
+
+// Interval field value. As in PostgreSQL, months and days are kept separately
+// from the time part, as their length in microseconds varies.
+type IntervalField struct {
+	Months int32
+	Days   int32
+	Micros int64
+}
+
+// SQL NULL value. A NULL can appear in a field of any type; the type of the
+// field is given by the TupleDesc.
+type NullField struct {
+}
+
+// Return true if the value is NULL.
+func isNull(v DBValue) bool {
+	_, ok := v.(NullField)
+	return ok
+}
+
+// Return the DBType of a field value, or UnknownType if the value is NULL.
+func typeOfValue(v DBValue) DBType {
+	switch v := v.(type) {
+	case IntField:
+		return IntType
+	case StringField:
+		return StringType
+	case FloatField:
+		return FloatType
+	case DateField:
+		return DateType
+	case TimestampField:
+		return TimestampType
+	case IntervalField:
+		return IntervalType
+	case DecimalField:
+		return v.dbType()
+	}
+	return UnknownType
+}
+
+// Convert v to a value of type t, if there is an implicit conversion from the
+// type of v to t: ints are converted to floats, dates to timestamps, and
+// strings to dates, timestamps and intervals. Ints, floats, strings and
+// decimals are converted to decimals, rounded to the scale of t. Otherwise v is
+// returned unchanged.
+//
+// Returns an error if v is a string that isn't a valid literal of type t, or a
+// number that overflows the decimal type t.
+func coerceValue(v DBValue, t DBType) (DBValue, error) {
+	if t.isDecimal() {
+		d, err := toDecimal(v)
+		if err != nil {
+			return nil, err
+		}
+		if d, ok := d.(DecimalField); ok {
+			return d.fit(t)
+		}
+		return v, nil
+	}
+	switch v := v.(type) {
+	case IntField:
+		if t == FloatType {
+			return FloatField{float64(v.Value)}, nil
+		}
+	case DateField:
+		if t == TimestampType {
+			return v.toTimestamp(), nil
+		}
+	case StringField:
+		if t == DateType || t == TimestampType || t == IntervalType {
+			return parseDateTimeValue(v.Value, t)
+		}
+	}
+	return v, nil
+}
+
 // Tuple represents the contents of a tuple read from a database
 // It includes the tuple descriptor, and the value of the fields
 type Tuple struct {
@@ -157,21 +255,31 @@ type Tuple struct {
 type recordID interface {
 }
 
-// Serialize the contents of the tuple into a byte array Since all tuples are of
-// fixed size, this method should simply write the fields in sequential order
-// into the supplied buffer.
-//
-// See the function [binary.Write].  Objects should be serialized in little
-// endian oder.
+// Serialize the contents of the tuple into a byte array. Tuples are variable
+// length records: a null bitmap with one bit per field is written first,
+// followed by the non-NULL fields in sequential order, in little endian order
+// (see [binary.Write]). NULL fields take no space beyond their bit in the
+// bitmap.
 //
-// Strings can be converted to byte arrays by casting to []byte. Note that all
-// strings need to be padded to StringLength bytes (set in types.go). For
-// example if StringLength is set to 5, the string 'mit' should be written as
-// 'm', 'i', 't', 0, 0
+// Integers, floats, dates, timestamps and the unscaled values of decimals are
+// written as 8 byte values;
+// intervals are written as 4 byte months, 4 byte days and 8 byte microseconds.
+// Strings are written as a 2 byte length
+// followed by the bytes of the string, so short strings only take the space
+// they need and long strings are never truncated.
 //
-// May return an error if the buffer has insufficient capacity to store the
-// tuple.
+// May return an error if a string is too long to be stored.
 func (t *Tuple) writeTo(b *bytes.Buffer) error {
+	nulls := make([]byte, nullBitmapSize(len(t.Fields)))
+	for j, f := range t.Fields {
+		if isNull(f) {
+			nulls[j/8] |= 1 << (j % 8)
+		}
+	}
+	_, err := b.Write(nulls)
+	if err != nil {
+		return err
+	}
 	for j := 0; j < len(t.Fields); j++ {
 		f := t.Fields[j]
 		switch f := f.(type) {
@@ -180,14 +288,40 @@ func (t *Tuple) writeTo(b *bytes.Buffer) error {
 			if err != nil {
 				return err
 			}
+		case FloatField:
+			err := binary.Write(b, binary.LittleEndian, f.Value)
+			if err != nil {
+				return err
+			}
+		case DateField:
+			err := binary.Write(b, binary.LittleEndian, f.Value)
+			if err != nil {
+				return err
+			}
+		case TimestampField:
+			err := binary.Write(b, binary.LittleEndian, f.Value)
+			if err != nil {
+				return err
+			}
+		case DecimalField:
+			err := binary.Write(b, binary.LittleEndian, f.Value)
+			if err != nil {
+				return err
+			}
+		case IntervalField:
+			err := binary.Write(b, binary.LittleEndian, f)
+			if err != nil {
+				return err
+			}
 		case StringField:
-			err := binary.Write(b, binary.LittleEndian, []byte(f.Value))
+			if len(f.Value) > MaxStringLength {
+				return GoDBError{MalformedDataError, fmt.Sprintf("string of length %d exceeds maximum length %d", len(f.Value), MaxStringLength)}
+			}
+			err := binary.Write(b, binary.LittleEndian, uint16(len(f.Value)))
 			if err != nil {
 				return err
 			}
-			rem := StringLength - len(f.Value)
-			//pad to StringLength
-			err = binary.Write(b, binary.LittleEndian, make([]byte, rem))
+			_, err = b.WriteString(f.Value)
 			if err != nil {
 				return err
 			}
@@ -196,24 +330,60 @@ func (t *Tuple) writeTo(b *bytes.Buffer) error {
 	return nil
 }
 
+// Return the number of bytes in the null bitmap of a tuple with nFields fields.
+func nullBitmapSize(nFields int) int {
+	return (nFields + 7) / 8
+}
+
+// Return the number of bytes [Tuple.writeTo] will use to serialize the tuple.
+func (t *Tuple) serializedSize() int {
+	size := nullBitmapSize(len(t.Fields))
+	for _, f := range t.Fields {
+		switch f := f.(type) {
+		case IntField:
+			size += int(unsafe.Sizeof(f.Value))
+		case FloatField:
+			size += int(unsafe.Sizeof(f.Value))
+		case DateField:
+			size += int(unsafe.Sizeof(f.Value))
+		case TimestampField:
+			size += int(unsafe.Sizeof(f.Value))
+		case DecimalField:
+			size += int(unsafe.Sizeof(f.Value))
+		case IntervalField:
+			size += binary.Size(f)
+		case StringField:
+			size += int(unsafe.Sizeof(uint16(0))) + len(f.Value)
+		}
+	}
+	return size
+}
+
 // Read the contents of a tuple with the specified [TupleDesc] from the
 // specified buffer, returning a Tuple.
 //
 // See [binary.Read]. Objects should be deserialized in little endian oder.
 //
-// All strings are stored as StringLength byte objects.
-//
-// Strings with length < StringLength will be padded with zeros, and these
-// trailing zeros should be removed from the strings.  A []byte can be cast
-// directly to string.
+// The record starts with a null bitmap; fields whose bit is set are NULL and
+// are not present in the rest of the record. Strings are stored as a 2 byte
+// length followed by that many bytes. The scale of a decimal isn't stored;
+// it's the scale of the field's type.
 //
 // May return an error if the buffer has insufficent data to deserialize the
 // tuple.
 func readTupleFrom(b *bytes.Buffer, desc *TupleDesc) (*Tuple, error) {
-	bs := make([]byte, StringLength)
+	nulls := make([]byte, nullBitmapSize(len(desc.Fields)))
+	err := binary.Read(b, binary.LittleEndian, nulls)
+	if err != nil {
+		return nil, err
+	}
 	fs := make([]DBValue, len(desc.Fields))
 	for i := 0; i < len(desc.Fields); i++ {
-		switch desc.Fields[i].Ftype {
+		if nulls[i/8]&(1<<(i%8)) != 0 {
+			fs[i] = NullField{}
+			continue
+		}
+		switch desc.Fields[i].Ftype.baseType() {
 		case IntType:
 			var intField int64
 			err := binary.Read(b, binary.LittleEndian, &intField)
@@ -221,12 +391,53 @@ func readTupleFrom(b *bytes.Buffer, desc *TupleDesc) (*Tuple, error) {
 				return nil, err
 			}
 			fs[i] = IntField{intField}
+		case FloatType:
+			var floatField float64
+			err := binary.Read(b, binary.LittleEndian, &floatField)
+			if err != nil {
+				return nil, err
+			}
+			fs[i] = FloatField{floatField}
+		case DateType:
+			var dateField int64
+			err := binary.Read(b, binary.LittleEndian, &dateField)
+			if err != nil {
+				return nil, err
+			}
+			fs[i] = DateField{dateField}
+		case TimestampType:
+			var timestampField int64
+			err := binary.Read(b, binary.LittleEndian, &timestampField)
+			if err != nil {
+				return nil, err
+			}
+			fs[i] = TimestampField{timestampField}
+		case DecimalType:
+			var decimalField int64
+			err := binary.Read(b, binary.LittleEndian, &decimalField)
+			if err != nil {
+				return nil, err
+			}
+			fs[i] = DecimalField{decimalField, desc.Fields[i].Ftype.scale()}
+		case IntervalType:
+			var intervalField IntervalField
+			err := binary.Read(b, binary.LittleEndian, &intervalField)
+			if err != nil {
+				return nil, err
+			}
+			fs[i] = intervalField
 		case StringType:
-			err := binary.Read(b, binary.LittleEndian, bs)
+			var strLen uint16
+			err := binary.Read(b, binary.LittleEndian, &strLen)
 			if err != nil {
 				return nil, err
 			}
-			fs[i] = StringField{string(bytes.TrimRight(bs, "\x00"))}
+			bs := make([]byte, strLen)
+			err = binary.Read(b, binary.LittleEndian, bs)
+			if err != nil {
+				return nil, err
+			}
+			fs[i] = StringField{string(bs)}
 		}
 	}
 
@@ -284,6 +495,9 @@ const (
 //
 // Note that EvalExpr uses the [Tuple.project] method, so you will need
 // to implement projection before testing compareField.
+//
+// NULL values compare as equal to each other and greater than any non-NULL
+// value, so they sort last in ascending order and first in descending order.
 func (t *Tuple) compareField(t2 *Tuple, field Expr) (orderByState, error) {
 	var order orderByState
 
@@ -296,7 +510,17 @@ func (t *Tuple) compareField(t2 *Tuple, field Expr) (orderByState, error) {
 		return order, err
 	}
 
-	switch field.GetExprType().Ftype {
+	if isNull(v1) || isNull(v2) {
+		if isNull(v1) && isNull(v2) {
+			return OrderedEqual, nil
+		} else if isNull(v1) {
+			return OrderedGreaterThan, nil
+		} else {
+			return OrderedLessThan, nil
+		}
+	}
+
+	switch field.GetExprType().Ftype.baseType() {
 	case IntType:
 		v1 := v1.(IntField).Value
 		v2 := v2.(IntField).Value
@@ -307,6 +531,16 @@ func (t *Tuple) compareField(t2 *Tuple, field Expr) (orderByState, error) {
 		} else {
 			return OrderedGreaterThan, nil
 		}
+	case FloatType:
+		v1 := v1.(FloatField).Value
+		v2 := v2.(FloatField).Value
+		if v1 < v2 {
+			return OrderedLessThan, nil
+		} else if v1 == v2 {
+			return OrderedEqual, nil
+		} else {
+			return OrderedGreaterThan, nil
+		}
 	case StringType:
 		v1 := v1.(StringField).Value
 		v2 := v2.(StringField).Value
@@ -317,6 +551,14 @@ func (t *Tuple) compareField(t2 *Tuple, field Expr) (orderByState, error) {
 		} else {
 			return OrderedGreaterThan, nil
 		}
+	case DateType, TimestampType, IntervalType, DecimalType:
+		if v1.EvalPred(v2, OpLt) {
+			return OrderedLessThan, nil
+		} else if v1.EvalPred(v2, OpEq) {
+			return OrderedEqual, nil
+		} else {
+			return OrderedGreaterThan, nil
+		}
 	}
 	return order, GoDBError{IncompatibleTypesError, "unknown type"}
 }
@@ -397,8 +639,20 @@ func (t *Tuple) PrettyPrintString(aligned bool) string {
 		switch f := f.(type) {
 		case IntField:
 			str = strconv.FormatInt(f.Value, 10)
+		case FloatField:
+			str = strconv.FormatFloat(f.Value, 'f', -1, 64)
+		case DateField:
+			str = f.String()
+		case TimestampField:
+			str = f.String()
+		case IntervalField:
+			str = f.String()
+		case DecimalField:
+			str = f.String()
 		case StringField:
 			str = f.Value
+		case NullField:
+			str = "NULL"
 		}
 		if aligned {
 			outstr = fmt.Sprintf("%s %s", outstr, fmtCol(str, len(t.Fields)))
@@ -3,6 +3,7 @@ package godb
 import (
 	"bytes"
 	"fmt"
+	"strings"
 	"testing"
 )
 
@@ -107,6 +108,148 @@ func TestTupleSerialization(t *testing.T) {
 	}
 }
 
+// Unit test for serializing strings longer than the old fixed string width
+func TestTupleSerializationLongString(t *testing.T) {
+	td, _, _ := makeTupleTestVars()
+	long := strings.Repeat("product name ", 20)
+	t1 := Tuple{Desc: td, Fields: []DBValue{StringField{long}, IntField{1}}}
+	b := new(bytes.Buffer)
+	if err := t1.writeTo(b); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if b.Len() != t1.serializedSize() {
+		t.Errorf("expected %d serialized bytes, got %d", t1.serializedSize(), b.Len())
+	}
+	t3, err := readTupleFrom(b, &td)
+	if err != nil {
+		t.Fatalf("Error loading tuple from saved buffer: %v", err.Error())
+	}
+	if !t3.equals(&t1) {
+		t.Errorf("Serialization / deserialization truncated a long string.")
+	}
+}
+
+func TestTupleSerializationNull(t *testing.T) {
+	td, _, _ := makeTupleTestVars()
+	t1 := Tuple{Desc: td, Fields: []DBValue{NullField{}, IntField{25}}}
+	t2 := Tuple{Desc: td, Fields: []DBValue{StringField{"sam"}, NullField{}}}
+	b := new(bytes.Buffer)
+	for _, tup := range []*Tuple{&t1, &t2} {
+		b.Reset()
+		if err := tup.writeTo(b); err != nil {
+			t.Fatalf(err.Error())
+		}
+		if b.Len() != tup.serializedSize() {
+			t.Errorf("expected %d serialized bytes, got %d", tup.serializedSize(), b.Len())
+		}
+		t3, err := readTupleFrom(b, &td)
+		if err != nil {
+			t.Fatalf("Error loading tuple from saved buffer: %v", err.Error())
+		}
+		if !t3.equals(tup) {
+			t.Errorf("Serialization / deserialization doesn't preserve NULLs (got %v, expected %v)", t3, tup)
+		}
+	}
+}
+
+func TestTupleSerializationFloat(t *testing.T) {
+	td := TupleDesc{Fields: []FieldType{
+		{Fname: "sensor", Ftype: StringType},
+		{Fname: "reading", Ftype: FloatType},
+	}}
+	t1 := Tuple{Desc: td, Fields: []DBValue{StringField{"thermo"}, FloatField{-12.625}}}
+	b := new(bytes.Buffer)
+	if err := t1.writeTo(b); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if b.Len() != t1.serializedSize() {
+		t.Errorf("expected %d serialized bytes, got %d", t1.serializedSize(), b.Len())
+	}
+	t2, err := readTupleFrom(b, &td)
+	if err != nil {
+		t.Fatalf("Error loading tuple from saved buffer: %v", err.Error())
+	}
+	if !t2.equals(&t1) {
+		t.Errorf("Serialization / deserialization lost the fractional part of a float (got %v)", t2)
+	}
+}
+
+func TestTupleSerializationDecimal(t *testing.T) {
+	td := TupleDesc{Fields: []FieldType{
+		{Fname: "item", Ftype: StringType},
+		{Fname: "price", Ftype: decimalType(10, 2)},
+		{Fname: "rate", Ftype: decimalType(18, 6)},
+	}}
+	t1 := Tuple{Desc: td, Fields: []DBValue{StringField{"widget"}, DecimalField{-123456, 2}, DecimalField{999999999999999999, 6}}}
+	b := new(bytes.Buffer)
+	if err := t1.writeTo(b); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if b.Len() != t1.serializedSize() {
+		t.Errorf("expected %d serialized bytes, got %d", t1.serializedSize(), b.Len())
+	}
+	t2, err := readTupleFrom(b, &td)
+	if err != nil {
+		t.Fatalf("Error loading tuple from saved buffer: %v", err.Error())
+	}
+	if !t2.equals(&t1) {
+		t.Errorf("Serialization / deserialization changed a decimal (got %v)", t2)
+	}
+	if s := t2.PrettyPrintString(false); s != "widget,-1234.56,999999999999.999999" {
+		t.Errorf("unexpected decimal formatting %s", s)
+	}
+}
+
+func TestTupleSerializationDateTime(t *testing.T) {
+	td := TupleDesc{Fields: []FieldType{
+		{Fname: "day", Ftype: DateType},
+		{Fname: "ts", Ftype: TimestampType},
+		{Fname: "duration", Ftype: IntervalType},
+	}}
+	t1 := Tuple{Desc: td, Fields: []DBValue{DateField{20454}, TimestampField{1767225600123456}, IntervalField{-14, 3, 3600000000}}}
+	b := new(bytes.Buffer)
+	if err := t1.writeTo(b); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if b.Len() != t1.serializedSize() {
+		t.Errorf("expected %d serialized bytes, got %d", t1.serializedSize(), b.Len())
+	}
+	t2, err := readTupleFrom(b, &td)
+	if err != nil {
+		t.Fatalf("Error loading tuple from saved buffer: %v", err.Error())
+	}
+	if !t2.equals(&t1) {
+		t.Errorf("Serialization / deserialization doesn't preserve dates and times (got %v)", t2)
+	}
+}
+
+func TestTupleCompareNull(t *testing.T) {
+	td, t1, _ := makeTupleTestVars()
+	tNull := Tuple{Desc: td, Fields: []DBValue{NullField{}, NullField{}}}
+	f := FieldExpr{td.Fields[1]}
+	result, err := tNull.compareField(&t1, &f)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if result != OrderedGreaterThan {
+		t.Errorf("expected NULL to sort after non-NULL values")
+	}
+	result, err = t1.compareField(&tNull, &f)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if result != OrderedLessThan {
+		t.Errorf("expected non-NULL values to sort before NULL")
+	}
+	result, err = tNull.compareField(&tNull, &f)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if result != OrderedEqual {
+		t.Errorf("expected NULLs to compare equal")
+	}
+}
+
 // Unit test for Tuple.compareField()
 func TestTupleExpr(t *testing.T) {
 	td, t1, t2 := makeTupleTestVars()
@@ -22,6 +22,11 @@ const (
 	IllegalOperationError   GoDBErrorCode = iota
 	DeadlockError           GoDBErrorCode = iota
 	IllegalTransactionError GoDBErrorCode = iota
+	NumericOverflowError    GoDBErrorCode = iota
+	LockTimeoutError        GoDBErrorCode = iota
+	MemoryLimitError        GoDBErrorCode = iota
+	WriteConflictError      GoDBErrorCode = iota
+	SnapshotTooOldError     GoDBErrorCode = iota
 )
 
 //go:generate stringer -type=GoDBErrorCode
@@ -36,8 +41,11 @@ func (e GoDBError) Error() string {
 }
 
 const (
-	PageSize     int = 4096
-	StringLength int = 32
+	PageSize int = 4096
+
+	// Strings are stored with a 2 byte length prefix, which bounds their size.
+	// In practice a string must also fit in a single heap page record.
+	MaxStringLength int = 1<<16 - 1
 )
 
 type Page interface {
@@ -76,6 +84,11 @@ const (
 	OpEq   BoolOp = iota
 	OpNeq  BoolOp = iota
 	OpLike BoolOp = iota
+
+	// IS NULL and IS NOT NULL; the right hand side of these predicates is
+	// ignored.
+	OpIsNull    BoolOp = iota
+	OpIsNotNull BoolOp = iota
 )
 
 var BoolOpMap = map[string]BoolOp{
@@ -89,7 +102,37 @@ var BoolOpMap = map[string]BoolOp{
 	"like": OpLike,
 }
 
+// Evaluate a predicate against a NULL value. Comparisons involving NULL are
+// unknown under SQL's three-valued logic, and are treated as false when
+// filtering. Only IS NULL is true for a NULL value.
+func (n NullField) EvalPred(v2 DBValue, op BoolOp) bool {
+	return op == OpIsNull
+}
+
+// Evaluate IS NULL and IS NOT NULL against a non-NULL value. Returns ok =
+// false if op is not one of these operators.
+func evalNullPred(op BoolOp) (result bool, ok bool) {
+	switch op {
+	case OpIsNull:
+		return false, true
+	case OpIsNotNull:
+		return true, true
+	}
+	return false, false
+}
+
 func (i1 IntField) EvalPred(v2 DBValue, op BoolOp) bool {
+	if result, ok := evalNullPred(op); ok {
+		return result
+	}
+	// Ints are compared with floats by promoting the int to a float, and
+	// with decimals by promoting it to a decimal
+	switch v2 := v2.(type) {
+	case FloatField:
+		return FloatField{float64(i1.Value)}.EvalPred(v2, op)
+	case DecimalField:
+		return DecimalField{i1.Value, 0}.EvalPred(v2, op)
+	}
 	i2, ok := v2.(IntField)
 	if !ok {
 		return false
@@ -114,7 +157,105 @@ func (i1 IntField) EvalPred(v2 DBValue, op BoolOp) bool {
 	}
 }
 
+func (f1 FloatField) EvalPred(v2 DBValue, op BoolOp) bool {
+	if result, ok := evalNullPred(op); ok {
+		return result
+	}
+	var x2 float64
+	switch v2 := v2.(type) {
+	case FloatField:
+		x2 = v2.Value
+	case IntField:
+		x2 = float64(v2.Value)
+	case DecimalField:
+		x2 = v2.toFloat()
+	default:
+		return false
+	}
+	x1 := f1.Value
+	switch op {
+	case OpEq:
+		return x1 == x2
+	case OpNeq:
+		return x1 != x2
+	case OpGt:
+		return x1 > x2
+	case OpGe:
+		return x1 >= x2
+	case OpLt:
+		return x1 < x2
+	case OpLe:
+		return x1 <= x2
+	default:
+		return false
+	}
+}
+
+// Evaluate a comparison between two int64s, used by the date and time types.
+func evalInt64Pred(x1 int64, x2 int64, op BoolOp) bool {
+	switch op {
+	case OpEq:
+		return x1 == x2
+	case OpNeq:
+		return x1 != x2
+	case OpGt:
+		return x1 > x2
+	case OpGe:
+		return x1 >= x2
+	case OpLt:
+		return x1 < x2
+	case OpLe:
+		return x1 <= x2
+	default:
+		return false
+	}
+}
+
+// Dates can be compared with dates and timestamps; a date is midnight when
+// compared with a timestamp.
+func (d1 DateField) EvalPred(v2 DBValue, op BoolOp) bool {
+	if result, ok := evalNullPred(op); ok {
+		return result
+	}
+	switch v2 := v2.(type) {
+	case DateField:
+		return evalInt64Pred(d1.Value, v2.Value, op)
+	case TimestampField:
+		return evalInt64Pred(d1.toTimestamp().Value, v2.Value, op)
+	}
+	return false
+}
+
+func (t1 TimestampField) EvalPred(v2 DBValue, op BoolOp) bool {
+	if result, ok := evalNullPred(op); ok {
+		return result
+	}
+	switch v2 := v2.(type) {
+	case TimestampField:
+		return evalInt64Pred(t1.Value, v2.Value, op)
+	case DateField:
+		return evalInt64Pred(t1.Value, v2.toTimestamp().Value, op)
+	}
+	return false
+}
+
+// Intervals are compared by their approximate length, so, e.g., 1 month is
+// equal to 30 days.
+func (iv1 IntervalField) EvalPred(v2 DBValue, op BoolOp) bool {
+	if result, ok := evalNullPred(op); ok {
+		return result
+	}
+	iv2, ok := v2.(IntervalField)
+	if !ok {
+		return false
+	}
+	return evalInt64Pred(iv1.approxMicros(), iv2.approxMicros(), op)
+}
+
 func (i1 StringField) EvalPred(v2 DBValue, op BoolOp) bool {
+	if result, ok := evalNullPred(op); ok {
+		return result
+	}
 	i2, ok := v2.(StringField)
 	if !ok {
 		return false
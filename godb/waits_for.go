@@ -37,25 +37,35 @@ func (w WaitFor) RemoveTransaction(tid TransactionID) {
 	}
 }
 
-func (w WaitFor) breakCycle(start TransactionID, root TransactionID, seen map[TransactionID]bool) *TransactionID {
-	for _, n := range w[start] {
-		if n == root { // found cycle
-			return &n
-		}
-		if _, exists := seen[n]; !exists {
-			seen[n] = true
-			deadlockTID := w.breakCycle(n, root, seen)
-			if deadlockTID != nil {
-				return deadlockTID
+// Return the transactions on a cycle through [start], beginning with start,
+// or nil if start isn't part of a cycle.
+func (w WaitFor) cycle(start TransactionID) []TransactionID {
+	seen := map[TransactionID]bool{start: true}
+	path := []TransactionID{start}
+	var visit func(tid TransactionID) bool
+	visit = func(tid TransactionID) bool {
+		for _, n := range w[tid] {
+			if n == start { // found cycle
+				return true
+			}
+			if !seen[n] {
+				seen[n] = true
+				path = append(path, n)
+				if visit(n) {
+					return true
+				}
+				path = path[:len(path)-1]
 			}
 		}
+		return false
+	}
+	if visit(start) {
+		return path
 	}
 	return nil
 }
 
 // Returns true if [start] is part of a cycle and false otherwise.
 func (w WaitFor) DetectDeadlock(start TransactionID) bool {
-	seenSet := make(map[TransactionID]bool)
-	seenSet[start] = true
-	return w.breakCycle(start, start, seenSet) != nil
+	return w.cycle(start) != nil
 }
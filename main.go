@@ -5,6 +5,7 @@ import (
 	"log"
 	"os"
 	"os/signal"
+	"sort"
 	"strconv"
 	"strings"
 	"syscall"
@@ -19,17 +20,73 @@ var helpText = `Enter a SQL query terminated by a ; to process it.  Commands pre
 Available shell commands:
 	\h : This help
 	\c path/to/catalog : Change the current database to a specified catalog file
+	\r path/to/catalog : Rebuild a catalog file from the table files in its directory, and change to it
 	\d : List tables and fields in the current database
 	\f : List available functions for use in queries
+	\s [reset] : Show buffer pool and I/O statistics, or reset them to zero
+	\t [locks | waits | kill tid] : List running transactions, the locks they hold and wait for, or the wait-for graph, or abort a transaction
 	\a : Toggle aligned vs csv output
     \o : Toggle query optimization
 	\l table path/to/file [sep] [hasHeader]: Append csv file to end of table.  Default to sep = ',', hasHeader = 'true'`
 
+// The number of bytes of memory the buffer pool and queries may use.
+const memoryBudget = 512 << 20
+
 func printCatalog(c *godb.Catalog) {
 	s := c.CatalogString()
 	fmt.Printf("\033[34m%s\n\033[0m", s)
 }
 
+// Show the running transactions, their locks, or the wait-for graph, or
+// kill a transaction, for the \t command.
+func printTransactions(bp *godb.BufferPool, args string) {
+	fields := strings.Fields(args)
+	if len(fields) == 0 {
+		fmt.Printf("%-6s %-16s %-8s %-10s %6s %6s %s\n", "tid", "isolation", "snapshot", "started", "locks", "dirty", "waiting")
+		for _, t := range bp.Transactions() {
+			fmt.Printf("%-6d %-16s %-8t %-10s %6d %6d %t\n", t.ID, t.Isolation, t.Snapshot, t.Started.Format("15:04:05"), t.Locks, t.DirtyPages, t.Waiting)
+		}
+		return
+	}
+	switch fields[0] {
+	case "locks":
+		fmt.Printf("%-40s %-4s %6s %s\n", "object", "mode", "tid", "state")
+		for _, l := range bp.Locks() {
+			state := "held"
+			if l.Waiting {
+				state = "waiting"
+			}
+			fmt.Printf("%-40s %-4s %6d %s\n", l.Object, l.Mode, l.TID, state)
+		}
+	case "waits":
+		graph := bp.WaitsFor()
+		tids := make([]godb.TransactionID, 0, len(graph))
+		for tid := range graph {
+			tids = append(tids, tid)
+		}
+		sort.Slice(tids, func(i, j int) bool { return tids[i] < tids[j] })
+		for _, tid := range tids {
+			fmt.Printf("%d waits for %v\n", tid, graph[tid])
+		}
+	case "kill":
+		if len(fields) != 2 {
+			fmt.Println("Expected a transaction ID after kill")
+			return
+		}
+		tid, err := strconv.Atoi(fields[1])
+		if err == nil {
+			err = bp.KillTransaction(godb.TransactionID(tid))
+		}
+		if err != nil {
+			fmt.Printf("\033[31;1m%s\033[0m\n", err.Error())
+			return
+		}
+		fmt.Printf("Killed transaction %d\n", tid)
+	default:
+		fmt.Printf("Unknown argument %s to \\t\n", fields[0])
+	}
+}
+
 func main() {
 	alarm := make(chan int, 1)
 
@@ -51,6 +108,14 @@ func main() {
 	if err != nil {
 		log.Fatal(err.Error())
 	}
+	// the buffer pool and the operators of the queries share this budget
+	mem, err := godb.NewMemoryManager(memoryBudget)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	if err := bp.SetMemoryManager(mem); err != nil {
+		log.Fatal(err.Error())
+	}
 
 	catName := "catalog.txt"
 	catPath := "godb"
@@ -86,6 +151,7 @@ func main() {
 	query := ""
 	var autocommit bool = true
 	var tid godb.TransactionID
+	var isolation godb.IsolationLevel = godb.Serializable
 	aligned := true
 	for {
 		text, err := rl.Readline()
@@ -116,6 +182,35 @@ func main() {
 				}
 				fmt.Printf("Loaded %s/%s\n", catPath, catName)
 				printCatalog(c)
+			case 'r':
+				if len(text) <= 3 {
+					fmt.Println("Expected the path of the catalog to rebuild from the data files in its directory after \\r")
+					continue
+				}
+				rest := text[3:]
+				pathAr := strings.Split(rest, "/")
+				name := pathAr[len(pathAr)-1]
+				path := strings.Join(pathAr[0:len(pathAr)-1], "/")
+				newC, err := godb.NewCatalogFromDataFiles(name, bp, path)
+				if err == nil {
+					err = newC.SaveToFile(name, path)
+				}
+				if err != nil {
+					fmt.Printf("failed to rebuild catalog, %s\n", err.Error())
+					continue
+				}
+				c, catName, catPath = newC, name, path
+				fmt.Printf("Rebuilt %s/%s\n", catPath, catName)
+				printCatalog(c)
+			case 's':
+				if strings.TrimSpace(text[2:]) == "reset" {
+					bp.ResetStats()
+					fmt.Println("Statistics reset")
+					continue
+				}
+				fmt.Print(bp.Stats())
+			case 't':
+				printTransactions(bp, text[2:])
 			case 'f':
 				fmt.Println("Available functions:")
 				fmt.Print(godb.ListOfFunctions())
@@ -226,7 +321,7 @@ func main() {
 			}
 			if autocommit {
 				tid = godb.NewTID()
-				err := bp.BeginTransaction(tid)
+				err := bp.BeginTransactionWithIsolation(tid, isolation)
 				if err != nil {
 					fmt.Printf("\033[31;1m%s\033[0m\n", err.Error())
 					continue
@@ -269,19 +364,46 @@ func main() {
 			duration := time.Since(start)
 			fmt.Printf("\033[32;1m%v\033[0m\n\n", duration)
 
-		case godb.BeginXactionType:
+		case godb.BeginXactionType, godb.BeginReadCommittedXactionType, godb.BeginRepeatableReadXactionType, godb.BeginSerializableXactionType:
 			if !autocommit {
 				fmt.Printf("\033[31;1m%s\033[0m\n", "Cannot start transaction while in transaction")
 				continue
 			}
+			level := isolation
+			switch queryType {
+			case godb.BeginReadCommittedXactionType:
+				level = godb.ReadCommitted
+			case godb.BeginRepeatableReadXactionType:
+				level = godb.RepeatableRead
+			case godb.BeginSerializableXactionType:
+				level = godb.Serializable
+			}
 			tid = godb.NewTID()
-			err := bp.BeginTransaction(tid)
+			err := bp.BeginTransactionWithIsolation(tid, level)
 			if err != nil {
 				fmt.Printf("\033[31;1m%s\033[0m\n", err.Error())
 				continue
 			}
 			autocommit = false
-			fmt.Printf("\033[32;1mBEGIN\033[0m\n\n")
+			if queryType == godb.BeginXactionType {
+				fmt.Printf("\033[32;1mBEGIN\033[0m\n\n")
+			} else {
+				fmt.Printf("\033[32;1mBEGIN ISOLATION LEVEL %s\033[0m\n\n", level)
+			}
+
+		case godb.BeginSnapshotXactionType:
+			if !autocommit {
+				fmt.Printf("\033[31;1m%s\033[0m\n", "Cannot start transaction while in transaction")
+				continue
+			}
+			tid = godb.NewTID()
+			err := bp.BeginSnapshotTransaction(tid)
+			if err != nil {
+				fmt.Printf("\033[31;1m%s\033[0m\n", err.Error())
+				continue
+			}
+			autocommit = false
+			fmt.Printf("\033[32;1mSTART TRANSACTION WITH CONSISTENT SNAPSHOT\033[0m\n\n")
 
 		case godb.AbortXactionType:
 			if autocommit {
@@ -299,6 +421,46 @@ func main() {
 			bp.CommitTransaction(tid)
 			autocommit = true
 			fmt.Printf("\033[32;1mCOMMIT\033[0m\n\n")
+		case godb.SetReadCommittedType, godb.SetRepeatableReadType, godb.SetSerializableType:
+			if !autocommit {
+				fmt.Printf("\033[31;1m%s\033[0m\n", "Cannot change the isolation level while in transaction, use BEGIN ISOLATION LEVEL")
+				continue
+			}
+			switch queryType {
+			case godb.SetReadCommittedType:
+				isolation = godb.ReadCommitted
+			case godb.SetRepeatableReadType:
+				isolation = godb.RepeatableRead
+			case godb.SetSerializableType:
+				isolation = godb.Serializable
+			}
+			fmt.Printf("\033[32;1mSET %s\033[0m\n\n", isolation)
+		case godb.SavepointQueryType, godb.RollbackToSavepointQueryType, godb.ReleaseSavepointQueryType:
+			if autocommit {
+				fmt.Printf("\033[31;1m%s\033[0m\n", "Savepoints can only be used in transactions")
+				continue
+			}
+			savepoint := plan.(*godb.SavepointPlan).Name
+			var err error
+			done := "SAVEPOINT"
+			switch queryType {
+			case godb.SavepointQueryType:
+				err = bp.Savepoint(tid, savepoint)
+			case godb.RollbackToSavepointQueryType:
+				err = bp.RollbackToSavepoint(tid, savepoint)
+				done = "ROLLBACK"
+			case godb.ReleaseSavepointQueryType:
+				err = bp.ReleaseSavepoint(tid, savepoint)
+				done = "RELEASE"
+			}
+			if err != nil {
+				fmt.Printf("\033[31;1m%s\033[0m\n", err.Error())
+				if !bp.IsRunning(tid) {
+					autocommit = true
+				}
+				continue
+			}
+			fmt.Printf("\033[32;1m%s\033[0m\n\n", done)
 		case godb.CreateTableQueryType:
 			fmt.Printf("\033[32;1mCREATE\033[0m\n\n")
 			err := c.SaveToFile(catName, catPath)
@@ -311,6 +473,18 @@ func main() {
 			if err != nil {
 				fmt.Printf("\033[31;1m%s\033[0m\n", err.Error())
 			}
+		case godb.CreateIndexQueryType:
+			fmt.Printf("\033[32;1mCREATE INDEX\033[0m\n\n")
+			err := c.SaveToFile(catName, catPath)
+			if err != nil {
+				fmt.Printf("\033[31;1m%s\033[0m\n", err.Error())
+			}
+		case godb.DropIndexQueryType:
+			fmt.Printf("\033[32;1mDROP INDEX\033[0m\n\n")
+			err := c.SaveToFile(catName, catPath)
+			if err != nil {
+				fmt.Printf("\033[31;1m%s\033[0m\n", err.Error())
+			}
 		}
 	}
 }